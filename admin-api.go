@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AdminAPIConfig configures the daemon's HTTP admin API
+type AdminAPIConfig struct {
+	Addr  string // Listen address, e.g. ":8081"; the API is off when empty
+	Token string // Bearer token every request must carry
+}
+
+// defaultDraftDays is how far back GET /drafts looks without ?days
+const defaultDraftDays = 7
+
+// defaultTimingDays is how far back GET /timings looks without ?days
+const defaultTimingDays = 14
+
+// loadAdminAPIConfig reads ADMIN_ADDR and ADMIN_TOKEN. A token is required
+// whenever the API is on, since it can publish articles.
+func loadAdminAPIConfig() (AdminAPIConfig, error) {
+	config := AdminAPIConfig{
+		Addr:  os.Getenv("ADMIN_ADDR"),
+		Token: os.Getenv("ADMIN_TOKEN"),
+	}
+	if config.Addr != "" && config.Token == "" {
+		return config, fmt.Errorf("ADMIN_TOKEN must be set when ADMIN_ADDR is")
+	}
+	return config, nil
+}
+
+// adminJob is a pipeline job as listed by GET /failures, without its payload
+type adminJob struct {
+	ID          uuid.UUID `json:"id"`
+	Mode        string    `json:"mode"`
+	Kind        string    `json:"kind"`
+	Keyword     string    `json:"keyword"`
+	Status      string    `json:"status"` // "failed", or "pending" for a retry
+	Attempts    int       `json:"attempts"`
+	FailedStage string    `json:"failedStage"`
+	LastError   string    `json:"lastError"`
+	RunAfter    time.Time `json:"runAfter"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// adminDraft is an unpublished article as listed by GET /drafts
+type adminDraft struct {
+	ID        uuid.UUID `json:"id"`
+	Title     string    `json:"title"`
+	URLTitle  string    `json:"urlTitle"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// startAdminAPI serves the admin API for the daemon's scheduler:
+//
+//	POST /runs?mode=recent          trigger a run
+//	GET  /runs                      runs in progress and recently finished, and whether the pipeline is paused
+//	GET  /failures                  failed jobs and jobs waiting to be retried
+//	POST /scheduler/pause?reason=x  stop runs starting and runs in progress taking new topics
+//	POST /scheduler/resume          let them go again
+//	GET  /drafts?days=7             unpublished articles
+//	POST /articles/{id}/approve     publish an article
+//	GET  /timings?days=14           per-stage durations of each run
+//	GET  /proxies                   requests and failures through each proxy, and which are blacklisted
+//	POST /proxies/{host}/clear      let a blacklisted proxy back in at the next refresh, with its totals reset
+//	GET  /subscribers               newsletter subscribers
+//	POST /subscribers?email=x       subscribe an address to the newsletters
+//	DELETE /subscribers?email=x     unsubscribe it
+//	GET  /healthz                   database and ffmpeg checks, 503 when one fails; needs no token
+//	POST /unsubscribe?token=x       unsubscribe the address a newsletter's signed token names; needs no token
+//
+// Nothing is served when config.Addr is empty.
+func startAdminAPI(config AdminAPIConfig, scheduler *TrendScheduler) *http.Server {
+	if config.Addr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /runs", func(w http.ResponseWriter, r *http.Request) {
+		mode := r.URL.Query().Get("mode")
+		if err := scheduler.Trigger(mode); err != nil {
+			writeAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+		slog.Info("Admin API triggered a run", "mode", mode)
+		writeAdminJSON(w, http.StatusAccepted, map[string]string{"status": "started", "mode": mode})
+	})
+	mux.HandleFunc("GET /runs", func(w http.ResponseWriter, r *http.Request) {
+		paused, reason := scheduler.Paused()
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+			"paused":      paused,
+			"pauseReason": reason,
+			"runs":        scheduler.Runs(),
+		})
+	})
+	mux.HandleFunc("GET /failures", func(w http.ResponseWriter, r *http.Request) {
+		failures, err := adminFailures()
+		if err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"failures": failures})
+	})
+	mux.HandleFunc("POST /scheduler/pause", func(w http.ResponseWriter, r *http.Request) {
+		reason := r.URL.Query().Get("reason")
+		if reason == "" {
+			reason = "paused from the admin API"
+		}
+		if err := scheduler.Pause(reason); err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err)
+			return
+		}
+		slog.Warn("Admin API paused the pipeline", "reason", reason)
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"paused": true, "pauseReason": reason})
+	})
+	mux.HandleFunc("POST /scheduler/resume", func(w http.ResponseWriter, r *http.Request) {
+		if err := scheduler.Resume(); err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err)
+			return
+		}
+		slog.Info("Admin API resumed the pipeline")
+		writeAdminJSON(w, http.StatusOK, map[string]bool{"paused": false})
+	})
+	mux.HandleFunc("GET /drafts", func(w http.ResponseWriter, r *http.Request) {
+		days, err := queryDays(r, defaultDraftDays)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+		drafts, err := adminDrafts(days)
+		if err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"drafts": drafts})
+	})
+	mux.HandleFunc("POST /articles/{id}/approve", func(w http.ResponseWriter, r *http.Request) {
+		published := true
+		article, err := dbClient.UpdateArticle(r.PathValue("id"), ArticleUpdate{Published: &published})
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+		slog.Info("Admin API approved article", "article", article.ID, "title", article.Title)
+		go publishWebhooks(context.Background(), []*NewsArticle{article})
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"id": article.ID, "published": article.Published})
+	})
+
+	mux.HandleFunc("GET /timings", func(w http.ResponseWriter, r *http.Request) {
+		days, err := queryDays(r, defaultTimingDays)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+		timings, err := dbClient.GetStageTimings(appNow().AddDate(0, 0, -days))
+		if err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"runs": summarizeStageTimings(timings)})
+	})
+
+	mux.HandleFunc("GET /proxies", func(w http.ResponseWriter, r *http.Request) {
+		stats, err := dbClient.GetProxyStats()
+		if err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"pool": proxyPool.States(), "proxies": stats})
+	})
+	mux.HandleFunc("POST /proxies/{host}/clear", func(w http.ResponseWriter, r *http.Request) {
+		host := r.PathValue("host")
+		if err := dbClient.ClearProxyBlacklist(host); err != nil {
+			writeAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+		slog.Info("Admin API cleared proxy blacklisting", "proxy", host)
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"host": host, "blacklisted": false})
+	})
+
+	mux.HandleFunc("GET /subscribers", func(w http.ResponseWriter, r *http.Request) {
+		subscribers, err := dbClient.GetNewsletterSubscribers()
+		if err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"subscribers": subscribers})
+	})
+	setSubscription := func(subscribed bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			address, err := mail.ParseAddress(r.URL.Query().Get("email"))
+			if err != nil {
+				writeAdminError(w, http.StatusBadRequest, fmt.Errorf("email must be an email address"))
+				return
+			}
+			if err := dbClient.SetNewsletterSubscription(address.Address, subscribed); err != nil {
+				writeAdminError(w, http.StatusInternalServerError, err)
+				return
+			}
+			slog.Info("Admin API changed newsletter subscription", "subscribed", subscribed)
+			writeAdminJSON(w, http.StatusOK, map[string]interface{}{"email": address.Address, "subscribed": subscribed})
+		}
+	}
+	mux.HandleFunc("POST /subscribers", setSubscription(true))
+	mux.HandleFunc("DELETE /subscribers", setSubscription(false))
+
+	// Health probes from the orchestrator don't carry the token
+	root := http.NewServeMux()
+	root.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		results := runPreflightChecks(r.Context(), healthChecks())
+		status, code := "ok", http.StatusOK
+		for _, result := range results {
+			if result.Status == preflightFail {
+				status, code = "failing", http.StatusServiceUnavailable
+			}
+		}
+		writeAdminJSON(w, code, map[string]interface{}{"status": status, "checks": results})
+	})
+	// Unsubscribe links, and mail clients' one-click unsubscribes, carry a
+	// signed token instead
+	root.HandleFunc("POST /unsubscribe", func(w http.ResponseWriter, r *http.Request) {
+		if emailConfig.UnsubscribeSecret == "" {
+			writeAdminError(w, http.StatusNotFound, fmt.Errorf("newsletter emails are off"))
+			return
+		}
+		email, err := verifyUnsubscribeToken(emailConfig.UnsubscribeSecret, r.URL.Query().Get("token"))
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := dbClient.SetNewsletterSubscription(email, false); err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err)
+			return
+		}
+		slog.Info("Newsletter subscriber unsubscribed")
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"subscribed": false})
+	})
+	root.Handle("/", requireAdminToken(config.Token, mux))
+
+	server := &http.Server{Addr: config.Addr, Handler: root}
+	go func() {
+		slog.Info("Serving admin API", "addr", config.Addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Warn("Admin API stopped", "error", err)
+		}
+	}()
+	return server
+}
+
+// requireAdminToken rejects requests without "Authorization: Bearer <token>"
+func requireAdminToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			writeAdminError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminFailures lists every mode's failed jobs and the ones waiting to be retried
+func adminFailures() ([]adminJob, error) {
+	failures := []adminJob{}
+	for _, mode := range []string{"daily", "recent", backfillMode} {
+		jobs, err := dbClient.GetPipelineJobs(mode, []string{jobPending, jobFailed})
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range jobs {
+			if job.LastError == "" {
+				continue
+			}
+			failures = append(failures, adminJob{
+				ID:          job.ID,
+				Mode:        job.Mode,
+				Kind:        job.Kind,
+				Keyword:     job.Keyword,
+				Status:      job.Status,
+				Attempts:    job.Attempts,
+				FailedStage: job.FailedStage,
+				LastError:   job.LastError,
+				RunAfter:    job.RunAfter,
+				UpdatedAt:   job.UpdatedAt,
+			})
+		}
+	}
+	return failures, nil
+}
+
+// adminDrafts lists the articles created in the last days that aren't published
+func adminDrafts(days int) ([]adminDraft, error) {
+	articles, err := dbClient.GetArticlesSince(appNow().AddDate(0, 0, -days), ArticleFilters{})
+	if err != nil {
+		return nil, err
+	}
+	drafts := []adminDraft{}
+	for _, article := range articles {
+		if article.Published {
+			continue
+		}
+		drafts = append(drafts, adminDraft{
+			ID:        article.ID,
+			Title:     article.Title,
+			URLTitle:  article.URLTitle,
+			CreatedAt: article.CreatedAt,
+		})
+	}
+	return drafts, nil
+}
+
+// queryDays reads the ?days a listing looks back over, or returns fallback
+// when it isn't given
+func queryDays(r *http.Request, fallback int) (int, error) {
+	value := r.URL.Query().Get("days")
+	if value == "" {
+		return fallback, nil
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 1 {
+		return 0, fmt.Errorf("days must be a positive integer, got %q", value)
+	}
+	return days, nil
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Warn("Failed to write admin API response", "error", err)
+	}
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	writeAdminJSON(w, status, map[string]string{"error": err.Error()})
+}
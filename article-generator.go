@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
 	"strings"
@@ -13,28 +14,44 @@ import (
 	"google.golang.org/api/option"
 )
 
+// Model settings used by queryGeminiForArticle
+const (
+	articleProvider    = "gemini"
+	articleTemperature = 0.7
+)
+
+// articleModel is the Gemini model behind articles and the other prompts,
+// overridden by GEMINI_MODEL
+var articleModel = "gemini-2.0-flash"
+
+// loadArticleModel applies GEMINI_MODEL
+func loadArticleModel() {
+	if model := os.Getenv("GEMINI_MODEL"); model != "" {
+		articleModel = model
+	}
+}
+
 type ArticleRequest struct {
 	Keyword     string            `json:"keyword"`
 	Summaries   map[string]string `json:"summaries"`
 	URLs        []string          `json:"urls"`
 }
 
-func GenerateArticleFromSummaries(keyword string, summaries map[string]string, urls []string) (*GeneratedArticle, error) {
+func GenerateArticleFromSummaries(ctx context.Context, logger *slog.Logger, keyword string, summaries map[string]string, urls []string) (*GeneratedArticle, error) {
 	// First, filter summaries for relevance using Gemini
-	relevantSummaries, err := filterRelevantSummaries(keyword, summaries)
+	relevantSummaries, err := filterRelevantSummaries(ctx, logger, keyword, summaries)
 	if err != nil {
 		return nil, fmt.Errorf("error filtering summaries: %v", err)
 	}
 
 	// Verify and correct claims using Google Search grounding
-	verifiedSummaries, err := verifyClaimsWithGrounding(keyword, relevantSummaries)
+	verifiedSummaries, err := verifyClaimsWithGrounding(ctx, logger, keyword, relevantSummaries)
 	if err != nil {
 		return nil, fmt.Errorf("error verifying claims: %v", err)
 	}
 
 	// Log the number of summaries before and after filtering
-	fmt.Printf("Article generation for '%s': Original summaries: %d, Relevant summaries: %d\n",
-		keyword, len(summaries), len(verifiedSummaries))
+	logger.Info("Filtered summaries for article generation", "summaries", len(summaries), "relevant", len(verifiedSummaries))
 
 	// Only proceed if we have at least two relevant summaries
 	if len(verifiedSummaries) < 2 {
@@ -42,6 +59,9 @@ func GenerateArticleFromSummaries(keyword string, summaries map[string]string, u
 			keyword, len(verifiedSummaries))
 	}
 
+	// Categories come from the database so the prompt matches the stored taxonomy
+	categories := loadCategories()
+
 	// Use existing prompt but with filtered summaries
 	prompt := fmt.Sprintf(`As an **objective and data-driven news journalist**, craft a **concise, high-impact** article based on these news summaries about "%s."
 Focus on a **single significant angle**—not a summary, but a **clear and factual narrative**.
@@ -84,11 +104,7 @@ Summaries of source articles:
 
 6. **Categorize the Article Objectively:**
    - Select the most **fitting category ID based on the factual topic**, not subjective interpretation or slant.
-   - Categories: 1: Breaking News, 2: Politics, 3: World News, 4: Business & Finance,
-     5: Technology, 6: Entertainment, 7: Sports, 8: Health & Wellness,
-     9: Science, 10: Art & Culture, 11: Travel, 12: Food & Drink,
-     13: Environment, 14: Lifestyle, 15: Opinion, 16: Education,
-     17: Religion, 18: Other. (Note: "Opinion" should be avoided unless the summaries are explicitly about opinions, and even then, report *on* the opinion neutrally, not *express* an opinion).
+   - Categories: ` + formatCategoriesForPrompt(categories) + `. (Note: "Opinion" should be avoided unless the summaries are explicitly about opinions, and even then, report *on* the opinion neutrally, not *express* an opinion).
 
 7. **Format as Valid JSON:**
    - Ensure markdown is used minimally and for factual clarity only.
@@ -107,7 +123,7 @@ Summaries of source articles:
 }`
 
 	// Query Gemini API
-	response, err := queryGeminiForArticle(prompt)
+	response, err := queryGeminiForArticle(ctx, prompt)
 	if err != nil {
 		return nil, fmt.Errorf("error generating article: %v", err)
 	}
@@ -121,6 +137,7 @@ Summaries of source articles:
 		URLTitle   string   `json:"urlTitle"`
 	}
 	if err := json.Unmarshal([]byte(response), &result); err != nil {
+		reportLLMParseError("article", response, err, "keyword", keyword)
 		return nil, fmt.Errorf("error parsing Gemini response: %v, response string: %s", err, response) // Added response string to error
 	}
 
@@ -132,12 +149,19 @@ Summaries of source articles:
 		Keywords:   append([]string{keyword}, result.Keywords...),
 		CategoryId: result.CategoryId,
 		URLTitle:   result.URLTitle,
+		Generation: &GenerationInfo{
+			Prompt:      prompt,
+			Model:       articleModel,
+			Provider:    articleProvider,
+			Temperature: articleTemperature,
+		},
+	}
+	for url := range verifiedSummaries {
+		article.SourceURLs = append(article.SourceURLs, url)
 	}
 
 	// Validate category ID and default to "Other" if invalid
-	if article.CategoryId < 1 || article.CategoryId > 18 {
-		article.CategoryId = 18 // Default to "Other"
-	}
+	article.CategoryId = validCategoryId(article.CategoryId, categories)
 
 	return article, nil
 }
@@ -150,26 +174,33 @@ func formatSummariesForPrompt(summaries map[string]string) string {
 	return builder.String()
 }
 
-func queryGeminiForArticle(prompt string) (string, error) {
+func queryGeminiForArticle(ctx context.Context, prompt string) (string, error) {
 	// Create a new client with your API key
-	client, err := genai.NewClient(context.Background(), option.WithAPIKey(os.Getenv("GEMINI_API_KEY")))
+	client, err := genai.NewClient(ctx, option.WithAPIKey(os.Getenv("GEMINI_API_KEY")))
 	if err != nil {
 		return "", fmt.Errorf("Failed to create client: %v", err)
 	}
 	defer client.Close()
 
 	// Using gemini-pro with specific configuration for JSON output
-	model := client.GenerativeModel("gemini-2.0-flash") // Using Flash model for speed and cost-effectiveness
-	model.SetTemperature(0.7)
+	model := client.GenerativeModel(articleModel) // Using Flash model for speed and cost-effectiveness
+	model.SetTemperature(articleTemperature)
 	model.SetTopK(40)
 	model.SetTopP(0.8)
 	model.ResponseMIMEType = "application/json"
 
 	// Generate content
-	resp, err := model.GenerateContent(context.Background(), genai.Text(prompt))
+	release, err := waitForAPI(ctx, apiGemini)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	resp, err := model.GenerateContent(ctx, genai.Text(prompt))
 	if err != nil {
+		pipelineMetrics.GeminiError("article")
 		return "", fmt.Errorf("Failed to generate content: %v", err)
 	}
+	recordGeminiUsage(resp.UsageMetadata)
 
 	// Check for errors in the response
 	if len(resp.Candidates) == 0 {
@@ -202,7 +233,7 @@ func queryGeminiForArticle(prompt string) (string, error) {
 	err = json.Unmarshal([]byte(cleaned), &jsonCheck)
 	if err != nil {
 		// Log the raw response for debugging
-		fmt.Printf("Raw Gemini Response (Pre-Cleaning):\n%s\n", responseText)
+		slog.Debug("Gemini returned invalid JSON", "response", responseText)
 		// If still invalid, try to extract just the JSON portion - Keep the fallback, it's useful
 		jsonStart := strings.Index(responseText, "{")
 		jsonEnd := strings.LastIndex(responseText, "}")
@@ -210,9 +241,11 @@ func queryGeminiForArticle(prompt string) (string, error) {
 			cleaned = responseText[jsonStart : jsonEnd+1]
 			err = json.Unmarshal([]byte(cleaned), &jsonCheck)
 			if err != nil {
+				reportLLMParseError("article", responseText, err)
 				return "", fmt.Errorf("invalid JSON response after all cleaning attempts: %v, response: %s, raw_response: %s", err, cleaned, responseText) // Include raw response in error
 			}
 		} else {
+			reportLLMParseError("article", responseText, err)
 			return "", fmt.Errorf("invalid JSON response and couldn't find valid JSON object: %v, response: %s, raw_response: %s", err, cleaned, responseText) // Include raw response in error
 		}
 	}
@@ -222,25 +255,25 @@ func queryGeminiForArticle(prompt string) (string, error) {
 
 func printResponse(resp *genai.GenerateContentResponse) { // Changed to correct response type
 	if resp == nil {
-		fmt.Println("No response to print.")
+		slog.Debug("No response to print")
 		return
 	}
 	for _, candidate := range resp.Candidates {
 		if candidate == nil {
-			fmt.Println("Nil candidate in response.")
+			slog.Debug("Nil candidate in response")
 			continue
 		}
 		for _, part := range candidate.Content.Parts {
 			if text, ok := part.(genai.Text); ok {
-				fmt.Println("Generated Text:", string(text))
+				slog.Debug("Generated text", "text", string(text))
 			} else {
-				fmt.Printf("Non-text part received: %+v\n", part) // Handle non-text parts if expected
+				slog.Debug("Non-text part received", "part", fmt.Sprintf("%+v", part)) // Handle non-text parts if expected
 			}
 		}
 	}
 }
 
-func filterRelevantSummaries(keyword string, summaries map[string]string) (map[string]string, error) {
+func filterRelevantSummaries(ctx context.Context, logger *slog.Logger, keyword string, summaries map[string]string) (map[string]string, error) {
 	relevantSummaries := make(map[string]string)
 
 	for url, summary := range summaries {
@@ -257,7 +290,7 @@ Summary: %s
 
 Reply with ONLY "true" or "false" in JSON format: {"relevant": true} or {"relevant": false}`, keyword, summary) // Asking for JSON response
 
-		responseStr, err := queryGeminiForArticle(prompt)
+		responseStr, err := queryGeminiForArticle(ctx, prompt)
 		if err != nil {
 			return nil, fmt.Errorf("error checking summary relevance: %v", err)
 		}
@@ -267,7 +300,8 @@ Reply with ONLY "true" or "false" in JSON format: {"relevant": true} or {"releva
 		}
 		err = json.Unmarshal([]byte(responseStr), &relevanceResult)
 		if err != nil {
-			fmt.Printf("Warning: Failed to parse relevance JSON response: %v, response string: %s. Treating as not relevant.\n", err, responseStr)
+			logger.Warn("Failed to parse relevance response, treating the summary as not relevant", "url", url, "response", responseStr, "error", err)
+			reportLLMParseError("relevance", responseStr, err, "keyword", keyword, "url", url)
 			continue // Treat as not relevant if parsing fails, and continue to next summary
 		}
 
@@ -279,8 +313,8 @@ Reply with ONLY "true" or "false" in JSON format: {"relevant": true} or {"releva
 	return relevantSummaries, nil
 }
 
-func verifyClaimsWithGrounding(keyword string, summaries map[string]string) (map[string]string, error) {
-	fmt.Printf("Starting claims verification for keyword '%s' with %d summaries\n", keyword, len(summaries))
+func verifyClaimsWithGrounding(ctx context.Context, logger *slog.Logger, keyword string, summaries map[string]string) (map[string]string, error) {
+	logger.Info("Starting claims verification", "summaries", len(summaries))
 	
 	// Prepare input data for Python script
 	input := struct {
@@ -296,11 +330,11 @@ func verifyClaimsWithGrounding(keyword string, summaries map[string]string) (map
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal input data: %v", err)
 	}
-	fmt.Printf("Prepared JSON input for Python script (length: %d bytes)\n", len(inputJSON))
+	logger.Debug("Prepared fact checker input", "bytes", len(inputJSON))
 
 	// Create command to run Python script
-	cmd := exec.Command("python3", "fact_checker.py")
-	fmt.Printf("Created Python command: %v\n", cmd.Args)
+	cmd := exec.CommandContext(ctx, "python3", "fact_checker.py")
+	logger.Debug("Created fact checker command", "args", cmd.Args)
 	
 	// Set up pipes for input/output
 	stdin, err := cmd.StdinPipe()
@@ -323,7 +357,7 @@ func verifyClaimsWithGrounding(keyword string, summaries map[string]string) (map
 	if err := cmd.Start(); err != nil {
 		return nil, fmt.Errorf("failed to start Python script: %v", err)
 	}
-	fmt.Println("Started Python script successfully")
+	logger.Debug("Started fact checker")
 
 	// Create a channel for debug messages
 	debugChan := make(chan string, 100)
@@ -342,7 +376,7 @@ func verifyClaimsWithGrounding(keyword string, summaries map[string]string) (map
 		return nil, fmt.Errorf("failed to write to stdin: %v", err)
 	}
 	stdin.Close()
-	fmt.Println("Wrote input to Python script")
+	logger.Debug("Wrote input to fact checker")
 
 	// Process debug messages
 	go func() {
@@ -357,16 +391,16 @@ func verifyClaimsWithGrounding(keyword string, summaries map[string]string) (map
 			}
 			if err := json.Unmarshal([]byte(msg), &debugMsg); err == nil {
 				if debugMsg.Debug != "" {
-					fmt.Printf("Python Debug: %s\n", debugMsg.Debug)
 					if debugMsg.Original != "" {
-						fmt.Printf("  Original: %s\n", debugMsg.Original)
-						fmt.Printf("  Verified: %v\n", debugMsg.Verified)
-						fmt.Printf("  Corrected: %s\n", debugMsg.Corrected)
-						fmt.Printf("  Source: %s\n", debugMsg.Source)
+						logger.Debug("Fact checker output", "message", debugMsg.Debug,
+							"original", debugMsg.Original, "verified", debugMsg.Verified,
+							"corrected", debugMsg.Corrected, "source", debugMsg.Source)
+					} else {
+						logger.Debug("Fact checker output", "message", debugMsg.Debug)
 					}
 				}
 				if debugMsg.Error != "" {
-					fmt.Printf("Python Error: %s\n", debugMsg.Error)
+					logger.Error("Fact checker error", "error", debugMsg.Error)
 				}
 			}
 		}
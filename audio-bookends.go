@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// AudioBookendConfig holds the spoken intro/outro and optional jingles that
+// frame every narrated article
+type AudioBookendConfig struct {
+	Intro       string // text/template spoken before the article, e.g. "{{.Date}}: {{.Title}}."
+	Outro       string // text/template spoken after the article
+	IntroJingle string // Optional pre-recorded audio file played before the narration
+	OutroJingle string // Optional pre-recorded audio file played after the narration
+}
+
+var defaultAudioBookendConfig = AudioBookendConfig{
+	Outro: "I'm Daily Bot, and you're listening to Daily Scoop AI.",
+}
+
+var audioBookendConfig = defaultAudioBookendConfig
+
+// audioBookendData is available to the intro and outro templates
+type audioBookendData struct {
+	Title string
+	Date  string // e.g. "Monday, January 2"
+}
+
+// loadAudioBookendConfig reads AUDIO_INTRO, AUDIO_OUTRO, AUDIO_INTRO_JINGLE and
+// AUDIO_OUTRO_JINGLE. AUDIO_OUTRO=none disables the default outro.
+func loadAudioBookendConfig() (AudioBookendConfig, error) {
+	config := defaultAudioBookendConfig
+
+	if value := os.Getenv("AUDIO_INTRO"); value != "" {
+		config.Intro = value
+	}
+	if value := os.Getenv("AUDIO_OUTRO"); value == "none" {
+		config.Outro = ""
+	} else if value != "" {
+		config.Outro = value
+	}
+	for name, text := range map[string]string{"AUDIO_INTRO": config.Intro, "AUDIO_OUTRO": config.Outro} {
+		if _, err := template.New(name).Parse(text); err != nil {
+			return config, fmt.Errorf("%s is not a valid template: %v", name, err)
+		}
+	}
+
+	config.IntroJingle = os.Getenv("AUDIO_INTRO_JINGLE")
+	config.OutroJingle = os.Getenv("AUDIO_OUTRO_JINGLE")
+	for name, path := range map[string]string{"AUDIO_INTRO_JINGLE": config.IntroJingle, "AUDIO_OUTRO_JINGLE": config.OutroJingle} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return config, fmt.Errorf("%s file is not readable: %v", name, err)
+		}
+	}
+
+	return config, nil
+}
+
+// renderBookends returns the intro and outro text for an article
+func (c AudioBookendConfig) renderBookends(title string) (string, string, error) {
+	data := audioBookendData{
+		Title: title,
+		Date:  appNow().Format("Monday, January 2"),
+	}
+	intro, err := renderBookend("intro", c.Intro, data)
+	if err != nil {
+		return "", "", err
+	}
+	outro, err := renderBookend("outro", c.Outro, data)
+	if err != nil {
+		return "", "", err
+	}
+	return intro, outro, nil
+}
+
+func renderBookend(name, text string, data audioBookendData) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %v", name, err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render %s: %v", name, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// addJingles wraps the narration at audioPath with the configured jingles,
+// re-encoding everything to a common format so the parts join cleanly
+func (c AudioBookendConfig) addJingles(audioPath string) error {
+	var inputs []string
+	if c.IntroJingle != "" {
+		inputs = append(inputs, c.IntroJingle)
+	}
+	inputs = append(inputs, audioPath)
+	if c.OutroJingle != "" {
+		inputs = append(inputs, c.OutroJingle)
+	}
+	if len(inputs) == 1 {
+		return nil
+	}
+
+	tempPath := strings.TrimSuffix(audioPath, ".mp3") + "_jingles.mp3"
+	if err := concatAudio(inputs, tempPath); err != nil {
+		return fmt.Errorf("failed to add jingles: %v", err)
+	}
+	return os.Rename(tempPath, audioPath)
+}
+
+// introLength is how far the intro jingle pushes back the narration
+func (c AudioBookendConfig) introLength() (time.Duration, error) {
+	if c.IntroJingle == "" {
+		return 0, nil
+	}
+	return probeAudioLength(c.IntroJingle)
+}
+
+// concatAudio joins audio files end to end into an MP3 at outputPath,
+// resampling each input so files from different sources can be mixed
+func concatAudio(inputs []string, outputPath string) error {
+	var args []string
+	var filter strings.Builder
+	for i, input := range inputs {
+		args = append(args, "-i", input)
+		fmt.Fprintf(&filter, "[%d:a]aresample=44100,aformat=channel_layouts=stereo[a%d];", i, i)
+	}
+	for i := range inputs {
+		fmt.Fprintf(&filter, "[a%d]", i)
+	}
+	fmt.Fprintf(&filter, "concat=n=%d:v=0:a=1[out]", len(inputs))
+
+	args = append(args,
+		"-filter_complex", filter.String(),
+		"-map", "[out]",
+		"-codec:a", "libmp3lame",
+		"-y", outputPath)
+	if output, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("ffmpeg concat failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultDialogueVoices are used for the two hosts when AUDIO_DIALOGUE_VOICES
+// is unset; other providers need voices configured explicitly
+var defaultDialogueVoices = map[string][2]string{
+	"openai": {"alloy", "onyx"},
+}
+
+// DialogueConfig controls the two-host podcast version of the daily flagship story
+type DialogueConfig struct {
+	Enabled bool
+	Voices  [2]string // Voices for the first and second host
+}
+
+var dialogueConfig DialogueConfig
+
+// loadDialogueConfig reads AUDIO_DIALOGUE ("true" to enable) and
+// AUDIO_DIALOGUE_VOICES ("voiceA,voiceB")
+func loadDialogueConfig() (DialogueConfig, error) {
+	config := DialogueConfig{Enabled: os.Getenv("AUDIO_DIALOGUE") == "true"}
+	if !config.Enabled {
+		return config, nil
+	}
+
+	if value := os.Getenv("AUDIO_DIALOGUE_VOICES"); value != "" {
+		voices := strings.Split(value, ",")
+		if len(voices) != 2 || strings.TrimSpace(voices[0]) == "" || strings.TrimSpace(voices[1]) == "" {
+			return config, fmt.Errorf("AUDIO_DIALOGUE_VOICES must be two comma-separated voices, got %q", value)
+		}
+		config.Voices = [2]string{strings.TrimSpace(voices[0]), strings.TrimSpace(voices[1])}
+		return config, nil
+	}
+
+	voices, ok := defaultDialogueVoices[ttsProviderName()]
+	if !ok {
+		return config, fmt.Errorf("AUDIO_DIALOGUE_VOICES must be set for the %s TTS provider", ttsProviderName())
+	}
+	config.Voices = voices
+	return config, nil
+}
+
+// DialogueLine is one turn of the two-host script
+type DialogueLine struct {
+	Host int    `json:"host"` // 1 or 2
+	Text string `json:"text"`
+}
+
+const dialoguePrompt = `Rewrite the news article below as a short, lively conversation between two podcast hosts.
+- Host 1 introduces the story and guides the conversation; Host 2 reacts, asks questions and adds detail
+- Stick strictly to the facts in the article; do not invent quotes, numbers or names
+- Keep it to between 8 and 16 turns, each one to three spoken sentences
+- Write plain spoken text only: no stage directions, sound effects or markdown
+- Do not greet listeners or sign off; an intro and outro are added separately
+
+Return JSON in this format:
+{"lines": [{"host": 1, "text": "..."}, {"host": 2, "text": "..."}]}
+
+Title: %s
+
+Article:
+%s`
+
+// generateDialogueScript turns an article into a two-host script with Gemini
+func generateDialogueScript(ctx context.Context, article GeneratedArticle) ([]DialogueLine, error) {
+	response, err := queryGeminiForArticle(ctx, fmt.Sprintf(dialoguePrompt, article.Title, stripMarkdownTags(article.Article)))
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Lines []DialogueLine `json:"lines"`
+	}
+	if err := json.Unmarshal([]byte(response), &result); err != nil {
+		reportLLMParseError("dialogue", response, err, "keyword", article.Keyword)
+		return nil, fmt.Errorf("error parsing dialogue script: %v", err)
+	}
+
+	var lines []DialogueLine
+	for _, line := range result.Lines {
+		line.Text = strings.TrimSpace(line.Text)
+		if line.Text == "" {
+			continue
+		}
+		if line.Host != 1 && line.Host != 2 {
+			return nil, fmt.Errorf("dialogue line has unknown host %d", line.Host)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("dialogue script has only %d lines", len(lines))
+	}
+	return lines, nil
+}
+
+// GenerateDialogueAudioFile produces a two-host podcast of the article: each
+// line is synthesized with its host's voice and the clips are joined with
+// ffmpeg. The first host reads the configured intro and outro.
+func GenerateDialogueAudioFile(ctx context.Context, article GeneratedArticle, config DialogueConfig) (string, error) {
+	lines, err := generateDialogueScript(ctx, article)
+	if err != nil {
+		return "", fmt.Errorf("failed to write dialogue script: %v", err)
+	}
+
+	intro, outro, err := audioBookendConfig.renderBookends(article.Title)
+	if err != nil {
+		return "", err
+	}
+	if intro != "" {
+		lines = append([]DialogueLine{{Host: 1, Text: intro}}, lines...)
+	}
+	if outro != "" {
+		lines = append(lines, DialogueLine{Host: 1, Text: outro})
+	}
+
+	provider, err := newTTSProvider()
+	if err != nil {
+		return "", err
+	}
+
+	var clips []string
+	defer func() {
+		for _, clip := range clips {
+			os.Remove(clip)
+		}
+	}()
+	for i, line := range lines {
+		clip, err := synthesizeClip(ctx, provider, line.Text, config.Voices[line.Host-1])
+		if err != nil {
+			return "", fmt.Errorf("dialogue line %d: %v", i+1, err)
+		}
+		clips = append(clips, clip)
+	}
+
+	outputPath := strings.TrimSuffix(clips[0], ".mp3") + "_dialogue.mp3"
+	if err := concatAudio(clips, outputPath); err != nil {
+		return "", fmt.Errorf("failed to join dialogue audio: %v", err)
+	}
+
+	if err := audioBookendConfig.addJingles(outputPath); err != nil {
+		os.Remove(outputPath)
+		return "", err
+	}
+	return outputPath, nil
+}
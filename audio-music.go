@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// noMusicBed disables the music bed for a category in AUDIO_CATEGORY_MUSIC_BEDS
+const noMusicBed = "none"
+
+// MusicBedConfig controls the background music mixed under narration
+type MusicBedConfig struct {
+	Default    string            // Music file used for every category without its own
+	ByCategory map[string]string // Lowercase category name or ID -> music file or "none"
+	Volume     float64           // Bed volume relative to its source, before ducking
+	Fade       time.Duration     // Fade in at the start and out at the end
+}
+
+var defaultMusicBedConfig = MusicBedConfig{
+	ByCategory: map[string]string{},
+	Volume:     0.25,
+	Fade:       2 * time.Second,
+}
+
+var musicBedConfig = defaultMusicBedConfig
+
+// loadMusicBedConfig reads AUDIO_MUSIC_BED, AUDIO_CATEGORY_MUSIC_BEDS
+// ("Sports=music/upbeat.mp3,Politics=none"), AUDIO_MUSIC_VOLUME and AUDIO_MUSIC_FADE
+func loadMusicBedConfig() (MusicBedConfig, error) {
+	config := defaultMusicBedConfig
+	config.Default = os.Getenv("AUDIO_MUSIC_BED")
+	config.ByCategory = loadCategorySettings("AUDIO_CATEGORY_MUSIC_BEDS")
+
+	for _, path := range append([]string{config.Default}, mapValues(config.ByCategory)...) {
+		if path == "" || path == noMusicBed {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return config, fmt.Errorf("music bed %s is not readable: %v", path, err)
+		}
+	}
+
+	volume, err := getEnvFloat("AUDIO_MUSIC_VOLUME", config.Volume)
+	if err != nil {
+		return config, err
+	}
+	if volume <= 0 || volume > 1 {
+		return config, fmt.Errorf("AUDIO_MUSIC_VOLUME must be between 0 and 1, got %v", volume)
+	}
+	config.Volume = volume
+
+	fade, err := getEnvDuration("AUDIO_MUSIC_FADE", config.Fade)
+	if err != nil {
+		return config, err
+	}
+	config.Fade = fade
+
+	return config, nil
+}
+
+// musicBedForCategory returns the music file for a category, or "" for none
+func (c MusicBedConfig) musicBedForCategory(categoryId int) string {
+	bed := categorySetting(c.ByCategory, categoryId)
+	if bed == "" {
+		bed = c.Default
+	}
+	if bed == noMusicBed {
+		return ""
+	}
+	return bed
+}
+
+// mixMusicBed loops the music bed under the narration at audioPath, ducking
+// it while the voice is speaking and fading it in and out
+func (c MusicBedConfig) mixMusicBed(audioPath string, musicPath string) error {
+	duration, err := probeAudioDuration(audioPath)
+	if err != nil {
+		return fmt.Errorf("failed to read narration duration: %v", err)
+	}
+	fade := c.Fade.Seconds()
+	fadeOutStart := float64(duration) - fade
+	if fadeOutStart < 0 {
+		fadeOutStart = 0
+	}
+
+	filter := fmt.Sprintf(
+		"[0:a]asplit=2[voice][trigger];"+
+			"[1:a]volume=%.2f,afade=t=in:d=%.2f,afade=t=out:st=%.2f:d=%.2f[bed];"+
+			"[bed][trigger]sidechaincompress=threshold=0.02:ratio=8:attack=20:release=400[ducked];"+
+			"[voice][ducked]amix=inputs=2:duration=first:dropout_transition=0:normalize=0[out]",
+		c.Volume, fade, fadeOutStart, fade)
+
+	tempPath := strings.TrimSuffix(audioPath, ".mp3") + "_music.mp3"
+	output, err := exec.Command("ffmpeg",
+		"-i", audioPath,
+		"-stream_loop", "-1", "-i", musicPath, // Loop the bed for long narrations
+		"-filter_complex", filter,
+		"-map", "[out]",
+		"-codec:a", "libmp3lame",
+		"-y", tempPath).CombinedOutput()
+	if err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to mix music bed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return os.Rename(tempPath, audioPath)
+}
+
+func mapValues(m map[string]string) []string {
+	values := make([]string, 0, len(m))
+	for _, value := range m {
+		values = append(values, value)
+	}
+	return values
+}
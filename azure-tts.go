@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAzureVoice       = "en-US-JennyNeural"
+	azureSpeechOutputFormat = "audio-24khz-96kbitrate-mono-mp3"
+)
+
+// AzureTTS synthesizes speech with Azure AI Speech
+type AzureTTS struct {
+	key        string
+	region     string // e.g. "eastus"
+	voice      string // Default voice
+	speed      float64
+	pitch      float64 // Semitones
+	httpClient *http.Client
+}
+
+// NewAzureTTS reads AZURE_SPEECH_KEY, AZURE_SPEECH_REGION and AZURE_SPEECH_VOICE
+func NewAzureTTS() (*AzureTTS, error) {
+	a := &AzureTTS{
+		key:        os.Getenv("AZURE_SPEECH_KEY"),
+		region:     os.Getenv("AZURE_SPEECH_REGION"),
+		voice:      os.Getenv("AZURE_SPEECH_VOICE"),
+		speed:      ttsConfig.Speed,
+		pitch:      ttsConfig.Pitch,
+		httpClient: &http.Client{Timeout: 5 * time.Minute},
+	}
+	if a.key == "" {
+		return nil, fmt.Errorf("AZURE_SPEECH_KEY environment variable is not set")
+	}
+	if a.region == "" {
+		return nil, fmt.Errorf("AZURE_SPEECH_REGION environment variable is not set")
+	}
+	if a.voice == "" {
+		a.voice = defaultAzureVoice
+	}
+	if _, err := languageCodeFromVoice(a.voice); err != nil {
+		return nil, fmt.Errorf("AZURE_SPEECH_VOICE must be a voice name like %q: %v", defaultAzureVoice, err)
+	}
+	return a, nil
+}
+
+func (a *AzureTTS) Synthesize(ctx context.Context, text string, voice string) (io.ReadCloser, error) {
+	return a.speak(ctx, escapeXML(text), voice)
+}
+
+// SynthesizeSSML sends the whole script in one request; Azure accepts up to
+// ten minutes of audio per request
+func (a *AzureTTS) SynthesizeSSML(ctx context.Context, script ssmlScript, voice string) (io.ReadCloser, error) {
+	chunks := script.chunks(0)
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("empty SSML script")
+	}
+	return a.speak(ctx, chunks[0], voice)
+}
+
+// speak wraps an SSML body in <speak> and <voice> elements and synthesizes it
+func (a *AzureTTS) speak(ctx context.Context, body string, voice string) (io.ReadCloser, error) {
+	if voice == "" {
+		voice = a.voice
+	}
+	languageCode, err := languageCodeFromVoice(voice)
+	if err != nil {
+		return nil, err
+	}
+	if a.speed != 1.0 || a.pitch != 0 {
+		body = fmt.Sprintf(`<prosody rate="%+.0f%%" pitch="%+.1fst">%s</prosody>`, (a.speed-1)*100, a.pitch, body)
+	}
+	ssml := fmt.Sprintf(`<speak version="1.0" xmlns="http://www.w3.org/2001/10/synthesis" xml:lang="%s"><voice name="%s">%s</voice></speak>`,
+		languageCode, escapeXML(voice), body)
+
+	endpoint := fmt.Sprintf("https://%s.tts.speech.microsoft.com/cognitiveservices/v1", a.region)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(ssml))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/ssml+xml")
+	req.Header.Set("X-Microsoft-OutputFormat", azureSpeechOutputFormat)
+	req.Header.Set("Ocp-Apim-Subscription-Key", a.key)
+	req.Header.Set("User-Agent", "daily-scoop-api")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to Azure Speech: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		// GenerateAudioFileWithConfig backs off on errors mentioning a rate limit
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return nil, fmt.Errorf("Azure Speech rate limit reached: %s", string(body))
+		}
+		return nil, fmt.Errorf("Azure Speech request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return resp.Body, nil
+}
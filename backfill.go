@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// backfillMode is the job queue mode backfills run under, kept apart from the
+// scheduled runs' queues
+const backfillMode = "backfill"
+
+// parseBackfillRange reads the -from and -to dates (YYYY-MM-DD in
+// APP_TIMEZONE, both inclusive) into a [from, to) range. to defaults to from.
+func parseBackfillRange(fromDate string, toDate string) (time.Time, time.Time, error) {
+	if fromDate == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("-from is required, e.g. -from=2025-03-01")
+	}
+	if toDate == "" {
+		toDate = fromDate
+	}
+	from, err := time.ParseInLocation("2006-01-02", fromDate, appLocation)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("-from must be a date like 2025-03-01, got %q", fromDate)
+	}
+	to, err := time.ParseInLocation("2006-01-02", toDate, appLocation)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("-to must be a date like 2025-03-01, got %q", toDate)
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("-to (%s) is before -from (%s)", toDate, fromDate)
+	}
+	return from, to.AddDate(0, 0, 1), nil
+}
+
+// backfillTopics returns the topics accepted in [from, to), under the keyword
+// they were accepted as and in the country they trended in, optionally only
+// those picked by one trend mode. Coverage is searched for in the same days.
+func backfillTopics(from time.Time, to time.Time, trendMode string) ([]TrendingTopic, error) {
+	decisions, err := dbClient.GetKeywordDecisions(from, to, KeywordAccepted)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var topics []TrendingTopic
+	for _, decision := range decisions {
+		if trendMode != "" && decision.Mode != trendMode {
+			continue
+		}
+		keyword := decision.Keyword
+		if decision.ReplacementKeyword != "" {
+			keyword = decision.ReplacementKeyword
+		}
+		if seen[keyword] {
+			continue
+		}
+		seen[keyword] = true
+		// Decisions recorded before the geo was kept were all for TRENDS_GEO
+		geo := decision.Geo
+		if geo == "" {
+			geo = trendsGeo
+		}
+		topics = append(topics, TrendingTopic{
+			Keyword:        keyword,
+			Geo:            geo,
+			TrendBreakdown: decision.TrendBreakdown,
+			SearchWindow:   &SearchWindow{From: from, To: to},
+		})
+	}
+	return topics, nil
+}
+
+// withoutArticles drops the topics that already have an article created in
+// [from, to), so a backfill only fills the gaps
+func withoutArticles(topics []TrendingTopic, from time.Time, to time.Time) ([]TrendingTopic, error) {
+	articles, err := dbClient.GetArticlesSince(from, ArticleFilters{})
+	if err != nil {
+		return nil, fmt.Errorf("error loading existing articles: %v", err)
+	}
+
+	var missing []TrendingTopic
+	for _, topic := range topics {
+		normalized := NormalizeKeyword(topic.Keyword)
+		covered := false
+		for _, article := range articles {
+			if article.CreatedAt.Before(to) && hasKeyword(article.Keywords, normalized) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			missing = append(missing, topic)
+		}
+	}
+	return missing, nil
+}
+
+// RunBackfill generates the articles missing for the topics accepted between
+// from and to, e.g. when an outage stopped runs from finishing. Coverage is
+// searched for in the same days. Topics that already have an article from
+// those days are skipped; delete the article first to regenerate it.
+func RunBackfill(ctx context.Context, from time.Time, to time.Time, trendMode string) error {
+	if trendMode != "" && trendMode != "daily" && trendMode != "recent" {
+		return fmt.Errorf("-backfill-trends must be daily or recent, got %q", trendMode)
+	}
+	topics, err := backfillTopics(from, to, trendMode)
+	if err != nil {
+		return err
+	}
+	if len(topics) == 0 {
+		return fmt.Errorf("no accepted topics between %s and %s", from.Format("2006-01-02"), to.AddDate(0, 0, -1).Format("2006-01-02"))
+	}
+	missing, err := withoutArticles(topics, from, to)
+	if err != nil {
+		return err
+	}
+	if len(missing) < len(topics) {
+		loggerFrom(ctx).Info("Skipping topics that already have articles", "topics", len(topics)-len(missing))
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	topics = missing
+	loggerFrom(ctx).Info("Backfilling accepted topics", "topics", len(topics), "from", from.Format("2006-01-02"), "to", to.AddDate(0, 0, -1).Format("2006-01-02"))
+	processTopics(ctx, topics, backfillMode)
+	return nil
+}
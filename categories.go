@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// otherCategoryId is the catch-all category used when a category can't be determined
+const otherCategoryId = 18
+
+// defaultCategories is the taxonomy seeded into the category table. IDs are
+// fixed so existing articles keep their meaning across environments.
+var defaultCategories = []Category{
+	{ID: 1, Name: "Breaking News"},
+	{ID: 2, Name: "Politics"},
+	{ID: 3, Name: "World News"},
+	{ID: 4, Name: "Business & Finance"},
+	{ID: 5, Name: "Technology"},
+	{ID: 6, Name: "Entertainment"},
+	{ID: 7, Name: "Sports"},
+	{ID: 8, Name: "Health & Wellness"},
+	{ID: 9, Name: "Science"},
+	{ID: 10, Name: "Art & Culture"},
+	{ID: 11, Name: "Travel"},
+	{ID: 12, Name: "Food & Drink"},
+	{ID: 13, Name: "Environment"},
+	{ID: 14, Name: "Lifestyle"},
+	{ID: 15, Name: "Opinion"},
+	{ID: 16, Name: "Education"},
+	{ID: 17, Name: "Religion"},
+	{ID: otherCategoryId, Name: "Other"},
+}
+
+// listCategories returns all categories ordered by ID
+func listCategories(db *gorm.DB) ([]Category, error) {
+	var categories []Category
+	if err := db.Order("id ASC").Find(&categories).Error; err != nil {
+		return nil, fmt.Errorf("error listing categories: %v", err)
+	}
+	return categories, nil
+}
+
+// addCategory creates a category with the next free ID
+func addCategory(db *gorm.DB, name string) (*Category, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("category name is required")
+	}
+
+	// The frontend owns the table, so a unique index on name can't be relied on
+	var existing int64
+	if err := db.Model(&Category{}).Where("LOWER(name) = LOWER(?)", name).Count(&existing).Error; err != nil {
+		return nil, fmt.Errorf("error adding category '%s': %v", name, err)
+	}
+	if existing > 0 {
+		return nil, fmt.Errorf("error adding category '%s': category already exists", name)
+	}
+
+	category := &Category{Name: name}
+	if err := db.Create(category).Error; err != nil {
+		return nil, fmt.Errorf("error adding category '%s': %v", name, err)
+	}
+	return category, nil
+}
+
+// seedCategories inserts any default categories that are missing and returns how many were added
+func seedCategories(db *gorm.DB) (int64, error) {
+	categories := append([]Category(nil), defaultCategories...)
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&categories)
+	if result.Error != nil {
+		return 0, fmt.Errorf("error seeding categories: %v", result.Error)
+	}
+
+	// Explicit IDs don't advance the serial sequence, so move it past them for addCategory
+	err := db.Exec(`SELECT setval(pg_get_serial_sequence('category', 'id'), (SELECT MAX(id) FROM category))`).Error
+	if err != nil {
+		return result.RowsAffected, fmt.Errorf("error resetting category ID sequence: %v", err)
+	}
+	return result.RowsAffected, nil
+}
+
+// loadCategories returns the category taxonomy from the database, falling back
+// to the defaults when the table is empty or unreachable so generation can continue
+func loadCategories() []Category {
+	categories, err := dbClient.ListCategories()
+	if err != nil {
+		slog.Warn("Could not load categories, using defaults", "error", err)
+		return defaultCategories
+	}
+	if len(categories) == 0 {
+		return defaultCategories
+	}
+	return categories
+}
+
+// loadCategorySettings reads a per-category setting such as TTS_CATEGORY_VOICES,
+// keyed by lowercase category name or by category ID
+func loadCategorySettings(key string) map[string]string {
+	settings := make(map[string]string)
+	for category, value := range getEnvMap(key) {
+		settings[strings.ToLower(category)] = value
+	}
+	return settings
+}
+
+// categorySetting looks up a category's entry by ID, then by name; "" when unset
+func categorySetting(settings map[string]string, categoryId int) string {
+	if len(settings) == 0 {
+		return ""
+	}
+	if value, ok := settings[strconv.Itoa(categoryId)]; ok {
+		return value
+	}
+	for _, category := range loadCategories() {
+		if category.ID == categoryId {
+			return settings[strings.ToLower(category.Name)]
+		}
+	}
+	return ""
+}
+
+// formatCategoriesForPrompt renders categories as "1: Breaking News, 2: Politics, ..."
+func formatCategoriesForPrompt(categories []Category) string {
+	entries := make([]string, 0, len(categories))
+	for _, category := range categories {
+		entries = append(entries, fmt.Sprintf("%d: %s", category.ID, category.Name))
+	}
+	return strings.Join(entries, ", ")
+}
+
+// validCategoryId returns categoryId if it exists in categories, otherwise the "Other" category
+func validCategoryId(categoryId int, categories []Category) int {
+	fallback := otherCategoryId
+	for _, category := range categories {
+		if category.ID == categoryId {
+			return categoryId
+		}
+		if category.Name == "Other" {
+			fallback = category.ID
+		}
+	}
+	return fallback
+}
+
+// RunCategoryCommand handles the categories mode: listing, adding or seeding categories
+func RunCategoryCommand(action string, name string) error {
+	switch action {
+	case "list":
+		categories, err := dbClient.ListCategories()
+		if err != nil {
+			return err
+		}
+		if len(categories) == 0 {
+			slog.Info("No categories found, run with -category-action=seed to add the defaults")
+		}
+		for _, category := range categories {
+			fmt.Printf("%d: %s\n", category.ID, category.Name)
+		}
+	case "add":
+		category, err := dbClient.AddCategory(name)
+		if err != nil {
+			return err
+		}
+		slog.Info("Added category", "category", category.ID, "name", category.Name)
+	case "seed":
+		added, err := dbClient.SeedCategories()
+		if err != nil {
+			return err
+		}
+		slog.Info("Seeded missing default categories", "added", added)
+	default:
+		return fmt.Errorf("unknown category action %q: use list, add or seed", action)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultRetentionDays = 90
+	cleanupActionDelete  = "delete"
+	cleanupActionArchive = "archive"
+)
+
+// CleanupConfig controls how old articles are handled by the cleanup mode
+type CleanupConfig struct {
+	RetentionDays int    // Articles older than this many days are cleaned up
+	Action        string // "delete" removes rows, "archive" unpublishes them
+}
+
+// loadCleanupConfig reads ARTICLE_RETENTION_DAYS and CLEANUP_ACTION from the environment
+func loadCleanupConfig() (CleanupConfig, error) {
+	config := CleanupConfig{
+		RetentionDays: defaultRetentionDays,
+		Action:        cleanupActionDelete,
+	}
+
+	if value := os.Getenv("ARTICLE_RETENTION_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 1 {
+			return config, fmt.Errorf("ARTICLE_RETENTION_DAYS must be a positive integer, got %q", value)
+		}
+		config.RetentionDays = days
+	}
+
+	if value := os.Getenv("CLEANUP_ACTION"); value != "" {
+		if value != cleanupActionDelete && value != cleanupActionArchive {
+			return config, fmt.Errorf("CLEANUP_ACTION must be %q or %q, got %q", cleanupActionDelete, cleanupActionArchive, value)
+		}
+		config.Action = value
+	}
+
+	return config, nil
+}
+
+// RunCleanup deletes or archives articles past the retention period, then
+// removes their media from storage and vacuums orphaned newsletter rows
+func RunCleanup(config CleanupConfig) error {
+	cutoff := appNow().AddDate(0, 0, -config.RetentionDays)
+	slog.Info("Running cleanup", "action", config.Action, "before", cutoff.Format(time.RFC3339))
+
+	articles, err := dbClient.GetArticlesBefore(cutoff)
+	if err != nil {
+		return fmt.Errorf("error loading expired articles: %v", err)
+	}
+	slog.Info("Found articles past retention", "articles", len(articles), "retentionDays", config.RetentionDays)
+
+	// Only articles after the cutoff survive the cleanup, so only their media must be kept
+	kept, err := dbClient.GetArticlesSince(cutoff, ArticleFilters{})
+	if err != nil {
+		return fmt.Errorf("error loading retained articles: %v", err)
+	}
+	inUse := make(map[string]bool)
+	for _, article := range kept {
+		for _, mediaURL := range articleMediaURLs(article) {
+			inUse[mediaURL] = true
+		}
+	}
+
+	var ids []uuid.UUID
+	for _, article := range articles {
+		ids = append(ids, article.ID)
+	}
+
+	// Rows go first, so a failed archive or delete never leaves live rows
+	// pointing at media that's already gone
+	switch config.Action {
+	case cleanupActionArchive:
+		if err := dbClient.ArchiveArticles(ids); err != nil {
+			return err
+		}
+		slog.Info("Archived articles", "articles", len(ids))
+	default:
+		if err := dbClient.DeleteArticles(ids); err != nil {
+			return err
+		}
+		slog.Info("Deleted articles", "articles", len(ids))
+	}
+	for _, article := range articles {
+		removeArticleMedia(article, inUse)
+	}
+
+	removed, err := dbClient.DeleteOrphanedNewsletters()
+	if err != nil {
+		return err
+	}
+	slog.Info("Removed orphaned newsletter rows", "rows", removed)
+
+	return nil
+}
+
+// articleMediaURLs lists every uploaded media URL an article references
+func articleMediaURLs(article *NewsArticle) []string {
+	var mediaURLs []string
+	for _, mediaURL := range []*string{article.ImageUrl, article.ThumbnailUrl, article.ImageAvifUrl, article.ThumbnailAvifUrl, article.AudioUrl, article.TranscriptUrl} {
+		if mediaURL != nil && *mediaURL != "" {
+			mediaURLs = append(mediaURLs, *mediaURL)
+		}
+	}
+
+	// The srcset repeats the full-size banner, which is already in the list
+	if article.ImageSrcset != nil {
+		var srcset []ImageSource
+		if err := json.Unmarshal([]byte(*article.ImageSrcset), &srcset); err != nil {
+			slog.Warn("Failed to parse image srcset", "article", article.ID, "error", err)
+		}
+		for _, source := range srcset {
+			if source.URL != "" && (article.ImageUrl == nil || source.URL != *article.ImageUrl) {
+				mediaURLs = append(mediaURLs, source.URL)
+			}
+		}
+	}
+
+	return mediaURLs
+}
+
+// removeArticleMedia deletes an article's uploaded media, logging failures.
+// Media is stored by content hash and shared between articles with identical
+// files, so URLs in inUse are kept.
+func removeArticleMedia(article *NewsArticle, inUse map[string]bool) {
+	for _, mediaURL := range articleMediaURLs(article) {
+		if inUse[mediaURL] {
+			slog.Info("Keeping media a newer article still uses", "url", mediaURL, "article", article.ID)
+			continue
+		}
+		if err := deleteFromStorage(mediaURL); err != nil {
+			slog.Warn("Failed to remove media", "url", mediaURL, "article", article.ID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is read when it exists and neither -config nor
+// CONFIG_FILE names another file
+const defaultConfigFile = "config.yaml"
+
+// Kinds of value a configFileSetting holds, checked when the file is loaded
+const (
+	configString   = "string"
+	configInt      = "integer"
+	configFloat    = "number"
+	configDuration = "duration"
+	configBool     = "boolean"
+	configList     = "list"    // A YAML list, joined with commas
+	configMap      = "mapping" // A YAML mapping, joined as "key=value" pairs
+)
+
+// configFileSetting maps a setting in the config file to the environment
+// variable its loader reads
+type configFileSetting struct {
+	Path string // Dotted path in the file, e.g. "topics.max_daily"
+	Env  string
+	Kind string
+	Sep  string // Separator between configMap pairs, "," when empty
+}
+
+// configFileSettings lists everything the config file can set. API keys,
+// tokens and database URLs aren't among them: secrets stay in the
+// environment.
+var configFileSettings = []configFileSetting{
+	{Path: "app.timezone", Env: "APP_TIMEZONE", Kind: configString},
+	{Path: "logging.level", Env: "LOG_LEVEL", Kind: configString},
+	{Path: "logging.format", Env: "LOG_FORMAT", Kind: configString},
+	{Path: "errors.sentry_environment", Env: "SENTRY_ENVIRONMENT", Kind: configString},
+
+	{Path: "schedule.daily_cron", Env: "DAILY_CRON", Kind: configString},
+	{Path: "schedule.recent_cron", Env: "RECENT_CRON", Kind: configString},
+	{Path: "schedule.daily_jitter", Env: "DAILY_JITTER", Kind: configDuration},
+	{Path: "schedule.recent_jitter", Env: "RECENT_JITTER", Kind: configDuration},
+	{Path: "schedule.shutdown_grace_period", Env: "SHUTDOWN_GRACE_PERIOD", Kind: configDuration},
+
+	{Path: "pipeline.workers", Env: "PIPELINE_WORKERS", Kind: configMap},
+	{Path: "pipeline.job_retries", Env: "JOB_RETRIES", Kind: configInt},
+	{Path: "pipeline.job_retry_delay", Env: "JOB_RETRY_DELAY", Kind: configDuration},
+	{Path: "pipeline.topic_timeout", Env: "TOPIC_TIMEOUT", Kind: configDuration},
+	{Path: "pipeline.rate_limits", Env: "RATE_LIMITS", Kind: configMap},
+
+	{Path: "topics.max_daily", Env: "MAX_DAILY_TOPICS", Kind: configInt},
+	{Path: "topics.max_recent", Env: "MAX_RECENT_TOPICS", Kind: configInt},
+	{Path: "topics.max_sports", Env: "MAX_SPORTS_TOPICS", Kind: configInt},
+	{Path: "topics.geo", Env: "TRENDS_GEO", Kind: configString},
+	{Path: "topics.similarity_threshold", Env: "SIMILARITY_THRESHOLD", Kind: configFloat},
+	{Path: "topics.similarity_window", Env: "SIMILARITY_WINDOW", Kind: configDuration},
+	{Path: "topics.weekly_digest_size", Env: "WEEKLY_DIGEST_SIZE", Kind: configInt},
+
+	{Path: "models.article", Env: "GEMINI_MODEL", Kind: configString},
+	{Path: "models.openai_image", Env: "OPENAI_IMAGE_MODEL", Kind: configString},
+	{Path: "models.elevenlabs", Env: "ELEVENLABS_MODEL", Kind: configString},
+
+	{Path: "budget.run", Env: "RUN_BUDGET", Kind: configFloat},
+	{Path: "budget.gemini_prices", Env: "GEMINI_PRICES", Kind: configMap},
+	{Path: "budget.image_prices", Env: "IMAGE_PRICES", Kind: configMap},
+
+	{Path: "features.disable_audio", Env: "DISABLE_AUDIO", Kind: configBool},
+	{Path: "features.disable_image", Env: "DISABLE_IMAGE", Kind: configBool},
+	{Path: "features.podcast", Env: "PODCAST_ENABLED", Kind: configBool},
+	{Path: "features.sitemap", Env: "SITEMAP_ENABLED", Kind: configBool},
+	{Path: "features.audio_dialogue", Env: "AUDIO_DIALOGUE", Kind: configBool},
+	{Path: "features.image_moderation", Env: "IMAGE_MODERATION", Kind: configBool},
+	{Path: "features.tts_ssml", Env: "TTS_SSML", Kind: configBool},
+	{Path: "features.storage_startup_check", Env: "STORAGE_STARTUP_CHECK", Kind: configBool},
+	{Path: "features.playwright_install", Env: "PLAYWRIGHT_INSTALL", Kind: configBool},
+
+	{Path: "server.admin_addr", Env: "ADMIN_ADDR", Kind: configString},
+	{Path: "server.metrics_addr", Env: "METRICS_ADDR", Kind: configString},
+
+	{Path: "webhooks.urls", Env: "WEBHOOK_URLS", Kind: configList},
+	{Path: "webhooks.timeout", Env: "WEBHOOK_TIMEOUT", Kind: configDuration},
+	{Path: "webhooks.retries", Env: "WEBHOOK_RETRIES", Kind: configInt},
+
+	{Path: "summary_email.to", Env: "SUMMARY_EMAIL_TO", Kind: configList},
+	{Path: "summary_email.from", Env: "SUMMARY_EMAIL_FROM", Kind: configString},
+	{Path: "summary_email.cron", Env: "SUMMARY_EMAIL_CRON", Kind: configString},
+	{Path: "summary_email.template", Env: "SUMMARY_EMAIL_TEMPLATE", Kind: configString},
+	{Path: "summary_email.smtp_host", Env: "SMTP_HOST", Kind: configString},
+	{Path: "summary_email.smtp_port", Env: "SMTP_PORT", Kind: configInt},
+	{Path: "summary_email.smtp_username", Env: "SMTP_USERNAME", Kind: configString},
+	{Path: "newsletter_email.provider", Env: "EMAIL_PROVIDER", Kind: configString},
+	{Path: "newsletter_email.from", Env: "EMAIL_FROM", Kind: configString},
+	{Path: "newsletter_email.from_name", Env: "EMAIL_FROM_NAME", Kind: configString},
+	{Path: "newsletter_email.reply_to", Env: "EMAIL_REPLY_TO", Kind: configString},
+	{Path: "newsletter_email.article_url", Env: "NEWSLETTER_ARTICLE_URL", Kind: configString},
+	{Path: "newsletter_email.unsubscribe_url", Env: "NEWSLETTER_UNSUBSCRIBE_URL", Kind: configString},
+	{Path: "newsletter_email.template", Env: "NEWSLETTER_TEMPLATE", Kind: configString},
+	{Path: "newsletter_email.ses_region", Env: "SES_REGION", Kind: configString},
+
+	{Path: "proxies.provider", Env: "PROXY_PROVIDER", Kind: configString},
+	{Path: "proxies.scheme", Env: "PROXY_SCHEME", Kind: configString},
+	{Path: "proxies.provider_url", Env: "PROXY_PROVIDER_URL", Kind: configString},
+	{Path: "proxies.list", Env: "PROXY_LIST", Kind: configList},
+	{Path: "proxies.file", Env: "PROXY_FILE", Kind: configString},
+	{Path: "proxies.scraper", Env: "PROXY_SCRAPER", Kind: configBool},
+	{Path: "proxies.direct_fallback", Env: "PROXY_DIRECT_FALLBACK", Kind: configBool},
+	{Path: "proxies.refresh", Env: "PROXY_REFRESH", Kind: configDuration},
+	{Path: "proxies.check_url", Env: "PROXY_CHECK_URL", Kind: configString},
+	{Path: "proxies.max_latency", Env: "PROXY_MAX_LATENCY", Kind: configDuration},
+	{Path: "proxies.max_failures", Env: "PROXY_MAX_FAILURES", Kind: configInt},
+	{Path: "proxies.cooldown", Env: "PROXY_COOLDOWN", Kind: configDuration},
+	{Path: "proxies.blacklist_ratio", Env: "PROXY_BLACKLIST_RATIO", Kind: configFloat},
+	{Path: "proxies.blacklist_min_requests", Env: "PROXY_BLACKLIST_MIN_REQUESTS", Kind: configInt},
+
+	{Path: "database.type", Env: "DB_TYPE", Kind: configString},
+	{Path: "database.max_open_conns", Env: "DB_MAX_OPEN_CONNS", Kind: configInt},
+	{Path: "database.max_idle_conns", Env: "DB_MAX_IDLE_CONNS", Kind: configInt},
+	{Path: "database.conn_max_lifetime", Env: "DB_CONN_MAX_LIFETIME", Kind: configDuration},
+	{Path: "database.connect_retries", Env: "DB_CONNECT_RETRIES", Kind: configInt},
+	{Path: "database.connect_backoff", Env: "DB_CONNECT_BACKOFF", Kind: configDuration},
+	{Path: "database.health_interval", Env: "DB_HEALTH_INTERVAL", Kind: configDuration},
+	{Path: "database.breaker_threshold", Env: "DB_BREAKER_THRESHOLD", Kind: configInt},
+	{Path: "database.breaker_cooldown", Env: "DB_BREAKER_COOLDOWN", Kind: configDuration},
+
+	{Path: "cleanup.retention_days", Env: "ARTICLE_RETENTION_DAYS", Kind: configInt},
+	{Path: "cleanup.action", Env: "CLEANUP_ACTION", Kind: configString},
+
+	{Path: "storage.backend", Env: "STORAGE_BACKEND", Kind: configString},
+	{Path: "storage.max_upload_bytes", Env: "MAX_UPLOAD_BYTES", Kind: configInt},
+	{Path: "storage.supabase_project_url", Env: "SUPABASE_PROJECT_URL", Kind: configString},
+	{Path: "storage.local_dir", Env: "LOCAL_STORAGE_DIR", Kind: configString},
+	{Path: "storage.local_base_url", Env: "LOCAL_STORAGE_BASE_URL", Kind: configString},
+	{Path: "storage.s3_bucket", Env: "S3_BUCKET", Kind: configString},
+	{Path: "storage.s3_region", Env: "S3_REGION", Kind: configString},
+	{Path: "storage.s3_endpoint", Env: "S3_ENDPOINT", Kind: configString},
+	{Path: "storage.s3_public_url", Env: "S3_PUBLIC_URL", Kind: configString},
+
+	{Path: "images.provider", Env: "IMAGE_PROVIDER", Kind: configString},
+	{Path: "images.fallback_provider", Env: "IMAGE_FALLBACK_PROVIDER", Kind: configString},
+	{Path: "images.strategy", Env: "IMAGE_STRATEGY", Kind: configString},
+	{Path: "images.policy", Env: "IMAGE_POLICY", Kind: configString},
+	{Path: "images.category_policies", Env: "IMAGE_CATEGORY_POLICIES", Kind: configMap},
+	{Path: "images.category_styles", Env: "IMAGE_CATEGORY_STYLES", Kind: configMap, Sep: ";"},
+	{Path: "images.sensitive_categories", Env: "IMAGE_SENSITIVE_CATEGORIES", Kind: configList},
+	{Path: "images.banner_width", Env: "IMAGE_BANNER_WIDTH", Kind: configInt},
+	{Path: "images.banner_height", Env: "IMAGE_BANNER_HEIGHT", Kind: configInt},
+	{Path: "images.thumb_size", Env: "IMAGE_THUMB_SIZE", Kind: configInt},
+	{Path: "images.quality", Env: "IMAGE_QUALITY", Kind: configInt},
+	{Path: "images.aspect_ratio", Env: "IMAGE_ASPECT_RATIO", Kind: configString},
+	{Path: "images.candidates", Env: "IMAGE_CANDIDATES", Kind: configInt},
+	{Path: "images.prompt_revisions", Env: "IMAGE_PROMPT_REVISIONS", Kind: configInt},
+	{Path: "images.deterministic_seeds", Env: "IMAGE_DETERMINISTIC_SEEDS", Kind: configBool},
+	{Path: "images.source_domains", Env: "SOURCE_IMAGE_DOMAINS", Kind: configList},
+	{Path: "images.source_min_width", Env: "SOURCE_IMAGE_MIN_WIDTH", Kind: configInt},
+	{Path: "images.openai_size", Env: "OPENAI_IMAGE_SIZE", Kind: configString},
+	{Path: "images.openai_quality", Env: "OPENAI_IMAGE_QUALITY", Kind: configString},
+
+	{Path: "stable_diffusion.url", Env: "SD_URL", Kind: configString},
+	{Path: "stable_diffusion.api", Env: "SD_API", Kind: configString},
+	{Path: "stable_diffusion.negative_prompt", Env: "SD_NEGATIVE_PROMPT", Kind: configString},
+	{Path: "stable_diffusion.width", Env: "SD_WIDTH", Kind: configInt},
+	{Path: "stable_diffusion.height", Env: "SD_HEIGHT", Kind: configInt},
+	{Path: "stable_diffusion.steps", Env: "SD_STEPS", Kind: configInt},
+	{Path: "stable_diffusion.timeout", Env: "SD_TIMEOUT", Kind: configDuration},
+	{Path: "stable_diffusion.comfyui_workflow", Env: "SD_COMFYUI_WORKFLOW", Kind: configString},
+
+	{Path: "tts.provider", Env: "TTS_PROVIDER", Kind: configString},
+	{Path: "tts.providers", Env: "TTS_PROVIDERS", Kind: configList},
+	{Path: "tts.monthly_budgets", Env: "TTS_MONTHLY_BUDGETS", Kind: configMap},
+	{Path: "tts.prices", Env: "TTS_PRICES", Kind: configMap},
+	{Path: "tts.max_concurrent", Env: "TTS_MAX_CONCURRENT", Kind: configInt},
+	{Path: "tts.speed", Env: "TTS_SPEED", Kind: configFloat},
+	{Path: "tts.pitch", Env: "TTS_PITCH", Kind: configFloat},
+	{Path: "tts.pronunciations", Env: "TTS_PRONUNCIATIONS", Kind: configMap},
+	{Path: "tts.category_voices", Env: "TTS_CATEGORY_VOICES", Kind: configMap},
+	{Path: "tts.google_voice", Env: "GOOGLE_TTS_VOICE", Kind: configString},
+	{Path: "tts.google_speaking_rate", Env: "GOOGLE_TTS_SPEAKING_RATE", Kind: configFloat},
+	{Path: "tts.elevenlabs_voice_id", Env: "ELEVENLABS_VOICE_ID", Kind: configString},
+	{Path: "tts.polly_region", Env: "POLLY_REGION", Kind: configString},
+	{Path: "tts.polly_voice", Env: "POLLY_VOICE", Kind: configString},
+	{Path: "tts.polly_engine", Env: "POLLY_ENGINE", Kind: configString},
+	{Path: "tts.azure_region", Env: "AZURE_SPEECH_REGION", Kind: configString},
+	{Path: "tts.azure_voice", Env: "AZURE_SPEECH_VOICE", Kind: configString},
+
+	{Path: "audio.intro", Env: "AUDIO_INTRO", Kind: configString},
+	{Path: "audio.outro", Env: "AUDIO_OUTRO", Kind: configString},
+	{Path: "audio.intro_jingle", Env: "AUDIO_INTRO_JINGLE", Kind: configString},
+	{Path: "audio.outro_jingle", Env: "AUDIO_OUTRO_JINGLE", Kind: configString},
+	{Path: "audio.dialogue_voices", Env: "AUDIO_DIALOGUE_VOICES", Kind: configList},
+	{Path: "audio.music_bed", Env: "AUDIO_MUSIC_BED", Kind: configString},
+	{Path: "audio.category_music_beds", Env: "AUDIO_CATEGORY_MUSIC_BEDS", Kind: configMap},
+	{Path: "audio.music_volume", Env: "AUDIO_MUSIC_VOLUME", Kind: configFloat},
+	{Path: "audio.music_fade", Env: "AUDIO_MUSIC_FADE", Kind: configDuration},
+
+	{Path: "podcast.title", Env: "PODCAST_TITLE", Kind: configString},
+	{Path: "podcast.description", Env: "PODCAST_DESCRIPTION", Kind: configString},
+	{Path: "podcast.author", Env: "PODCAST_AUTHOR", Kind: configString},
+	{Path: "podcast.site_url", Env: "PODCAST_SITE_URL", Kind: configString},
+	{Path: "podcast.image_url", Env: "PODCAST_IMAGE_URL", Kind: configString},
+	{Path: "podcast.language", Env: "PODCAST_LANGUAGE", Kind: configString},
+	{Path: "podcast.max_episodes", Env: "PODCAST_MAX_EPISODES", Kind: configInt},
+
+	{Path: "sitemap.article_url", Env: "SITEMAP_ARTICLE_URL", Kind: configString},
+	{Path: "sitemap.publication_name", Env: "SITEMAP_PUBLICATION_NAME", Kind: configString},
+	{Path: "sitemap.language", Env: "SITEMAP_LANGUAGE", Kind: configString},
+	{Path: "sitemap.max_urls", Env: "SITEMAP_MAX_URLS", Kind: configInt},
+	{Path: "sitemap.bucket", Env: "SITEMAP_BUCKET", Kind: configString},
+	{Path: "sitemap.url", Env: "SITEMAP_URL", Kind: configString},
+	{Path: "sitemap.ping_urls", Env: "SITEMAP_PING_URLS", Kind: configList},
+}
+
+// configFilePath returns the config file named by the -config flag, else
+// CONFIG_FILE, else config.yaml when it exists; "" when there is none
+func configFilePath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return path
+	}
+	if _, err := os.Stat(defaultConfigFile); err == nil {
+		return defaultConfigFile
+	}
+	return ""
+}
+
+// loadConfigFile checks every setting in the YAML file at path and copies
+// it into the environment variable its loader reads, unless that variable is
+// already set: the environment overrides the file. It returns how many
+// settings the file applied.
+func loadConfigFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("error reading config file: %v", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return 0, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(root.Content) == 0 {
+		return 0, nil
+	}
+
+	settings := make(map[string]configFileSetting, len(configFileSettings))
+	for _, setting := range configFileSettings {
+		settings[setting.Path] = setting
+	}
+	values := make(map[string]string)
+	if err := readConfigSection(root.Content[0], "", settings, values); err != nil {
+		return 0, fmt.Errorf("%s: %v", path, err)
+	}
+
+	applied := 0
+	for env, value := range values {
+		if os.Getenv(env) != "" {
+			continue
+		}
+		if err := os.Setenv(env, value); err != nil {
+			return applied, fmt.Errorf("error setting %s: %v", env, err)
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// readConfigSection reads the settings in a mapping node into values, keyed
+// by environment variable. prefix is the section's dotted path.
+func readConfigSection(node *yaml.Node, prefix string, settings map[string]configFileSetting, values map[string]string) error {
+	if node.Kind != yaml.MappingNode {
+		if prefix == "" {
+			return fmt.Errorf("line %d: expected sections such as \"topics:\" at the top level", node.Line)
+		}
+		return fmt.Errorf("line %d: %s is a section, not a setting", node.Line, strings.TrimSuffix(prefix, "."))
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		path := prefix + key.Value
+
+		setting, ok := settings[path]
+		if !ok {
+			if !isConfigSection(path, settings) {
+				return fmt.Errorf("line %d: unknown setting %q", key.Line, path)
+			}
+			// A section whose settings are all commented out is empty
+			if value.Tag == "!!null" {
+				continue
+			}
+			if err := readConfigSection(value, path+".", settings, values); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if value.Tag == "!!null" {
+			continue
+		}
+		converted, err := configValue(setting, value)
+		if err != nil {
+			return fmt.Errorf("line %d: %s %v", value.Line, path, err)
+		}
+		values[setting.Env] = converted
+	}
+	return nil
+}
+
+// isConfigSection reports whether any setting lives under path
+func isConfigSection(path string, settings map[string]configFileSetting) bool {
+	for name := range settings {
+		if strings.HasPrefix(name, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// configValue checks a value against the setting's kind and formats it the
+// way the environment variable is written
+func configValue(setting configFileSetting, node *yaml.Node) (string, error) {
+	switch setting.Kind {
+	case configList:
+		if node.Kind == yaml.ScalarNode {
+			return node.Value, nil
+		}
+		if node.Kind != yaml.SequenceNode {
+			return "", errors.New("must be a list")
+		}
+		var items []string
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", errors.New("must be a list of plain values")
+			}
+			items = append(items, item.Value)
+		}
+		return strings.Join(items, ","), nil
+
+	case configMap:
+		if node.Kind == yaml.ScalarNode {
+			return node.Value, nil
+		}
+		if node.Kind != yaml.MappingNode {
+			return "", errors.New("must be a mapping such as \"Sports: value\"")
+		}
+		sep := setting.Sep
+		if sep == "" {
+			sep = ","
+		}
+		var pairs []string
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i+1].Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("entry %q must be a plain value", node.Content[i].Value)
+			}
+			pairs = append(pairs, node.Content[i].Value+"="+node.Content[i+1].Value)
+		}
+		return strings.Join(pairs, sep), nil
+	}
+
+	if node.Kind != yaml.ScalarNode {
+		return "", fmt.Errorf("must be a single %s", setting.Kind)
+	}
+	value := node.Value
+	switch setting.Kind {
+	case configInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return "", fmt.Errorf("must be an integer, got %q", value)
+		}
+	case configFloat:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "", fmt.Errorf("must be a number, got %q", value)
+		}
+	case configDuration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return "", fmt.Errorf("must be a duration like \"30s\" or \"5m\", got %q", value)
+		}
+	case configBool:
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("must be true or false, got %q", value)
+		}
+		value = strconv.FormatBool(enabled)
+	}
+	return value, nil
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"strings"
 	"time"
@@ -11,6 +14,8 @@ import (
 	"github.com/lib/pq"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
 )
 
 // Global database client
@@ -18,8 +23,80 @@ var dbClient DBClient
 
 type DBClient interface {
 	SaveArticle(article *GeneratedArticle, mediaAssets NewsMediaAssets, imageSuccess bool) (*NewsArticle, error)
-	CheckSimilarKeywords(keyword string, hours int) (bool, error)
+	SaveArticles(bundles []ArticleBundle) ([]*NewsArticle, error)
+	SearchArticles(query string, filters ArticleFilters) ([]*NewsArticle, error)
+	CheckSimilarKeywords(keyword string, config SimilarityConfig) (bool, error)
 	SaveDailyNewsletter(articleId string, titleText string, previewText string) error
+	GetArticlesSince(since time.Time, filters ArticleFilters) ([]*NewsArticle, error)
+	GetArticleByID(id string) (*NewsArticle, error)
+	SaveKeywordDecision(decision *KeywordDecision) error
+	GetKeywordDecisions(from time.Time, to time.Time, decision string) ([]*KeywordDecision, error)
+	GetArticlesBefore(before time.Time) ([]*NewsArticle, error)
+	DeleteArticles(ids []uuid.UUID) error
+	ArchiveArticles(ids []uuid.UUID) error
+	DeleteOrphanedNewsletters() (int64, error)
+	DeleteArticle(id string) error
+	RestoreArticle(id string) error
+	UpdateArticle(id string, update ArticleUpdate) (*NewsArticle, error)
+	HasDailyNewsletterSince(since time.Time) (bool, error)
+	GetDailyNewsletterSince(since time.Time) (*DailyNewsletter, error)
+	SaveWeeklyDigest(weekStart time.Time, articleIds []string, titleText string, previewText string, intro string) error
+	HasWeeklyDigestSince(since time.Time) (bool, error)
+	GetWeeklyDigestSince(since time.Time) (*WeeklyDigest, error)
+	ListCategories() ([]Category, error)
+	AddCategory(name string) (*Category, error)
+	SeedCategories() (int64, error)
+	EnqueuePipelineJobs(jobs []*PipelineJob) error
+	ClaimPipelineJob(mode string, kind string) (*PipelineJob, error)
+	CheckpointPipelineJob(id uuid.UUID, payload string) error
+	FinishPipelineJob(job *PipelineJob, next *PipelineJob) error
+	GetPipelineJobs(mode string, statuses []string) ([]*PipelineJob, error)
+	RequeueRunningPipelineJobs(mode string) (int64, error)
+	DeletePipelineJobs(ids []uuid.UUID) error
+	SavePodcastEpisode(episode *PodcastEpisode) error
+	GetPodcastEpisodes(limit int) ([]*PodcastEpisode, error)
+	RecordTTSUsage(provider string, month time.Time, characters int, costUSD float64) error
+	GetTTSUsage(month time.Time) ([]*TTSUsage, error)
+	RecordStageTimings(timings []*StageTiming) error
+	GetStageTimings(since time.Time) ([]*StageTiming, error)
+	GetPipelineControl() (*PipelineControl, error)
+	SetPipelineControl(paused bool, reason string) (*PipelineControl, error)
+	RecordProxyOutcomes(host string, successes int, failures int) error
+	GetProxyStats() ([]*ProxyStat, error)
+	BlacklistProxy(host string, reason string) error
+	ClearProxyBlacklist(host string) error
+	GetNewsletterSubscribers() ([]*NewsletterSubscriber, error)
+	SetNewsletterSubscription(email string, subscribed bool) error
+	GetNewsletterDelivery(kind string, issueId string) (*NewsletterDelivery, error)
+	SaveNewsletterDelivery(delivery *NewsletterDelivery) error
+	GetNewsletterRecipients(kind string, issueId string) ([]*NewsletterRecipient, error)
+	SaveNewsletterRecipient(recipient *NewsletterRecipient) error
+	Ping(ctx context.Context) error
+}
+
+// ArticleBundle is a generated article with its uploaded media, saved together by SaveArticles
+type ArticleBundle struct {
+	Article      *GeneratedArticle
+	MediaAssets  NewsMediaAssets
+	ImageSuccess bool
+}
+
+// ArticleUpdate lists the article fields that can be changed after publishing.
+// Nil fields are left untouched.
+type ArticleUpdate struct {
+	Title        *string
+	Body         *string
+	ImageUrl     *string
+	ThumbnailUrl *string
+	AudioUrl     *string
+	Published    *bool
+}
+
+// ArticleFilters narrows the articles returned by GetArticlesSince and SearchArticles
+type ArticleFilters struct {
+	PublishedOnly bool  // Only return published articles
+	CategoryIds   []int // Restrict to these categories (empty means all)
+	Limit         int   // Maximum number of articles to return (0 means no limit)
 }
 
 // Models
@@ -29,15 +106,25 @@ type NewsArticle struct {
 	Body       string        `gorm:"not null;type:text"`
 	ImageUrl   *string       `gorm:"column:imageUrl"`
 	ThumbnailUrl *string     `gorm:"column:thumbnailUrl"`
+	ImageAvifUrl     *string `gorm:"column:imageAvifUrl"`
+	ThumbnailAvifUrl *string `gorm:"column:thumbnailAvifUrl"`
+	ImageSrcset      *string `gorm:"column:imageSrcset;type:jsonb"` // JSON array of ImageSource
+	ImageAltText     *string `gorm:"column:imageAltText"`
+	ImageCaption     *string `gorm:"column:imageCaption"`   // Labels AI-generated images
+	ImageCredit      *string `gorm:"column:imageCredit"`    // Stock photo attribution or AI image provider
+	ImageCreditUrl   *string `gorm:"column:imageCreditUrl"` // Where the attribution links to
 	AudioUrl   *string       `gorm:"column:audioUrl"`
+	AudioDurationSeconds *int `gorm:"column:audioDurationSeconds"`
+	TranscriptUrl    *string `gorm:"column:transcriptUrl"` // WebVTT with word timings for the audio
 	AuthorId   string        `gorm:"column:authorId;type:uuid;not null"`
 	CategoryId *int          `gorm:"column:categoryId"`
 	Keywords   pq.StringArray `gorm:"type:text[];default:'{}'"`
 	CreatedAt  time.Time     `gorm:"column:createdAt;default:CURRENT_TIMESTAMP"`
-	UpdatedAt  time.Time     `gorm:"column:updatedAt"`
+	UpdatedAt  time.Time     `gorm:"column:updatedAt"` // Kept current by GORM on create and update
 	Published  bool          `gorm:"default:false"`
 	URLTitle   string        `gorm:"column:urlTitle"`
 	UseImage   bool          `gorm:"column:useImage;default:true"`
+	DeletedAt  gorm.DeletedAt `gorm:"column:deletedAt;index"`
 }
 
 type User struct {
@@ -45,42 +132,396 @@ type User struct {
 	// ... other User fields ...
 }
 
+// Category is a row of the category table, which the frontend owns and this
+// service only reads and seeds
 type Category struct {
-	ID int `gorm:"primary_key"`
-	// ... other Category fields ...
+	ID   int    `gorm:"primary_key;autoIncrement"`
+	Name string `gorm:"type:text"`
+}
+
+func (Category) TableName() string {
+	return "category"
 }
 
 func (NewsArticle) TableName() string {
 	return "news_article"
 }
 
+// Keyword decision outcomes recorded in the keyword_decision audit table
+const (
+	KeywordAccepted               = "accepted"
+	KeywordRejectedNotNews        = "rejected_not_news"
+	KeywordRejectedInactive       = "rejected_inactive"
+	KeywordRejectedSimilarInDB    = "rejected_similar_in_db"
+	KeywordRejectedSimilarInBatch = "rejected_similar_in_batch"
+	KeywordRejectedError          = "rejected_error"
+	KeywordSkippedLimit           = "skipped_topic_limit"
+)
+
+// KeywordDecision records why a trending keyword was accepted or rejected
+type KeywordDecision struct {
+	ID                 uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Keyword            string         `gorm:"not null;type:text"`
+	ReplacementKeyword string         `gorm:"column:replacementKeyword;type:text"`
+	Geo                string         `gorm:"type:text"` // Country the keyword trended in
+	Mode               string         `gorm:"not null;type:text"`
+	Decision           string         `gorm:"not null;type:text;index"`
+	Reason             string         `gorm:"type:text"`
+	TrendBreakdown     pq.StringArray `gorm:"column:trendBreakdown;type:text[];default:'{}'"`
+	LLMResponses       pq.StringArray `gorm:"column:llmResponses;type:text[];default:'{}'"`
+	CreatedAt          time.Time      `gorm:"column:createdAt;default:CURRENT_TIMESTAMP"`
+}
+
+func (KeywordDecision) TableName() string {
+	return "keyword_decision"
+}
+
+// NewsArticleSource links an article to a source article it was generated from
+type NewsArticleSource struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	NewsArticleId uuid.UUID  `gorm:"column:newsArticleId;type:uuid;not null;index"`
+	URL           string     `gorm:"column:url;not null;type:text"`
+	Title         string     `gorm:"type:text"`
+	Domain        string     `gorm:"type:text;index"`
+	PublishedAt   *time.Time `gorm:"column:publishedAt"`
+	CreatedAt     time.Time  `gorm:"column:createdAt;default:CURRENT_TIMESTAMP"`
+}
+
+func (NewsArticleSource) TableName() string {
+	return "news_article_source"
+}
+
+// GenerationMetadata stores the prompt and model settings an article was generated with
+type GenerationMetadata struct {
+	ID            uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	NewsArticleId uuid.UUID `gorm:"column:newsArticleId;type:uuid;not null;uniqueIndex"`
+	Prompt        string    `gorm:"not null;type:text"`
+	Model         string    `gorm:"not null;type:text;index"`
+	Provider      string    `gorm:"not null;type:text"`
+	Temperature   float32   `gorm:"not null"`
+	CreatedAt     time.Time `gorm:"column:createdAt;default:CURRENT_TIMESTAMP"`
+}
+
+func (GenerationMetadata) TableName() string {
+	return "generation_metadata"
+}
+
+// ImageGenerationMetadata stores how an article's AI-generated image was made,
+// so it can be regenerated or audited
+type ImageGenerationMetadata struct {
+	ID                  uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	NewsArticleId       uuid.UUID `gorm:"column:newsArticleId;type:uuid;not null;uniqueIndex"`
+	Prompt              string    `gorm:"not null;type:text"`
+	Provider            string    `gorm:"not null;type:text;index"`
+	Model               string    `gorm:"not null;type:text"`
+	Seed                *int64
+	Symbolic            bool      `gorm:"not null"`
+	PromptRevisions     int       `gorm:"column:promptRevisions;not null"`
+	ModerationRejection string    `gorm:"column:moderationRejection;not null;type:text"` // Empty when the first image passed
+	CreatedAt           time.Time `gorm:"column:createdAt;default:CURRENT_TIMESTAMP"`
+}
+
+func (ImageGenerationMetadata) TableName() string {
+	return "image_generation_metadata"
+}
+
+func newImageGenerationMetadata(articleId uuid.UUID, image *ImageGenerationInfo) ImageGenerationMetadata {
+	return ImageGenerationMetadata{
+		ID:                  uuid.New(),
+		NewsArticleId:       articleId,
+		Prompt:              image.Prompt,
+		Provider:            image.Provider,
+		Model:               image.Model,
+		Seed:                image.Seed,
+		Symbolic:            image.Symbolic,
+		PromptRevisions:     image.PromptRevisions,
+		ModerationRejection: image.ModerationRejection,
+	}
+}
+
+// migrateSchema creates the tables owned by this service if they don't exist yet
+func migrateSchema(db *gorm.DB) error {
+	// news_article is shared with the frontend, so only add the columns we rely on
+	if err := db.Exec(`ALTER TABLE news_article ADD COLUMN IF NOT EXISTS "deletedAt" timestamptz`).Error; err != nil {
+		return err
+	}
+	if err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_news_article_deleted_at ON news_article ("deletedAt")`).Error; err != nil {
+		return err
+	}
+	// AVIF variants of the banner and thumbnail, null when only WebP was produced
+	if err := db.Exec(`ALTER TABLE news_article ADD COLUMN IF NOT EXISTS "imageAvifUrl" text`).Error; err != nil {
+		return err
+	}
+	if err := db.Exec(`ALTER TABLE news_article ADD COLUMN IF NOT EXISTS "thumbnailAvifUrl" text`).Error; err != nil {
+		return err
+	}
+	// Banner sizes for responsive images, e.g. [{"url": "...", "width": 640}, ...]
+	if err := db.Exec(`ALTER TABLE news_article ADD COLUMN IF NOT EXISTS "imageSrcset" jsonb`).Error; err != nil {
+		return err
+	}
+	// Alt text for the banner and thumbnail
+	if err := db.Exec(`ALTER TABLE news_article ADD COLUMN IF NOT EXISTS "imageAltText" text`).Error; err != nil {
+		return err
+	}
+	// Attribution for stock photos used when no image could be generated, or
+	// the provider of AI-generated images
+	if err := db.Exec(`ALTER TABLE news_article ADD COLUMN IF NOT EXISTS "imageCredit" text`).Error; err != nil {
+		return err
+	}
+	if err := db.Exec(`ALTER TABLE news_article ADD COLUMN IF NOT EXISTS "imageCreditUrl" text`).Error; err != nil {
+		return err
+	}
+	// Caption disclosing that an image is AI-generated
+	if err := db.Exec(`ALTER TABLE news_article ADD COLUMN IF NOT EXISTS "imageCaption" text`).Error; err != nil {
+		return err
+	}
+	// Playback length shown next to the audio player
+	if err := db.Exec(`ALTER TABLE news_article ADD COLUMN IF NOT EXISTS "audioDurationSeconds" integer`).Error; err != nil {
+		return err
+	}
+	// Timed transcript for highlighting text along with the audio
+	if err := db.Exec(`ALTER TABLE news_article ADD COLUMN IF NOT EXISTS "transcriptUrl" text`).Error; err != nil {
+		return err
+	}
+	// Full-text search over titles and bodies. Postgres keeps the generated
+	// column current for every writer, the frontend included. A plain column
+	// left by an earlier version is replaced, along with its index.
+	if err := db.Exec(`DO $$ BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_name = 'news_article' AND column_name = 'searchVector' AND is_generated = 'NEVER') THEN
+			ALTER TABLE news_article DROP COLUMN "searchVector";
+		END IF;
+	END $$`).Error; err != nil {
+		return err
+	}
+	if err := db.Exec(`ALTER TABLE news_article ADD COLUMN IF NOT EXISTS "searchVector" tsvector GENERATED ALWAYS AS (` + searchVectorSQL + `) STORED`).Error; err != nil {
+		return err
+	}
+	if err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_news_article_search_vector ON news_article USING GIN ("searchVector")`).Error; err != nil {
+		return err
+	}
+	// Live articles sharing a urlTitle would stop the unique index being built,
+	// so all but the newest get their ID appended, as distinctURLTitle does
+	if err := db.Exec(`UPDATE news_article SET "urlTitle" = "urlTitle" || '-' || LEFT(id::text, 8)
+		WHERE id IN (SELECT id FROM (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY "urlTitle" ORDER BY "createdAt" DESC, id) AS position
+			FROM news_article WHERE "urlTitle" <> '' AND "deletedAt" IS NULL) ranked
+		WHERE position > 1)`).Error; err != nil {
+		return err
+	}
+	// The upsert's ON CONFLICT needs this index; without it saves fall back to plain inserts
+	if err := db.Exec(`DROP INDEX IF EXISTS idx_news_article_url_title`).Error; err != nil {
+		return err
+	}
+	if err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_news_article_live_url_title ON news_article ("urlTitle") WHERE ` + liveURLTitleSQL).Error; err != nil {
+		slog.Warn("Could not create unique urlTitle index, article saves will not be idempotent", "error", err)
+		articleUpsertReady = false
+	} else {
+		articleUpsertReady = true
+	}
+	return db.AutoMigrate(&KeywordDecision{}, &NewsArticleSource{}, &GenerationMetadata{}, &WeeklyDigest{}, &PodcastEpisode{}, &TTSUsage{}, &ImageGenerationMetadata{}, &PipelineJob{}, &StageTiming{}, &PipelineControl{}, &ProxyStat{}, &NewsletterSubscriber{}, &NewsletterDelivery{}, &NewsletterRecipient{})
+}
+
 // SupabaseClient implementation
 type SupabaseClient struct {
 	db *gorm.DB
 }
 
+// DBPoolConfig holds connection pool and startup retry settings
+type DBPoolConfig struct {
+	MaxOpenConns    int           // Maximum number of open connections (0 means unlimited)
+	MaxIdleConns    int           // Maximum number of idle connections kept in the pool
+	ConnMaxLifetime time.Duration // Maximum time a connection may be reused
+	ConnectRetries  int           // Number of retries when the database is unreachable at startup
+	RetryBackoff    time.Duration // Initial delay between retries, doubled after each attempt
+}
+
+var defaultDBPoolConfig = DBPoolConfig{
+	MaxOpenConns:    10,
+	MaxIdleConns:    5,
+	ConnMaxLifetime: 30 * time.Minute,
+	ConnectRetries:  5,
+	RetryBackoff:    2 * time.Second,
+}
+
+// loadDBPoolConfig reads pool settings from DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS,
+// DB_CONN_MAX_LIFETIME, DB_CONNECT_RETRIES and DB_CONNECT_BACKOFF
+func loadDBPoolConfig() (DBPoolConfig, error) {
+	config := defaultDBPoolConfig
+	var err error
+
+	if config.MaxOpenConns, err = getEnvInt("DB_MAX_OPEN_CONNS", config.MaxOpenConns); err != nil {
+		return config, err
+	}
+	if config.MaxIdleConns, err = getEnvInt("DB_MAX_IDLE_CONNS", config.MaxIdleConns); err != nil {
+		return config, err
+	}
+	if config.ConnMaxLifetime, err = getEnvDuration("DB_CONN_MAX_LIFETIME", config.ConnMaxLifetime); err != nil {
+		return config, err
+	}
+	if config.ConnectRetries, err = getEnvInt("DB_CONNECT_RETRIES", config.ConnectRetries); err != nil {
+		return config, err
+	}
+	if config.RetryBackoff, err = getEnvDuration("DB_CONNECT_BACKOFF", config.RetryBackoff); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+// openDatabase connects to Postgres, retrying with exponential backoff while the
+// database is unreachable, and applies the pool settings to the connection.
+// When readDSN is set, read queries are routed to that replica and writes stay on dsn.
+func openDatabase(dsn string, readDSN string) (*gorm.DB, error) {
+	config, err := loadDBPoolConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid database pool configuration: %v", err)
+	}
+
+	var db *gorm.DB
+	backoff := config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		if err == nil {
+			break
+		}
+		if attempt >= config.ConnectRetries {
+			return nil, err
+		}
+		slog.Warn("Database unreachable, retrying", "attempt", attempt+1, "attempts", config.ConnectRetries+1, "backoff", backoff, "error", err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to access connection pool: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(config.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(config.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(config.ConnMaxLifetime)
+
+	if readDSN != "" {
+		resolver := dbresolver.Register(dbresolver.Config{
+			Replicas: []gorm.Dialector{postgres.Open(readDSN)},
+			Policy:   dbresolver.RandomPolicy{},
+		}).
+			SetMaxOpenConns(config.MaxOpenConns).
+			SetMaxIdleConns(config.MaxIdleConns).
+			SetConnMaxLifetime(config.ConnMaxLifetime)
+		if err := db.Use(resolver); err != nil {
+			return nil, fmt.Errorf("failed to configure read replica: %v", err)
+		}
+		slog.Info("Routing database reads to read replica")
+	}
+
+	if err := enableDBHealthChecks(db); err != nil {
+		return nil, fmt.Errorf("failed to enable database health checks: %v", err)
+	}
+
+	return db, nil
+}
+
 func NewSupabaseClient(dbURL, apiKey string) (*SupabaseClient, error) {
-	db, err := gorm.Open(postgres.Open(dbURL), &gorm.Config{})
+	db, err := openDatabase(dbURL, os.Getenv("SUPABASE_READ_URL"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to Supabase database: %v", err)
 	}
+	if err := migrateSchema(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate Supabase database schema: %v", err)
+	}
 	return &SupabaseClient{db: db}, nil
 }
 
 func (s *SupabaseClient) SaveArticle(article *GeneratedArticle, mediaAssets NewsMediaAssets, imageSuccess bool) (*NewsArticle, error) {
-	// Ensure the original keyword is included in the keywords array
-	keywords := article.Keywords
-	if !contains(keywords, article.Keyword) {
-		keywords = append([]string{article.Keyword}, keywords...)
+	newsArticle := newNewsArticle(article, mediaAssets, imageSuccess)
+
+	if err := saveArticleWithSources(s.db, newsArticle, article.Sources, article.Generation, mediaAssets.ImageGeneration); err != nil {
+		return nil, fmt.Errorf("error saving to Supabase database: %v", err)
+	}
+
+	return newsArticle, nil
+}
+
+func (s *SupabaseClient) SaveArticles(bundles []ArticleBundle) ([]*NewsArticle, error) {
+	articles, err := saveArticleBundles(s.db, bundles)
+	if err != nil {
+		return nil, fmt.Errorf("error saving to Supabase database: %v", err)
+	}
+	return articles, nil
+}
+
+// newNewsArticle builds the row for a generated article. The original keyword
+// is always included; keywords are stored as written, since readers see them,
+// and dedup checks normalize them when comparing.
+func newNewsArticle(article *GeneratedArticle, mediaAssets NewsMediaAssets, imageSuccess bool) *NewsArticle {
+	keywords := uniqueKeywords(append([]string{article.Keyword}, article.Keywords...))
+
+	// Media that was disabled or failed is stored as NULL rather than ""
+	var imageUrl, thumbnailUrl, audioUrl *string
+	if mediaAssets.ImagePath != "" {
+		imageUrl = &mediaAssets.ImagePath
+	}
+	if mediaAssets.ThumbnailPath != "" {
+		thumbnailUrl = &mediaAssets.ThumbnailPath
+	}
+	if mediaAssets.AudioPath != "" {
+		audioUrl = &mediaAssets.AudioPath
+	}
+	var imageAvifUrl, thumbnailAvifUrl *string
+	if mediaAssets.ImageAvifPath != "" {
+		imageAvifUrl = &mediaAssets.ImageAvifPath
+	}
+	if mediaAssets.ThumbnailAvifPath != "" {
+		thumbnailAvifUrl = &mediaAssets.ThumbnailAvifPath
+	}
+	var imageAltText *string
+	if mediaAssets.ImageAltText != "" {
+		imageAltText = &mediaAssets.ImageAltText
+	}
+	var imageCaption *string
+	if mediaAssets.ImageCaption != "" {
+		imageCaption = &mediaAssets.ImageCaption
+	}
+	var imageCredit, imageCreditUrl *string
+	if mediaAssets.ImageCredit != "" {
+		imageCredit = &mediaAssets.ImageCredit
+	}
+	if mediaAssets.ImageCreditURL != "" {
+		imageCreditUrl = &mediaAssets.ImageCreditURL
+	}
+	var audioDurationSeconds *int
+	if mediaAssets.AudioDurationSeconds > 0 {
+		audioDurationSeconds = &mediaAssets.AudioDurationSeconds
+	}
+	var transcriptUrl *string
+	if mediaAssets.TranscriptPath != "" {
+		transcriptUrl = &mediaAssets.TranscriptPath
+	}
+	var imageSrcset *string
+	if len(mediaAssets.ImageSrcset) > 0 {
+		if encoded, err := json.Marshal(mediaAssets.ImageSrcset); err == nil {
+			srcset := string(encoded)
+			imageSrcset = &srcset
+		}
 	}
 
-	newsArticle := &NewsArticle{
+	return &NewsArticle{
 		ID:           uuid.New(),
 		Title:        article.Title,
 		Body:         article.Article,
-		ImageUrl:     &mediaAssets.ImagePath,
-		ThumbnailUrl: &mediaAssets.ThumbnailPath,
-		AudioUrl:     &mediaAssets.AudioPath,
+		ImageUrl:     imageUrl,
+		ThumbnailUrl: thumbnailUrl,
+		ImageAvifUrl:     imageAvifUrl,
+		ThumbnailAvifUrl: thumbnailAvifUrl,
+		ImageSrcset:      imageSrcset,
+		ImageAltText:     imageAltText,
+		ImageCaption:     imageCaption,
+		ImageCredit:      imageCredit,
+		ImageCreditUrl:   imageCreditUrl,
+		AudioUrl:     audioUrl,
+		AudioDurationSeconds: audioDurationSeconds,
+		TranscriptUrl:    transcriptUrl,
 		AuthorId:     "a66dd82e-9e8e-44e8-94fa-825dd1cd2f7c",
 		CategoryId:   &article.CategoryId,
 		Keywords:     pq.StringArray(keywords),
@@ -88,185 +529,309 @@ func (s *SupabaseClient) SaveArticle(article *GeneratedArticle, mediaAssets News
 		URLTitle:     article.URLTitle,
 		UseImage:     imageSuccess,
 	}
+}
 
-	if err := s.db.Create(newsArticle).Error; err != nil {
-		return nil, fmt.Errorf("error saving to Supabase database: %v", err)
-	}
+// liveURLTitleSQL limits the unique urlTitle index to articles that aren't deleted
+const liveURLTitleSQL = `"urlTitle" <> '' AND "deletedAt" IS NULL`
 
-	return newsArticle, nil
+// articleReplaceWindow is how recently an article must have been saved for a
+// save with the same urlTitle to replace it. Long enough to cover a retried
+// run; a later story that happens to get the same urlTitle is kept separate.
+const articleReplaceWindow = 48 * time.Hour
+
+// articleUpsertReady records whether migrateSchema built the unique urlTitle
+// index the upsert relies on
+var articleUpsertReady = true
+
+// articleUpsertClause updates the live article with the same urlTitle when a
+// save repeats it
+var articleUpsertClause = clause.OnConflict{
+	Columns:     []clause.Column{{Name: "urlTitle"}},
+	TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: liveURLTitleSQL}}},
+	DoUpdates: clause.AssignmentColumns([]string{
+		"title", "body", "imageUrl", "thumbnailUrl", "imageAvifUrl", "thumbnailAvifUrl", "imageSrcset", "imageAltText", "imageCaption", "imageCredit", "imageCreditUrl", "audioUrl", "audioDurationSeconds", "transcriptUrl",
+		"categoryId", "keywords", "published", "useImage", "updatedAt", "deletedAt",
+	}),
 }
 
-// Helper function to check if a string slice contains a value
-func contains(slice []string, str string) bool {
-	for _, v := range slice {
-		if v == str {
-			return true
+// distinctURLTitle gives an article a urlTitle of its own, by appending the
+// start of its ID
+func distinctURLTitle(article *NewsArticle) {
+	article.URLTitle += "-" + article.ID.String()[:8]
+}
+
+// separateFromOlderArticles renames articles whose urlTitle belongs to a live
+// article saved before articleReplaceWindow, so they are published alongside
+// it instead of overwriting it
+func separateFromOlderArticles(db *gorm.DB, articles []*NewsArticle) error {
+	var urlTitles []string
+	for _, article := range articles {
+		if article.URLTitle != "" {
+			urlTitles = append(urlTitles, article.URLTitle)
 		}
 	}
-	return false
+	if len(urlTitles) == 0 {
+		return nil
+	}
+	var older []string
+	err := db.Model(&NewsArticle{}).
+		Where(`"urlTitle" IN ? AND "createdAt" < ?`, urlTitles, appNow().Add(-articleReplaceWindow)).
+		Pluck(`"urlTitle"`, &older).Error
+	if err != nil {
+		return fmt.Errorf("error checking for older articles: %v", err)
+	}
+	taken := make(map[string]bool)
+	for _, urlTitle := range older {
+		taken[urlTitle] = true
+	}
+	for _, article := range articles {
+		if taken[article.URLTitle] {
+			distinctURLTitle(article)
+		}
+	}
+	return nil
 }
 
-func (s *SupabaseClient) CheckSimilarKeywords(keyword string, hours int) (bool, error) {
-	var count int64
-	timeThreshold := time.Now().Add(-time.Duration(hours) * time.Hour)
-	
-	// Check for exact matches first
-	err := s.db.Model(&NewsArticle{}).
-		Where("LOWER(keywords::text) LIKE LOWER(?) AND \"createdAt\" > ?", 
-			fmt.Sprintf("%%\"%s\"%%", keyword), timeThreshold).
-		Count(&count).Error
-	
-	if err != nil {
-		return false, fmt.Errorf("error checking exact keywords: %v", err)
+// upsertArticle inserts an article, or updates the live row with the same
+// urlTitle saved within articleReplaceWindow so a retried run doesn't publish
+// the same story twice. The article's ID is refreshed from the stored row
+// afterwards.
+func upsertArticle(db *gorm.DB, article *NewsArticle) error {
+	if article.URLTitle == "" || !articleUpsertReady {
+		return db.Create(article).Error
 	}
-	
-	if count > 0 {
-		return true, nil
+	if err := separateFromOlderArticles(db, []*NewsArticle{article}); err != nil {
+		return err
 	}
-	
-	// Check for similar keywords using trigram similarity
-	err = s.db.Raw(`
-		SELECT COUNT(*) 
-		FROM news_article, unnest(keywords) keyword 
-		WHERE "createdAt" > ? 
-		AND similarity(LOWER(keyword), LOWER(?)) > 0.8`,
-		timeThreshold, keyword).
-		Count(&count).Error
-	
-	if err != nil {
-		return false, fmt.Errorf("error checking similar keywords: %v", err)
+	if err := db.Clauses(articleUpsertClause).Create(article).Error; err != nil {
+		return err
 	}
-	
-	return count > 0, nil
+	return db.Where("\"urlTitle\" = ?", article.URLTitle).First(article).Error
 }
 
-func (s *SupabaseClient) SaveDailyNewsletter(articleId string, titleText string, previewText string) error {
-	newsletter := &DailyNewsletter{
-		ID:            uuid.New().String(),
+// saveArticleWithSources upserts an article and replaces its source rows and
+// generation metadata in one transaction
+func saveArticleWithSources(db *gorm.DB, article *NewsArticle, sources []ArticleSource, generation *GenerationInfo, imageGeneration *ImageGenerationInfo) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := upsertArticle(tx, article); err != nil {
+			return err
+		}
+		if err := saveGenerationMetadata(tx, article.ID, generation); err != nil {
+			return err
+		}
+		if imageGeneration != nil {
+			metadata := newImageGenerationMetadata(article.ID, imageGeneration)
+			if err := saveImageGenerationMetadata(tx, []ImageGenerationMetadata{metadata}); err != nil {
+				return err
+			}
+		}
+
+		// Replace rather than append so a retried save doesn't duplicate sources
+		if err := tx.Where("\"newsArticleId\" = ?", article.ID).Delete(&NewsArticleSource{}).Error; err != nil {
+			return fmt.Errorf("error clearing article sources: %v", err)
+		}
+		if len(sources) == 0 {
+			return nil
+		}
+
+		rows := make([]NewsArticleSource, 0, len(sources))
+		for _, source := range sources {
+			rows = append(rows, NewsArticleSource{
+				ID:            uuid.New(),
+				NewsArticleId: article.ID,
+				URL:           source.URL,
+				Title:         source.Title,
+				Domain:        source.Domain,
+				PublishedAt:   source.PublishedAt,
+			})
+		}
+		if err := tx.Create(&rows).Error; err != nil {
+			return fmt.Errorf("error saving article sources: %v", err)
+		}
+		return nil
+	})
+}
+
+// generationMetadataUpsertClause overwrites an article's previous generation metadata
+var generationMetadataUpsertClause = clause.OnConflict{
+	Columns:   []clause.Column{{Name: "newsArticleId"}},
+	DoUpdates: clause.AssignmentColumns([]string{"prompt", "model", "provider", "temperature", "createdAt"}),
+}
+
+// saveGenerationMetadata replaces the generation metadata row for an article.
+// Articles saved without generation info keep whatever was stored before.
+func saveGenerationMetadata(db *gorm.DB, articleId uuid.UUID, generation *GenerationInfo) error {
+	if generation == nil {
+		return nil
+	}
+	metadata := &GenerationMetadata{
+		ID:            uuid.New(),
 		NewsArticleId: articleId,
-		TitleText:     titleText,
-		PreviewText:   previewText,
+		Prompt:        generation.Prompt,
+		Model:         generation.Model,
+		Provider:      generation.Provider,
+		Temperature:   generation.Temperature,
 	}
-	
-	if err := s.db.Create(newsletter).Error; err != nil {
-		return fmt.Errorf("error saving daily newsletter: %v", err)
+	err := db.Clauses(generationMetadataUpsertClause).Create(metadata).Error
+	if err != nil {
+		return fmt.Errorf("error saving generation metadata: %v", err)
 	}
-	
 	return nil
 }
 
-// LocalDBClient implementation
-type LocalDBClient struct {
-	db *gorm.DB
+// imageGenerationMetadataUpsertClause overwrites the metadata of an article's previous image
+var imageGenerationMetadataUpsertClause = clause.OnConflict{
+	Columns: []clause.Column{{Name: "newsArticleId"}},
+	DoUpdates: clause.AssignmentColumns([]string{
+		"prompt", "provider", "model", "seed", "symbolic", "promptRevisions", "moderationRejection", "createdAt",
+	}),
 }
 
-func NewLocalDBClient() (*LocalDBClient, error) {
-	dsn := os.Getenv("LOCAL_DB_URL")
-	if dsn == "" {
-		return nil, fmt.Errorf("LOCAL_DB_URL environment variable is not set")
+// saveImageGenerationMetadata upserts image generation metadata rows. Articles
+// saved without a generated image keep whatever was stored before.
+func saveImageGenerationMetadata(db *gorm.DB, rows []ImageGenerationMetadata) error {
+	if len(rows) == 0 {
+		return nil
 	}
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	err := db.Clauses(imageGenerationMetadataUpsertClause).CreateInBatches(rows, articleBatchSize).Error
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %v", err)
+		return fmt.Errorf("error saving image generation metadata: %v", err)
 	}
-
-	// Initialize database schema
-	db.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\";")
-	db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm;")
-	db.Exec(`ALTER TABLE news_article DROP CONSTRAINT IF EXISTS news_article_authorId_fkey;`)
-	db.Exec(`
-        DO $$ 
-        BEGIN
-            IF EXISTS (
-                SELECT 1 
-                FROM information_schema.columns 
-                WHERE table_name = 'user' 
-                AND column_name = 'id' 
-                AND data_type != 'uuid'
-            ) THEN
-                ALTER TABLE "user" ALTER COLUMN id TYPE uuid USING id::uuid;
-            END IF;
-
-            IF EXISTS (
-                SELECT 1 
-                FROM information_schema.columns 
-                WHERE table_name = 'news_article' 
-                AND column_name = 'authorId' 
-                AND data_type != 'uuid'
-            ) THEN
-                ALTER TABLE news_article ALTER COLUMN "authorId" TYPE uuid USING "authorId"::uuid;
-            END IF;
-        END $$;
-    `)
-	db.Exec(`
-        ALTER TABLE news_article
-        ADD CONSTRAINT news_article_authorId_fkey
-        FOREIGN KEY ("authorId")
-        REFERENCES "user" (id)
-        ON DELETE CASCADE;
-    `)
-
-	return &LocalDBClient{db: db}, nil
+	return nil
 }
 
-func (l *LocalDBClient) SaveArticle(article *GeneratedArticle, mediaAssets NewsMediaAssets, imageSuccess bool) (*NewsArticle, error) {
-	newsArticle := &NewsArticle{
-		ID:           uuid.New(),
-		Title:        article.Title,
-		Body:         article.Article,
-		ImageUrl:     &mediaAssets.ImagePath,
-		ThumbnailUrl: &mediaAssets.ThumbnailPath,
-		AudioUrl:     &mediaAssets.AudioPath,
-		AuthorId:     "a66dd82e-9e8e-44e8-94fa-825dd1cd2f7c",
-		CategoryId:   &article.CategoryId,
-		Keywords:     pq.StringArray(article.Keywords),
-		Published:    true,
-		UseImage:     imageSuccess,
+// articleBatchSize caps the rows sent per INSERT when saving articles in bulk
+const articleBatchSize = 100
+
+// saveArticleBundles upserts many articles with their sources and generation
+// metadata in one transaction using batched inserts, so a run either publishes
+// all of its articles or none of them. Saved articles are returned in input order;
+// bundles repeating an earlier urlTitle replace it, as sequential upserts would.
+func saveArticleBundles(db *gorm.DB, bundles []ArticleBundle) ([]*NewsArticle, error) {
+	if len(bundles) == 0 {
+		return nil, nil
 	}
 
-	if err := l.db.Create(newsArticle).Error; err != nil {
-		return nil, fmt.Errorf("error saving to local database: %v", err)
+	// Postgres rejects an upsert that touches the same row twice, so fold repeats first
+	var articles []*NewsArticle
+	var kept []ArticleBundle
+	indexByURLTitle := make(map[string]int)
+	for _, bundle := range bundles {
+		article := newNewsArticle(bundle.Article, bundle.MediaAssets, bundle.ImageSuccess)
+		if article.URLTitle != "" {
+			if i, exists := indexByURLTitle[article.URLTitle]; exists {
+				articles[i], kept[i] = article, bundle
+				continue
+			}
+			indexByURLTitle[article.URLTitle] = len(articles)
+		}
+		articles = append(articles, article)
+		kept = append(kept, bundle)
 	}
 
-	return newsArticle, nil
-}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if !articleUpsertReady {
+			if err := tx.CreateInBatches(articles, articleBatchSize).Error; err != nil {
+				return err
+			}
+		} else {
+			if err := separateFromOlderArticles(tx, articles); err != nil {
+				return err
+			}
+			if err := tx.Clauses(articleUpsertClause).CreateInBatches(articles, articleBatchSize).Error; err != nil {
+				return err
+			}
+		}
 
-func (l *LocalDBClient) CheckSimilarKeywords(keyword string, hours int) (bool, error) {
-	var count int64
-	timeThreshold := time.Now().Add(-time.Duration(hours) * time.Hour)
-	
-	// Check for exact matches first
-	err := l.db.Model(&NewsArticle{}).
-		Where("LOWER(keywords::text) LIKE LOWER(?) AND \"createdAt\" > ?", 
-			fmt.Sprintf("%%\"%s\"%%", keyword), timeThreshold).
-		Count(&count).Error
-	
+		// Upserted rows keep their original IDs, so read them back by urlTitle,
+		// which separateFromOlderArticles may have changed
+		if articleUpsertReady && len(indexByURLTitle) > 0 {
+			indexByURLTitle = make(map[string]int)
+			urlTitles := make([]string, 0, len(articles))
+			for i, article := range articles {
+				if article.URLTitle != "" {
+					indexByURLTitle[article.URLTitle] = i
+					urlTitles = append(urlTitles, article.URLTitle)
+				}
+			}
+			var stored []*NewsArticle
+			if err := tx.Where("\"urlTitle\" IN ?", urlTitles).Find(&stored).Error; err != nil {
+				return fmt.Errorf("error reloading saved articles: %v", err)
+			}
+			for _, article := range stored {
+				articles[indexByURLTitle[article.URLTitle]] = article
+			}
+		}
+
+		ids := make([]uuid.UUID, len(articles))
+		var sourceRows []NewsArticleSource
+		var metadataRows []GenerationMetadata
+		var imageMetadataRows []ImageGenerationMetadata
+		for i, article := range articles {
+			ids[i] = article.ID
+			for _, source := range kept[i].Article.Sources {
+				sourceRows = append(sourceRows, NewsArticleSource{
+					ID:            uuid.New(),
+					NewsArticleId: article.ID,
+					URL:           source.URL,
+					Title:         source.Title,
+					Domain:        source.Domain,
+					PublishedAt:   source.PublishedAt,
+				})
+			}
+			if generation := kept[i].Article.Generation; generation != nil {
+				metadataRows = append(metadataRows, GenerationMetadata{
+					ID:            uuid.New(),
+					NewsArticleId: article.ID,
+					Prompt:        generation.Prompt,
+					Model:         generation.Model,
+					Provider:      generation.Provider,
+					Temperature:   generation.Temperature,
+				})
+			}
+			if imageGeneration := kept[i].MediaAssets.ImageGeneration; imageGeneration != nil {
+				imageMetadataRows = append(imageMetadataRows, newImageGenerationMetadata(article.ID, imageGeneration))
+			}
+		}
+
+		if err := tx.Where("\"newsArticleId\" IN ?", ids).Delete(&NewsArticleSource{}).Error; err != nil {
+			return fmt.Errorf("error clearing article sources: %v", err)
+		}
+		if len(sourceRows) > 0 {
+			if err := tx.CreateInBatches(sourceRows, articleBatchSize).Error; err != nil {
+				return fmt.Errorf("error saving article sources: %v", err)
+			}
+		}
+		if len(metadataRows) > 0 {
+			err := tx.Clauses(generationMetadataUpsertClause).CreateInBatches(metadataRows, articleBatchSize).Error
+			if err != nil {
+				return fmt.Errorf("error saving generation metadata: %v", err)
+			}
+		}
+		return saveImageGenerationMetadata(tx, imageMetadataRows)
+	})
 	if err != nil {
-		return false, fmt.Errorf("error checking exact keywords: %v", err)
+		return nil, err
 	}
-	
-	if count > 0 {
-		return true, nil
-	}
-	
-	// Check for similar keywords using trigram similarity
-	err = l.db.Raw(`
-		SELECT COUNT(*) 
-		FROM news_article, unnest(keywords) keyword 
-		WHERE "createdAt" > ? 
-		AND similarity(LOWER(keyword), LOWER(?)) > 0.8`,
-		timeThreshold, keyword).
-		Count(&count).Error
-	
-	if err != nil {
-		return false, fmt.Errorf("error checking similar keywords: %v", err)
+
+	return articles, nil
+}
+
+// Helper function to check if a string slice contains a value
+func contains(slice []string, str string) bool {
+	for _, v := range slice {
+		if v == str {
+			return true
+		}
 	}
-	
-	return count > 0, nil
+	return false
 }
 
-func (l *LocalDBClient) SaveDailyNewsletter(articleId string, titleText string, previewText string) error {
+func (s *SupabaseClient) CheckSimilarKeywords(keyword string, config SimilarityConfig) (bool, error) {
+	return checkSimilarKeywords(s.db, keyword, config)
+}
+
+func (s *SupabaseClient) SaveDailyNewsletter(articleId string, titleText string, previewText string) error {
 	newsletter := &DailyNewsletter{
 		ID:            uuid.New().String(),
 		NewsArticleId: articleId,
@@ -274,13 +839,1223 @@ func (l *LocalDBClient) SaveDailyNewsletter(articleId string, titleText string,
 		PreviewText:   previewText,
 	}
 	
-	if err := l.db.Create(newsletter).Error; err != nil {
+	if err := s.db.Create(newsletter).Error; err != nil {
 		return fmt.Errorf("error saving daily newsletter: %v", err)
 	}
 	
 	return nil
 }
 
+func (s *SupabaseClient) GetArticlesSince(since time.Time, filters ArticleFilters) ([]*NewsArticle, error) {
+	return getArticlesSince(s.db, since, filters)
+}
+
+func (s *SupabaseClient) GetArticleByID(id string) (*NewsArticle, error) {
+	return getArticleByID(s.db, id)
+}
+
+func (s *SupabaseClient) SearchArticles(query string, filters ArticleFilters) ([]*NewsArticle, error) {
+	return searchArticles(s.db, query, filters)
+}
+
+func (s *SupabaseClient) SaveKeywordDecision(decision *KeywordDecision) error {
+	return saveKeywordDecision(s.db, decision)
+}
+
+func (s *SupabaseClient) GetKeywordDecisions(from time.Time, to time.Time, decision string) ([]*KeywordDecision, error) {
+	return getKeywordDecisions(s.db, from, to, decision)
+}
+
+func (s *SupabaseClient) GetArticlesBefore(before time.Time) ([]*NewsArticle, error) {
+	return getArticlesBefore(s.db, before)
+}
+
+func (s *SupabaseClient) DeleteArticles(ids []uuid.UUID) error {
+	return deleteArticles(s.db, ids)
+}
+
+func (s *SupabaseClient) ArchiveArticles(ids []uuid.UUID) error {
+	return archiveArticles(s.db, ids)
+}
+
+func (s *SupabaseClient) DeleteOrphanedNewsletters() (int64, error) {
+	return deleteOrphanedNewsletters(s.db)
+}
+
+func (s *SupabaseClient) DeleteArticle(id string) error {
+	return deleteArticle(s.db, id)
+}
+
+func (s *SupabaseClient) RestoreArticle(id string) error {
+	return restoreArticle(s.db, id)
+}
+
+func (s *SupabaseClient) UpdateArticle(id string, update ArticleUpdate) (*NewsArticle, error) {
+	return updateArticle(s.db, id, update)
+}
+
+func (s *SupabaseClient) HasDailyNewsletterSince(since time.Time) (bool, error) {
+	return hasDailyNewsletterSince(s.db, since)
+}
+
+func (s *SupabaseClient) GetDailyNewsletterSince(since time.Time) (*DailyNewsletter, error) {
+	return getDailyNewsletterSince(s.db, since)
+}
+
+func (s *SupabaseClient) SaveWeeklyDigest(weekStart time.Time, articleIds []string, titleText string, previewText string, intro string) error {
+	return saveWeeklyDigest(s.db, weekStart, articleIds, titleText, previewText, intro)
+}
+
+func (s *SupabaseClient) HasWeeklyDigestSince(since time.Time) (bool, error) {
+	return hasWeeklyDigestSince(s.db, since)
+}
+
+func (s *SupabaseClient) GetWeeklyDigestSince(since time.Time) (*WeeklyDigest, error) {
+	return getWeeklyDigestSince(s.db, since)
+}
+
+func (s *SupabaseClient) EnqueuePipelineJobs(jobs []*PipelineJob) error {
+	return enqueuePipelineJobs(s.db, jobs)
+}
+
+func (s *SupabaseClient) ClaimPipelineJob(mode string, kind string) (*PipelineJob, error) {
+	return claimPipelineJob(s.db, mode, kind)
+}
+
+func (s *SupabaseClient) CheckpointPipelineJob(id uuid.UUID, payload string) error {
+	return checkpointPipelineJob(s.db, id, payload)
+}
+
+func (s *SupabaseClient) FinishPipelineJob(job *PipelineJob, next *PipelineJob) error {
+	return finishPipelineJob(s.db, job, next)
+}
+
+func (s *SupabaseClient) GetPipelineJobs(mode string, statuses []string) ([]*PipelineJob, error) {
+	return getPipelineJobs(s.db, mode, statuses)
+}
+
+func (s *SupabaseClient) RequeueRunningPipelineJobs(mode string) (int64, error) {
+	return requeueRunningPipelineJobs(s.db, mode)
+}
+
+func (s *SupabaseClient) DeletePipelineJobs(ids []uuid.UUID) error {
+	return deletePipelineJobs(s.db, ids)
+}
+
+func (s *SupabaseClient) SavePodcastEpisode(episode *PodcastEpisode) error {
+	return savePodcastEpisode(s.db, episode)
+}
+
+func (s *SupabaseClient) GetPodcastEpisodes(limit int) ([]*PodcastEpisode, error) {
+	return getPodcastEpisodes(s.db, limit)
+}
+
+func (s *SupabaseClient) RecordTTSUsage(provider string, month time.Time, characters int, costUSD float64) error {
+	return recordTTSUsage(s.db, provider, month, characters, costUSD)
+}
+
+func (s *SupabaseClient) GetTTSUsage(month time.Time) ([]*TTSUsage, error) {
+	return getTTSUsage(s.db, month)
+}
+
+func (s *SupabaseClient) RecordStageTimings(timings []*StageTiming) error {
+	return recordStageTimings(s.db, timings)
+}
+
+func (s *SupabaseClient) GetStageTimings(since time.Time) ([]*StageTiming, error) {
+	return getStageTimings(s.db, since)
+}
+
+func (s *SupabaseClient) GetPipelineControl() (*PipelineControl, error) {
+	return getPipelineControl(s.db)
+}
+
+func (s *SupabaseClient) SetPipelineControl(paused bool, reason string) (*PipelineControl, error) {
+	return setPipelineControl(s.db, paused, reason)
+}
+
+func (s *SupabaseClient) RecordProxyOutcomes(host string, successes int, failures int) error {
+	return recordProxyOutcomes(s.db, host, successes, failures)
+}
+
+func (s *SupabaseClient) GetProxyStats() ([]*ProxyStat, error) {
+	return getProxyStats(s.db)
+}
+
+func (s *SupabaseClient) BlacklistProxy(host string, reason string) error {
+	return blacklistProxy(s.db, host, reason)
+}
+
+func (s *SupabaseClient) ClearProxyBlacklist(host string) error {
+	return clearProxyBlacklist(s.db, host)
+}
+
+func (s *SupabaseClient) GetNewsletterSubscribers() ([]*NewsletterSubscriber, error) {
+	return getNewsletterSubscribers(s.db)
+}
+
+func (s *SupabaseClient) SetNewsletterSubscription(email string, subscribed bool) error {
+	return setNewsletterSubscription(s.db, email, subscribed)
+}
+
+func (s *SupabaseClient) GetNewsletterDelivery(kind string, issueId string) (*NewsletterDelivery, error) {
+	return getNewsletterDelivery(s.db, kind, issueId)
+}
+
+func (s *SupabaseClient) SaveNewsletterDelivery(delivery *NewsletterDelivery) error {
+	return saveNewsletterDelivery(s.db, delivery)
+}
+
+func (s *SupabaseClient) GetNewsletterRecipients(kind string, issueId string) ([]*NewsletterRecipient, error) {
+	return getNewsletterRecipients(s.db, kind, issueId)
+}
+
+func (s *SupabaseClient) SaveNewsletterRecipient(recipient *NewsletterRecipient) error {
+	return saveNewsletterRecipient(s.db, recipient)
+}
+
+func (s *SupabaseClient) Ping(ctx context.Context) error {
+	return pingDatabase(ctx, s.db)
+}
+
+func (s *SupabaseClient) ListCategories() ([]Category, error) {
+	return listCategories(s.db)
+}
+
+func (s *SupabaseClient) AddCategory(name string) (*Category, error) {
+	return addCategory(s.db, name)
+}
+
+func (s *SupabaseClient) SeedCategories() (int64, error) {
+	return seedCategories(s.db)
+}
+
+// LocalDBClient implementation
+type LocalDBClient struct {
+	db *gorm.DB
+}
+
+func NewLocalDBClient() (*LocalDBClient, error) {
+	dsn := os.Getenv("LOCAL_DB_URL")
+	if dsn == "" {
+		return nil, fmt.Errorf("LOCAL_DB_URL environment variable is not set")
+	}
+
+	db, err := openDatabase(dsn, os.Getenv("LOCAL_DB_READ_URL"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+
+	// Initialize database schema
+	db.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\";")
+	db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm;")
+	db.Exec(`ALTER TABLE news_article DROP CONSTRAINT IF EXISTS news_article_authorId_fkey;`)
+	db.Exec(`
+        DO $$ 
+        BEGIN
+            IF EXISTS (
+                SELECT 1 
+                FROM information_schema.columns 
+                WHERE table_name = 'user' 
+                AND column_name = 'id' 
+                AND data_type != 'uuid'
+            ) THEN
+                ALTER TABLE "user" ALTER COLUMN id TYPE uuid USING id::uuid;
+            END IF;
+
+            IF EXISTS (
+                SELECT 1 
+                FROM information_schema.columns 
+                WHERE table_name = 'news_article' 
+                AND column_name = 'authorId' 
+                AND data_type != 'uuid'
+            ) THEN
+                ALTER TABLE news_article ALTER COLUMN "authorId" TYPE uuid USING "authorId"::uuid;
+            END IF;
+        END $$;
+    `)
+	db.Exec(`
+        ALTER TABLE news_article
+        ADD CONSTRAINT news_article_authorId_fkey
+        FOREIGN KEY ("authorId")
+        REFERENCES "user" (id)
+        ON DELETE CASCADE;
+    `)
+	if err := migrateSchema(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate database schema: %v", err)
+	}
+
+	return &LocalDBClient{db: db}, nil
+}
+
+func (l *LocalDBClient) SaveArticle(article *GeneratedArticle, mediaAssets NewsMediaAssets, imageSuccess bool) (*NewsArticle, error) {
+	newsArticle := newNewsArticle(article, mediaAssets, imageSuccess)
+
+	if err := saveArticleWithSources(l.db, newsArticle, article.Sources, article.Generation, mediaAssets.ImageGeneration); err != nil {
+		return nil, fmt.Errorf("error saving to local database: %v", err)
+	}
+
+	return newsArticle, nil
+}
+
+func (l *LocalDBClient) SaveArticles(bundles []ArticleBundle) ([]*NewsArticle, error) {
+	articles, err := saveArticleBundles(l.db, bundles)
+	if err != nil {
+		return nil, fmt.Errorf("error saving to local database: %v", err)
+	}
+	return articles, nil
+}
+
+func (l *LocalDBClient) CheckSimilarKeywords(keyword string, config SimilarityConfig) (bool, error) {
+	return checkSimilarKeywords(l.db, keyword, config)
+}
+
+func (l *LocalDBClient) SaveDailyNewsletter(articleId string, titleText string, previewText string) error {
+	newsletter := &DailyNewsletter{
+		ID:            uuid.New().String(),
+		NewsArticleId: articleId,
+		TitleText:     titleText,
+		PreviewText:   previewText,
+	}
+	
+	if err := l.db.Create(newsletter).Error; err != nil {
+		return fmt.Errorf("error saving daily newsletter: %v", err)
+	}
+	
+	return nil
+}
+
+func (l *LocalDBClient) GetArticlesSince(since time.Time, filters ArticleFilters) ([]*NewsArticle, error) {
+	return getArticlesSince(l.db, since, filters)
+}
+
+func (l *LocalDBClient) GetArticleByID(id string) (*NewsArticle, error) {
+	return getArticleByID(l.db, id)
+}
+
+func (l *LocalDBClient) SearchArticles(query string, filters ArticleFilters) ([]*NewsArticle, error) {
+	return searchArticles(l.db, query, filters)
+}
+
+func (l *LocalDBClient) SaveKeywordDecision(decision *KeywordDecision) error {
+	return saveKeywordDecision(l.db, decision)
+}
+
+func (l *LocalDBClient) GetKeywordDecisions(from time.Time, to time.Time, decision string) ([]*KeywordDecision, error) {
+	return getKeywordDecisions(l.db, from, to, decision)
+}
+
+func (l *LocalDBClient) GetArticlesBefore(before time.Time) ([]*NewsArticle, error) {
+	return getArticlesBefore(l.db, before)
+}
+
+func (l *LocalDBClient) DeleteArticles(ids []uuid.UUID) error {
+	return deleteArticles(l.db, ids)
+}
+
+func (l *LocalDBClient) ArchiveArticles(ids []uuid.UUID) error {
+	return archiveArticles(l.db, ids)
+}
+
+func (l *LocalDBClient) DeleteOrphanedNewsletters() (int64, error) {
+	return deleteOrphanedNewsletters(l.db)
+}
+
+func (l *LocalDBClient) DeleteArticle(id string) error {
+	return deleteArticle(l.db, id)
+}
+
+func (l *LocalDBClient) RestoreArticle(id string) error {
+	return restoreArticle(l.db, id)
+}
+
+func (l *LocalDBClient) UpdateArticle(id string, update ArticleUpdate) (*NewsArticle, error) {
+	return updateArticle(l.db, id, update)
+}
+
+func (l *LocalDBClient) HasDailyNewsletterSince(since time.Time) (bool, error) {
+	return hasDailyNewsletterSince(l.db, since)
+}
+
+func (l *LocalDBClient) GetDailyNewsletterSince(since time.Time) (*DailyNewsletter, error) {
+	return getDailyNewsletterSince(l.db, since)
+}
+
+func (l *LocalDBClient) SaveWeeklyDigest(weekStart time.Time, articleIds []string, titleText string, previewText string, intro string) error {
+	return saveWeeklyDigest(l.db, weekStart, articleIds, titleText, previewText, intro)
+}
+
+func (l *LocalDBClient) HasWeeklyDigestSince(since time.Time) (bool, error) {
+	return hasWeeklyDigestSince(l.db, since)
+}
+
+func (l *LocalDBClient) GetWeeklyDigestSince(since time.Time) (*WeeklyDigest, error) {
+	return getWeeklyDigestSince(l.db, since)
+}
+
+func (l *LocalDBClient) EnqueuePipelineJobs(jobs []*PipelineJob) error {
+	return enqueuePipelineJobs(l.db, jobs)
+}
+
+func (l *LocalDBClient) ClaimPipelineJob(mode string, kind string) (*PipelineJob, error) {
+	return claimPipelineJob(l.db, mode, kind)
+}
+
+func (l *LocalDBClient) CheckpointPipelineJob(id uuid.UUID, payload string) error {
+	return checkpointPipelineJob(l.db, id, payload)
+}
+
+func (l *LocalDBClient) FinishPipelineJob(job *PipelineJob, next *PipelineJob) error {
+	return finishPipelineJob(l.db, job, next)
+}
+
+func (l *LocalDBClient) GetPipelineJobs(mode string, statuses []string) ([]*PipelineJob, error) {
+	return getPipelineJobs(l.db, mode, statuses)
+}
+
+func (l *LocalDBClient) RequeueRunningPipelineJobs(mode string) (int64, error) {
+	return requeueRunningPipelineJobs(l.db, mode)
+}
+
+func (l *LocalDBClient) DeletePipelineJobs(ids []uuid.UUID) error {
+	return deletePipelineJobs(l.db, ids)
+}
+
+func (l *LocalDBClient) SavePodcastEpisode(episode *PodcastEpisode) error {
+	return savePodcastEpisode(l.db, episode)
+}
+
+func (l *LocalDBClient) GetPodcastEpisodes(limit int) ([]*PodcastEpisode, error) {
+	return getPodcastEpisodes(l.db, limit)
+}
+
+func (l *LocalDBClient) RecordTTSUsage(provider string, month time.Time, characters int, costUSD float64) error {
+	return recordTTSUsage(l.db, provider, month, characters, costUSD)
+}
+
+func (l *LocalDBClient) GetTTSUsage(month time.Time) ([]*TTSUsage, error) {
+	return getTTSUsage(l.db, month)
+}
+
+func (l *LocalDBClient) RecordStageTimings(timings []*StageTiming) error {
+	return recordStageTimings(l.db, timings)
+}
+
+func (l *LocalDBClient) GetStageTimings(since time.Time) ([]*StageTiming, error) {
+	return getStageTimings(l.db, since)
+}
+
+func (l *LocalDBClient) GetPipelineControl() (*PipelineControl, error) {
+	return getPipelineControl(l.db)
+}
+
+func (l *LocalDBClient) SetPipelineControl(paused bool, reason string) (*PipelineControl, error) {
+	return setPipelineControl(l.db, paused, reason)
+}
+
+func (l *LocalDBClient) RecordProxyOutcomes(host string, successes int, failures int) error {
+	return recordProxyOutcomes(l.db, host, successes, failures)
+}
+
+func (l *LocalDBClient) GetProxyStats() ([]*ProxyStat, error) {
+	return getProxyStats(l.db)
+}
+
+func (l *LocalDBClient) BlacklistProxy(host string, reason string) error {
+	return blacklistProxy(l.db, host, reason)
+}
+
+func (l *LocalDBClient) ClearProxyBlacklist(host string) error {
+	return clearProxyBlacklist(l.db, host)
+}
+
+func (l *LocalDBClient) GetNewsletterSubscribers() ([]*NewsletterSubscriber, error) {
+	return getNewsletterSubscribers(l.db)
+}
+
+func (l *LocalDBClient) SetNewsletterSubscription(email string, subscribed bool) error {
+	return setNewsletterSubscription(l.db, email, subscribed)
+}
+
+func (l *LocalDBClient) GetNewsletterDelivery(kind string, issueId string) (*NewsletterDelivery, error) {
+	return getNewsletterDelivery(l.db, kind, issueId)
+}
+
+func (l *LocalDBClient) SaveNewsletterDelivery(delivery *NewsletterDelivery) error {
+	return saveNewsletterDelivery(l.db, delivery)
+}
+
+func (l *LocalDBClient) GetNewsletterRecipients(kind string, issueId string) ([]*NewsletterRecipient, error) {
+	return getNewsletterRecipients(l.db, kind, issueId)
+}
+
+func (l *LocalDBClient) SaveNewsletterRecipient(recipient *NewsletterRecipient) error {
+	return saveNewsletterRecipient(l.db, recipient)
+}
+
+func (l *LocalDBClient) Ping(ctx context.Context) error {
+	return pingDatabase(ctx, l.db)
+}
+
+func (l *LocalDBClient) ListCategories() ([]Category, error) {
+	return listCategories(l.db)
+}
+
+func (l *LocalDBClient) AddCategory(name string) (*Category, error) {
+	return addCategory(l.db, name)
+}
+
+func (l *LocalDBClient) SeedCategories() (int64, error) {
+	return seedCategories(l.db)
+}
+
+// SimilarityConfig controls when a trending keyword counts as already covered
+type SimilarityConfig struct {
+	Threshold float64       // Minimum trigram similarity for two keywords to match
+	Window    time.Duration // How far back to look for articles with matching keywords
+}
+
+var defaultSimilarityConfig = SimilarityConfig{
+	Threshold: 0.8,
+	Window:    24 * time.Hour,
+}
+
+// loadSimilarityConfig reads SIMILARITY_THRESHOLD and SIMILARITY_WINDOW, then
+// applies per-mode overrides such as SIMILARITY_WINDOW_RECENT=6h
+func loadSimilarityConfig(mode string) (SimilarityConfig, error) {
+	config := defaultSimilarityConfig
+	suffix := "_" + strings.ToUpper(mode)
+	var err error
+
+	for _, key := range []string{"SIMILARITY_THRESHOLD", "SIMILARITY_THRESHOLD" + suffix} {
+		if config.Threshold, err = getEnvFloat(key, config.Threshold); err != nil {
+			return config, err
+		}
+		if config.Threshold <= 0 || config.Threshold > 1 {
+			return config, fmt.Errorf("%s must be between 0 and 1, got %v", key, config.Threshold)
+		}
+	}
+	for _, key := range []string{"SIMILARITY_WINDOW", "SIMILARITY_WINDOW" + suffix} {
+		if config.Window, err = getEnvDuration(key, config.Window); err != nil {
+			return config, err
+		}
+		if config.Window <= 0 {
+			return config, fmt.Errorf("%s must be positive, got %v", key, config.Window)
+		}
+	}
+
+	return config, nil
+}
+
+// checkSimilarKeywords reports whether an article created within the configured window has a
+// keyword matching or closely resembling the given keyword once both are normalized
+func checkSimilarKeywords(db *gorm.DB, keyword string, config SimilarityConfig) (bool, error) {
+	timeThreshold := dbTime(appNow().Add(-config.Window))
+	normalized := NormalizeKeyword(keyword)
+
+	// Keywords are stored as written, by this pipeline and the frontend alike,
+	// so both sides are normalized here rather than compared in SQL
+	var recent []NewsArticle
+	if err := db.Select("keywords").Where("\"createdAt\" > ?", timeThreshold).Find(&recent).Error; err != nil {
+		return false, fmt.Errorf("error checking similar keywords: %v", err)
+	}
+	for _, article := range recent {
+		if similarKeyword(article.Keywords, normalized, config.Threshold) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getArticlesSince returns articles created after the given time, newest first
+func getArticlesSince(db *gorm.DB, since time.Time, filters ArticleFilters) ([]*NewsArticle, error) {
+	query := db.Model(&NewsArticle{}).Where("\"createdAt\" > ?", dbTime(since))
+
+	if filters.PublishedOnly {
+		query = query.Where("published = ?", true)
+	}
+	if len(filters.CategoryIds) > 0 {
+		query = query.Where("\"categoryId\" IN ?", filters.CategoryIds)
+	}
+	if filters.Limit > 0 {
+		query = query.Limit(filters.Limit)
+	}
+
+	var articles []*NewsArticle
+	if err := query.Order("\"createdAt\" DESC").Find(&articles).Error; err != nil {
+		return nil, fmt.Errorf("error fetching articles since %v: %v", since, err)
+	}
+
+	return articles, nil
+}
+
+// getArticleByID returns a single article by its UUID
+func getArticleByID(db *gorm.DB, id string) (*NewsArticle, error) {
+	articleId, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid article ID %q: %v", id, err)
+	}
+
+	var article NewsArticle
+	if err := db.First(&article, "id = ?", articleId).Error; err != nil {
+		return nil, fmt.Errorf("error fetching article %s: %v", id, err)
+	}
+
+	return &article, nil
+}
+
+// searchVectorSQL weights title matches above body matches. It must stay
+// immutable, since the generated searchVector column is defined with it.
+const searchVectorSQL = `setweight(to_tsvector('english', coalesce(title, '')), 'A') || setweight(to_tsvector('english', coalesce(body, '')), 'B')`
+
+// searchArticles returns articles matching a web-style search query
+// (quoted phrases, "or", -exclusions), best matches first
+func searchArticles(db *gorm.DB, query string, filters ArticleFilters) ([]*NewsArticle, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("search query is required")
+	}
+
+	tsQuery := clause.Expr{SQL: "websearch_to_tsquery('english', ?)", Vars: []interface{}{query}}
+	search := db.Model(&NewsArticle{}).Where("\"searchVector\" @@ ?", tsQuery)
+
+	if filters.PublishedOnly {
+		search = search.Where("published = ?", true)
+	}
+	if len(filters.CategoryIds) > 0 {
+		search = search.Where("\"categoryId\" IN ?", filters.CategoryIds)
+	}
+	if filters.Limit > 0 {
+		search = search.Limit(filters.Limit)
+	}
+
+	var articles []*NewsArticle
+	err := search.Clauses(clause.OrderBy{
+		Expression: clause.Expr{SQL: "ts_rank(\"searchVector\", ?) DESC, \"createdAt\" DESC", Vars: []interface{}{tsQuery}},
+	}).Find(&articles).Error
+	if err != nil {
+		return nil, fmt.Errorf("error searching articles for %q: %v", query, err)
+	}
+
+	return articles, nil
+}
+
+// getArticlesBefore returns all articles created before the given time, oldest first.
+// Soft-deleted articles are included so retention cleanup purges them too.
+func getArticlesBefore(db *gorm.DB, before time.Time) ([]*NewsArticle, error) {
+	var articles []*NewsArticle
+	if err := db.Unscoped().Where("\"createdAt\" < ?", dbTime(before)).Order("\"createdAt\" ASC").Find(&articles).Error; err != nil {
+		return nil, fmt.Errorf("error fetching articles before %v: %v", before, err)
+	}
+	return articles, nil
+}
+
+// deleteArticles permanently removes articles along with any newsletter rows pointing at them
+func deleteArticles(db *gorm.DB, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("\"newsArticleId\" IN ?", ids).Delete(&DailyNewsletter{}).Error; err != nil {
+			return fmt.Errorf("error deleting newsletters for articles: %v", err)
+		}
+		if err := tx.Where("\"newsArticleId\" IN ?", ids).Delete(&GenerationMetadata{}).Error; err != nil {
+			return fmt.Errorf("error deleting generation metadata for articles: %v", err)
+		}
+		if err := tx.Where("\"newsArticleId\" IN ?", ids).Delete(&ImageGenerationMetadata{}).Error; err != nil {
+			return fmt.Errorf("error deleting image generation metadata for articles: %v", err)
+		}
+		if err := tx.Unscoped().Where("id IN ?", ids).Delete(&NewsArticle{}).Error; err != nil {
+			return fmt.Errorf("error deleting articles: %v", err)
+		}
+		return nil
+	})
+}
+
+// archiveArticles unpublishes articles and clears their media URLs
+func archiveArticles(db *gorm.DB, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	err := db.Model(&NewsArticle{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"published":    false,
+		"imageUrl":     nil,
+		"thumbnailUrl": nil,
+		"imageAvifUrl": nil,
+		"thumbnailAvifUrl": nil,
+		"imageSrcset": nil,
+		"imageAltText": nil,
+		"imageCaption": nil,
+		"imageCredit": nil,
+		"imageCreditUrl": nil,
+		"audioUrl":     nil,
+		"audioDurationSeconds": nil,
+		"transcriptUrl": nil,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("error archiving articles: %v", err)
+	}
+	return nil
+}
+
+// deleteOrphanedNewsletters removes newsletter rows whose article no longer exists
+func deleteOrphanedNewsletters(db *gorm.DB) (int64, error) {
+	result := db.Exec(`
+		DELETE FROM daily_newsletter
+		WHERE NOT EXISTS (
+			SELECT 1 FROM news_article WHERE news_article.id::text = daily_newsletter."newsArticleId"::text
+		)`)
+	if result.Error != nil {
+		return 0, fmt.Errorf("error deleting orphaned newsletters: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// deleteArticle soft-deletes an article so it is hidden but recoverable
+func deleteArticle(db *gorm.DB, id string) error {
+	articleId, err := uuid.Parse(id)
+	if err != nil {
+		return fmt.Errorf("invalid article ID %q: %v", id, err)
+	}
+
+	result := db.Delete(&NewsArticle{}, "id = ?", articleId)
+	if result.Error != nil {
+		return fmt.Errorf("error deleting article %s: %v", id, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("article %s not found", id)
+	}
+	return nil
+}
+
+// restoreArticle clears the soft-delete marker on an article
+func restoreArticle(db *gorm.DB, id string) error {
+	articleId, err := uuid.Parse(id)
+	if err != nil {
+		return fmt.Errorf("invalid article ID %q: %v", id, err)
+	}
+
+	result := db.Unscoped().Model(&NewsArticle{}).
+		Where("id = ? AND \"deletedAt\" IS NOT NULL", articleId).
+		Update("deletedAt", nil)
+	if result.Error != nil {
+		return fmt.Errorf("error restoring article %s: %v", id, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("no deleted article with ID %s", id)
+	}
+	return nil
+}
+
+// updateArticle applies the non-nil fields of update and returns the refreshed article
+func updateArticle(db *gorm.DB, id string, update ArticleUpdate) (*NewsArticle, error) {
+	article, err := getArticleByID(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]interface{})
+	if update.Title != nil {
+		changes["title"] = *update.Title
+	}
+	if update.Body != nil {
+		changes["body"] = *update.Body
+	}
+	if update.ImageUrl != nil {
+		changes["imageUrl"] = *update.ImageUrl
+	}
+	if update.ThumbnailUrl != nil {
+		changes["thumbnailUrl"] = *update.ThumbnailUrl
+	}
+	if update.AudioUrl != nil {
+		changes["audioUrl"] = *update.AudioUrl
+	}
+	if update.Published != nil {
+		changes["published"] = *update.Published
+	}
+	if len(changes) == 0 {
+		return article, nil
+	}
+
+	if err := db.Model(article).Updates(changes).Error; err != nil {
+		return nil, fmt.Errorf("error updating article %s: %v", id, err)
+	}
+
+	// Read back from the primary so replica lag can't return the stale row
+	return getArticleByID(db.Clauses(dbresolver.Write), id)
+}
+
+// hasDailyNewsletterSince reports whether a newsletter issue was already saved
+// after the given time. It reads the primary, since replica lag could let a
+// duplicate issue through.
+func hasDailyNewsletterSince(db *gorm.DB, since time.Time) (bool, error) {
+	var count int64
+	if err := db.Clauses(dbresolver.Write).Model(&DailyNewsletter{}).Where("\"createdAt\" >= ?", dbTime(since)).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("error checking for existing daily newsletter: %v", err)
+	}
+	return count > 0, nil
+}
+
+// getDailyNewsletterSince returns the newsletter issue saved after the given
+// time, or nil if there isn't one
+func getDailyNewsletterSince(db *gorm.DB, since time.Time) (*DailyNewsletter, error) {
+	var newsletter DailyNewsletter
+	err := db.Clauses(dbresolver.Write).Where("\"createdAt\" >= ?", dbTime(since)).Order("\"createdAt\" DESC").First(&newsletter).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading daily newsletter: %v", err)
+	}
+	return &newsletter, nil
+}
+
+// saveWeeklyDigest stores a weekly digest issue with its articles in ranked order
+func saveWeeklyDigest(db *gorm.DB, weekStart time.Time, articleIds []string, titleText string, previewText string, intro string) error {
+	digest := &WeeklyDigest{
+		ID:          uuid.New().String(),
+		WeekStart:   dbTime(weekStart),
+		ArticleIds:  pq.StringArray(articleIds),
+		TitleText:   titleText,
+		PreviewText: previewText,
+		Intro:       intro,
+	}
+	if err := db.Create(digest).Error; err != nil {
+		return fmt.Errorf("error saving weekly digest: %v", err)
+	}
+	return nil
+}
+
+// hasWeeklyDigestSince reports whether a digest was already saved for a week starting at or after the given time
+func hasWeeklyDigestSince(db *gorm.DB, since time.Time) (bool, error) {
+	var count int64
+	if err := db.Model(&WeeklyDigest{}).Where("\"weekStart\" >= ?", dbTime(since)).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("error checking for existing weekly digest: %v", err)
+	}
+	return count > 0, nil
+}
+
+// getWeeklyDigestSince returns the digest for the first week starting at or
+// after the given time, or nil if there isn't one
+func getWeeklyDigestSince(db *gorm.DB, since time.Time) (*WeeklyDigest, error) {
+	var digest WeeklyDigest
+	err := db.Clauses(dbresolver.Write).Where("\"weekStart\" >= ?", dbTime(since)).Order("\"weekStart\"").First(&digest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading weekly digest: %v", err)
+	}
+	return &digest, nil
+}
+
+// enqueuePipelineJobs adds pending jobs, claimed in the order given
+func enqueuePipelineJobs(db *gorm.DB, jobs []*PipelineJob) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+	now := appNow()
+	for i, job := range jobs {
+		if job.ID == uuid.Nil {
+			job.ID = uuid.New()
+		}
+		job.Status = jobPending
+		// Jobs are claimed oldest first, so spread a batch out to keep its order
+		job.CreatedAt = now.Add(time.Duration(i) * time.Microsecond)
+		job.UpdatedAt = job.CreatedAt
+		job.RunAfter = job.CreatedAt
+	}
+	if err := db.Create(jobs).Error; err != nil {
+		return fmt.Errorf("error enqueueing pipeline jobs: %v", err)
+	}
+	return nil
+}
+
+// claimPipelineJob marks the oldest pending job of a kind that is due as
+// running and returns it, or nil when there is none. Rows locked by another worker's
+// claim are skipped rather than waited on.
+func claimPipelineJob(db *gorm.DB, mode string, kind string) (*PipelineJob, error) {
+	var claimed *PipelineJob
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var jobs []*PipelineJob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("mode = ? AND kind = ? AND status = ? AND \"runAfter\" <= ?", mode, kind, jobPending, appNow()).
+			Order("\"createdAt\" ASC").Limit(1).Find(&jobs).Error
+		if err != nil || len(jobs) == 0 {
+			return err
+		}
+
+		job := jobs[0]
+		job.Status = jobRunning
+		job.Attempts++
+		job.UpdatedAt = appNow()
+		err = tx.Model(&PipelineJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+			"status":    job.Status,
+			"attempts":  job.Attempts,
+			"updatedAt": job.UpdatedAt,
+		}).Error
+		if err != nil {
+			return err
+		}
+		claimed = job
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error claiming %s job: %v", kind, err)
+	}
+	return claimed, nil
+}
+
+// checkpointPipelineJob saves a running job's progress so a restart resumes it
+func checkpointPipelineJob(db *gorm.DB, id uuid.UUID, payload string) error {
+	err := db.Model(&PipelineJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"payload":   payload,
+		"updatedAt": appNow(),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("error checkpointing pipeline job: %v", err)
+	}
+	return nil
+}
+
+// finishPipelineJob records a job's outcome, which for a retry puts it back
+// as pending until RunAfter, and enqueues the next stage's job, if any, in the
+// same transaction so a topic is never dropped between stages
+func finishPipelineJob(db *gorm.DB, job *PipelineJob, next *PipelineJob) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&PipelineJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+			"status":      job.Status,
+			"payload":     job.Payload,
+			"lastError":   job.LastError,
+			"failedStage": job.FailedStage,
+			"runAfter":    job.RunAfter,
+			"updatedAt":   appNow(),
+		}).Error
+		if err != nil || next == nil {
+			return err
+		}
+		return enqueuePipelineJobs(tx, []*PipelineJob{next})
+	})
+	if err != nil {
+		return fmt.Errorf("error finishing %s job for %s: %v", job.Kind, job.Keyword, err)
+	}
+	return nil
+}
+
+// getPipelineJobs returns a mode's jobs with any of the statuses (all when
+// empty), oldest first
+func getPipelineJobs(db *gorm.DB, mode string, statuses []string) ([]*PipelineJob, error) {
+	query := db.Where("mode = ?", mode)
+	if len(statuses) > 0 {
+		query = query.Where("status IN ?", statuses)
+	}
+	var jobs []*PipelineJob
+	if err := query.Order("\"createdAt\" ASC").Find(&jobs).Error; err != nil {
+		return nil, fmt.Errorf("error loading pipeline jobs: %v", err)
+	}
+	return jobs, nil
+}
+
+// requeueRunningPipelineJobs puts jobs left running by a crashed run back on the queue
+func requeueRunningPipelineJobs(db *gorm.DB, mode string) (int64, error) {
+	result := db.Model(&PipelineJob{}).Where("mode = ? AND status = ?", mode, jobRunning).Updates(map[string]interface{}{
+		"status":    jobPending,
+		"updatedAt": appNow(),
+	})
+	if result.Error != nil {
+		return 0, fmt.Errorf("error requeueing running pipeline jobs: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// deletePipelineJobs removes jobs whose articles were saved
+func deletePipelineJobs(db *gorm.DB, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := db.Where("id IN ?", ids).Delete(&PipelineJob{}).Error; err != nil {
+		return fmt.Errorf("error deleting pipeline jobs: %v", err)
+	}
+	return nil
+}
+
+// savePodcastEpisode stores an episode, replacing any earlier episode for the same day
+func savePodcastEpisode(db *gorm.DB, episode *PodcastEpisode) error {
+	if episode.ID == uuid.Nil {
+		episode.ID = uuid.New()
+	}
+	episode.EpisodeDate = dbTime(episode.EpisodeDate)
+	episode.UpdatedAt = appNow()
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "episodeDate"}},
+		DoUpdates: clause.AssignmentColumns([]string{"title", "description", "audioUrl", "audioBytes", "durationSeconds", "articleIds", "updatedAt"}),
+	}).Create(episode).Error
+	if err != nil {
+		return fmt.Errorf("error saving podcast episode: %v", err)
+	}
+	return nil
+}
+
+// getPodcastEpisodes returns the most recent episodes, newest first
+func getPodcastEpisodes(db *gorm.DB, limit int) ([]*PodcastEpisode, error) {
+	query := db.Order("\"episodeDate\" DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var episodes []*PodcastEpisode
+	if err := query.Find(&episodes).Error; err != nil {
+		return nil, fmt.Errorf("error loading podcast episodes: %v", err)
+	}
+	return episodes, nil
+}
+
+// recordTTSUsage adds characters synthesized by a provider to its total for the month
+func recordTTSUsage(db *gorm.DB, provider string, month time.Time, characters int, costUSD float64) error {
+	usage := &TTSUsage{
+		ID:         uuid.New(),
+		Provider:   provider,
+		Month:      dbTime(month),
+		Characters: int64(characters),
+		CostUSD:    costUSD,
+		UpdatedAt:  appNow(),
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "provider"}, {Name: "month"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"characters": gorm.Expr("tts_usage.characters + EXCLUDED.characters"),
+			"costUsd":    gorm.Expr(`tts_usage."costUsd" + EXCLUDED."costUsd"`),
+			"updatedAt":  gorm.Expr(`EXCLUDED."updatedAt"`),
+		}),
+	}).Create(usage).Error
+	if err != nil {
+		return fmt.Errorf("error recording TTS usage for %s: %v", provider, err)
+	}
+	return nil
+}
+
+// getTTSUsage returns every provider's usage for a month
+func getTTSUsage(db *gorm.DB, month time.Time) ([]*TTSUsage, error) {
+	var usage []*TTSUsage
+	if err := db.Where("month = ?", dbTime(month)).Order("provider").Find(&usage).Error; err != nil {
+		return nil, fmt.Errorf("error loading TTS usage: %v", err)
+	}
+	return usage, nil
+}
+
+// recordStageTimings saves a run's stage timings
+func recordStageTimings(db *gorm.DB, timings []*StageTiming) error {
+	if len(timings) == 0 {
+		return nil
+	}
+	for _, timing := range timings {
+		if timing.ID == uuid.Nil {
+			timing.ID = uuid.New()
+		}
+	}
+	if err := db.Create(timings).Error; err != nil {
+		return fmt.Errorf("error recording stage timings: %v", err)
+	}
+	return nil
+}
+
+// getStageTimings returns the timings recorded since a time, oldest first
+func getStageTimings(db *gorm.DB, since time.Time) ([]*StageTiming, error) {
+	var timings []*StageTiming
+	if err := db.Where(`"createdAt" >= ?`, dbTime(since)).Order(`"createdAt"`).Find(&timings).Error; err != nil {
+		return nil, fmt.Errorf("error loading stage timings: %v", err)
+	}
+	return timings, nil
+}
+
+// getPipelineControl returns the control row, unpaused when it hasn't been
+// written yet
+func getPipelineControl(db *gorm.DB) (*PipelineControl, error) {
+	var control PipelineControl
+	err := db.Clauses(dbresolver.Write).Where("id = ?", pipelineControlID).First(&control).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &PipelineControl{ID: pipelineControlID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading pipeline control: %v", err)
+	}
+	return &control, nil
+}
+
+// recordProxyOutcomes adds requests through a proxy to its totals
+func recordProxyOutcomes(db *gorm.DB, host string, successes int, failures int) error {
+	stat := &ProxyStat{Host: host, Successes: int64(successes), Failures: int64(failures), UpdatedAt: appNow()}
+	err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "host"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"successes": gorm.Expr("proxy_stats.successes + EXCLUDED.successes"),
+			"failures":  gorm.Expr("proxy_stats.failures + EXCLUDED.failures"),
+			"updatedAt": gorm.Expr(`EXCLUDED."updatedAt"`),
+		}),
+	}).Create(stat).Error
+	if err != nil {
+		return fmt.Errorf("error recording proxy outcomes for %s: %v", host, err)
+	}
+	return nil
+}
+
+// getProxyStats returns every proxy's totals, by host
+func getProxyStats(db *gorm.DB) ([]*ProxyStat, error) {
+	var stats []*ProxyStat
+	if err := db.Clauses(dbresolver.Write).Order("host").Find(&stats).Error; err != nil {
+		return nil, fmt.Errorf("error loading proxy stats: %v", err)
+	}
+	return stats, nil
+}
+
+// blacklistProxy keeps a proxy out of the pool until it is cleared
+func blacklistProxy(db *gorm.DB, host string, reason string) error {
+	now := appNow()
+	stat := &ProxyStat{Host: host, BlacklistedAt: &now, BlacklistReason: reason, UpdatedAt: now}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "host"}},
+		DoUpdates: clause.AssignmentColumns([]string{"blacklistedAt", "blacklistReason", "updatedAt"}),
+	}).Create(stat).Error
+	if err != nil {
+		return fmt.Errorf("error blacklisting proxy %s: %v", host, err)
+	}
+	return nil
+}
+
+// clearProxyBlacklist lets a proxy back into the pool with its totals reset,
+// so the failures that blacklisted it don't do so again straight away
+func clearProxyBlacklist(db *gorm.DB, host string) error {
+	result := db.Model(&ProxyStat{}).Where("host = ?", host).Updates(map[string]interface{}{
+		"successes":       0,
+		"failures":        0,
+		"blacklistedAt":   nil,
+		"blacklistReason": "",
+		"updatedAt":       appNow(),
+	})
+	if result.Error != nil {
+		return fmt.Errorf("error clearing proxy blacklist for %s: %v", host, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("no stats for proxy %s", host)
+	}
+	return nil
+}
+
+// getNewsletterSubscribers returns the subscribers who haven't unsubscribed,
+// oldest first
+func getNewsletterSubscribers(db *gorm.DB) ([]*NewsletterSubscriber, error) {
+	var subscribers []*NewsletterSubscriber
+	if err := db.Where(`"unsubscribedAt" IS NULL`).Order(`"createdAt"`).Find(&subscribers).Error; err != nil {
+		return nil, fmt.Errorf("error loading newsletter subscribers: %v", err)
+	}
+	return subscribers, nil
+}
+
+// setNewsletterSubscription subscribes an email address, or unsubscribes it
+// while keeping the row so the unsubscribe is remembered
+func setNewsletterSubscription(db *gorm.DB, email string, subscribed bool) error {
+	subscriber := &NewsletterSubscriber{ID: uuid.New(), Email: email, CreatedAt: appNow()}
+	if !subscribed {
+		now := appNow()
+		subscriber.UnsubscribedAt = &now
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "email"}},
+		DoUpdates: clause.AssignmentColumns([]string{"unsubscribedAt"}),
+	}).Create(subscriber).Error
+	if err != nil {
+		return fmt.Errorf("error saving newsletter subscription for %s: %v", email, err)
+	}
+	return nil
+}
+
+// getNewsletterDelivery returns how an issue was sent, or nil if it hasn't been
+func getNewsletterDelivery(db *gorm.DB, kind string, issueId string) (*NewsletterDelivery, error) {
+	var delivery NewsletterDelivery
+	err := db.Clauses(dbresolver.Write).Where(`kind = ? AND "issueId" = ?`, kind, issueId).First(&delivery).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading newsletter delivery: %v", err)
+	}
+	return &delivery, nil
+}
+
+// saveNewsletterDelivery records that an issue was sent
+func saveNewsletterDelivery(db *gorm.DB, delivery *NewsletterDelivery) error {
+	if delivery.ID == uuid.Nil {
+		delivery.ID = uuid.New()
+	}
+	if err := db.Create(delivery).Error; err != nil {
+		return fmt.Errorf("error saving newsletter delivery: %v", err)
+	}
+	return nil
+}
+
+// getNewsletterRecipients returns who an issue has been emailed to so far
+func getNewsletterRecipients(db *gorm.DB, kind string, issueId string) ([]*NewsletterRecipient, error) {
+	var recipients []*NewsletterRecipient
+	err := db.Clauses(dbresolver.Write).Where(`kind = ? AND "issueId" = ?`, kind, issueId).Find(&recipients).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading newsletter recipients: %v", err)
+	}
+	return recipients, nil
+}
+
+// saveNewsletterRecipient records that an issue was emailed to one address
+func saveNewsletterRecipient(db *gorm.DB, recipient *NewsletterRecipient) error {
+	if recipient.ID == uuid.Nil {
+		recipient.ID = uuid.New()
+	}
+	if err := db.Create(recipient).Error; err != nil {
+		return fmt.Errorf("error saving newsletter recipient: %v", err)
+	}
+	return nil
+}
+
+// setPipelineControl pauses or resumes the pipeline
+func setPipelineControl(db *gorm.DB, paused bool, reason string) (*PipelineControl, error) {
+	control := &PipelineControl{ID: pipelineControlID, Paused: paused, Reason: reason, UpdatedAt: appNow()}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"paused", "reason", "updatedAt"}),
+	}).Create(control).Error
+	if err != nil {
+		return nil, fmt.Errorf("error saving pipeline control: %v", err)
+	}
+	return control, nil
+}
+
+// pingDatabase checks the primary database answers a query. It goes through
+// the circuit breaker, so an open breaker fails the ping too.
+func pingDatabase(ctx context.Context, db *gorm.DB) error {
+	if err := db.WithContext(ctx).Clauses(dbresolver.Write).Exec("SELECT 1").Error; err != nil {
+		return fmt.Errorf("error pinging database: %v", err)
+	}
+	return nil
+}
+
+// saveKeywordDecision inserts a row into the keyword decision audit table
+func saveKeywordDecision(db *gorm.DB, decision *KeywordDecision) error {
+	if decision.ID == uuid.Nil {
+		decision.ID = uuid.New()
+	}
+	if err := db.Create(decision).Error; err != nil {
+		return fmt.Errorf("error saving keyword decision for '%s': %v", decision.Keyword, err)
+	}
+	return nil
+}
+
+// getKeywordDecisions returns the decisions with an outcome made in [from, to), oldest first
+func getKeywordDecisions(db *gorm.DB, from time.Time, to time.Time, decision string) ([]*KeywordDecision, error) {
+	var decisions []*KeywordDecision
+	err := db.Where("decision = ? AND \"createdAt\" >= ? AND \"createdAt\" < ?", decision, dbTime(from), dbTime(to)).
+		Order("\"createdAt\" ASC").Find(&decisions).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading keyword decisions: %v", err)
+	}
+	return decisions, nil
+}
+
 type DailyNewsletter struct {
 	ID            string      `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	NewsArticleId string      `gorm:"column:newsArticleId;unique"`
@@ -295,36 +2070,223 @@ func (DailyNewsletter) TableName() string {
 	return "daily_newsletter"
 }
 
-func initDB() error {
-	dbType := os.Getenv("DB_TYPE")
-	
-	switch dbType {
-	case "prod":
+// WeeklyDigest is a weekly recap issue listing the week's top articles, best first
+type WeeklyDigest struct {
+	ID          string         `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	WeekStart   time.Time      `gorm:"column:weekStart;not null;uniqueIndex"`
+	ArticleIds  pq.StringArray `gorm:"column:articleIds;type:text[];not null"`
+	TitleText   string         `gorm:"column:titleText;type:text"`
+	PreviewText string         `gorm:"column:previewText;type:text"`
+	Intro       string         `gorm:"column:intro;type:text"` // Opening paragraph of the email
+	CreatedAt   time.Time      `gorm:"column:createdAt;default:CURRENT_TIMESTAMP"`
+	Issue       int            `gorm:"column:issue;autoIncrement"`
+}
+
+func (WeeklyDigest) TableName() string {
+	return "weekly_digest"
+}
+
+// PipelineJob is one stage of a topic's trip through the pipeline: a topic
+// job searches, scrapes and summarizes, a generation job writes the article
+// and a media job renders and uploads its media. Finishing a job enqueues the
+// next stage's, so stages are retried and worked on independently.
+type PipelineJob struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Mode        string    `gorm:"not null;index:idx_pipeline_job_queue"`
+	Kind        string    `gorm:"not null;index:idx_pipeline_job_queue"`                 // "topic", "generation" or "media"
+	Status      string    `gorm:"not null;default:pending;index:idx_pipeline_job_queue"` // "pending", "running", "done" or "failed"
+	Keyword     string    `gorm:"not null"`
+	Payload     string    `gorm:"not null;type:jsonb"` // TopicJob as JSON
+	Attempts    int       `gorm:"not null;default:0"`
+	LastError   string    `gorm:"column:lastError;type:text"`
+	FailedStage string    `gorm:"column:failedStage"`                                 // Stage the last failure happened in, e.g. "scraped"
+	RunAfter    time.Time `gorm:"column:runAfter;not null;default:CURRENT_TIMESTAMP"` // Retries aren't claimed before this
+	CreatedAt   time.Time `gorm:"column:createdAt;default:CURRENT_TIMESTAMP"`
+	UpdatedAt   time.Time `gorm:"column:updatedAt"`
+}
+
+func (PipelineJob) TableName() string {
+	return "pipeline_job"
+}
+
+// PodcastEpisode is a day's article audio joined into one episode of the podcast feed
+type PodcastEpisode struct {
+	ID              uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	EpisodeDate     time.Time      `gorm:"column:episodeDate;not null;uniqueIndex"` // Midnight of the episode's day in APP_TIMEZONE
+	Title           string         `gorm:"not null;type:text"`
+	Description     string         `gorm:"type:text"`
+	AudioUrl        string         `gorm:"column:audioUrl;not null"`
+	AudioBytes      int64          `gorm:"column:audioBytes"`
+	DurationSeconds int            `gorm:"column:durationSeconds"`
+	ArticleIds      pq.StringArray `gorm:"column:articleIds;type:text[];not null"` // Articles in episode order
+	CreatedAt       time.Time      `gorm:"column:createdAt;default:CURRENT_TIMESTAMP"`
+	UpdatedAt       time.Time      `gorm:"column:updatedAt"`
+}
+
+func (PodcastEpisode) TableName() string {
+	return "podcast_episode"
+}
+
+// TTSUsage is what a TTS provider has synthesized in a calendar month, checked
+// against TTS_MONTHLY_BUDGETS by the provider chain
+type TTSUsage struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Provider   string    `gorm:"not null;uniqueIndex:idx_tts_usage_provider_month"`
+	Month      time.Time `gorm:"not null;uniqueIndex:idx_tts_usage_provider_month"` // Midnight on the 1st in APP_TIMEZONE
+	Characters int64     `gorm:"not null;default:0"`
+	CostUSD    float64   `gorm:"column:costUsd;not null;default:0"` // Estimated from the provider's list price
+	UpdatedAt  time.Time `gorm:"column:updatedAt"`
+}
+
+func (TTSUsage) TableName() string {
+	return "tts_usage"
+}
+
+// StageTiming is how long one stage took on one topic in a run, or on the
+// whole run for stages such as saving that aren't done per topic
+type StageTiming struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RunID      string    `gorm:"column:runId;not null;index"`
+	Mode       string    `gorm:"not null"`
+	Keyword    string    `gorm:"not null"` // Empty for stages of the whole run
+	Stage      string    `gorm:"not null"`
+	DurationMs int64     `gorm:"column:durationMs;not null"`
+	CreatedAt  time.Time `gorm:"column:createdAt;default:CURRENT_TIMESTAMP;index"`
+}
+
+func (StageTiming) TableName() string {
+	return "stage_timing"
+}
+
+// pipelineControlID is the ID of the one pipeline_control row
+const pipelineControlID = 1
+
+// PipelineControl is the pipeline's kill switch, one row shared by every
+// deployment using the database. While paused no run starts and runs in
+// progress take no new topics.
+type PipelineControl struct {
+	ID        int       `gorm:"primary_key;autoIncrement:false"`
+	Paused    bool      `gorm:"not null;default:false"`
+	Reason    string    `gorm:"type:text"`
+	UpdatedAt time.Time `gorm:"column:updatedAt"`
+}
+
+func (PipelineControl) TableName() string {
+	return "pipeline_control"
+}
+
+// ProxyStat counts the requests made through one proxy, keyed by its
+// address without credentials so totals survive the provider rotating them
+type ProxyStat struct {
+	Host            string     `gorm:"primary_key"`
+	Successes       int64      `gorm:"not null;default:0"`
+	Failures        int64      `gorm:"not null;default:0"`
+	BlacklistedAt   *time.Time `gorm:"column:blacklistedAt"` // Set while the proxy is kept out of the pool
+	BlacklistReason string     `gorm:"column:blacklistReason;type:text"`
+	UpdatedAt       time.Time  `gorm:"column:updatedAt"`
+}
+
+func (ProxyStat) TableName() string {
+	return "proxy_stats"
+}
+
+// NewsletterSubscriber is an email address the newsletters are sent to
+type NewsletterSubscriber struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Email          string     `gorm:"not null;uniqueIndex"`
+	CreatedAt      time.Time  `gorm:"column:createdAt;default:CURRENT_TIMESTAMP"`
+	UnsubscribedAt *time.Time `gorm:"column:unsubscribedAt"`
+}
+
+func (NewsletterSubscriber) TableName() string {
+	return "newsletter_subscriber"
+}
+
+// NewsletterDelivery records an issue having been emailed to every
+// subscriber, so reruns don't look at it again
+type NewsletterDelivery struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Kind       string    `gorm:"not null;uniqueIndex:idx_newsletter_delivery_issue"` // "daily" or "weekly"
+	IssueId    string    `gorm:"column:issueId;not null;uniqueIndex:idx_newsletter_delivery_issue"`
+	Recipients int       `gorm:"not null"`
+	Failures   int       `gorm:"not null;default:0"` // Recipients the provider didn't accept
+	SentAt     time.Time `gorm:"column:sentAt;not null"`
+}
+
+func (NewsletterDelivery) TableName() string {
+	return "newsletter_delivery"
+}
+
+// NewsletterRecipient records an issue being emailed to one address, saved as
+// each email is sent so a run cut short partway through never emails anyone
+// twice
+type NewsletterRecipient struct {
+	ID      uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Kind    string    `gorm:"not null;uniqueIndex:idx_newsletter_recipient_issue"` // "daily" or "weekly"
+	IssueId string    `gorm:"column:issueId;not null;uniqueIndex:idx_newsletter_recipient_issue"`
+	Email   string    `gorm:"not null;uniqueIndex:idx_newsletter_recipient_issue"`
+	SentAt  time.Time `gorm:"column:sentAt;not null"`
+}
+
+func (NewsletterRecipient) TableName() string {
+	return "newsletter_recipient"
+}
+
+// DBClientFactory creates a DBClient for a DB_TYPE value
+type DBClientFactory func() (DBClient, error)
+
+// dbBackends maps DB_TYPE values to the factories that create their clients
+var dbBackends = make(map[string]DBClientFactory)
+
+// RegisterDBBackend makes a DBClient implementation selectable through DB_TYPE
+func RegisterDBBackend(name string, factory DBClientFactory) {
+	if _, exists := dbBackends[name]; exists {
+		panic(fmt.Sprintf("database backend %q registered twice", name))
+	}
+	dbBackends[name] = factory
+}
+
+func init() {
+	RegisterDBBackend("prod", func() (DBClient, error) {
 		dbURL := os.Getenv("SUPABASE_URL")
 		if dbURL == "" {
-			return fmt.Errorf("SUPABASE_URL environment variable is not set")
+			return nil, fmt.Errorf("SUPABASE_URL environment variable is not set")
 		}
 		apiKey := os.Getenv("SUPABASE_ANON_KEY")
 		if apiKey == "" {
-			return fmt.Errorf("SUPABASE_ANON_KEY environment variable is not set")
+			return nil, fmt.Errorf("SUPABASE_ANON_KEY environment variable is not set")
 		}
 		client, err := NewSupabaseClient(dbURL, apiKey)
 		if err != nil {
-			return fmt.Errorf("error initializing Supabase client: %v", err)
+			return nil, fmt.Errorf("error initializing Supabase client: %v", err)
 		}
-		dbClient = client
-		
-	case "local", "":
+		return client, nil
+	})
+	RegisterDBBackend("local", func() (DBClient, error) {
 		localClient, err := NewLocalDBClient()
 		if err != nil {
-			return fmt.Errorf("error initializing local database: %v", err)
+			return nil, fmt.Errorf("error initializing local database: %v", err)
 		}
-		dbClient = localClient
-		
-	default:
+		return localClient, nil
+	})
+}
+
+func initDB() error {
+	dbType := os.Getenv("DB_TYPE")
+	if dbType == "" {
+		dbType = "local"
+	}
+
+	factory, ok := dbBackends[dbType]
+	if !ok {
 		return fmt.Errorf("unknown database type: %s", dbType)
 	}
-	
+	client, err := factory()
+	if err != nil {
+		return err
+	}
+	dbClient = client
+
 	return nil
 }
 
@@ -334,8 +2296,12 @@ func selectDailyNewsletterArticle(articles []*NewsArticle) (string, string, stri
 	var articleMapping = make(map[int]*NewsArticle) // Add mapping to preserve article order
 
 	for i, article := range articles {
+		categoryId := otherCategoryId // Articles loaded from the database may have no category; treat as "Other"
+		if article.CategoryId != nil {
+			categoryId = *article.CategoryId
+		}
 		articleTexts = append(articleTexts, fmt.Sprintf("Article %d:\nTitle: %s\nBody: %s\nCategory: %d", 
-			i+1, article.Title, article.Body, *article.CategoryId))
+			i+1, article.Title, article.Body, categoryId))
 		articleMapping[i+1] = article // Store with 1-based index to match prompt
 	}
 
@@ -353,7 +2319,7 @@ Respond in this JSON format:
     "previewText": "Compelling preview text (max 150 chars)"
 }`, strings.Join(articleTexts, "\n\n"), len(articles))
 
-	response, err := queryGeminiForArticle(prompt)
+	response, err := queryGeminiForArticle(context.Background(), prompt)
 	if err != nil {
 		return "", "", "", fmt.Errorf("error querying Gemini: %v", err)
 	}
@@ -365,6 +2331,7 @@ Respond in this JSON format:
 	}
 
 	if err := json.Unmarshal([]byte(response), &result); err != nil {
+		reportLLMParseError("newsletter", response, err)
 		return "", "", "", fmt.Errorf("error parsing Gemini response: %v", err)
 	}
 
@@ -0,0 +1,577 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RunDBClientConformance exercises a DBClient against the behavior the
+// pipeline relies on, so every backend (Postgres, in-memory, future ones) can
+// be checked with the same suite. It writes its own uniquely named rows and
+// hard-deletes them afterwards, but should still only be pointed at a
+// disposable database.
+func RunDBClientConformance(client DBClient) error {
+	runId := uuid.New().String()[:8]
+	keyword := "conformance check " + runId
+	var created []uuid.UUID
+	defer func() {
+		if err := client.DeleteArticles(created); err != nil {
+			slog.Warn("Failed to clean up conformance articles", "error", err)
+		}
+	}()
+
+	if err := client.Ping(context.Background()); err != nil {
+		return fmt.Errorf("Ping: %v", err)
+	}
+
+	start := time.Now().Add(-time.Second)
+	generated := &GeneratedArticle{
+		Title:      "Conformance Check " + runId,
+		Article:    "Body written by the DBClient conformance suite.",
+		Keyword:    keyword,
+		Keywords:   []string{keyword, "Conformance Checks"},
+		CategoryId: 18,
+		URLTitle:   "conformance-check-" + runId,
+	}
+	assets := NewsMediaAssets{ImagePath: "image.webp", ThumbnailPath: "thumb.webp", AudioPath: "audio.mp3", AudioDurationSeconds: 42, TranscriptPath: "audio.vtt",
+		ImageGeneration: &ImageGenerationInfo{Prompt: "A photo of a test", Provider: "imagen", Model: imagenModel}}
+
+	// Saving
+	saved, err := client.SaveArticle(generated, assets, true)
+	if err != nil {
+		return fmt.Errorf("SaveArticle: %v", err)
+	}
+	created = append(created, saved.ID)
+	if saved.ID == uuid.Nil {
+		return fmt.Errorf("SaveArticle: returned article has no ID")
+	}
+	if !contains(saved.Keywords, "Conformance Checks") {
+		return fmt.Errorf("SaveArticle: keywords %v were not stored as written", saved.Keywords)
+	}
+	if saved.AudioDurationSeconds == nil || *saved.AudioDurationSeconds != 42 {
+		return fmt.Errorf("SaveArticle: audio duration was not stored")
+	}
+	if saved.TranscriptUrl == nil || *saved.TranscriptUrl != "audio.vtt" {
+		return fmt.Errorf("SaveArticle: transcript URL was not stored")
+	}
+
+	generated.Title = "Conformance Check " + runId + " (retried)"
+	resaved, err := client.SaveArticle(generated, assets, true)
+	if err != nil {
+		return fmt.Errorf("SaveArticle retry: %v", err)
+	}
+	if resaved.ID != saved.ID {
+		return fmt.Errorf("SaveArticle retry: expected upsert onto %s, got new article %s", saved.ID, resaved.ID)
+	}
+
+	// Bulk saving, including a bundle that repeats the first article's urlTitle
+	// and one without media, as when audio and images are disabled
+	second := *generated
+	second.Title = "Conformance Check " + runId + " (second)"
+	second.URLTitle = "conformance-check-second-" + runId
+	bulk, err := client.SaveArticles([]ArticleBundle{
+		{Article: &second, MediaAssets: NewsMediaAssets{}, ImageSuccess: false},
+		{Article: generated, MediaAssets: assets, ImageSuccess: true},
+	})
+	if err != nil {
+		return fmt.Errorf("SaveArticles: %v", err)
+	}
+	if len(bulk) != 2 {
+		return fmt.Errorf("SaveArticles: expected 2 articles, got %d", len(bulk))
+	}
+	created = append(created, bulk[0].ID)
+	if bulk[0].Title != second.Title {
+		return fmt.Errorf("SaveArticles: results are not in input order")
+	}
+	if bulk[0].ImageUrl != nil || bulk[0].AudioUrl != nil || bulk[0].UseImage {
+		return fmt.Errorf("SaveArticles: article without media was stored with media URLs")
+	}
+	if bulk[1].ID != saved.ID {
+		return fmt.Errorf("SaveArticles: expected upsert onto %s, got new article %s", saved.ID, bulk[1].ID)
+	}
+
+	// Reading
+	fetched, err := client.GetArticleByID(saved.ID.String())
+	if err != nil {
+		return fmt.Errorf("GetArticleByID: %v", err)
+	}
+	if fetched.Title != generated.Title {
+		return fmt.Errorf("GetArticleByID: expected title %q, got %q", generated.Title, fetched.Title)
+	}
+	if _, err := client.GetArticleByID("not-a-uuid"); err == nil {
+		return fmt.Errorf("GetArticleByID: expected an error for an invalid ID")
+	}
+
+	articles, err := client.GetArticlesSince(start, ArticleFilters{PublishedOnly: true, CategoryIds: []int{18}})
+	if err != nil {
+		return fmt.Errorf("GetArticlesSince: %v", err)
+	}
+	if !containsArticle(articles, saved.ID) {
+		return fmt.Errorf("GetArticlesSince: saved article missing from results")
+	}
+
+	found, err := client.SearchArticles("conformance "+runId, ArticleFilters{Limit: 10})
+	if err != nil {
+		return fmt.Errorf("SearchArticles: %v", err)
+	}
+	if !containsArticle(found, saved.ID) {
+		return fmt.Errorf("SearchArticles: saved article missing from results")
+	}
+
+	similar, err := client.CheckSimilarKeywords("Conformance Check "+runId+".", defaultSimilarityConfig)
+	if err != nil {
+		return fmt.Errorf("CheckSimilarKeywords: %v", err)
+	}
+	if !similar {
+		return fmt.Errorf("CheckSimilarKeywords: expected a match for a differently punctuated keyword")
+	}
+	similar, err = client.CheckSimilarKeywords("Conformance Chek "+runId, defaultSimilarityConfig)
+	if err != nil {
+		return fmt.Errorf("CheckSimilarKeywords: %v", err)
+	}
+	if !similar {
+		return fmt.Errorf("CheckSimilarKeywords: expected a match for a misspelled keyword")
+	}
+
+	// Updating
+	title := "Conformance Check " + runId + " (updated)"
+	updated, err := client.UpdateArticle(saved.ID.String(), ArticleUpdate{Title: &title})
+	if err != nil {
+		return fmt.Errorf("UpdateArticle: %v", err)
+	}
+	if updated.Title != title {
+		return fmt.Errorf("UpdateArticle: expected title %q, got %q", title, updated.Title)
+	}
+
+	// Soft delete and restore
+	if err := client.DeleteArticle(saved.ID.String()); err != nil {
+		return fmt.Errorf("DeleteArticle: %v", err)
+	}
+	if _, err := client.GetArticleByID(saved.ID.String()); err == nil {
+		return fmt.Errorf("DeleteArticle: deleted article is still returned by GetArticleByID")
+	}
+	if err := client.RestoreArticle(saved.ID.String()); err != nil {
+		return fmt.Errorf("RestoreArticle: %v", err)
+	}
+	if _, err := client.GetArticleByID(saved.ID.String()); err != nil {
+		return fmt.Errorf("RestoreArticle: restored article not found: %v", err)
+	}
+
+	// A save repeating a deleted article's urlTitle is a new article, not the deleted one
+	removed := *generated
+	removed.URLTitle = "conformance-check-deleted-" + runId
+	deleted, err := client.SaveArticle(&removed, assets, true)
+	if err != nil {
+		return fmt.Errorf("SaveArticle: %v", err)
+	}
+	created = append(created, deleted.ID)
+	if err := client.DeleteArticle(deleted.ID.String()); err != nil {
+		return fmt.Errorf("DeleteArticle: %v", err)
+	}
+	newer, err := client.SaveArticle(&removed, assets, true)
+	if err != nil {
+		return fmt.Errorf("SaveArticle after delete: %v", err)
+	}
+	created = append(created, newer.ID)
+	if newer.ID == deleted.ID {
+		return fmt.Errorf("SaveArticle after delete: saved into the deleted article %s", deleted.ID)
+	}
+	if _, err := client.GetArticleByID(newer.ID.String()); err != nil {
+		return fmt.Errorf("SaveArticle after delete: new article not found: %v", err)
+	}
+
+	// Newsletters
+	if err := client.SaveDailyNewsletter(saved.ID.String(), "Title", "Preview"); err != nil {
+		return fmt.Errorf("SaveDailyNewsletter: %v", err)
+	}
+	exists, err := client.HasDailyNewsletterSince(start)
+	if err != nil {
+		return fmt.Errorf("HasDailyNewsletterSince: %v", err)
+	}
+	if !exists {
+		return fmt.Errorf("HasDailyNewsletterSince: saved newsletter not found")
+	}
+	newsletter, err := client.GetDailyNewsletterSince(start)
+	if err != nil {
+		return fmt.Errorf("GetDailyNewsletterSince: %v", err)
+	}
+	if newsletter == nil || newsletter.NewsArticleId != saved.ID.String() || newsletter.TitleText != "Title" {
+		return fmt.Errorf("GetDailyNewsletterSince: saved newsletter not returned: %+v", newsletter)
+	}
+
+	// A delivery is recorded once per issue
+	delivered, err := client.GetNewsletterDelivery("conformance", newsletter.ID)
+	if err != nil {
+		return fmt.Errorf("GetNewsletterDelivery: %v", err)
+	}
+	if delivered != nil {
+		return fmt.Errorf("GetNewsletterDelivery: unsent issue has a delivery: %+v", delivered)
+	}
+	if err := client.SaveNewsletterDelivery(&NewsletterDelivery{Kind: "conformance", IssueId: newsletter.ID, Recipients: 3, Failures: 1, SentAt: time.Now()}); err != nil {
+		return fmt.Errorf("SaveNewsletterDelivery: %v", err)
+	}
+	delivered, err = client.GetNewsletterDelivery("conformance", newsletter.ID)
+	if err != nil {
+		return fmt.Errorf("GetNewsletterDelivery: %v", err)
+	}
+	if delivered == nil || delivered.Recipients != 3 || delivered.Failures != 1 {
+		return fmt.Errorf("SaveNewsletterDelivery: delivery was not saved: %+v", delivered)
+	}
+	if err := client.SaveNewsletterDelivery(&NewsletterDelivery{Kind: "conformance", IssueId: newsletter.ID, Recipients: 3, SentAt: time.Now()}); err == nil {
+		return fmt.Errorf("SaveNewsletterDelivery: a second delivery of the same issue was saved")
+	}
+
+	// Each recipient is recorded once per issue
+	recipient := &NewsletterRecipient{Kind: "conformance", IssueId: newsletter.ID, Email: "reader@example.com", SentAt: time.Now()}
+	if err := client.SaveNewsletterRecipient(recipient); err != nil {
+		return fmt.Errorf("SaveNewsletterRecipient: %v", err)
+	}
+	recipients, err := client.GetNewsletterRecipients("conformance", newsletter.ID)
+	if err != nil {
+		return fmt.Errorf("GetNewsletterRecipients: %v", err)
+	}
+	if len(recipients) != 1 || recipients[0].Email != recipient.Email {
+		return fmt.Errorf("GetNewsletterRecipients: expected only %s, got %+v", recipient.Email, recipients)
+	}
+	if err := client.SaveNewsletterRecipient(&NewsletterRecipient{Kind: "conformance", IssueId: newsletter.ID, Email: recipient.Email, SentAt: time.Now()}); err == nil {
+		return fmt.Errorf("SaveNewsletterRecipient: the same recipient of an issue was saved twice")
+	}
+
+	// Subscriptions; the address is left unsubscribed so a real database
+	// never emails it
+	subscriberEmail := "conformance-" + saved.ID.String() + "@example.invalid"
+	if err := client.SetNewsletterSubscription(subscriberEmail, true); err != nil {
+		return fmt.Errorf("SetNewsletterSubscription: %v", err)
+	}
+	subscribed, err := newsletterSubscribed(client, subscriberEmail)
+	if err != nil {
+		return err
+	}
+	if !subscribed {
+		return fmt.Errorf("SetNewsletterSubscription: subscriber not listed")
+	}
+	if err := client.SetNewsletterSubscription(subscriberEmail, false); err != nil {
+		return fmt.Errorf("SetNewsletterSubscription: %v", err)
+	}
+	if subscribed, err = newsletterSubscribed(client, subscriberEmail); err != nil {
+		return err
+	}
+	if subscribed {
+		return fmt.Errorf("SetNewsletterSubscription: unsubscribed address still listed")
+	}
+
+	// Weekly digests, dated in the past so the row can't stand in for a real week's issue
+	weekStart := time.Date(2000, 1, 3, 0, 0, 0, 0, time.UTC).Add(time.Duration(saved.ID.ID()%(365*24*3600)) * time.Second)
+	if err := client.SaveWeeklyDigest(weekStart, []string{saved.ID.String()}, "Title", "Preview", "Intro"); err != nil {
+		return fmt.Errorf("SaveWeeklyDigest: %v", err)
+	}
+	exists, err = client.HasWeeklyDigestSince(weekStart)
+	if err != nil {
+		return fmt.Errorf("HasWeeklyDigestSince: %v", err)
+	}
+	if !exists {
+		return fmt.Errorf("HasWeeklyDigestSince: saved digest not found")
+	}
+	digest, err := client.GetWeeklyDigestSince(weekStart)
+	if err != nil {
+		return fmt.Errorf("GetWeeklyDigestSince: %v", err)
+	}
+	if digest == nil || len(digest.ArticleIds) != 1 || digest.ArticleIds[0] != saved.ID.String() || digest.Intro != "Intro" {
+		return fmt.Errorf("GetWeeklyDigestSince: saved digest not returned: %+v", digest)
+	}
+
+	// Keyword audit
+	if err := client.SaveKeywordDecision(&KeywordDecision{Keyword: keyword, Mode: "conformance", Decision: KeywordAccepted}); err != nil {
+		return fmt.Errorf("SaveKeywordDecision: %v", err)
+	}
+	decisions, err := client.GetKeywordDecisions(start, appNow().Add(time.Minute), KeywordAccepted)
+	if err != nil {
+		return fmt.Errorf("GetKeywordDecisions: %v", err)
+	}
+	recorded := false
+	for _, decision := range decisions {
+		recorded = recorded || decision.Keyword == keyword
+	}
+	if !recorded {
+		return fmt.Errorf("GetKeywordDecisions: saved decision for %s not found", keyword)
+	}
+
+	// Categories
+	if _, err := client.SeedCategories(); err != nil {
+		return fmt.Errorf("SeedCategories: %v", err)
+	}
+	categories, err := client.ListCategories()
+	if err != nil {
+		return fmt.Errorf("ListCategories: %v", err)
+	}
+	if validCategoryId(otherCategoryId, categories) != otherCategoryId {
+		return fmt.Errorf("SeedCategories: default \"Other\" category missing after seeding")
+	}
+
+	// Pipeline jobs, under a mode no real run uses
+	topicJob := &PipelineJob{Mode: "conformance", Kind: jobTopic, Keyword: keyword, Payload: `{"stage": ""}`}
+	if err := client.EnqueuePipelineJobs([]*PipelineJob{topicJob}); err != nil {
+		return fmt.Errorf("EnqueuePipelineJobs: %v", err)
+	}
+	claimed, err := client.ClaimPipelineJob("conformance", jobTopic)
+	if err != nil {
+		return fmt.Errorf("ClaimPipelineJob: %v", err)
+	}
+	if claimed == nil || claimed.ID != topicJob.ID || claimed.Status != jobRunning || claimed.Attempts != 1 {
+		return fmt.Errorf("ClaimPipelineJob: expected job %s to be claimed, got %+v", topicJob.ID, claimed)
+	}
+	if again, err := client.ClaimPipelineJob("conformance", jobTopic); err != nil || again != nil {
+		return fmt.Errorf("ClaimPipelineJob: running job claimed twice: %+v, %v", again, err)
+	}
+	if err := client.CheckpointPipelineJob(claimed.ID, `{"stage": "searched"}`); err != nil {
+		return fmt.Errorf("CheckpointPipelineJob: %v", err)
+	}
+	if requeued, err := client.RequeueRunningPipelineJobs("conformance"); err != nil || requeued < 1 {
+		return fmt.Errorf("RequeueRunningPipelineJobs: expected the running job requeued, got %d, %v", requeued, err)
+	}
+	if claimed, err = client.ClaimPipelineJob("conformance", jobTopic); err != nil || claimed == nil || claimed.ID != topicJob.ID {
+		return fmt.Errorf("ClaimPipelineJob: requeued job not claimed: %+v, %v", claimed, err)
+	}
+	if !strings.Contains(claimed.Payload, "searched") {
+		return fmt.Errorf("CheckpointPipelineJob: payload not saved: %s", claimed.Payload)
+	}
+	claimed.Status = jobDone
+	generationJob := &PipelineJob{Mode: "conformance", Kind: jobGeneration, Keyword: keyword, Payload: claimed.Payload}
+	if err := client.FinishPipelineJob(claimed, generationJob); err != nil {
+		return fmt.Errorf("FinishPipelineJob: %v", err)
+	}
+	retry, err := client.ClaimPipelineJob("conformance", jobGeneration)
+	if err != nil || retry == nil || retry.ID != generationJob.ID {
+		return fmt.Errorf("ClaimPipelineJob: enqueued next job not claimed: %+v, %v", retry, err)
+	}
+	retry.Status = jobPending
+	retry.LastError = "conformance failure"
+	retry.FailedStage = stageGenerated
+	retry.RunAfter = appNow().Add(time.Hour)
+	if err := client.FinishPipelineJob(retry, nil); err != nil {
+		return fmt.Errorf("FinishPipelineJob: %v", err)
+	}
+	if early, err := client.ClaimPipelineJob("conformance", jobGeneration); err != nil || early != nil {
+		return fmt.Errorf("ClaimPipelineJob: retry claimed before it was due: %+v, %v", early, err)
+	}
+	jobs, err := client.GetPipelineJobs("conformance", []string{jobPending, jobDone})
+	if err != nil {
+		return fmt.Errorf("GetPipelineJobs: %v", err)
+	}
+	statuses := make(map[uuid.UUID]string)
+	for _, job := range jobs {
+		statuses[job.ID] = job.Status
+	}
+	if statuses[topicJob.ID] != jobDone || statuses[generationJob.ID] != jobPending {
+		return fmt.Errorf("FinishPipelineJob: expected the topic job done and the generation job pending, got %v", statuses)
+	}
+	if err := client.DeletePipelineJobs([]uuid.UUID{topicJob.ID, generationJob.ID}); err != nil {
+		return fmt.Errorf("DeletePipelineJobs: %v", err)
+	}
+	if jobs, err = client.GetPipelineJobs("conformance", nil); err != nil {
+		return fmt.Errorf("GetPipelineJobs: %v", err)
+	}
+	for _, job := range jobs {
+		if job.ID == topicJob.ID || job.ID == generationJob.ID {
+			return fmt.Errorf("DeletePipelineJobs: job %s still queued", job.ID)
+		}
+	}
+
+	// Podcast episodes, dated in the past like the digest so the feed never lists them
+	episodeDate := weekStart.Add(-time.Duration(saved.ID.ID()%1000) * 24 * time.Hour)
+	episode := &PodcastEpisode{EpisodeDate: episodeDate, Title: "First", AudioUrl: "https://example.com/first.mp3", ArticleIds: []string{saved.ID.String()}}
+	if err := client.SavePodcastEpisode(episode); err != nil {
+		return fmt.Errorf("SavePodcastEpisode: %v", err)
+	}
+	replacement := &PodcastEpisode{EpisodeDate: episodeDate, Title: "Second", AudioUrl: "https://example.com/second.mp3", ArticleIds: []string{saved.ID.String()}}
+	if err := client.SavePodcastEpisode(replacement); err != nil {
+		return fmt.Errorf("SavePodcastEpisode: %v", err)
+	}
+	episodes, err := client.GetPodcastEpisodes(0)
+	if err != nil {
+		return fmt.Errorf("GetPodcastEpisodes: %v", err)
+	}
+	matches := 0
+	for _, candidate := range episodes {
+		if candidate.EpisodeDate.Equal(episodeDate) {
+			matches++
+			if candidate.Title != "Second" || candidate.AudioUrl != "https://example.com/second.mp3" {
+				return fmt.Errorf("SavePodcastEpisode: episode for the same day not replaced: %+v", candidate)
+			}
+		}
+	}
+	if matches != 1 {
+		return fmt.Errorf("GetPodcastEpisodes: expected one episode for %s, got %d", episodeDate.Format("2006-01-02"), matches)
+	}
+
+	// TTS usage accumulates per provider and month; the month is long past so
+	// repeated runs against a real database only ever add to this one row
+	usageMonth := time.Date(2000, time.January, 1, 0, 0, 0, 0, appLocation)
+	usageBefore, err := client.GetTTSUsage(usageMonth)
+	if err != nil {
+		return fmt.Errorf("GetTTSUsage: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := client.RecordTTSUsage("conformance", usageMonth, 1000, 0.5); err != nil {
+			return fmt.Errorf("RecordTTSUsage: %v", err)
+		}
+	}
+	after, err := client.GetTTSUsage(usageMonth)
+	if err != nil {
+		return fmt.Errorf("GetTTSUsage: %v", err)
+	}
+	if len(after) != 1 || after[0].Provider != "conformance" {
+		return fmt.Errorf("GetTTSUsage: expected one row for the month, got %d", len(after))
+	}
+	var previous int64
+	if len(usageBefore) == 1 {
+		previous = usageBefore[0].Characters
+	}
+	if after[0].Characters != previous+2000 {
+		return fmt.Errorf("RecordTTSUsage: characters %d were not added to %d", after[0].Characters, previous)
+	}
+
+	// Stage timings come back by time, with the ones recorded earlier left out
+	timingsSince := time.Now().Add(-time.Minute)
+	runID := uuid.NewString()
+	if err := client.RecordStageTimings([]*StageTiming{
+		{RunID: runID, Mode: "conformance", Keyword: "conformance", Stage: stageSearched, DurationMs: 1500, CreatedAt: time.Now()},
+		{RunID: runID, Mode: "conformance", Stage: stageSaved, DurationMs: 20, CreatedAt: time.Now()},
+	}); err != nil {
+		return fmt.Errorf("RecordStageTimings: %v", err)
+	}
+	timings, err := client.GetStageTimings(timingsSince)
+	if err != nil {
+		return fmt.Errorf("GetStageTimings: %v", err)
+	}
+	timed := 0
+	for _, timing := range timings {
+		if timing.RunID == runID {
+			timed++
+			if timing.Stage == stageSearched && timing.DurationMs != 1500 {
+				return fmt.Errorf("GetStageTimings: duration %d was not saved as 1500", timing.DurationMs)
+			}
+		}
+	}
+	if timed != 2 {
+		return fmt.Errorf("GetStageTimings: expected 2 timings for the run, got %d", timed)
+	}
+
+	// The kill switch round-trips and is left as it was found
+	controlBefore, err := client.GetPipelineControl()
+	if err != nil {
+		return fmt.Errorf("GetPipelineControl: %v", err)
+	}
+	if _, err := client.SetPipelineControl(true, "conformance"); err != nil {
+		return fmt.Errorf("SetPipelineControl: %v", err)
+	}
+	control, err := client.GetPipelineControl()
+	if err != nil {
+		return fmt.Errorf("GetPipelineControl: %v", err)
+	}
+	if !control.Paused || control.Reason != "conformance" {
+		return fmt.Errorf("SetPipelineControl: pause was not saved: %+v", control)
+	}
+	if _, err := client.SetPipelineControl(controlBefore.Paused, controlBefore.Reason); err != nil {
+		return fmt.Errorf("SetPipelineControl: %v", err)
+	}
+
+	// Proxy outcomes accumulate per host, and clearing a blacklist resets
+	// them; the host is cleared first so repeated runs start from zero
+	statHost := "conformance.invalid:8080"
+	if err := client.RecordProxyOutcomes(statHost, 0, 0); err != nil {
+		return fmt.Errorf("RecordProxyOutcomes: %v", err)
+	}
+	if err := client.ClearProxyBlacklist(statHost); err != nil {
+		return fmt.Errorf("ClearProxyBlacklist: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := client.RecordProxyOutcomes(statHost, 3, 1); err != nil {
+			return fmt.Errorf("RecordProxyOutcomes: %v", err)
+		}
+	}
+	if err := client.BlacklistProxy(statHost, "conformance"); err != nil {
+		return fmt.Errorf("BlacklistProxy: %v", err)
+	}
+	proxyStats, err := client.GetProxyStats()
+	if err != nil {
+		return fmt.Errorf("GetProxyStats: %v", err)
+	}
+	var proxyStat *ProxyStat
+	for _, stat := range proxyStats {
+		if stat.Host == statHost {
+			proxyStat = stat
+		}
+	}
+	if proxyStat == nil || proxyStat.Successes != 6 || proxyStat.Failures != 2 {
+		return fmt.Errorf("RecordProxyOutcomes: expected 6 successes and 2 failures, got %+v", proxyStat)
+	}
+	if proxyStat.BlacklistedAt == nil || proxyStat.BlacklistReason != "conformance" {
+		return fmt.Errorf("BlacklistProxy: blacklisting was not saved: %+v", proxyStat)
+	}
+	if err := client.ClearProxyBlacklist(statHost); err != nil {
+		return fmt.Errorf("ClearProxyBlacklist: %v", err)
+	}
+
+	// Retention
+	if err := client.ArchiveArticles([]uuid.UUID{saved.ID}); err != nil {
+		return fmt.Errorf("ArchiveArticles: %v", err)
+	}
+	archived, err := client.GetArticleByID(saved.ID.String())
+	if err != nil {
+		return fmt.Errorf("ArchiveArticles: %v", err)
+	}
+	if archived.Published || archived.ImageUrl != nil {
+		return fmt.Errorf("ArchiveArticles: article is still published or has media")
+	}
+
+	before, err := client.GetArticlesBefore(time.Now().Add(time.Second))
+	if err != nil {
+		return fmt.Errorf("GetArticlesBefore: %v", err)
+	}
+	if !containsArticle(before, saved.ID) {
+		return fmt.Errorf("GetArticlesBefore: saved article missing from results")
+	}
+
+	if err := client.DeleteArticles(created); err != nil {
+		return fmt.Errorf("DeleteArticles: %v", err)
+	}
+	created = nil
+	if _, err := client.GetArticleByID(saved.ID.String()); err == nil {
+		return fmt.Errorf("DeleteArticles: article still exists")
+	}
+	if _, err := client.DeleteOrphanedNewsletters(); err != nil {
+		return fmt.Errorf("DeleteOrphanedNewsletters: %v", err)
+	}
+
+	return nil
+}
+
+// containsArticle reports whether an article with the given ID is in the list
+func containsArticle(articles []*NewsArticle, id uuid.UUID) bool {
+	for _, article := range articles {
+		if article.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// newsletterSubscribed reports whether GetNewsletterSubscribers lists email
+func newsletterSubscribed(client DBClient, email string) (bool, error) {
+	subscribers, err := client.GetNewsletterSubscribers()
+	if err != nil {
+		return false, fmt.Errorf("GetNewsletterSubscribers: %v", err)
+	}
+	for _, subscriber := range subscribers {
+		if subscriber.Email == email {
+			return true, nil
+		}
+	}
+	return false, nil
+}
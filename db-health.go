@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var errDBCircuitOpen = errors.New("database unavailable: circuit breaker is open")
+
+// DBHealthConfig controls the periodic health check and circuit breaker
+type DBHealthConfig struct {
+	Interval         time.Duration // How often the connection is pinged
+	FailureThreshold int           // Consecutive connection failures before the breaker opens
+	Cooldown         time.Duration // How long the breaker stays open before allowing a trial request
+}
+
+var defaultDBHealthConfig = DBHealthConfig{
+	Interval:         30 * time.Second,
+	FailureThreshold: 5,
+	Cooldown:         30 * time.Second,
+}
+
+// loadDBHealthConfig reads DB_HEALTH_INTERVAL, DB_BREAKER_THRESHOLD and DB_BREAKER_COOLDOWN
+func loadDBHealthConfig() (DBHealthConfig, error) {
+	config := defaultDBHealthConfig
+	var err error
+
+	if config.Interval, err = getEnvDuration("DB_HEALTH_INTERVAL", config.Interval); err != nil {
+		return config, err
+	}
+	if config.FailureThreshold, err = getEnvInt("DB_BREAKER_THRESHOLD", config.FailureThreshold); err != nil {
+		return config, err
+	}
+	if config.Cooldown, err = getEnvDuration("DB_BREAKER_COOLDOWN", config.Cooldown); err != nil {
+		return config, err
+	}
+
+	if config.Interval <= 0 {
+		return config, fmt.Errorf("DB_HEALTH_INTERVAL must be positive, got %v", config.Interval)
+	}
+	if config.FailureThreshold < 1 {
+		return config, fmt.Errorf("DB_BREAKER_THRESHOLD must be at least 1, got %d", config.FailureThreshold)
+	}
+	if config.Cooldown <= 0 {
+		return config, fmt.Errorf("DB_BREAKER_COOLDOWN must be positive, got %v", config.Cooldown)
+	}
+
+	return config, nil
+}
+
+// CircuitBreaker stops calls to a failing dependency for a cooldown period.
+// After the cooldown a single trial call is let through; its outcome decides
+// whether the breaker closes again or stays open for another cooldown.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	open      bool
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow reports whether a call may proceed
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return true
+	}
+	if time.Since(b.openedAt) >= b.cooldown {
+		// Half-open: let one trial call through and restart the cooldown
+		b.openedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+func (b *CircuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.open {
+		slog.Info("Database connection recovered, closing circuit breaker")
+	}
+	b.failures = 0
+	b.open = false
+}
+
+func (b *CircuitBreaker) RecordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.failures >= b.threshold {
+		if !b.open {
+			slog.Warn("Database failing, opening circuit breaker", "failures", b.failures, "cooldown", b.cooldown)
+		}
+		b.open = true
+		b.openedAt = time.Now()
+	}
+}
+
+// dbHealthPlugin is a GORM plugin that rejects queries while the breaker is
+// open and feeds connection errors from real queries back into the breaker
+type dbHealthPlugin struct {
+	breaker *CircuitBreaker
+}
+
+func (p *dbHealthPlugin) Name() string {
+	return "db_health"
+}
+
+func (p *dbHealthPlugin) Initialize(db *gorm.DB) error {
+	before := func(tx *gorm.DB) {
+		if !p.breaker.Allow() {
+			tx.AddError(errDBCircuitOpen)
+		}
+	}
+	after := func(tx *gorm.DB) {
+		if errors.Is(tx.Error, errDBCircuitOpen) {
+			return
+		}
+		if isConnectionError(tx.Error) {
+			p.breaker.RecordFailure()
+		} else {
+			p.breaker.RecordSuccess()
+		}
+	}
+
+	callbacks := db.Callback()
+	errs := []error{
+		callbacks.Create().Before("gorm:create").Register("db_health:before_create", before),
+		callbacks.Create().After("gorm:create").Register("db_health:after_create", after),
+		callbacks.Query().Before("gorm:query").Register("db_health:before_query", before),
+		callbacks.Query().After("gorm:query").Register("db_health:after_query", after),
+		callbacks.Update().Before("gorm:update").Register("db_health:before_update", before),
+		callbacks.Update().After("gorm:update").Register("db_health:after_update", after),
+		callbacks.Delete().Before("gorm:delete").Register("db_health:before_delete", before),
+		callbacks.Delete().After("gorm:delete").Register("db_health:after_delete", after),
+		callbacks.Row().Before("gorm:row").Register("db_health:before_row", before),
+		callbacks.Row().After("gorm:row").Register("db_health:after_row", after),
+		callbacks.Raw().Before("gorm:raw").Register("db_health:before_raw", before),
+		callbacks.Raw().After("gorm:raw").Register("db_health:after_raw", after),
+	}
+	return errors.Join(errs...)
+}
+
+// isConnectionError distinguishes broken connections from ordinary query errors
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, sql.ErrConnDone) || errors.As(err, &netErr) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "connection refused") ||
+		strings.Contains(message, "connection reset") ||
+		strings.Contains(message, "broken pipe") ||
+		strings.Contains(message, "failed to connect")
+}
+
+// enableDBHealthChecks installs the circuit breaker plugin and starts a
+// background goroutine that pings the database for the life of the process
+func enableDBHealthChecks(db *gorm.DB) error {
+	config, err := loadDBHealthConfig()
+	if err != nil {
+		return err
+	}
+
+	breaker := NewCircuitBreaker(config.FailureThreshold, config.Cooldown)
+	if err := db.Use(&dbHealthPlugin{breaker: breaker}); err != nil {
+		return err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	go monitorDBHealth(sqlDB, breaker, config.Interval)
+	return nil
+}
+
+// monitorDBHealth pings the database and, on failure, drops idle connections
+// so the pool redials instead of reusing connections killed by an outage
+func monitorDBHealth(sqlDB *sql.DB, breaker *CircuitBreaker, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := sqlDB.PingContext(ctx)
+		cancel()
+
+		if err == nil {
+			breaker.RecordSuccess()
+			continue
+		}
+
+		slog.Warn("Database health check failed", "error", err)
+		breaker.RecordFailure()
+
+		// Temporarily disallowing idle connections closes the existing ones
+		maxIdle := defaultDBPoolConfig.MaxIdleConns
+		if config, err := loadDBPoolConfig(); err == nil {
+			maxIdle = config.MaxIdleConns
+		}
+		sqlDB.SetMaxIdleConns(0)
+		sqlDB.SetMaxIdleConns(maxIdle)
+	}
+}
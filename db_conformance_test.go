@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMemoryDBClientConformance(t *testing.T) {
+	if err := RunDBClientConformance(NewMemoryDBClient()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The Postgres run writes to a real database, so it only runs when
+// CONFORMANCE_DB_URL names one, e.g. a disposable local instance
+func TestLocalDBClientConformance(t *testing.T) {
+	dsn := os.Getenv("CONFORMANCE_DB_URL")
+	if dsn == "" {
+		t.Skip("CONFORMANCE_DB_URL is not set")
+	}
+	t.Setenv("LOCAL_DB_URL", dsn)
+	t.Setenv("LOCAL_DB_READ_URL", "")
+
+	client, err := NewLocalDBClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RunDBClientConformance(client); err != nil {
+		t.Fatal(err)
+	}
+}
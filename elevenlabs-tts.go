@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	elevenLabsEndpoint     = "https://api.elevenlabs.io/v1/text-to-speech"
+	defaultElevenLabsModel = "eleven_multilingual_v2"
+	elevenLabsOutputFormat = "mp3_44100_128"
+)
+
+// ElevenLabsTTS synthesizes speech with ElevenLabs, for deployments that want
+// premium voices. The audio is streamed straight from the response.
+type ElevenLabsTTS struct {
+	apiKey     string
+	voiceId    string
+	model      string
+	speed      float64
+	httpClient *http.Client
+}
+
+// NewElevenLabsTTS reads ELEVENLABS_API_KEY, ELEVENLABS_VOICE_ID and ELEVENLABS_MODEL
+func NewElevenLabsTTS() (*ElevenLabsTTS, error) {
+	e := &ElevenLabsTTS{
+		apiKey:     os.Getenv("ELEVENLABS_API_KEY"),
+		voiceId:    os.Getenv("ELEVENLABS_VOICE_ID"),
+		model:      os.Getenv("ELEVENLABS_MODEL"),
+		speed:      math.Min(math.Max(ttsConfig.Speed, 0.7), 1.2), // ElevenLabs only accepts 0.7 to 1.2
+		httpClient: &http.Client{Timeout: 5 * time.Minute},        // Long enough to stream a long article
+	}
+	if e.apiKey == "" {
+		return nil, fmt.Errorf("ELEVENLABS_API_KEY environment variable is not set")
+	}
+	if e.voiceId == "" {
+		return nil, fmt.Errorf("ELEVENLABS_VOICE_ID environment variable is not set")
+	}
+	if e.model == "" {
+		e.model = defaultElevenLabsModel
+	}
+	return e, nil
+}
+
+func (e *ElevenLabsTTS) Synthesize(ctx context.Context, text string, voice string) (io.ReadCloser, error) {
+	if voice == "" {
+		voice = e.voiceId
+	}
+	requestBody := map[string]interface{}{
+		"text":     text,
+		"model_id": e.model,
+	}
+	if e.speed != 1.0 {
+		requestBody["voice_settings"] = map[string]float64{"speed": e.speed}
+	}
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body to JSON: %v", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/stream?output_format=%s", elevenLabsEndpoint, url.PathEscape(voice), elevenLabsOutputFormat)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "audio/mpeg")
+	req.Header.Set("xi-api-key", e.apiKey)
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to ElevenLabs: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		// GenerateAudioFileWithConfig backs off on errors mentioning a rate limit
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return nil, fmt.Errorf("ElevenLabs rate limit reached: %s", string(body))
+		}
+		return nil, fmt.Errorf("ElevenLabs request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	// The caller copies the body to disk as it arrives and closes it
+	return resp.Body, nil
+}
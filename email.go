@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+)
+
+// EmailConfig controls how the newsletters are emailed to subscribers.
+// Nothing is sent unless Provider is set.
+type EmailConfig struct {
+	Provider          string // "sendgrid" or "ses"
+	From              string // Sender address, verified with the provider
+	FromName          string
+	ReplyTo           string
+	ArticleURL        string // Link to an article, with {urlTitle} replaced
+	UnsubscribeURL    string // Link in each email, with {token} replaced
+	UnsubscribeSecret string // Signs the unsubscribe tokens
+	Template          string // html/template file replacing newsletterEmailTemplate
+}
+
+var defaultEmailConfig = EmailConfig{FromName: "Daily Scoop"}
+
+var emailConfig = defaultEmailConfig
+
+// loadEmailConfig reads EMAIL_PROVIDER, EMAIL_FROM, EMAIL_FROM_NAME,
+// EMAIL_REPLY_TO, NEWSLETTER_ARTICLE_URL ("https://example.com/news/{urlTitle}"),
+// NEWSLETTER_UNSUBSCRIBE_URL ("https://example.com/unsubscribe?token={token}"),
+// NEWSLETTER_UNSUBSCRIBE_SECRET and NEWSLETTER_TEMPLATE, and checks the
+// provider's credentials are set. Every email carries an unsubscribe link,
+// so it is required along with its secret whenever EMAIL_PROVIDER is set.
+func loadEmailConfig() (EmailConfig, error) {
+	config := defaultEmailConfig
+	config.Provider = os.Getenv("EMAIL_PROVIDER")
+	config.From = os.Getenv("EMAIL_FROM")
+	config.ReplyTo = os.Getenv("EMAIL_REPLY_TO")
+	config.ArticleURL = os.Getenv("NEWSLETTER_ARTICLE_URL")
+	config.UnsubscribeURL = os.Getenv("NEWSLETTER_UNSUBSCRIBE_URL")
+	config.UnsubscribeSecret = os.Getenv("NEWSLETTER_UNSUBSCRIBE_SECRET")
+	config.Template = os.Getenv("NEWSLETTER_TEMPLATE")
+	if value := os.Getenv("EMAIL_FROM_NAME"); value != "" {
+		config.FromName = value
+	}
+	if config.Provider == "" {
+		return config, nil
+	}
+
+	if _, err := mail.ParseAddress(config.From); err != nil {
+		return config, fmt.Errorf("EMAIL_FROM must be an email address when EMAIL_PROVIDER is set, got %q", config.From)
+	}
+	if config.ReplyTo != "" {
+		if _, err := mail.ParseAddress(config.ReplyTo); err != nil {
+			return config, fmt.Errorf("EMAIL_REPLY_TO must be an email address, got %q", config.ReplyTo)
+		}
+	}
+	if !strings.Contains(config.ArticleURL, "{urlTitle}") {
+		return config, fmt.Errorf("NEWSLETTER_ARTICLE_URL must contain {urlTitle} when EMAIL_PROVIDER is set, got %q", config.ArticleURL)
+	}
+	if !strings.Contains(config.UnsubscribeURL, "{token}") {
+		return config, fmt.Errorf("NEWSLETTER_UNSUBSCRIBE_URL must contain {token} when EMAIL_PROVIDER is set, got %q", config.UnsubscribeURL)
+	}
+	if len(config.UnsubscribeSecret) < minUnsubscribeSecretLength {
+		return config, fmt.Errorf("NEWSLETTER_UNSUBSCRIBE_SECRET must be at least %d characters when EMAIL_PROVIDER is set", minUnsubscribeSecretLength)
+	}
+	if _, err := newEmailSender(config); err != nil {
+		return config, err
+	}
+	if _, err := config.template(); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// Email is one message to one recipient
+type Email struct {
+	To      string
+	Subject string
+	HTML    string
+	Text    string            // Plain-text alternative
+	Headers map[string]string // Extra headers, such as List-Unsubscribe
+}
+
+// EmailSender delivers email through a provider's API
+type EmailSender interface {
+	Send(ctx context.Context, email Email) error
+}
+
+// newEmailSender creates the sender EMAIL_PROVIDER names
+func newEmailSender(config EmailConfig) (EmailSender, error) {
+	switch config.Provider {
+	case "sendgrid":
+		return NewSendGridEmail(config)
+	case "ses":
+		return NewSESEmail(config)
+	default:
+		return nil, fmt.Errorf("unknown EMAIL_PROVIDER %q (must be sendgrid or ses)", config.Provider)
+	}
+}
+
+// fromAddress is the From header, with the sender's name when there is one
+func (c EmailConfig) fromAddress() string {
+	address, err := mail.ParseAddress(c.From)
+	if err != nil {
+		return c.From
+	}
+	if c.FromName != "" {
+		address.Name = c.FromName
+	}
+	return address.String()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getEnvInt reads an integer environment variable, falling back to the default when unset
+func getEnvInt(key string, defaultValue int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s must be an integer, got %q", key, value)
+	}
+	return parsed, nil
+}
+
+// getEnvDuration reads a duration environment variable (e.g. "30m"), falling back to the default when unset
+func getEnvDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s must be a duration like \"30s\" or \"5m\", got %q", key, value)
+	}
+	return parsed, nil
+}
+
+// getEnvFloat reads a floating point environment variable, falling back to the default when unset
+func getEnvFloat(key string, defaultValue float64) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s must be a number, got %q", key, value)
+	}
+	return parsed, nil
+}
+
+// getEnvMap reads a comma-separated list of key=value pairs such as
+// "Sports=nova,Politics=onyx", skipping and logging malformed entries
+func getEnvMap(key string) map[string]string {
+	values := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv(key), ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" || value == "" {
+			slog.Warn("Ignoring invalid entry", "variable", key, "entry", entry)
+			continue
+		}
+		values[name] = value
+	}
+	return values
+}
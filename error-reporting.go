@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error report levels, as Sentry names them
+const (
+	reportLevelWarning = "warning" // Recovered from, e.g. a job that will be retried
+	reportLevelError   = "error"
+	reportLevelFatal   = "fatal" // A panic, or a failure the process exits on
+)
+
+// ErrorReport is one failure sent to the error reporter
+type ErrorReport struct {
+	Title string            // What failed, e.g. "Pipeline stage failed"; reports are grouped by it
+	Err   error             // Sent as the exception message
+	Level string            // reportLevelWarning, reportLevelError or reportLevelFatal
+	Tags  map[string]string // Searchable context: run, mode, keyword, stage, ...
+	Extra map[string]string // Longer context such as a model response or a stack
+}
+
+// ErrorReporter sends failures somewhere they raise an alert, so a nightly
+// run failing doesn't go unnoticed in the logs
+type ErrorReporter interface {
+	Report(report ErrorReport)
+	// Flush waits up to timeout for reports still being sent
+	Flush(timeout time.Duration)
+}
+
+// noopErrorReporter is used when no reporter is configured; failures are
+// still logged where they happen
+type noopErrorReporter struct{}
+
+func (noopErrorReporter) Report(ErrorReport)  {}
+func (noopErrorReporter) Flush(time.Duration) {}
+
+var errorReporter ErrorReporter = noopErrorReporter{}
+
+// errorReportFlushTimeout is how long the process waits on exit for reports
+// still being sent
+const errorReportFlushTimeout = 5 * time.Second
+
+// loadErrorReporter reads SENTRY_DSN, and SENTRY_ENVIRONMENT to tell
+// deployments apart. Without a DSN nothing is reported.
+func loadErrorReporter() (ErrorReporter, error) {
+	dsn := os.Getenv("SENTRY_DSN")
+	if dsn == "" {
+		return noopErrorReporter{}, nil
+	}
+	return newSentryReporter(dsn, os.Getenv("SENTRY_ENVIRONMENT"))
+}
+
+type reportTagsKey struct{}
+
+// withReportTags returns a context whose error reports carry the key/value
+// pairs in args as tags, along with any ctx already carries
+func withReportTags(ctx context.Context, args ...any) context.Context {
+	tags := make(map[string]string)
+	for key, value := range reportTagsFrom(ctx) {
+		tags[key] = value
+	}
+	for i := 0; i+1 < len(args); i += 2 {
+		tags[fmt.Sprint(args[i])] = fmt.Sprint(args[i+1])
+	}
+	return context.WithValue(ctx, reportTagsKey{}, tags)
+}
+
+func reportTagsFrom(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(reportTagsKey{}).(map[string]string)
+	return tags
+}
+
+// reportFailure reports err, tagged with what ctx carries
+func reportFailure(ctx context.Context, level string, title string, err error, extra map[string]string) {
+	errorReporter.Report(ErrorReport{
+		Title: title,
+		Err:   err,
+		Level: level,
+		Tags:  reportTagsFrom(ctx),
+		Extra: extra,
+	})
+}
+
+// reportLLMParseError reports a model response that couldn't be parsed,
+// which otherwise only shows up as a skipped or failed topic. caller names
+// the prompt, as for pipelineMetrics.GeminiError.
+func reportLLMParseError(caller string, response string, err error, args ...any) {
+	ctx := withReportTags(context.Background(), append([]any{"caller", caller}, args...)...)
+	reportFailure(ctx, reportLevelWarning, "Unparseable model response", err, map[string]string{"response": response})
+}
+
+// recoveredPanic is a panic turned into an error, carrying the stack it was
+// raised on
+type recoveredPanic struct {
+	value any
+	stack []byte
+}
+
+func (p *recoveredPanic) Error() string {
+	return fmt.Sprintf("panic: %v", p.value)
+}
+
+// panicError turns the value from recover into an error. Call it in the
+// deferred function so the stack is the panicking goroutine's.
+func panicError(recovered any) *recoveredPanic {
+	return &recoveredPanic{value: recovered, stack: debug.Stack()}
+}
+
+// sentryReporter sends reports to Sentry's envelope endpoint
+type sentryReporter struct {
+	endpoint    string
+	auth        string
+	dsn         string
+	environment string
+	client      *http.Client
+	pending     sync.WaitGroup
+}
+
+// newSentryReporter parses a DSN of the form https://<key>@<host>/<project>
+func newSentryReporter(dsn string, environment string) (*sentryReporter, error) {
+	parsed, err := url.Parse(dsn)
+	if err != nil || parsed.User == nil || parsed.User.Username() == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("SENTRY_DSN must look like https://<key>@<host>/<project>, got %q", dsn)
+	}
+	path := strings.Trim(parsed.Path, "/")
+	project := path[strings.LastIndex(path, "/")+1:]
+	if project == "" {
+		return nil, fmt.Errorf("SENTRY_DSN is missing the project ID: %q", dsn)
+	}
+	prefix := strings.TrimSuffix(path, project)
+
+	return &sentryReporter{
+		endpoint:    fmt.Sprintf("%s://%s/%sapi/%s/envelope/", parsed.Scheme, parsed.Host, prefix, project),
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=daily-scoop-api/1.0, sentry_key=%s", parsed.User.Username()),
+		dsn:         dsn,
+		environment: environment,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Report sends the report in the background; Flush waits for it
+func (r *sentryReporter) Report(report ErrorReport) {
+	body, err := r.envelope(report)
+	if err != nil {
+		slog.Warn("Failed to encode error report", "error", err)
+		return
+	}
+	r.pending.Add(1)
+	go func() {
+		defer r.pending.Done()
+		req, err := http.NewRequest(http.MethodPost, r.endpoint, bytes.NewReader(body))
+		if err != nil {
+			slog.Warn("Failed to send error report", "error", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/x-sentry-envelope")
+		req.Header.Set("X-Sentry-Auth", r.auth)
+		resp, err := r.client.Do(req)
+		if err != nil {
+			slog.Warn("Failed to send error report", "error", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			slog.Warn("Sentry rejected error report", "status", resp.StatusCode)
+		}
+	}()
+}
+
+func (r *sentryReporter) Flush(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		r.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		slog.Warn("Gave up waiting for error reports to send", "timeout", timeout)
+	}
+}
+
+// envelope encodes the report as a Sentry envelope holding one event
+func (r *sentryReporter) envelope(report ErrorReport) ([]byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	eventID := hex.EncodeToString(id)
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+
+	message := ""
+	if report.Err != nil {
+		message = report.Err.Error()
+	}
+	event := map[string]interface{}{
+		"event_id":  eventID,
+		"timestamp": now,
+		"platform":  "go",
+		"level":     report.Level,
+		"exception": map[string]interface{}{
+			"values": []map[string]string{{"type": report.Title, "value": message}},
+		},
+		"tags":  report.Tags,
+		"extra": report.Extra,
+	}
+	if r.environment != "" {
+		event["environment"] = r.environment
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		event["server_name"] = hostname
+	}
+
+	header, err := json.Marshal(map[string]string{"event_id": eventID, "sent_at": now, "dsn": r.dsn})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	itemHeader, err := json.Marshal(map[string]interface{}{"type": "event", "length": len(payload)})
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope bytes.Buffer
+	for _, line := range [][]byte{header, itemHeader, payload} {
+		envelope.Write(line)
+		envelope.WriteByte('\n')
+	}
+	return envelope.Bytes(), nil
+}
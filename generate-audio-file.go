@@ -2,15 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
-
-	"github.com/sashabaranov/go-openai"
 )
 
 // AudioBatchConfig holds configuration for audio generation batching
@@ -26,43 +25,67 @@ var defaultAudioBatchConfig = AudioBatchConfig{
 	MaxRetries:    3,
 }
 
-// Initialize a semaphore to control concurrent audio requests
-var audioSemaphore chan struct{}
-var once sync.Once
+// AudioOptions are the per-article narration settings
+type AudioOptions struct {
+	Voice    string // TTS voice; empty uses the provider's default
+	MusicBed string // Background music file; empty for none
+}
 
-func init() {
-	once.Do(func() {
-		audioSemaphore = make(chan struct{}, defaultAudioBatchConfig.MaxConcurrent)
-	})
+// audioOptionsForCategory returns the voice and music bed configured for a category
+func audioOptionsForCategory(categoryId int) AudioOptions {
+	return AudioOptions{
+		Voice:    voiceForCategory(categoryId),
+		MusicBed: musicBedConfig.musicBedForCategory(categoryId),
+	}
 }
 
-// GenerateAudioFile converts article text to speech and saves it as an MP3 file
-func GenerateAudioFile(content string) (string, error) {
-	return GenerateAudioFileWithConfig(content, defaultAudioBatchConfig)
+// GenerateAudioFile converts article text to speech, framed by the configured
+// intro and outro, and saves it as an MP3 file
+func GenerateAudioFile(ctx context.Context, title string, content string, options AudioOptions) (string, error) {
+	return GenerateAudioFileWithConfig(ctx, title, content, options, defaultAudioBatchConfig)
 }
 
 // GenerateAudioFileWithConfig allows custom batch configuration
-func GenerateAudioFileWithConfig(content string, config AudioBatchConfig) (string, error) {
+func GenerateAudioFileWithConfig(ctx context.Context, title string, content string, options AudioOptions, config AudioBatchConfig) (string, error) {
+	return runAudioAttempts(ctx, config, func() (string, error) {
+		return generateAudioWithRetry(ctx, title, content, options)
+	})
+}
+
+// runAudioAttempts runs a TTS request within the TTS concurrency limit,
+// retrying when the provider reports a rate limit. Waiting between retries
+// stops once ctx is done.
+func runAudioAttempts(ctx context.Context, config AudioBatchConfig, attempt func() (string, error)) (string, error) {
 	var lastErr error
 	
 	for retry := 0; retry <= config.MaxRetries; retry++ {
 		if retry > 0 {
-			time.Sleep(config.RetryDelay)
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(config.RetryDelay):
+			}
 		}
 
-		// Acquire semaphore token
-		audioSemaphore <- struct{}{}
-		defer func() { <-audioSemaphore }()
-
-		outputPath, err := generateAudioWithRetry(content)
+		// Hold a slot only for the duration of this attempt
+		release, err := waitForAPI(ctx, apiTTS)
+		if err != nil {
+			return "", err
+		}
+		outputPath, err := attempt()
+		release()
 		if err == nil {
 			return outputPath, nil
 		}
 
 		// Handle rate limit errors specially
 		if strings.Contains(err.Error(), "rate limit") {
-			time.Sleep(config.RetryDelay * 2)
 			lastErr = err
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(config.RetryDelay * 2):
+			}
 			continue
 		}
 
@@ -73,30 +96,97 @@ func GenerateAudioFileWithConfig(content string, config AudioBatchConfig) (strin
 	return "", fmt.Errorf("max retries exceeded: %v", lastErr)
 }
 
-func generateAudioWithRetry(content string) (string, error) {
-	// Strip markdown tags before TTS processing
-	content = stripMarkdownTags(content)
-	
-	// Append the outro message
-	content = content + " I'm Daily Bot, and you're listening to Daily Scoop AI."
-
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	client := openai.NewClient(apiKey)
-	ctx := context.Background()
-
-	req := openai.CreateSpeechRequest{
-		Model: openai.TTSModel1,
-		Input: content,
-		Voice: openai.VoiceAlloy,
-		ResponseFormat: openai.SpeechResponseFormatMp3,
+func generateAudioWithRetry(ctx context.Context, title string, content string, options AudioOptions) (string, error) {
+	intro, outro, err := audioBookendConfig.renderBookends(title)
+	if err != nil {
+		return "", err
 	}
 
-	resp, err := client.CreateSpeech(ctx, req)
+	provider, err := newTTSProvider()
 	if err != nil {
-		return "", fmt.Errorf("failed to synthesize speech: %v", err)
+		return "", err
+	}
+
+	// The intro and outro are read as their own paragraphs
+	paragraphs := renderPlainText(intro + paragraphTag + content + paragraphTag + outro)
+
+	var resp io.ReadCloser
+	// Providers that accept SSML get paragraph pauses and pronunciation hints
+	if ssmlProvider, ok := provider.(SSMLSynthesizer); ok && currentSSMLConfig().Enabled {
+		script := buildSSMLScript(content, currentSSMLConfig().Pronunciations).withBookends(intro, outro)
+		resp, err = ssmlProvider.SynthesizeSSML(ctx, script, options.Voice)
+		if errors.Is(err, errTTSSkipped) {
+			return "", err
+		}
+		if err != nil {
+			// Rate limits are retried by the caller; other failures may be markup
+			// the provider rejected, so retry as plain text
+			if strings.Contains(err.Error(), "rate limit") {
+				return "", fmt.Errorf("failed to synthesize speech: %v", err)
+			}
+			slog.Warn("SSML synthesis failed, falling back to plain text", "error", err)
+			resp = nil
+		}
+	}
+
+	if resp == nil {
+		// Blank lines make providers pause and let long articles split between them
+		resp, err = provider.Synthesize(ctx, strings.Join(paragraphs, "\n\n"), options.Voice)
+		if errors.Is(err, errTTSSkipped) {
+			return "", err
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to synthesize speech: %v", err)
+		}
 	}
 	defer resp.Close()
 
+	outputPath, err := writeAudioFile(resp)
+	if err != nil {
+		return "", err
+	}
+
+	// Aligned on the dry narration, since the music bed would fill the pauses
+	// it is split on, then shifted past the intro jingle. Audio without a
+	// transcript is still published.
+	if offset, err := audioBookendConfig.introLength(); err != nil {
+		slog.Warn("Failed to generate transcript", "error", err)
+	} else if err := writeTranscript(outputPath, paragraphs, offset); err != nil {
+		slog.Warn("Failed to generate transcript", "error", err)
+	}
+
+	// The music bed sits under the narration only, not the jingles. It keeps
+	// the narration's length, so the transcript still lines up.
+	if options.MusicBed != "" {
+		if err := musicBedConfig.mixMusicBed(outputPath, options.MusicBed); err != nil {
+			slog.Warn("Failed to add music bed, keeping plain narration", "error", err)
+		}
+	}
+
+	if err := audioBookendConfig.addJingles(outputPath); err != nil {
+		os.Remove(outputPath)
+		os.Remove(transcriptPathFor(outputPath))
+		return "", err
+	}
+
+	return outputPath, nil
+}
+
+// synthesizeClip speaks a short piece of text, such as a dialogue line or a
+// segment intro, into its own file under media/audio
+func synthesizeClip(ctx context.Context, provider TTSProvider, text string, voice string) (string, error) {
+	return runAudioAttempts(ctx, defaultAudioBatchConfig, func() (string, error) {
+		resp, err := provider.Synthesize(ctx, text, voice)
+		if err != nil {
+			return "", fmt.Errorf("failed to synthesize speech: %v", err)
+		}
+		defer resp.Close()
+		return writeAudioFile(resp)
+	})
+}
+
+// writeAudioFile saves synthesized MP3 data under media/audio
+func writeAudioFile(audio io.Reader) (string, error) {
 	// Create output directory if it doesn't exist
 	outputDir := "media/audio"
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
@@ -115,36 +205,15 @@ func generateAudioWithRetry(content string) (string, error) {
 	defer out.Close()
 
 	// Copy the audio content to file
-	if _, err := io.Copy(out, resp); err != nil {
+	if _, err := io.Copy(out, audio); err != nil {
 		// Clean up the file if we failed to write it
 		os.Remove(outputPath)
 		return "", fmt.Errorf("failed to write audio file: %v", err)
 	}
+	if err := out.Close(); err != nil {
+		os.Remove(outputPath)
+		return "", fmt.Errorf("failed to write audio file: %v", err)
+	}
 
 	return outputPath, nil
 }
-
-// stripMarkdownTags removes custom markdown tags from the content
-func stripMarkdownTags(content string) string {
-	// Replace all opening and closing tags
-	replacements := map[string]string{
-		"[bold]": "",
-		"[/bold]": "",
-		"[italic]": "",
-		"[/italic]": "",
-		"[bold-italic]": "",
-		"[/bold-italic]": "",
-		"[underline-italic]": "",
-		"[/underline-italic]": "",
-		"[p]": " ",
-	}
-
-	for tag, replacement := range replacements {
-		content = strings.ReplaceAll(content, tag, replacement)
-	}
-
-	// Clean up any extra whitespace
-	content = strings.Join(strings.Fields(content), " ")
-	
-	return content
-} 
\ No newline at end of file
@@ -2,27 +2,86 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
-	"time"
+
+	"github.com/google/uuid"
 )
 
-// GetNewsImage generates an image for a news article using Gemini Flash 2
-func GetNewsImage(article GeneratedArticle) (string, error) {
+// symbolicImageGuideline is added to the prompt instructions when an image has
+// to avoid depicting people: for sensitive stories under the category's image
+// policy (see image-policy.go), or after moderation rejected a first attempt
+const symbolicImageGuideline = `
+7. **Symbolic Photojournalism Only:** Show no people at all, not even in the background or from behind. Convey the story through symbolic or abstract imagery: locations, objects, signs, flags, weather or light.`
+
+// GeneratedImage is an AI-generated article image and how it was made
+type GeneratedImage struct {
+	Path string
+	ImageGenerationInfo
+}
+
+// GetNewsImage writes an image prompt for a news article with Gemini Flash 2
+// and renders it with the configured image provider. Sensitive stories get
+// symbolic imagery from the start; otherwise an image rejected by moderation
+// is replaced once with symbolic imagery.
+func GetNewsImage(ctx context.Context, article GeneratedArticle) (*GeneratedImage, error) {
+	symbolic := imagePolicyConfig.requiresSymbolic(article)
+	rejection := ""
+	for {
+		image, err := renderNewsImage(ctx, article, symbolic)
+		if err != nil {
+			return nil, err
+		}
+		image.ModerationRejection = rejection
+		if !imageModerationConfig.Enabled {
+			return image, nil
+		}
+
+		reason, err := imageModerationConfig.moderateImage(ctx, image.Path, article.CategoryId)
+		if err != nil {
+			// Providers filter their own output, so an unavailable check doesn't block publishing
+			slog.Warn("Image moderation failed, keeping the image", "error", err)
+			return image, nil
+		}
+		if reason == "" {
+			return image, nil
+		}
+		rejection = reason
+
+		os.Remove(image.Path)
+		if symbolic {
+			return nil, fmt.Errorf("symbolic image rejected by moderation: %s", reason)
+		}
+		slog.Warn("Image rejected by moderation, retrying with symbolic imagery", "reason", reason)
+		symbolic = true
+	}
+}
+
+// renderNewsImage writes an image prompt for the article and renders it
+func renderNewsImage(ctx context.Context, article GeneratedArticle, symbolic bool) (*GeneratedImage, error) {
 	// Create output directory if it doesn't exist
 	outputDir := "media/images"
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create output directory: %w", err)
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	// Generate unique filename using timestamp
-	filename := fmt.Sprintf("image_%d.jpg", time.Now().Unix())
-	outputPath := filepath.Join(outputDir, filename)
+	// Generate unique filename; topics are processed concurrently, so a timestamp alone can collide.
+	// The provider adds the extension for the format it produces.
+	basePath := filepath.Join(outputDir, fmt.Sprintf("image_%s", uuid.New().String()))
+
+	extraGuidelines := ""
+	if symbolic {
+		extraGuidelines = symbolicImageGuideline
+	}
+	// Category pages share a visual identity
+	extraGuidelines += imageStyleGuideline(article.CategoryId)
 
 	// Get optimized prompt
 	promptInstruction := fmt.Sprintf(`
@@ -33,48 +92,68 @@ Generate a photorealistic image prompt for a prestigious news publication websit
 3. **Context Enhances Relevance:** Include contextual elements like settings, time of day, weather, or relevant objects that capture the story's essence.
 4. **Style: Journalistic Photography:** Use a journalistic photography style with natural lighting, clear focus, and authentic details.
 5. **Safe & Neutral Content:** Ensure the prompt generates appropriate, policy-compliant imagery focusing on symbolic or representative elements of the story.
-6. **Image Quality Modifiers:** Include quality modifiers for professional, high-quality images (4K, HDR, professional photography).
+6. **Image Quality Modifiers:** Include quality modifiers for professional, high-quality images (4K, HDR, professional photography).%s
 
 Article Title: %s
 First Sentence: %s
 
 Generate ONLY the image prompt. Do not include any extra text or explanation.`, 
+	extraGuidelines,
 	article.Title, 
-	strings.SplitN(article.Article, ".", 2)[0])
+	strings.SplitN(stripMarkdownTags(article.Article), ".", 2)[0])
 
 	// Generate the prompt using Gemini
-	generatedPrompt, err := queryGeminiForPrompt(promptInstruction, "gemini-2.0-flash")
+	generatedPrompt, err := queryGeminiForPrompt(ctx, promptInstruction, articleModel)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate image prompt: %w", err)
+		return nil, fmt.Errorf("failed to generate image prompt: %w", err)
 	}
 
-	// Call the Python script with the prompt
-	cmd := exec.Command("python3", "imagen_generator.py", generatedPrompt, outputPath)
-	cmd.Env = append(os.Environ(), fmt.Sprintf("GEMINI_API_KEY=%s", os.Getenv("GEMINI_API_KEY")))
-
-	outputBytes, err := cmd.CombinedOutput()
-	output := string(outputBytes)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate image: %w, output: %s", err, output)
+	// Prompts blocked by the provider's content policy are softened and retried
+	seed := imageProviderConfig.seedFor(article)
+	for revision := 0; ; revision++ {
+		image, err := generateImage(ctx, imageProviderConfig, generatedPrompt, basePath, seed)
+		if err == nil {
+			image = pickImageCandidate(ctx, article, image, basePath, seed)
+			image.Symbolic = symbolic
+			image.PromptRevisions = revision
+			return image, nil
+		}
+		if !errors.Is(err, errImageDeclined) || revision >= imageProviderConfig.PromptRevisions {
+			return nil, err
+		}
+
+		slog.Warn("Image prompt declined, revising", "revision", revision+1, "revisions", imageProviderConfig.PromptRevisions, "error", err)
+		generatedPrompt, err = queryGeminiForPrompt(ctx, fmt.Sprintf(imagePromptRevisionInstruction, generatedPrompt), articleModel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to revise image prompt: %w", err)
+		}
 	}
+}
 
-	// Verify the image was created
-	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("image file was not created")
-	}
+// imagePromptRevisionInstruction asks Gemini to soften a prompt that an image
+// provider's content policy blocked
+const imagePromptRevisionInstruction = `
+The following image prompt for a news website was rejected by the image generator's content policy.
+Rewrite it more conservatively so it is clearly safe, while still illustrating the same story:
+- Remove any real or named people, political figures, brands and logos
+- Remove violence, weapons, injuries, blood, disasters in progress and anything distressing
+- Prefer calm, symbolic scenes: locations, buildings, objects, landscapes, weather and light
+- Keep it photorealistic, starting with "A photo of..."
 
-	return outputPath, nil
-}
+Rejected prompt: %s
+
+Generate ONLY the revised image prompt. Do not include any extra text or explanation.`
 
 // queryGeminiForPrompt queries the Gemini API for an optimized prompt
-func queryGeminiForPrompt(prompt string, modelName string) (string, error) {
+func queryGeminiForPrompt(ctx context.Context, prompt string, modelName string) (string, error) {
 	apiKey := os.Getenv("GEMINI_API_KEY")
 	if apiKey == "" {
 		return "", fmt.Errorf("GEMINI_API_KEY environment variable not set")
 	}
 
-	apiEndpoint := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", modelName, apiKey)
-	fmt.Println("Calling Gemini API Endpoint:", apiEndpoint)
+	// The key goes in a header so the URL is safe to log
+	apiEndpoint := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent", modelName)
+	slog.Debug("Calling Gemini for an image prompt", "endpoint", apiEndpoint)
 
 	requestBody := map[string]interface{}{
 		"contents": []map[string]interface{}{
@@ -93,12 +172,18 @@ func queryGeminiForPrompt(prompt string, modelName string) (string, error) {
 	}
 
 	client := &http.Client{}
-	req, err := http.NewRequest("POST", apiEndpoint, bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", apiEndpoint, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return "", fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", apiKey)
 
+	release, err := waitForAPI(ctx, apiGemini)
+	if err != nil {
+		return "", err
+	}
+	defer release()
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request to Gemini API: %w", err)
@@ -113,6 +198,7 @@ func queryGeminiForPrompt(prompt string, modelName string) (string, error) {
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
 		return "", fmt.Errorf("failed to decode Gemini API response: %w", err)
 	}
+	recordGeminiRESTUsage(response)
 
 	// Extract the generated text - adjust path based on actual Gemini API response structure
 	candidates, ok := response["candidates"].([]interface{})
@@ -134,6 +220,6 @@ func queryGeminiForPrompt(prompt string, modelName string) (string, error) {
 		return "", fmt.Errorf("text not found in part")
 	}
 
-	fmt.Println("Gemini API Response (Generated Prompt):\n", generatedPrompt) // Now logging generatedPrompt
+	slog.Debug("Generated image prompt", "prompt", generatedPrompt)
 	return generatedPrompt, nil // Returning the Gemini-generated prompt
 }
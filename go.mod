@@ -11,8 +11,13 @@ require (
 )
 
 require (
+	github.com/disintegration/imaging v1.6.2
+	github.com/gen2brain/webp v0.5.5
 	github.com/google/generative-ai-go v0.19.0
+	golang.org/x/time v0.10.0
 	google.golang.org/api v0.221.0
+	gopkg.in/yaml.v3 v3.0.1
+	gorm.io/plugin/dbresolver v1.5.3
 )
 
 require (
@@ -36,7 +41,6 @@ require (
 	go.opentelemetry.io/otel/trace v1.34.0 // indirect
 	golang.org/x/oauth2 v0.26.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
-	golang.org/x/time v0.10.0 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20241209162323-e6fa225c2576 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250207221924-e9438ea467c6 // indirect
 	google.golang.org/grpc v1.70.0 // indirect
@@ -64,5 +68,6 @@ require (
 	github.com/go-jose/go-jose/v3 v3.0.3 // indirect
 	github.com/go-stack/stack v1.8.1 // indirect
 	github.com/h2non/bimg v1.1.9
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/sashabaranov/go-openai v1.37.0
 )
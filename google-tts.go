@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	googleTTSEndpoint     = "https://texttospeech.googleapis.com/v1/text:synthesize"
+	defaultGoogleTTSVoice = "en-US-Neural2-D"
+	googleTTSMaxBytes     = 4800 // The API rejects input over 5000 bytes; leave room for multi-byte runes
+)
+
+// GoogleTTS synthesizes speech with Google Cloud Text-to-Speech. Neural2 and
+// Wavenet voices are both supported; GOOGLE_TTS_VOICE picks one.
+type GoogleTTS struct {
+	apiKey       string
+	voice        string // Default voice, e.g. "en-US-Neural2-D" or "en-US-Wavenet-F"
+	speakingRate float64
+	pitch        float64 // Semitones
+	httpClient   *http.Client
+}
+
+// NewGoogleTTS reads GOOGLE_TTS_API_KEY (falling back to GOOGLE_API_KEY),
+// GOOGLE_TTS_VOICE and GOOGLE_TTS_SPEAKING_RATE, which overrides TTS_SPEED
+func NewGoogleTTS() (*GoogleTTS, error) {
+	apiKey := os.Getenv("GOOGLE_TTS_API_KEY")
+	if apiKey == "" {
+		apiKey = os.Getenv("GOOGLE_API_KEY")
+	}
+	if apiKey == "" {
+		return nil, fmt.Errorf("GOOGLE_TTS_API_KEY environment variable is not set")
+	}
+
+	voice := os.Getenv("GOOGLE_TTS_VOICE")
+	if voice == "" {
+		voice = defaultGoogleTTSVoice
+	}
+	if _, err := languageCodeFromVoice(voice); err != nil {
+		return nil, fmt.Errorf("GOOGLE_TTS_VOICE must be a voice name like %q: %v", defaultGoogleTTSVoice, err)
+	}
+
+	speakingRate, err := getEnvFloat("GOOGLE_TTS_SPEAKING_RATE", ttsConfig.Speed)
+	if err != nil {
+		return nil, err
+	}
+	if speakingRate < 0.25 || speakingRate > 4.0 {
+		return nil, fmt.Errorf("GOOGLE_TTS_SPEAKING_RATE must be between 0.25 and 4.0, got %v", speakingRate)
+	}
+
+	return &GoogleTTS{
+		apiKey:       apiKey,
+		voice:        voice,
+		speakingRate: speakingRate,
+		pitch:        ttsConfig.Pitch,
+		httpClient:   &http.Client{Timeout: 2 * time.Minute},
+	}, nil
+}
+
+// Synthesize splits text into chunks the API accepts and joins the MP3 results;
+// MP3 frames are self-contained, so concatenated files play back as one
+func (g *GoogleTTS) Synthesize(ctx context.Context, text string, voice string) (io.ReadCloser, error) {
+	if voice == "" {
+		voice = g.voice
+	}
+	languageCode, err := languageCodeFromVoice(voice)
+	if err != nil {
+		return nil, err
+	}
+
+	var audio bytes.Buffer
+	for _, chunk := range splitTextForTTS(text, googleTTSMaxBytes) {
+		data, err := g.synthesizeChunk(ctx, map[string]string{"text": chunk}, voice, languageCode)
+		if err != nil {
+			return nil, err
+		}
+		audio.Write(data)
+	}
+	return io.NopCloser(&audio), nil
+}
+
+// SynthesizeSSML is Synthesize for SSML scripts, split between sentences
+func (g *GoogleTTS) SynthesizeSSML(ctx context.Context, script ssmlScript, voice string) (io.ReadCloser, error) {
+	if voice == "" {
+		voice = g.voice
+	}
+	languageCode, err := languageCodeFromVoice(voice)
+	if err != nil {
+		return nil, err
+	}
+
+	var audio bytes.Buffer
+	for _, chunk := range script.chunks(googleTTSMaxBytes - len("<speak></speak>")) {
+		data, err := g.synthesizeChunk(ctx, map[string]string{"ssml": "<speak>" + chunk + "</speak>"}, voice, languageCode)
+		if err != nil {
+			return nil, err
+		}
+		audio.Write(data)
+	}
+	return io.NopCloser(&audio), nil
+}
+
+// synthesizeChunk sends one request; input is {"text": ...} or {"ssml": ...}
+func (g *GoogleTTS) synthesizeChunk(ctx context.Context, input map[string]string, voice, languageCode string) ([]byte, error) {
+	requestBody := map[string]interface{}{
+		"input": input,
+		"voice": map[string]string{
+			"languageCode": languageCode,
+			"name":         voice,
+		},
+		"audioConfig": map[string]interface{}{
+			"audioEncoding": "MP3",
+			"speakingRate":  g.speakingRate,
+			"pitch":         g.pitch,
+		},
+	}
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body to JSON: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", googleTTSEndpoint, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Goog-Api-Key", g.apiKey)
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to Google TTS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		// GenerateAudioFileWithConfig backs off on errors mentioning a rate limit
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return nil, fmt.Errorf("Google TTS rate limit reached: %s", string(body))
+		}
+		return nil, fmt.Errorf("Google TTS request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		AudioContent string `json:"audioContent"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode Google TTS response: %v", err)
+	}
+	audio, err := base64.StdEncoding.DecodeString(result.AudioContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode Google TTS audio: %v", err)
+	}
+	return audio, nil
+}
+
+// splitTextForTTS breaks text into chunks of at most maxBytes, preferring to
+// split between sentences, then between words
+func splitTextForTTS(text string, maxBytes int) []string {
+	var chunks []string
+	var current strings.Builder
+
+	flush := func() {
+		if chunk := strings.TrimSpace(current.String()); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		current.Reset()
+	}
+
+	for _, sentence := range splitSentences(text) {
+		if current.Len()+len(sentence) <= maxBytes {
+			current.WriteString(sentence)
+			continue
+		}
+		flush()
+		if len(sentence) <= maxBytes {
+			current.WriteString(sentence)
+			continue
+		}
+		// A single sentence over the limit is split between words
+		for _, word := range strings.Fields(sentence) {
+			if current.Len()+len(word)+1 > maxBytes {
+				flush()
+			}
+			current.WriteString(word + " ")
+		}
+	}
+	flush()
+
+	return chunks
+}
+
+// splitSentences splits text after sentence-ending punctuation, keeping the
+// punctuation and following space with each sentence
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for i := 0; i < len(text); i++ {
+		if (text[i] == '.' || text[i] == '!' || text[i] == '?') && (i+1 == len(text) || text[i+1] == ' ' || text[i+1] == '\n') {
+			sentences = append(sentences, text[start:i+1]+" ")
+			start = i + 1
+		}
+	}
+	if start < len(text) {
+		sentences = append(sentences, text[start:])
+	}
+	return sentences
+}
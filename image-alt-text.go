@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
+)
+
+const maxAltTextChars = 125 // Screen readers commonly cut alt text around this length
+
+const altTextPrompt = `Write alt text for this news photo for screen reader users.
+Describe what is visible in one plain sentence of at most 125 characters.
+Do not start with "Image of" or "Photo of", and do not use quotes.
+Respond with the alt text only.`
+
+// GenerateImageAltText describes a generated image with Gemini vision for
+// accessibility and SEO
+func GenerateImageAltText(ctx context.Context, imagePath string) (string, error) {
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %v", err)
+	}
+
+	client, err := genai.NewClient(ctx, option.WithAPIKey(os.Getenv("GEMINI_API_KEY")))
+	if err != nil {
+		return "", fmt.Errorf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	model := client.GenerativeModel(articleModel)
+	model.SetTemperature(0.2) // Descriptions should be literal, not creative
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(imagePath)), ".")
+	if format == "jpg" {
+		format = "jpeg"
+	}
+
+	release, err := waitForAPI(ctx, apiGemini)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	resp, err := model.GenerateContent(ctx, genai.ImageData(format, data), genai.Text(altTextPrompt))
+	if err != nil {
+		pipelineMetrics.GeminiError("alt_text")
+		return "", fmt.Errorf("Failed to generate content: %v", err)
+	}
+	recordGeminiUsage(resp.UsageMetadata)
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		return "", fmt.Errorf("no alt text returned, possible safety filter: %+v", resp)
+	}
+	textPart, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
+	if !ok {
+		return "", fmt.Errorf("expected text part in response, got: %+v", resp.Candidates[0].Content.Parts[0])
+	}
+
+	altText := cleanAltText(string(textPart))
+	if altText == "" {
+		return "", fmt.Errorf("Gemini returned empty alt text")
+	}
+	return altText, nil
+}
+
+// altTextFromPrompt derives alt text from the image generation prompt when
+// vision is unavailable. Prompts start with "A photo of ..." and trail off
+// into style modifiers, so only the first sentence is kept.
+func altTextFromPrompt(prompt string) string {
+	firstSentence := strings.SplitN(strings.TrimSpace(prompt), ".", 2)[0]
+	firstSentence = strings.TrimPrefix(firstSentence, "A photo of ")
+	return cleanAltText(firstSentence)
+}
+
+// aiImageCaption labels a generated image from its alt text, e.g.
+// "AI-generated illustration of a flooded street at dusk."
+func aiImageCaption(altText string) string {
+	description := strings.TrimRight(altText, ".")
+	if runes := []rune(description); len(runes) > 1 && !unicode.IsUpper(runes[1]) {
+		// Lowercase the first letter unless it starts an acronym like "NASA"
+		description = string(unicode.ToLower(runes[0])) + string(runes[1:])
+	}
+	if description == "" {
+		return "AI-generated illustration."
+	}
+	return "AI-generated illustration of " + description + "."
+}
+
+// aiImageCredit is the credit line for an image from the named provider
+func aiImageCredit(provider string) string {
+	if name, ok := imageProviderCredits[provider]; ok {
+		return "AI-generated image by " + name
+	}
+	return "AI-generated image"
+}
+
+// cleanAltText collapses whitespace, strips wrapping quotes and shortens the
+// text to maxAltTextChars at a word boundary
+func cleanAltText(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	text = strings.Trim(text, "\"'")
+
+	runes := []rune(text)
+	if len(runes) <= maxAltTextChars {
+		return text
+	}
+	truncated := string(runes[:maxAltTextChars])
+	if space := strings.LastIndex(truncated, " "); space > 0 {
+		truncated = truncated[:space]
+	}
+	return strings.TrimRight(truncated, " ,;:")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
+)
+
+// ImageModerationConfig controls the vision check run on generated images
+// before they're published
+type ImageModerationConfig struct {
+	Enabled bool
+	// Categories, by lowercase name or ID, where graphic content is also
+	// rejected; identifiable real people are rejected everywhere
+	SensitiveCategories map[string]string
+}
+
+var defaultImageModerationConfig = ImageModerationConfig{
+	Enabled: true,
+	SensitiveCategories: map[string]string{
+		"breaking news": "true",
+		"politics":      "true",
+		"world news":    "true",
+	},
+}
+
+var imageModerationConfig = defaultImageModerationConfig
+
+// loadImageModerationConfig reads IMAGE_MODERATION ("false" to disable) and
+// IMAGE_SENSITIVE_CATEGORIES ("Breaking News,Politics,17")
+func loadImageModerationConfig() ImageModerationConfig {
+	config := defaultImageModerationConfig
+	config.Enabled = os.Getenv("IMAGE_MODERATION") != "false"
+
+	if value := os.Getenv("IMAGE_SENSITIVE_CATEGORIES"); value != "" {
+		config.SensitiveCategories = make(map[string]string)
+		for _, category := range strings.Split(value, ",") {
+			if category = strings.TrimSpace(category); category != "" {
+				config.SensitiveCategories[strings.ToLower(category)] = "true"
+			}
+		}
+	}
+	return config
+}
+
+const imageModerationPrompt = `You are reviewing an AI-generated photo before it illustrates a news article.
+Answer two questions about what is visible:
+- identifiable_people: does it show a person whose face is clear enough to recognize, or who appears to be a specific real public figure?
+- graphic: does it show violence, injury, blood, dead bodies, weapons in use or other disturbing content?
+
+Return JSON in this format:
+{"identifiable_people": false, "graphic": false, "reason": "short explanation"}`
+
+// imageModerationVerdict is Gemini's assessment of an image
+type imageModerationVerdict struct {
+	IdentifiablePeople bool   `json:"identifiable_people"`
+	Graphic            bool   `json:"graphic"`
+	Reason             string `json:"reason"`
+}
+
+// moderateImage checks an image with Gemini vision and returns why it must not
+// be published, or "" when it's acceptable for the article's category
+func (c ImageModerationConfig) moderateImage(ctx context.Context, imagePath string, categoryId int) (string, error) {
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %v", err)
+	}
+
+	client, err := genai.NewClient(ctx, option.WithAPIKey(os.Getenv("GEMINI_API_KEY")))
+	if err != nil {
+		return "", fmt.Errorf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	model := client.GenerativeModel(articleModel)
+	model.SetTemperature(0)
+	model.ResponseMIMEType = "application/json"
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(imagePath)), ".")
+	if format == "jpg" {
+		format = "jpeg"
+	}
+
+	release, err := waitForAPI(ctx, apiGemini)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	resp, err := model.GenerateContent(ctx, genai.ImageData(format, data), genai.Text(imageModerationPrompt))
+	if err != nil {
+		pipelineMetrics.GeminiError("image_moderation")
+		return "", fmt.Errorf("Failed to generate content: %v", err)
+	}
+	recordGeminiUsage(resp.UsageMetadata)
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		// Gemini's own safety filters blocking the review is itself a verdict
+		return "Gemini declined to review the image", nil
+	}
+	textPart, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
+	if !ok {
+		return "", fmt.Errorf("expected text part in response, got: %+v", resp.Candidates[0].Content.Parts[0])
+	}
+
+	var verdict imageModerationVerdict
+	if err := json.Unmarshal([]byte(textPart), &verdict); err != nil {
+		reportLLMParseError("image_moderation", string(textPart), err)
+		return "", fmt.Errorf("error parsing moderation verdict: %v", err)
+	}
+
+	switch {
+	case verdict.IdentifiablePeople:
+		return "identifiable person: " + verdict.Reason, nil
+	case verdict.Graphic && categorySetting(c.SensitiveCategories, categoryId) == "true":
+		return "graphic content in a sensitive category: " + verdict.Reason, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// Image policies for a category
+const (
+	imagePolicyStandard = "standard" // Scenes relevant to the story, which may include people
+	imagePolicySymbolic = "symbolic" // Always symbolic imagery without people
+	imagePolicyAuto     = "auto"     // Symbolic when the story involves deaths, crime or disasters
+)
+
+// sensitiveTopicPattern matches stories about deaths, crime or disasters,
+// where depicting people risks looking like real victims or suspects
+var sensitiveTopicPattern = regexp.MustCompile(`(?i)\b(?:kill(?:s|ed|ing)?|dead|deaths?|died|dies|fatal(?:ly|ity|ities)?|murder(?:s|ed)?|homicide|shoot(?:ing|ings)?|shot|stabb(?:ed|ing)|massacre|terror(?:ism|ist)?|bomb(?:ing)?|explosion|hostages?|kidnap(?:ped|ping)?|assault(?:ed)?|arrest(?:s|ed)?|crimes?|victims?|injur(?:ed|ies)|earthquake|hurricane|tornado|tsunami|floods?|flooding|wildfires?|landslide|crash(?:es|ed)?|derail(?:ed|ment)|disaster)\b`)
+
+// ImagePolicyConfig picks the image prompt style for each category
+type ImagePolicyConfig struct {
+	Default    string
+	ByCategory map[string]string // Lowercase category name or ID -> policy
+}
+
+var defaultImagePolicyConfig = ImagePolicyConfig{
+	Default: imagePolicyStandard,
+	ByCategory: map[string]string{
+		"breaking news": imagePolicyAuto,
+		"world news":    imagePolicyAuto,
+	},
+}
+
+var imagePolicyConfig = defaultImagePolicyConfig
+
+// loadImagePolicyConfig reads IMAGE_POLICY, the policy for categories without
+// their own, and IMAGE_CATEGORY_POLICIES ("Breaking News=symbolic,Sports=standard").
+// Policies are "standard", "symbolic" or "auto".
+func loadImagePolicyConfig() (ImagePolicyConfig, error) {
+	config := defaultImagePolicyConfig
+	if value := os.Getenv("IMAGE_POLICY"); value != "" {
+		config.Default = value
+	}
+	if os.Getenv("IMAGE_CATEGORY_POLICIES") != "" {
+		config.ByCategory = loadCategorySettings("IMAGE_CATEGORY_POLICIES")
+	}
+
+	for _, policy := range append([]string{config.Default}, mapValues(config.ByCategory)...) {
+		switch policy {
+		case imagePolicyStandard, imagePolicySymbolic, imagePolicyAuto:
+		default:
+			return config, fmt.Errorf("unknown image policy %q, expected standard, symbolic or auto", policy)
+		}
+	}
+	return config, nil
+}
+
+// requiresSymbolic reports whether the article's image must avoid depicting people
+func (c ImagePolicyConfig) requiresSymbolic(article GeneratedArticle) bool {
+	policy := categorySetting(c.ByCategory, article.CategoryId)
+	if policy == "" {
+		policy = c.Default
+	}
+	switch policy {
+	case imagePolicySymbolic:
+		return true
+	case imagePolicyAuto:
+		return sensitiveTopicPattern.MatchString(article.Title + "\n" + stripMarkdownTags(article.Article))
+	}
+	return false
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ImageProvider renders an image prompt to a file
+type ImageProvider interface {
+	// Generate writes the image to basePath plus the extension of the format
+	// the provider produces, and returns its full path along with the model
+	// and seed used. Providers that take a seed use the given one, or pick
+	// their own when it's nil; the rest ignore it.
+	Generate(ctx context.Context, prompt string, basePath string, seed *int64) (*GeneratedImage, error)
+}
+
+// errImageDeclined is wrapped by providers when their safety filters refuse a
+// prompt, which is when the fallback provider is tried
+var errImageDeclined = errors.New("image provider declined the prompt")
+
+// imageMaxSeed bounds seeds to what JSON numbers and 32-bit providers accept
+const imageMaxSeed = 1 << 32
+
+// ImageProviderConfig selects the image generators
+type ImageProviderConfig struct {
+	Provider string // "imagen", "openai" or "stablediffusion"
+	Fallback string // Tried when Provider declines a prompt; empty for none
+	// Times a declined prompt is rewritten more conservatively and retried
+	PromptRevisions int
+	// Images rendered per article, of which Gemini vision picks the best
+	Candidates int
+	// Shape of generated images as "width:height"; empty follows the banner
+	// size, so the optimizer crops as little as possible
+	AspectRatio string
+	// Derive seeds from the article so re-running it renders the same image
+	DeterministicSeeds bool
+}
+
+// maxImageCandidates caps IMAGE_CANDIDATES, since every candidate is paid for
+const maxImageCandidates = 3
+
+var defaultImageProviderConfig = ImageProviderConfig{Provider: "imagen", PromptRevisions: 2, Candidates: 2}
+
+var imageProviderConfig = defaultImageProviderConfig
+
+// loadImageProviderConfig reads IMAGE_PROVIDER, IMAGE_FALLBACK_PROVIDER,
+// IMAGE_PROMPT_REVISIONS, IMAGE_CANDIDATES (1 renders a single image),
+// IMAGE_ASPECT_RATIO (e.g. "16:9") and IMAGE_DETERMINISTIC_SEEDS ("true" to enable)
+func loadImageProviderConfig() (ImageProviderConfig, error) {
+	config := defaultImageProviderConfig
+	if value := os.Getenv("IMAGE_PROVIDER"); value != "" {
+		config.Provider = value
+	}
+	config.Fallback = os.Getenv("IMAGE_FALLBACK_PROVIDER")
+
+	revisions, err := getEnvInt("IMAGE_PROMPT_REVISIONS", config.PromptRevisions)
+	if err != nil {
+		return config, err
+	}
+	if revisions < 0 {
+		return config, fmt.Errorf("IMAGE_PROMPT_REVISIONS must not be negative, got %d", revisions)
+	}
+	config.PromptRevisions = revisions
+
+	candidates, err := getEnvInt("IMAGE_CANDIDATES", config.Candidates)
+	if err != nil {
+		return config, err
+	}
+	if candidates < 1 || candidates > maxImageCandidates {
+		return config, fmt.Errorf("IMAGE_CANDIDATES must be between 1 and %d, got %d", maxImageCandidates, candidates)
+	}
+	config.Candidates = candidates
+	config.AspectRatio = os.Getenv("IMAGE_ASPECT_RATIO")
+	config.DeterministicSeeds = os.Getenv("IMAGE_DETERMINISTIC_SEEDS") == "true"
+
+	return config, config.validate()
+}
+
+func (c ImageProviderConfig) validate() error {
+	for _, name := range []string{c.Provider, c.Fallback} {
+		if name != "" && !knownImageProviders[name] {
+			return fmt.Errorf("unknown image provider: %s", name)
+		}
+	}
+	if c.Fallback == c.Provider {
+		return fmt.Errorf("image fallback provider must differ from %s", c.Provider)
+	}
+	if c.AspectRatio != "" {
+		if _, err := parseImageShape(c.AspectRatio); err != nil {
+			return fmt.Errorf("invalid IMAGE_ASPECT_RATIO: %v", err)
+		}
+	}
+	return nil
+}
+
+// aspectRatio returns the width-to-height ratio images are generated at
+func (c ImageProviderConfig) aspectRatio() float64 {
+	if ratio, err := parseImageShape(c.AspectRatio); err == nil {
+		return ratio
+	}
+	return float64(imageConfig.BannerWidth) / float64(imageConfig.BannerHeight)
+}
+
+// seedFor returns the seed for an article's image: a hash of its urlTitle,
+// which identifies the article across runs, or nil for a random seed
+func (c ImageProviderConfig) seedFor(article GeneratedArticle) *int64 {
+	if !c.DeterministicSeeds || article.URLTitle == "" {
+		return nil
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(article.URLTitle))
+	seed := int64(hash.Sum64() % imageMaxSeed)
+	return &seed
+}
+
+// offsetSeed returns the seed for another image rendered alongside the one
+// with seed, or nil when seed is
+func offsetSeed(seed *int64, offset int) *int64 {
+	if seed == nil {
+		return nil
+	}
+	next := (*seed + int64(offset)) % imageMaxSeed
+	return &next
+}
+
+// parseImageShape returns the ratio of an aspect ratio like "16:9" or a size
+// like "1536x1024"
+func parseImageShape(shape string) (float64, error) {
+	width, height, ok := strings.Cut(shape, ":")
+	if !ok {
+		width, height, ok = strings.Cut(shape, "x")
+	}
+	w, errW := strconv.Atoi(strings.TrimSpace(width))
+	h, errH := strconv.Atoi(strings.TrimSpace(height))
+	if !ok || errW != nil || errH != nil || w <= 0 || h <= 0 {
+		return 0, fmt.Errorf("expected a shape like 16:9 or 1536x1024, got %q", shape)
+	}
+	return float64(w) / float64(h), nil
+}
+
+// closestImageShape picks the aspect ratio or size a provider supports that
+// is nearest to ratio, comparing on a log scale so 2:1 and 1:2 are equally far from 1:1
+func closestImageShape(ratio float64, shapes []string) string {
+	best, bestDistance := shapes[0], math.Inf(1)
+	for _, shape := range shapes {
+		shapeRatio, err := parseImageShape(shape)
+		if err != nil {
+			continue
+		}
+		if distance := math.Abs(math.Log(shapeRatio / ratio)); distance < bestDistance {
+			best, bestDistance = shape, distance
+		}
+	}
+	return best
+}
+
+var knownImageProviders = map[string]bool{"imagen": true, "openai": true, "stablediffusion": true}
+
+// newImageProvider creates an image provider by name: "imagen" for Google
+// Imagen through imagen_generator.py, "openai" for gpt-image/DALL-E, or
+// "stablediffusion" for a self-hosted AUTOMATIC1111 or ComfyUI server
+func newImageProvider(name string) (ImageProvider, error) {
+	switch name {
+	case "imagen":
+		return &ImagenProvider{}, nil
+	case "openai":
+		return NewOpenAIImageProvider()
+	case "stablediffusion":
+		return NewStableDiffusionProvider()
+	default:
+		return nil, fmt.Errorf("unknown image provider: %s", name)
+	}
+}
+
+// imageProviderCredits names each provider in the credit line of its images
+var imageProviderCredits = map[string]string{
+	"imagen":          "Google Imagen",
+	"openai":          "OpenAI",
+	"stablediffusion": "Stable Diffusion",
+}
+
+// generateImage renders the prompt with the configured provider, handing it to
+// the fallback provider if the first one declines it. The image records the
+// prompt and the provider that made it.
+func generateImage(ctx context.Context, config ImageProviderConfig, prompt string, basePath string, seed *int64) (*GeneratedImage, error) {
+	provider, err := newImageProvider(config.Provider)
+	if err != nil {
+		return nil, err
+	}
+	image, err := renderImage(ctx, provider, config.Provider, prompt, basePath, seed)
+	if err == nil || config.Fallback == "" || !errors.Is(err, errImageDeclined) {
+		return image, err
+	}
+
+	slog.Warn("Image prompt declined, trying fallback provider", "provider", config.Provider, "fallback", config.Fallback, "error", err)
+	fallback, fallbackErr := newImageProvider(config.Fallback)
+	if fallbackErr != nil {
+		return nil, fmt.Errorf("%v; fallback unavailable: %v", err, fallbackErr)
+	}
+	return renderImage(ctx, fallback, config.Fallback, prompt, basePath, seed)
+}
+
+// renderImage generates the image with the named provider and records the
+// prompt and provider on it
+func renderImage(ctx context.Context, provider ImageProvider, name string, prompt string, basePath string, seed *int64) (*GeneratedImage, error) {
+	image, err := provider.Generate(ctx, prompt, basePath, seed)
+	if err != nil {
+		return nil, err
+	}
+	image.Prompt = prompt
+	image.Provider = name
+	runSpend.Add(spendImage, runBudgetConfig.ImagePrices[name])
+	return image, nil
+}
+
+// imagenModel is the model imagen_generator.py calls
+const imagenModel = "imagen-3.0-generate-002"
+
+// imagenAspectRatios are the aspect ratios Imagen can generate
+var imagenAspectRatios = []string{"16:9", "4:3", "1:1", "3:4", "9:16"}
+
+// ImagenProvider generates images with Google Imagen by running imagen_generator.py
+type ImagenProvider struct{}
+
+// imagenDeclinedMarkers appear in imagen_generator.py's output when Imagen's
+// safety filters drop the image
+var imagenDeclinedMarkers = []string{"no images generated", "safety", "blocked"}
+
+func (p *ImagenProvider) Generate(ctx context.Context, prompt string, basePath string, seed *int64) (*GeneratedImage, error) {
+	outputPath := basePath + ".jpg"
+
+	// Call the Python script with the prompt
+	aspectRatio := closestImageShape(imageProviderConfig.aspectRatio(), imagenAspectRatios)
+	cmd := exec.CommandContext(ctx, "python3", "imagen_generator.py", prompt, outputPath, aspectRatio)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("GEMINI_API_KEY=%s", os.Getenv("GEMINI_API_KEY")))
+
+	outputBytes, err := cmd.CombinedOutput()
+	output := string(outputBytes)
+	if err != nil {
+		for _, marker := range imagenDeclinedMarkers {
+			if strings.Contains(strings.ToLower(output), marker) {
+				return nil, fmt.Errorf("%w: %s", errImageDeclined, output)
+			}
+		}
+		return nil, fmt.Errorf("failed to generate image: %w, output: %s", err, output)
+	}
+
+	// Verify the image was created
+	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("image file was not created")
+	}
+	// The Gemini API doesn't accept a seed for Imagen
+	return &GeneratedImage{Path: outputPath, ImageGenerationInfo: ImageGenerationInfo{Model: imagenModel}}, nil
+}
@@ -0,0 +1,71 @@
+//go:build purego
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/disintegration/imaging"
+	"github.com/gen2brain/webp"
+)
+
+// Image processing in pure Go, selected with -tags purego for builds without
+// libvips. imaging resizes and crops, and gen2brain/webp encodes WebP with
+// libwebp compiled to WebAssembly, so no cgo is needed. It is slower than
+// image-vips.go and, lacking an AVIF encoder, skips the AVIF variants.
+
+// imageFormatSupported reports whether the format can be encoded without libvips
+func imageFormatSupported(format imageFormat) bool {
+	return format == imageFormatWebP || format == imageFormatJPEG
+}
+
+func readImage(inputPath string) ([]byte, error) {
+	return os.ReadFile(inputPath)
+}
+
+// createBanner crops the image to a 16:9 banner of the given width
+func (m *MediaOptimizer) createBanner(buffer []byte, outputPath string, format imageFormat, width int) error {
+	if err := writeCoverImage(buffer, outputPath, format, width, width*m.Image.BannerHeight/m.Image.BannerWidth, m.Image.Quality); err != nil {
+		return fmt.Errorf("failed to create banner: %v", err)
+	}
+	return nil
+}
+
+func (m *MediaOptimizer) createThumbnail(buffer []byte, outputPath string, format imageFormat) error {
+	if err := writeCoverImage(buffer, outputPath, format, m.Image.ThumbSize, m.Image.ThumbSize, m.Image.Quality); err != nil {
+		return fmt.Errorf("failed to create thumbnail: %v", err)
+	}
+	return nil
+}
+
+// writeCoverImage scales the image to cover width x height, crops the center,
+// and writes it in the given format. Only pixels are re-encoded, so EXIF/XMP
+// metadata from the source never reaches the published file.
+func writeCoverImage(buffer []byte, outputPath string, format imageFormat, width, height, quality int) error {
+	if !imageFormatSupported(format) {
+		return fmt.Errorf("unsupported output format %s", format.ext())
+	}
+
+	src, err := imaging.Decode(bytes.NewReader(buffer), imaging.AutoOrientation(true))
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %v", err)
+	}
+	if src.Bounds().Empty() {
+		return fmt.Errorf("image is too small: %dx%d", src.Bounds().Dx(), src.Bounds().Dy())
+	}
+
+	out := imaging.Fill(src, width, height, imaging.Center, imaging.Lanczos)
+
+	var encoded bytes.Buffer
+	if format == imageFormatWebP {
+		err = webp.Encode(&encoded, out, webp.Options{Quality: quality})
+	} else {
+		err = imaging.Encode(&encoded, out, imaging.JPEG, imaging.JPEGQuality(quality))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode image: %v", err)
+	}
+	return os.WriteFile(outputPath, encoded.Bytes(), 0644)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
+)
+
+const imageSelectionPrompt = `You are the photo editor of a news website choosing a banner image for this article:
+Title: %s
+
+The %d images above are candidates, numbered from 1 in the order shown. Score each from 1 to 10 on:
+- relevance: how well it illustrates the story
+- composition: framing, focus and lighting, and how well it works as a wide banner
+- artifact_free: 10 when there are no AI artifacts; lower for distorted hands or faces, garbled text, melted objects or impossible geometry
+
+Return JSON in this format:
+{"scores": [{"candidate": 1, "relevance": 7, "composition": 8, "artifact_free": 9}]}`
+
+// imageCandidateScore is Gemini's rating of one candidate image
+type imageCandidateScore struct {
+	Candidate    int `json:"candidate"`
+	Relevance    int `json:"relevance"`
+	Composition  int `json:"composition"`
+	ArtifactFree int `json:"artifact_free"`
+}
+
+// pickImageCandidate renders the remaining IMAGE_CANDIDATES for the prompt
+// with the provider that made the first image, keeps the one Gemini vision
+// scores best and deletes the rest. The first image is kept when no other
+// candidate renders or scoring fails. Each candidate's seed follows on from
+// the first one's, so deterministic seeds give the same candidates every run.
+func pickImageCandidate(ctx context.Context, article GeneratedArticle, first *GeneratedImage, basePath string, seed *int64) *GeneratedImage {
+	candidates := []*GeneratedImage{first}
+	paths := []string{first.Path}
+	for i := 2; i <= imageProviderConfig.Candidates; i++ {
+		if runSpend.Exceeded() {
+			slog.Warn("Run budget exceeded, rendering no more image candidates", "candidates", len(candidates))
+			break
+		}
+		image, err := generateImage(ctx, ImageProviderConfig{Provider: first.Provider}, first.Prompt, fmt.Sprintf("%s_%d", basePath, i), offsetSeed(seed, i-1))
+		if err != nil {
+			slog.Warn("Failed to render image candidate", "candidate", i, "error", err)
+			continue
+		}
+		candidates = append(candidates, image)
+		paths = append(paths, image.Path)
+	}
+	if len(candidates) == 1 {
+		return first
+	}
+
+	best, err := selectBestImage(ctx, article.Title, paths)
+	if err != nil {
+		slog.Warn("Failed to score image candidates, keeping the first", "error", err)
+		best = 0
+	}
+	for i, path := range paths {
+		if i != best {
+			os.Remove(path)
+		}
+	}
+	return candidates[best]
+}
+
+// selectBestImage asks Gemini vision to score the candidates and returns the
+// index of the highest total, preferring the earlier candidate on ties
+func selectBestImage(ctx context.Context, title string, paths []string) (int, error) {
+	client, err := genai.NewClient(ctx, option.WithAPIKey(os.Getenv("GEMINI_API_KEY")))
+	if err != nil {
+		return 0, fmt.Errorf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	model := client.GenerativeModel(articleModel)
+	model.SetTemperature(0)
+	model.ResponseMIMEType = "application/json"
+
+	var parts []genai.Part
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read image: %v", err)
+		}
+		format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		if format == "jpg" {
+			format = "jpeg"
+		}
+		parts = append(parts, genai.ImageData(format, data))
+	}
+	parts = append(parts, genai.Text(fmt.Sprintf(imageSelectionPrompt, title, len(paths))))
+
+	release, err := waitForAPI(ctx, apiGemini)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	resp, err := model.GenerateContent(ctx, parts...)
+	if err != nil {
+		pipelineMetrics.GeminiError("image_selection")
+		return 0, fmt.Errorf("Failed to generate content: %v", err)
+	}
+	recordGeminiUsage(resp.UsageMetadata)
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		return 0, fmt.Errorf("no scores returned, possible safety filter: %+v", resp)
+	}
+	textPart, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
+	if !ok {
+		return 0, fmt.Errorf("expected text part in response, got: %+v", resp.Candidates[0].Content.Parts[0])
+	}
+
+	var result struct {
+		Scores []imageCandidateScore `json:"scores"`
+	}
+	if err := json.Unmarshal([]byte(textPart), &result); err != nil {
+		reportLLMParseError("image_selection", string(textPart), err)
+		return 0, fmt.Errorf("error parsing image scores: %v", err)
+	}
+	return bestImageCandidate(result.Scores, len(paths))
+}
+
+// bestImageCandidate returns the index of the highest scoring candidate out of count
+func bestImageCandidate(scores []imageCandidateScore, count int) (int, error) {
+	best, bestTotal := -1, 0
+	for _, score := range scores {
+		index := score.Candidate - 1
+		if index < 0 || index >= count {
+			continue
+		}
+		total := score.Relevance + score.Composition + score.ArtifactFree
+		if best == -1 || total > bestTotal || (total == bestTotal && index < best) {
+			best, bestTotal = index, total
+		}
+	}
+	if best == -1 {
+		return 0, fmt.Errorf("no valid scores for %d candidates", count)
+	}
+	slog.Info("Picked image candidate", "candidate", best+1, "candidates", count, "score", bestTotal)
+	return best, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// defaultImageStyles gives each category page a coherent look by adding a
+// style fragment to its image prompts, keyed by lowercase category name or ID
+var defaultImageStyles = map[string]string{
+	"politics":           "Civic documentary photography: government buildings, chambers, podiums, flags and ballot boxes, in sober, even light",
+	"business & finance": "Corporate and financial photography: office towers, trading floors, market screens, currency and industrial sites, in cool, crisp tones",
+	"technology":         "Clean technology photography: devices, circuit boards, data centers and screens, with cool blue accent lighting",
+	"entertainment":      "Entertainment photography: stages, film sets, red carpets and concert lighting, vivid and colorful",
+	"sports":             "Dynamic sports photography: stadiums, fields, courts and equipment, with a sense of motion and dramatic stadium light",
+	"health & wellness":  "Bright, calm health photography: clinics, medical equipment, fresh food and exercise settings, in soft natural light",
+	"science":            "Scientific photography: laboratories, instruments, microscopy, observatories and space, with precise, clinical lighting",
+	"art & culture":      "Cultural photography: galleries, theaters, museums, instruments and artworks, with rich, moody lighting",
+	"travel":             "Travel photography: landmarks, streetscapes and landscapes, in warm golden-hour light",
+	"food & drink":       "Food photography: plated dishes, ingredients, markets and kitchens, in warm close-ups with a shallow depth of field",
+	"environment":        "Nature and environmental photography: landscapes, wildlife, weather and energy infrastructure, in natural light",
+}
+
+var imageStyles = defaultImageStyles
+
+// loadImageStyles reads IMAGE_CATEGORY_STYLES, which replaces the styles of the
+// categories it names. Entries are separated by semicolons, since fragments
+// contain commas: "Sports=Black and white action photography;Travel=Aerial drone photography".
+// An entry with an empty style removes the category's style.
+func loadImageStyles() map[string]string {
+	styles := make(map[string]string, len(defaultImageStyles))
+	for category, style := range defaultImageStyles {
+		styles[category] = style
+	}
+
+	for _, entry := range strings.Split(os.Getenv("IMAGE_CATEGORY_STYLES"), ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		category, style, ok := strings.Cut(entry, "=")
+		category = strings.ToLower(strings.TrimSpace(category))
+		if !ok || category == "" {
+			slog.Warn("Ignoring invalid entry", "variable", "IMAGE_CATEGORY_STYLES", "entry", entry)
+			continue
+		}
+		if style = strings.TrimSpace(style); style == "" {
+			delete(styles, category)
+		} else {
+			styles[category] = style
+		}
+	}
+	return styles
+}
+
+// imageStyleGuideline is the prompt guideline for the category's style, or ""
+// when the category has none
+func imageStyleGuideline(categoryId int) string {
+	style := categorySetting(imageStyles, categoryId)
+	if style == "" {
+		return ""
+	}
+	return "\n**Section Style:** Match the visual identity of this news section: " + style + "."
+}
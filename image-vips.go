@@ -0,0 +1,140 @@
+//go:build !purego
+
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/h2non/bimg"
+)
+
+// Image processing with libvips via bimg. Build with -tags purego to drop the
+// libvips dependency in favour of the slower image-purego.go implementation.
+
+var vipsImageTypes = map[imageFormat]bimg.ImageType{
+	imageFormatWebP: bimg.WEBP,
+	imageFormatAVIF: bimg.AVIF,
+	imageFormatJPEG: bimg.JPEG,
+}
+
+// imageFormatSupported reports whether libvips was built with an encoder for the format
+func imageFormatSupported(format imageFormat) bool {
+	return bimg.IsTypeSupportedSave(vipsImageTypes[format])
+}
+
+func readImage(inputPath string) ([]byte, error) {
+	return bimg.Read(inputPath)
+}
+
+// createBanner crops the image to a 16:9 banner of the given width
+func (m *MediaOptimizer) createBanner(buffer []byte, outputPath string, format imageFormat, width int) error {
+	height := width * m.Image.BannerHeight / m.Image.BannerWidth
+
+	size, err := bimg.NewImage(buffer).Size()
+	if err != nil {
+		return fmt.Errorf("failed to get image dimensions: %v", err)
+	}
+
+	// Calculate resize dimensions
+	widthRatio := float64(width) / float64(size.Width)
+	heightRatio := float64(height) / float64(size.Height)
+	resizeRatio := math.Max(widthRatio, heightRatio)
+	resizedWidth := int(float64(size.Width) * resizeRatio)
+	resizedHeight := int(float64(size.Height) * resizeRatio)
+
+	// Resize image
+	banner, err := bimg.NewImage(buffer).Process(bimg.Options{
+		Width:         resizedWidth,
+		Height:        resizedHeight,
+		Force:         true,
+		Enlarge:       true,
+		Type:          vipsImageTypes[format],
+		Quality:       m.Image.Quality,
+		StripMetadata: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to resize banner: %v", err)
+	}
+
+	// Crop to 16:9
+	resizedSize, err := bimg.NewImage(banner).Size()
+	if err != nil {
+		return fmt.Errorf("failed to get resized dimensions: %v", err)
+	}
+
+	x := (resizedSize.Width - width) / 2
+	y := (resizedSize.Height - height) / 2
+	banner, err = vipsCrop(banner, y, x, width, height, m.Image.Quality)
+	if err != nil {
+		return fmt.Errorf("failed to crop banner: %v", err)
+	}
+
+	return bimg.Write(outputPath, banner)
+}
+
+func (m *MediaOptimizer) createThumbnail(buffer []byte, outputPath string, format imageFormat) error {
+	size, err := bimg.NewImage(buffer).Size()
+	if err != nil {
+		return fmt.Errorf("failed to get image dimensions: %v", err)
+	}
+
+	// Resize maintaining aspect ratio
+	var thumb []byte
+	if size.Height < size.Width {
+		thumb, err = bimg.NewImage(buffer).Process(bimg.Options{
+			Width:         0,
+			Height:        m.Image.ThumbSize,
+			Force:         true,
+			Type:          vipsImageTypes[format],
+			Quality:       m.Image.Quality,
+			StripMetadata: true,
+		})
+	} else {
+		thumb, err = bimg.NewImage(buffer).Process(bimg.Options{
+			Width:         m.Image.ThumbSize,
+			Height:        0,
+			Force:         true,
+			Type:          vipsImageTypes[format],
+			Quality:       m.Image.Quality,
+			StripMetadata: true,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to resize thumbnail: %v", err)
+	}
+
+	// Crop to square
+	resizedSize, err := bimg.NewImage(thumb).Size()
+	if err != nil {
+		return fmt.Errorf("failed to get resized dimensions: %v", err)
+	}
+
+	x := (resizedSize.Width - m.Image.ThumbSize) / 2
+	y := (resizedSize.Height - m.Image.ThumbSize) / 2
+	thumb, err = vipsCrop(thumb, y, x, m.Image.ThumbSize, m.Image.ThumbSize, m.Image.Quality)
+	if err != nil {
+		return fmt.Errorf("failed to crop thumbnail: %v", err)
+	}
+
+	return bimg.Write(outputPath, thumb)
+}
+
+// vipsCrop is bimg's Image.Extract, which doesn't take options, with the
+// encoder quality and metadata stripping kept. Without it libvips copies EXIF/XMP (camera, GPS, author)
+// from the source into the published file.
+func vipsCrop(buffer []byte, top, left, width, height, quality int) ([]byte, error) {
+	options := bimg.Options{
+		Top:           top,
+		Left:          left,
+		AreaWidth:     width,
+		AreaHeight:    height,
+		Quality:       quality,
+		StripMetadata: true,
+	}
+	// Like Extract: bimg treats a zero offset as "no crop" unless Top is -1
+	if top == 0 && left == 0 {
+		options.Top = -1
+	}
+	return bimg.NewImage(buffer).Process(options)
+}
@@ -10,7 +10,7 @@ import json
 import warnings
 warnings.filterwarnings("ignore")
 
-def generate_image(prompt, output_path):
+def generate_image(prompt, output_path, aspect_ratio="16:9"):
     try:
         # Initialize the API with key
         api_key = os.getenv('IMAGEN_API_KEY')
@@ -36,7 +36,7 @@ The image should be high-quality, professional, and suitable for a news website.
                 prompt=formatted_prompt,
                 config=types.GenerateImagesConfig(
                     number_of_images=1,
-                    aspect_ratio="16:9",
+                    aspect_ratio=aspect_ratio,
                     safety_filter_level="BLOCK_LOW_AND_ABOVE",
                     person_generation="ALLOW_ADULT"
                 )
@@ -69,12 +69,13 @@ The image should be high-quality, professional, and suitable for a news website.
         return False
 
 if __name__ == "__main__":
-    if len(sys.argv) != 3:
-        print(json.dumps({"error": "Usage: python imagen_generator.py <prompt> <output_path>"}), file=sys.stderr)
+    if len(sys.argv) not in (3, 4):
+        print(json.dumps({"error": "Usage: python imagen_generator.py <prompt> <output_path> [aspect_ratio]"}), file=sys.stderr)
         sys.exit(1)
     
     prompt = sys.argv[1]
     output_path = sys.argv[2]
-    success = generate_image(prompt, output_path)
+    aspect_ratio = sys.argv[3] if len(sys.argv) == 4 else "16:9"
+    success = generate_image(prompt, output_path, aspect_ratio)
     if not success:
         sys.exit(1)
\ No newline at end of file
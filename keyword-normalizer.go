@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NormalizeKeyword reduces a keyword to a canonical form so that trivially
+// different spellings ("NFL Draft", "nfl draft.", "NFL  drafts") compare equal.
+// It lowercases, replaces punctuation with spaces, applies light suffix
+// stemming to each word and collapses whitespace.
+func NormalizeKeyword(keyword string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			return unicode.ToLower(r)
+		case r == '\'' || r == '’':
+			return -1 // Drop apostrophes so "Trump's" becomes "trumps" rather than "trump s"
+		default:
+			return ' '
+		}
+	}, keyword)
+
+	words := strings.Fields(cleaned)
+	for i, word := range words {
+		words[i] = stemWord(word)
+	}
+	return strings.Join(words, " ")
+}
+
+// uniqueKeywords drops empty keywords and those normalizing to the same form
+// as an earlier one, keeping each keyword's spelling for display
+func uniqueKeywords(keywords []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, keyword := range keywords {
+		keyword = strings.TrimSpace(keyword)
+		n := NormalizeKeyword(keyword)
+		if n == "" || seen[n] {
+			continue
+		}
+		seen[n] = true
+		unique = append(unique, keyword)
+	}
+	return unique
+}
+
+// hasKeyword reports whether any of keywords normalizes to normalized
+func hasKeyword(keywords []string, normalized string) bool {
+	for _, keyword := range keywords {
+		if NormalizeKeyword(keyword) == normalized {
+			return true
+		}
+	}
+	return false
+}
+
+// similarKeyword reports whether any of keywords is more than threshold
+// similar to normalized once it is normalized too, or equal to it
+func similarKeyword(keywords []string, normalized string, threshold float64) bool {
+	for _, keyword := range keywords {
+		other := NormalizeKeyword(keyword)
+		if other == normalized || keywordSimilarity(other, normalized) > threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// keywordSimilarity is the pg_trgm similarity of two normalized keywords: the
+// share of their distinct trigrams that they have in common
+func keywordSimilarity(a string, b string) float64 {
+	trigramsA, trigramsB := keywordTrigrams(a), keywordTrigrams(b)
+	if len(trigramsA) == 0 || len(trigramsB) == 0 {
+		return 0
+	}
+	shared := 0
+	for trigram := range trigramsA {
+		if trigramsB[trigram] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(trigramsA)+len(trigramsB)-shared)
+}
+
+// keywordTrigrams splits each word into trigrams the way pg_trgm does, after
+// padding it with two spaces in front and one behind
+func keywordTrigrams(normalized string) map[string]bool {
+	trigrams := make(map[string]bool)
+	for _, word := range strings.Fields(normalized) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			trigrams[string(padded[i:i+3])] = true
+		}
+	}
+	return trigrams
+}
+
+// stemWord strips common English plural suffixes. It is deliberately
+// conservative: short words and words ending in "ss"/"us"/"is" are left alone.
+func stemWord(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+	switch {
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		return strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "sses"):
+		return strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"), strings.HasSuffix(word, "is"):
+		return word
+	case strings.HasSuffix(word, "s"):
+		return strings.TrimSuffix(word, "s")
+	}
+	return word
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultLocalStorageDir = "public"
+
+// LocalStorage copies media into a local directory for offline development.
+// Files are written to <dir>/<bucket>/<fileName> and addressed by file:// URLs,
+// or under LOCAL_STORAGE_BASE_URL when the directory is served over HTTP.
+type LocalStorage struct {
+	dir     string // Absolute path of the storage root
+	baseURL string // URL the storage root is served from
+}
+
+func init() {
+	RegisterStorageBackend("local", func() (StorageClient, error) {
+		client, err := NewLocalStorage()
+		if err != nil {
+			return nil, fmt.Errorf("error initializing local storage: %v", err)
+		}
+		return client, nil
+	})
+}
+
+// NewLocalStorage reads LOCAL_STORAGE_DIR (default "public") and LOCAL_STORAGE_BASE_URL
+func NewLocalStorage() (*LocalStorage, error) {
+	dir := os.Getenv("LOCAL_STORAGE_DIR")
+	if dir == "" {
+		dir = defaultLocalStorageDir
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOCAL_STORAGE_DIR: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create local storage directory: %v", err)
+	}
+
+	baseURL := strings.TrimSuffix(os.Getenv("LOCAL_STORAGE_BASE_URL"), "/")
+	if baseURL == "" {
+		baseURL = (&url.URL{Scheme: "file", Path: filepath.ToSlash(dir)}).String()
+	} else if _, err := url.ParseRequestURI(baseURL); err != nil {
+		return nil, fmt.Errorf("LOCAL_STORAGE_BASE_URL must be a URL like \"http://localhost:8080/media\", got %q", baseURL)
+	}
+
+	return &LocalStorage{dir: dir, baseURL: baseURL}, nil
+}
+
+// Upload copies a file into the storage directory and returns its URL
+func (l *LocalStorage) Upload(ctx context.Context, filePath string, bucket string, fileName string) (string, error) {
+	bucket = strings.Trim(bucket, "\"")
+
+	bucketDir := filepath.Join(l.dir, bucket)
+	if err := os.MkdirAll(bucketDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create bucket directory: %v", err)
+	}
+
+	src, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+	defer src.Close()
+
+	dst, err := os.Create(filepath.Join(bucketDir, fileName))
+	if err != nil {
+		return "", fmt.Errorf("failed to create stored file: %v", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return "", fmt.Errorf("failed to copy file: %v", err)
+	}
+	if err := dst.Close(); err != nil {
+		return "", fmt.Errorf("failed to write stored file: %v", err)
+	}
+
+	return l.PublicURL(bucket, fileName), nil
+}
+
+// PublicURL returns the URL a stored file is addressed by
+func (l *LocalStorage) PublicURL(bucket string, fileName string) string {
+	return l.baseURL + "/" + url.PathEscape(strings.Trim(bucket, "\"")) + "/" + url.PathEscape(fileName)
+}
+
+// Exists reports whether the file is in the storage directory
+func (l *LocalStorage) Exists(ctx context.Context, bucket string, fileName string) (bool, error) {
+	_, err := os.Stat(filepath.Join(l.dir, strings.Trim(bucket, "\""), fileName))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check file: %v", err)
+	}
+	return true, nil
+}
+
+// Delete removes a stored file given the URL returned by Upload
+func (l *LocalStorage) Delete(publicURL string) error {
+	prefix := l.baseURL + "/"
+	if !strings.HasPrefix(publicURL, prefix) {
+		return fmt.Errorf("not a local storage URL: %s", publicURL)
+	}
+
+	// URLs have the form <prefix><bucket>/<fileName>
+	parts := strings.SplitN(strings.TrimPrefix(publicURL, prefix), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("malformed storage URL: %s", publicURL)
+	}
+	bucket, err := url.PathUnescape(parts[0])
+	if err != nil {
+		return fmt.Errorf("malformed storage URL: %s", publicURL)
+	}
+	fileName, err := url.PathUnescape(parts[1])
+	if err != nil {
+		return fmt.Errorf("malformed storage URL: %s", publicURL)
+	}
+	// Never follow a crafted URL outside the storage directory
+	if bucket != filepath.Base(bucket) || fileName != filepath.Base(fileName) {
+		return fmt.Errorf("malformed storage URL: %s", publicURL)
+	}
+
+	if err := os.Remove(filepath.Join(l.dir, bucket, fileName)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file: %v", err)
+	}
+	return nil
+}
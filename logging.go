@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// LogConfig controls the process's logger
+type LogConfig struct {
+	Level  slog.Level // Least severe level written
+	Format string     // "text", or "json" for log aggregation
+}
+
+var defaultLogConfig = LogConfig{
+	Level:  slog.LevelInfo,
+	Format: "text",
+}
+
+// loadLogConfig reads LOG_LEVEL (debug, info, warn or error) and LOG_FORMAT
+// (text or json)
+func loadLogConfig() (LogConfig, error) {
+	config := defaultLogConfig
+	if level := os.Getenv("LOG_LEVEL"); level != "" {
+		if err := config.Level.UnmarshalText([]byte(level)); err != nil {
+			return config, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error, got %q", level)
+		}
+	}
+	if format := os.Getenv("LOG_FORMAT"); format != "" {
+		config.Format = strings.ToLower(format)
+	}
+	if config.Format != "text" && config.Format != "json" {
+		return config, fmt.Errorf("LOG_FORMAT must be text or json, got %q", config.Format)
+	}
+	return config, nil
+}
+
+// setupLogging makes the configured logger the default. Anything still
+// written through the log package goes to it too, at info level.
+func setupLogging(config LogConfig) {
+	options := &slog.HandlerOptions{Level: config.Level}
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, options)
+	if config.Format == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// fatal logs and reports an error and exits, for failures the process can't
+// run past. args are key/value pairs as for slog; an error among them is
+// reported as the cause.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+
+	cause := errors.New(msg)
+	var tags []any
+	for i := 0; i+1 < len(args); i += 2 {
+		if err, ok := args[i+1].(error); ok {
+			cause = err
+			continue
+		}
+		tags = append(tags, args[i], args[i+1])
+	}
+	reportFailure(withReportTags(context.Background(), tags...), reportLevelFatal, msg, cause, nil)
+	errorReporter.Flush(errorReportFlushTimeout)
+	os.Exit(1)
+}
+
+type loggerKey struct{}
+
+// withLogger returns a context carrying logger, so the fields it was built
+// with (run, mode, keyword) follow the work it is handed to
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// loggerFrom returns the logger ctx carries, or the default logger
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// withFields returns a context whose log lines and error reports carry the
+// key/value pairs in args
+func withFields(ctx context.Context, args ...any) context.Context {
+	return withReportTags(withLogger(ctx, loggerFrom(ctx).With(args...)), args...)
+}
+
+// runLogger returns a context that tags everything with a new run ID and the
+// mode it runs in, along with the ID
+func runLogger(ctx context.Context, mode string) (context.Context, string) {
+	runID := uuid.NewString()
+	return withFields(ctx, "run", runID, "mode", mode), runID
+}
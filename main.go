@@ -2,64 +2,410 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"log"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
-	"github.com/playwright-community/playwright-go"
 )
 
-type ArticleData struct {
-    Keyword   string
-    Articles  []ArticleContent
-    Summaries map[string]string
-}
-
 type ArticleContent struct {
-    URL     string
-    Title   string
-    Content string
+    URL         string
+    Title       string
+    Content     string
+    PublishedAt *time.Time
+    ImageURL    string // og:image of the page; empty when it has none
+    ImageWidth  int    // Width declared by og:image:width, 0 when undeclared
 }
 
 func main() {
 	// Parse command line flags
-	mode := flag.String("mode", "", "Mode to run: 'daily' or 'recent'")
+	mode := flag.String("mode", "", "Mode to run: 'daily', 'recent', 'daemon', 'backfill', 'weekly', 'podcast', 'cleanup', 'dbcheck', 'preflight', 'pause', 'resume', 'summary' or 'categories'")
+	categoryAction := flag.String("category-action", "list", "Categories mode action: 'list', 'add' or 'seed'")
+	categoryName := flag.String("category-name", "", "Name of the category to add with -category-action=add")
+	fromDate := flag.String("from", "", "First day to backfill, e.g. 2025-03-01 (backfill mode)")
+	toDate := flag.String("to", "", "Last day to backfill, defaults to -from (backfill mode)")
+	backfillTrends := flag.String("backfill-trends", "", "Only backfill topics picked by 'daily' or 'recent' runs (backfill mode)")
+	disableAudio := flag.Bool("disable-audio", false, "Publish articles without audio (or set DISABLE_AUDIO=true)")
+	disableImage := flag.Bool("disable-image", false, "Publish articles without images (or set DISABLE_IMAGE=true)")
+	imageProvider := flag.String("image-provider", "", "Image provider for this run: 'imagen', 'openai' or 'stablediffusion' (overrides IMAGE_PROVIDER)")
+	skipPlaywrightInstall := flag.Bool("skip-playwright-install", false, "Only check the Playwright browsers are installed instead of installing them (or set PLAYWRIGHT_INSTALL=false)")
+	pauseReason := flag.String("reason", "", "Why the pipeline is being paused, shown to whoever resumes it (pause mode)")
+	configFile := flag.String("config", "", "YAML config file (or set CONFIG_FILE); defaults to config.yaml when present. Environment variables override it")
 	flag.Parse()
 
 	if *mode == "" {
-		log.Fatal("Mode is required: use -mode=daily or -mode=recent")
+		fatal("Mode is required: use -mode=daily, -mode=recent, -mode=daemon, -mode=backfill, -mode=weekly, -mode=podcast, -mode=cleanup, -mode=dbcheck, -mode=preflight, -mode=pause, -mode=resume, -mode=summary or -mode=categories")
 	}
 
 	// Load .env file
 	if err := godotenv.Load(); err != nil {
-		log.Printf("Warning: Error loading .env file: %v", err)
+		slog.Warn("Error loading .env file", "error", err)
+	}
+
+	// The config file only fills in variables the environment leaves unset,
+	// so it has to be applied before anything reads them
+	configPath := configFilePath(*configFile)
+	configSettings := 0
+	if configPath != "" {
+		applied, err := loadConfigFile(configPath)
+		if err != nil {
+			fatal("Invalid configuration file", "error", err)
+		}
+		configSettings = applied
+	}
+
+	logConfig, err := loadLogConfig()
+	if err != nil {
+		fatal("Invalid logging configuration", "error", err)
+	}
+	setupLogging(logConfig)
+	if configPath != "" {
+		slog.Info("Loaded configuration file", "path", configPath, "settings", configSettings)
+	}
+
+	reporter, err := loadErrorReporter()
+	if err != nil {
+		fatal("Invalid error reporting configuration", "error", err)
+	}
+	errorReporter = reporter
+	defer errorReporter.Flush(errorReportFlushTimeout)
+
+	if err := loadAppTimezone(); err != nil {
+		fatal("Invalid timezone configuration", "error", err)
+	}
+
+	// Initialize database and storage; preflight reports a failure to connect
+	// alongside its other checks instead of exiting
+	dbErr := initDB()
+	if dbErr != nil && *mode != "preflight" {
+		fatal("Error initializing database", "error", dbErr)
+	}
+
+	storageErr := initStorage()
+	if storageErr != nil && *mode != "preflight" {
+		fatal("Error initializing media storage", "error", storageErr)
+	}
+
+	config, err := loadImageConfig()
+	if err != nil {
+		fatal("Invalid image configuration", "error", err)
+	}
+	imageConfig = config
+
+	bookends, err := loadAudioBookendConfig()
+	if err != nil {
+		fatal("Invalid audio intro/outro configuration", "error", err)
+	}
+	audioBookendConfig = bookends
+
+	dialogue, err := loadDialogueConfig()
+	if err != nil {
+		fatal("Invalid audio dialogue configuration", "error", err)
+	}
+	dialogueConfig = dialogue
+
+	music, err := loadMusicBedConfig()
+	if err != nil {
+		fatal("Invalid audio music bed configuration", "error", err)
+	}
+	musicBedConfig = music
+
+	podcast, err := loadPodcastConfig()
+	if err != nil {
+		fatal("Invalid podcast configuration", "error", err)
+	}
+	podcastConfig = podcast
+
+	sitemap, err := loadSitemapConfig()
+	if err != nil {
+		fatal("Invalid sitemap configuration", "error", err)
+	}
+	sitemapConfig = sitemap
+
+	tts, err := loadTTSConfig()
+	if err != nil {
+		fatal("Invalid TTS configuration", "error", err)
+	}
+	ttsConfig = tts
+
+	chain, err := loadTTSChainConfig()
+	if err != nil {
+		fatal("Invalid TTS provider chain configuration", "error", err)
+	}
+	ttsChainConfig = chain
+
+	mediaToggles = loadMediaToggles()
+	mediaToggles.DisableAudio = mediaToggles.DisableAudio || *disableAudio
+	mediaToggles.DisableImage = mediaToggles.DisableImage || *disableImage
+	if mediaToggles.DisableAudio || mediaToggles.DisableImage {
+		slog.Info("Media generation disabled", "audio", mediaToggles.DisableAudio, "image", mediaToggles.DisableImage)
+	}
+
+	images, err := loadImageProviderConfig()
+	if *imageProvider != "" {
+		images.Provider = *imageProvider
+		err = images.validate()
+	}
+	if err != nil {
+		fatal("Invalid image provider configuration", "error", err)
+	}
+	imageProviderConfig = images
+	imageModerationConfig = loadImageModerationConfig()
+
+	policy, err := loadImagePolicyConfig()
+	if err != nil {
+		fatal("Invalid image policy configuration", "error", err)
+	}
+	imagePolicyConfig = policy
+	imageStyles = loadImageStyles()
+
+	sourceImages, err := loadSourceImageConfig()
+	if err != nil {
+		fatal("Invalid source image configuration", "error", err)
+	}
+	sourceImageConfig = sourceImages
+
+	workers, err := loadPipelineWorkers()
+	if err != nil {
+		fatal("Invalid pipeline worker configuration", "error", err)
+	}
+	pipelineWorkers = workers
+
+	retries, err := loadJobRetryConfig()
+	if err != nil {
+		fatal("Invalid job retry configuration", "error", err)
 	}
+	jobRetryConfig = retries
 
-	// Initialize database
-	if err := initDB(); err != nil {
-		log.Fatalf("Error initializing database: %v", err)
+	timeout, err := loadTopicTimeout()
+	if err != nil {
+		fatal("Invalid topic timeout configuration", "error", err)
+	}
+	topicTimeout = timeout
+
+	limits, err := loadTopicLimits()
+	if err != nil {
+		fatal("Invalid topic limit configuration", "error", err)
+	}
+	topicLimits = limits
+
+	geo, err := loadTrendsGeo()
+	if err != nil {
+		fatal("Invalid trends geo configuration", "error", err)
+	}
+	trendsGeo = geo
+	loadArticleModel()
+
+	budget, err := loadRunBudgetConfig()
+	if err != nil {
+		fatal("Invalid run budget configuration", "error", err)
+	}
+	runBudgetConfig = budget
+
+	rates, err := loadRateLimitConfig()
+	if err != nil {
+		fatal("Invalid rate limit configuration", "error", err)
+	}
+	rateLimitConfig = rates
+
+	webhooks, err := loadWebhookConfig()
+	if err != nil {
+		fatal("Invalid webhook configuration", "error", err)
+	}
+	webhookConfig = webhooks
+
+	proxies, err := loadProxyPoolConfig()
+	if err != nil {
+		fatal("Invalid proxy configuration", "error", err)
 	}
+	proxyPoolConfig = proxies
+
+	summaryEmail, err := loadSummaryEmailConfig()
+	if err != nil {
+		fatal("Invalid summary email configuration", "error", err)
+	}
+	summaryEmailConfig = summaryEmail
+
+	newsletterEmail, err := loadEmailConfig()
+	if err != nil {
+		fatal("Invalid newsletter email configuration", "error", err)
+	}
+	emailConfig = newsletterEmail
+
+	// Maintenance mode doesn't need the scraping pipeline
+	if *mode == "cleanup" {
+		config, err := loadCleanupConfig()
+		if err != nil {
+			fatal("Invalid cleanup configuration", "error", err)
+		}
+		if err := RunCleanup(config); err != nil {
+			fatal("Error running cleanup", "error", err)
+		}
+		slog.Info("Completed cleanup")
+		return
+	}
+
+	// Runs the DBClient conformance suite against the configured backend
+	if *mode == "dbcheck" {
+		if os.Getenv("DB_TYPE") == "prod" {
+			fatal("Refusing to run the database conformance check against DB_TYPE=prod")
+		}
+		if err := RunDBClientConformance(dbClient); err != nil {
+			fatal("Database conformance check failed", "error", err)
+		}
+		slog.Info("Database conformance check passed")
+		return
+	}
+
+	// The weekly digest only ranks articles already in the database
+	if *mode == "weekly" {
+		ctx, _ := runLogger(context.Background(), "weekly")
+		if err := RunWeeklyDigest(ctx); err != nil {
+			fatal("Error running weekly digest", "error", err)
+		}
+		slog.Info("Completed weekly digest")
+		return
+	}
+
+	// Rebuilds today's podcast episode and feed from audio already in storage
+	if *mode == "podcast" {
+		if err := RunDailyPodcast(podcastConfig); err != nil {
+			fatal("Error building podcast episode", "error", err)
+		}
+		slog.Info("Completed podcast episode")
+		return
+	}
+
+	if *mode == "categories" {
+		if err := RunCategoryCommand(*categoryAction, *categoryName); err != nil {
+			fatal("Error managing categories", "error", err)
+		}
+		return
+	}
+
+	// Checks every dependency a scheduled run needs, e.g. before enabling the daemon
+	if *mode == "preflight" {
+		if err := RunPreflight(dbErr, storageErr); err != nil {
+			fatal("Preflight failed", "error", err)
+		}
+		slog.Info("Preflight passed")
+		return
+	}
+
+	// Emails the last day's summary now, without the daemon's run history
+	if *mode == "summary" {
+		if err := SendRunSummary(nil); err != nil {
+			fatal("Error sending summary email", "error", err)
+		}
+		return
+	}
+
+	// The kill switch, for when the admin API isn't reachable
+	if *mode == "pause" || *mode == "resume" {
+		if err := RunPipelineControl(*mode == "pause", *pauseReason); err != nil {
+			fatal("Error changing pipeline control", "error", err)
+		}
+		return
+	}
+
+	// A paused pipeline runs nothing; the daemon checks before each of its runs
+	if *mode != "daemon" {
+		if paused, reason := pipelinePaused(); paused {
+			slog.Warn("Pipeline paused, not running", "reason", reason)
+			return
+		}
+	}
+
+	// Generating content is slow and costly, so make sure it can be stored first
+	if err := checkStorageBuckets(); err != nil {
+		fatal("Media storage check failed", "error", err)
+	}
+
+	startMetricsServer()
 
 	go StartSummarizer()
 
 	time.Sleep(2 * time.Second)
 
-	// Install Playwright browsers
-	if err := playwright.Install(); err != nil {
-		log.Fatalf("Error installing playwright: %v", err)
+	// Install Playwright browsers, or check they were installed with the image
+	if err := setupPlaywright(*skipPlaywrightInstall); err != nil {
+		fatal("Playwright is not ready", "error", err)
+	}
+
+	grace, err := loadShutdownGracePeriod()
+	if err != nil {
+		fatal("Invalid shutdown configuration", "error", err)
+	}
+	ctx := notifyShutdown(grace)
+
+	// Backfill mode generates the articles missing for topics accepted on past days
+	if *mode == "backfill" {
+		from, to, err := parseBackfillRange(*fromDate, *toDate)
+		if err != nil {
+			fatal("Invalid backfill range", "error", err)
+		}
+		ctx, _ := runLogger(ctx, backfillMode)
+		ctx = withProxySession(ctx, proxyPool.Session(trendsGeo))
+		if err := RunBackfill(ctx, from, to, *backfillTrends); err != nil {
+			fatal("Error running backfill", "error", err)
+		}
+		slog.Info("Completed backfill")
+		return
+	}
+
+	// Daemon mode keeps running the scheduled fetches instead of relying on an external cron
+	if *mode == "daemon" {
+		schedule, err := loadScheduleConfig()
+		if err != nil {
+			fatal("Invalid schedule configuration", "error", err)
+		}
+		scheduler, err := NewTrendScheduler(ctx, schedule)
+		if err != nil {
+			fatal("Error creating scheduler", "error", err)
+		}
+		if len(summaryEmailConfig.To) > 0 {
+			if err := scheduler.ScheduleSummaryEmail(summaryEmailConfig.Cron); err != nil {
+				fatal("Error creating scheduler", "error", err)
+			}
+		}
+		admin, err := loadAdminAPIConfig()
+		if err != nil {
+			fatal("Invalid admin API configuration", "error", err)
+		}
+		scheduler.Start()
+		slog.Info("Scheduler started", "dailyCron", schedule.DailyCron, "recentCron", schedule.RecentCron, "timezone", appLocation.String(),
+			"nextDaily", schedule.nextRun("daily"), "nextRecent", schedule.nextRun("recent"),
+			"dailyJitter", schedule.DailyJitter, "recentJitter", schedule.RecentJitter)
+		adminServer := startAdminAPI(admin, scheduler)
+
+		<-ctx.Done()
+		if adminServer != nil {
+			adminServer.Close()
+		}
+		slog.Info("Stopping scheduler")
+		<-scheduler.Stop().Done()
+		slog.Info("Scheduler stopped")
+		return
 	}
 
 	// Run once for the specified mode
-	log.Printf("Starting trend fetch for mode: %s", *mode)
-	topics, err := GetTrendingKeywordsWithMode(*mode)
+	ctx, _ = runLogger(ctx, *mode)
+	ctx = withProxySession(ctx, proxyPool.Session(trendsGeo))
+	logger := loggerFrom(ctx)
+	logger.Info("Starting trend fetch")
+	topics, err := GetTrendingKeywordsWithMode(ctx, *mode)
 	if err != nil {
-		log.Fatalf("Error fetching %s trends: %v", *mode, err)
+		fatal("Error fetching trends", "mode", *mode, "error", err)
 	}
 
 	// Process the topics
-	processTopics(topics, *mode)
-	log.Printf("Completed trend fetch for mode: %s", *mode)
+	processTopics(ctx, topics, *mode)
+	logger.Info("Completed trend fetch")
 }
 
 // filterArticlesByURLs returns only the articles whose URLs are in the provided URLs slice
@@ -76,4 +422,24 @@ func filterArticlesByURLs(articles []ArticleContent, urls []string) []ArticleCon
         }
     }
     return filtered
-}
\ No newline at end of file
+}
+
+// buildArticleSources describes the scraped articles behind the given URLs for citation
+func buildArticleSources(articles []ArticleContent, urls []string) []ArticleSource {
+    var sources []ArticleSource
+    for _, article := range filterArticlesByURLs(articles, urls) {
+        domain := ""
+        if parsed, err := url.Parse(article.URL); err == nil {
+            domain = strings.TrimPrefix(parsed.Hostname(), "www.")
+        }
+        sources = append(sources, ArticleSource{
+            URL:         article.URL,
+            Title:       article.Title,
+            Domain:      domain,
+            PublishedAt: article.PublishedAt,
+            ImageURL:    article.ImageURL,
+            ImageWidth:  article.ImageWidth,
+        })
+    }
+    return sources
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Articles are written with a small set of inline tags (see the article
+// prompt): [bold], [italic], [bold-italic] and [underline-italic] wrap text
+// and [p] separates paragraphs. The site renders them; anything that needs
+// plain text, like narration and prompts, goes through renderPlainText.
+
+const paragraphTag = "[p]"
+
+// formattingTagPattern matches opening and closing formatting tags
+var formattingTagPattern = regexp.MustCompile(`\[/?(?:bold|italic|bold-italic|underline-italic)\]`)
+
+// renderPlainText returns the paragraphs of tagged content as plain text,
+// with formatting removed, whitespace collapsed and empty paragraphs dropped
+func renderPlainText(content string) []string {
+	var paragraphs []string
+	for _, paragraph := range strings.Split(content, paragraphTag) {
+		paragraph = formattingTagPattern.ReplaceAllString(paragraph, "")
+		if paragraph = strings.Join(strings.Fields(paragraph), " "); paragraph != "" {
+			paragraphs = append(paragraphs, paragraph)
+		}
+	}
+	return paragraphs
+}
+
+// stripMarkdownTags renders tagged content as a single line of plain text
+func stripMarkdownTags(content string) string {
+	return strings.Join(renderPlainText(content), " ")
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"expvar"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MediaStats aggregates optimizations of one kind of media asset
+type MediaStats struct {
+	Count       int           `json:"count"`
+	Duration    time.Duration `json:"durationNs"`
+	InputBytes  int64         `json:"inputBytes"`
+	OutputBytes int64         `json:"outputBytes"`
+}
+
+// Ratio is the output size as a fraction of the input size (lower is better)
+func (s MediaStats) Ratio() float64 {
+	if s.InputBytes == 0 {
+		return 0
+	}
+	return float64(s.OutputBytes) / float64(s.InputBytes)
+}
+
+// MediaMetrics counts optimization time and sizes per asset kind ("image", "audio")
+// for the lifetime of the process
+type MediaMetrics struct {
+	mu    sync.Mutex
+	stats map[string]MediaStats
+}
+
+var mediaMetrics = &MediaMetrics{stats: make(map[string]MediaStats)}
+
+func init() {
+	// Served at /debug/vars when METRICS_ADDR is set
+	expvar.Publish("media", expvar.Func(func() any {
+		return mediaMetrics.Snapshot()
+	}))
+}
+
+// Record adds one optimized asset and logs its numbers
+func (m *MediaMetrics) Record(kind string, duration time.Duration, inputBytes, outputBytes int64) {
+	m.mu.Lock()
+	stats := m.stats[kind]
+	stats.Count++
+	stats.Duration += duration
+	stats.InputBytes += inputBytes
+	stats.OutputBytes += outputBytes
+	m.stats[kind] = stats
+	m.mu.Unlock()
+
+	asset := MediaStats{Count: 1, Duration: duration, InputBytes: inputBytes, OutputBytes: outputBytes}
+	slog.Debug("Optimized media", "kind", kind, "duration", duration.Round(time.Millisecond), "inputBytes", inputBytes, "outputBytes", outputBytes, "ratio", asset.Ratio())
+}
+
+// Snapshot returns a copy of the totals so far
+func (m *MediaMetrics) Snapshot() map[string]MediaStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := make(map[string]MediaStats, len(m.stats))
+	for kind, stats := range m.stats {
+		snapshot[kind] = stats
+	}
+	return snapshot
+}
+
+// LogSince logs the totals recorded after the given snapshot, one line per asset kind
+func (m *MediaMetrics) LogSince(logger *slog.Logger, before map[string]MediaStats) {
+	after := m.Snapshot()
+
+	var kinds []string
+	for kind := range after {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	for _, kind := range kinds {
+		run := after[kind]
+		previous := before[kind]
+		run.Count -= previous.Count
+		run.Duration -= previous.Duration
+		run.InputBytes -= previous.InputBytes
+		run.OutputBytes -= previous.OutputBytes
+		if run.Count == 0 {
+			continue
+		}
+		logger.Info("Optimized media",
+			"kind", kind, "assets", run.Count, "duration", run.Duration.Round(time.Millisecond),
+			"inputBytes", run.InputBytes, "outputBytes", run.OutputBytes,
+			"ratio", run.Ratio(), "bytesPerAsset", run.OutputBytes/int64(run.Count))
+	}
+}
+
+// startMetricsServer serves expvar metrics, including the media totals, at
+// http://<METRICS_ADDR>/debug/vars and the pipeline metrics for Prometheus at
+// http://<METRICS_ADDR>/metrics. Nothing is served when METRICS_ADDR is unset.
+func startMetricsServer() {
+	addr := os.Getenv("METRICS_ADDR")
+	if addr == "" {
+		return
+	}
+	http.Handle("/metrics", pipelineMetrics)
+	go func() {
+		slog.Info("Serving metrics at /debug/vars and /metrics", "addr", addr)
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			slog.Warn("Metrics server stopped", "error", err)
+		}
+	}()
+}
+
+// fileSizes returns the combined size of the files, skipping any that are missing
+func fileSizes(paths ...string) int64 {
+	var total int64
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffedContentTypes lists the content types http.DetectContentType may report
+// for each uploadable extension. AVIF isn't sniffed by the standard library and
+// is only accepted through isAVIF.
+var sniffedContentTypes = map[string][]string{
+	".avif": {},
+	".webp": {"image/webp"},
+	".jpg":  {"image/jpeg"},
+	".jpeg": {"image/jpeg"},
+	".png":  {"image/png"},
+	".mp3":  {"audio/mpeg"},
+	".vtt":  {"text/plain; charset=utf-8"},
+}
+
+// validateMediaContent checks that a file's contents match its extension, so a
+// truncated or mislabelled file from a generator is never published
+func validateMediaContent(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %v", err)
+	}
+	defer file.Close()
+
+	// DetectContentType considers at most the first 512 bytes
+	header := make([]byte, 512)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return fmt.Errorf("%s is empty", filepath.Base(filePath))
+		}
+		return fmt.Errorf("failed to read file: %v", err)
+	}
+	header = header[:n]
+
+	ext := strings.ToLower(filepath.Ext(filePath))
+	// Formats the standard library doesn't sniff
+	switch {
+	case ext == ".avif" && isAVIF(header):
+		return nil
+	case ext == ".mp3" && isMP3Frame(header):
+		return nil
+	}
+
+	detected := http.DetectContentType(header)
+	allowed, known := sniffedContentTypes[ext]
+	if !known {
+		return fmt.Errorf("refusing to upload %s: unsupported extension %q", filepath.Base(filePath), ext)
+	}
+	for _, contentType := range allowed {
+		if detected == contentType {
+			return nil
+		}
+	}
+	return fmt.Errorf("refusing to upload %s: content is %s, which doesn't match its extension", filepath.Base(filePath), detected)
+}
+
+// isAVIF checks for an ISO-BMFF "ftyp" box with an AVIF brand
+func isAVIF(header []byte) bool {
+	if len(header) < 12 || !bytes.Equal(header[4:8], []byte("ftyp")) {
+		return false
+	}
+	brand := string(header[8:12])
+	return brand == "avif" || brand == "avis"
+}
+
+// isMP3Frame checks for an MPEG audio frame sync, which starts MP3 files written without an ID3 tag
+func isMP3Frame(header []byte) bool {
+	return len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0
+}
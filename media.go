@@ -1,29 +1,145 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"os"
+	"time"
 )
 
-// GenerateMediaAssets creates audio and image files for a news article
-func GenerateMediaAssets(article GeneratedArticle) (NewsMediaAssets, bool, error) {
+// MediaToggles turn off generating audio or images, e.g. to test the text
+// pipeline cheaply or ride out a provider outage
+type MediaToggles struct {
+	DisableAudio bool
+	DisableImage bool
+}
+
+var mediaToggles MediaToggles
+
+// loadMediaToggles reads DISABLE_AUDIO and DISABLE_IMAGE ("true" to disable);
+// the -disable-audio and -disable-image flags also turn them on
+func loadMediaToggles() MediaToggles {
+	return MediaToggles{
+		DisableAudio: os.Getenv("DISABLE_AUDIO") == "true",
+		DisableImage: os.Getenv("DISABLE_IMAGE") == "true",
+	}
+}
+
+// GenerateMediaAssets creates audio and image files for a news article. The
+// flagship story gets two-host dialogue audio when AUDIO_DIALOGUE is enabled.
+// Media turned off by mediaToggles is left out, and the image counts as failed.
+func GenerateMediaAssets(ctx context.Context, logger *slog.Logger, article GeneratedArticle, flagship bool) (NewsMediaAssets, bool, error) {
 	assets := NewsMediaAssets{}
-	imageSuccess := true
 
-	// Generate audio file using text-to-speech (assuming you have this function)
-	audioPath, err := GenerateAudioFile(article.Article)
-	if err != nil {
-		return assets, imageSuccess, fmt.Errorf("failed to generate audio: %v", err)
+	// Over the run budget, articles are published text-only
+	if runSpend.Exceeded() {
+		logger.Warn("Run budget exceeded, skipping audio and image")
+		return assets, false, nil
+	}
+
+	if !mediaToggles.DisableAudio {
+		start := time.Now()
+		audioPath, err := generateArticleAudio(ctx, logger, article, flagship)
+		observeStage(article.Keyword, stageAudio, time.Since(start))
+		if err != nil {
+			return assets, true, fmt.Errorf("failed to generate audio: %v", err)
+		}
+		assets.AudioPath = audioPath
+		if _, err := os.Stat(transcriptPathFor(audioPath)); audioPath != "" && err == nil {
+			assets.TranscriptPath = transcriptPathFor(audioPath)
+		}
+	}
+
+	if mediaToggles.DisableImage {
+		return assets, false, nil
+	}
+	if runSpend.Exceeded() {
+		logger.Warn("Run budget exceeded, skipping image")
+		return assets, false, nil
+	}
+	start := time.Now()
+	defer func() { observeStage(article.Keyword, stageImage, time.Since(start)) }()
+
+	// The source-first strategy prefers a photo from a source we may reuse
+	if sourceImageConfig.Strategy == imageStrategySourceFirst {
+		photo, err := sourceImageConfig.GetSourceImage(article)
+		if err == nil {
+			assets.ImagePath = photo.Path
+			altText, err := GenerateImageAltText(ctx, photo.Path)
+			if err != nil {
+				logger.Warn("Failed to generate image alt text, using the title", "error", err)
+				altText = article.Title
+			}
+			assets.ImageAltText = altText
+			assets.ImageCredit = photo.Credit
+			assets.ImageCreditURL = photo.CreditURL
+			return assets, true, nil
+		}
+		logger.Warn("No source image, generating one", "error", err)
 	}
-	assets.AudioPath = audioPath
 
 	// Generate and save the image using GetNewsImage (which internally uses Gemini Flash 2)
-	imagePath, err := GetNewsImage(article)
+	imageSuccess := true
+	image, err := GetNewsImage(ctx, article)
 	if err != nil {
-		fmt.Printf("Warning: Failed to generate image: %v\n", err)
+		logger.Warn("Failed to generate image", "error", err)
 		imageSuccess = false
 	} else {
-		assets.ImagePath = imagePath
+		assets.ImagePath = image.Path
+
+		// Describe the image for screen readers, falling back to its prompt
+		altText, err := GenerateImageAltText(ctx, image.Path)
+		if err != nil {
+			logger.Warn("Failed to generate image alt text, using the image prompt", "error", err)
+			altText = altTextFromPrompt(image.Prompt)
+		}
+		assets.ImageAltText = altText
+
+		// Label AI imagery so readers can tell it apart from photography
+		assets.ImageCaption = aiImageCaption(altText)
+		assets.ImageCredit = aiImageCredit(image.Provider)
+		assets.ImageGeneration = &image.ImageGenerationInfo
+	}
+
+	// A credited stock photo beats publishing without an image
+	if !imageSuccess {
+		photo, err := GetStockPhoto(article)
+		if err != nil {
+			logger.Warn("No stock photo fallback", "error", err)
+		} else {
+			assets.ImagePath = photo.Path
+			assets.ImageAltText = photo.AltText
+			if assets.ImageAltText == "" {
+				assets.ImageAltText = article.Title
+			}
+			assets.ImageCredit = photo.Credit
+			assets.ImageCreditURL = photo.CreditURL
+			imageSuccess = true
+		}
 	}
 
 	return assets, imageSuccess, nil
-}
\ No newline at end of file
+}
+
+// generateArticleAudio narrates the article, or returns "" when the TTS
+// provider chain skips audio
+func generateArticleAudio(ctx context.Context, logger *slog.Logger, article GeneratedArticle, flagship bool) (string, error) {
+	if flagship && dialogueConfig.Enabled {
+		audioPath, err := GenerateDialogueAudioFile(ctx, article, dialogueConfig)
+		if err == nil {
+			return audioPath, nil
+		}
+		logger.Warn("Failed to generate dialogue audio, using narration", "error", err)
+	}
+
+	// Generate audio file using text-to-speech
+	audioPath, err := GenerateAudioFile(ctx, article.Title, article.Article, audioOptionsForCategory(article.CategoryId))
+	if errors.Is(err, errTTSSkipped) {
+		// TTS_PROVIDERS ends with "skip", so the article is published without audio
+		logger.Warn("Publishing without audio", "error", err)
+		return "", nil
+	}
+	return audioPath, err
+}
@@ -0,0 +1,1052 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+func init() {
+	RegisterDBBackend("memory", func() (DBClient, error) {
+		return NewMemoryDBClient(), nil
+	})
+}
+
+// MemoryDBClient keeps everything in process memory. It is selected with
+// DB_TYPE=memory for dry-runs and tests that shouldn't touch a database.
+type MemoryDBClient struct {
+	mu               sync.Mutex
+	articles         map[uuid.UUID]*NewsArticle
+	sources          map[uuid.UUID][]NewsArticleSource
+	generations      map[uuid.UUID]GenerationMetadata
+	imageGenerations map[uuid.UUID]ImageGenerationMetadata
+	newsletters      []*DailyNewsletter
+	digests          []*WeeklyDigest
+	decisions        []*KeywordDecision
+	categories       []Category
+	jobs             []*PipelineJob
+	episodes         []*PodcastEpisode
+	ttsUsage         []*TTSUsage
+	timings          []*StageTiming
+	control          PipelineControl
+	proxyStats       map[string]*ProxyStat
+	subscribers      []*NewsletterSubscriber
+	deliveries       []*NewsletterDelivery
+	recipients       []*NewsletterRecipient
+}
+
+func NewMemoryDBClient() *MemoryDBClient {
+	return &MemoryDBClient{
+		articles:         make(map[uuid.UUID]*NewsArticle),
+		sources:          make(map[uuid.UUID][]NewsArticleSource),
+		generations:      make(map[uuid.UUID]GenerationMetadata),
+		imageGenerations: make(map[uuid.UUID]ImageGenerationMetadata),
+		control:          PipelineControl{ID: pipelineControlID},
+		proxyStats:       make(map[string]*ProxyStat),
+	}
+}
+
+// copyArticle returns a detached copy so callers can't mutate stored rows
+func copyArticle(article *NewsArticle) *NewsArticle {
+	copied := *article
+	copied.Keywords = append(pq.StringArray(nil), article.Keywords...)
+	return &copied
+}
+
+func (m *MemoryDBClient) SaveArticle(article *GeneratedArticle, mediaAssets NewsMediaAssets, imageSuccess bool) (*NewsArticle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.saveArticle(article, mediaAssets, imageSuccess), nil
+}
+
+func (m *MemoryDBClient) SaveArticles(bundles []ArticleBundle) ([]*NewsArticle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Repeated urlTitles collapse into one result, like the batched upsert
+	var articles []*NewsArticle
+	indexById := make(map[uuid.UUID]int)
+	for _, bundle := range bundles {
+		article := m.saveArticle(bundle.Article, bundle.MediaAssets, bundle.ImageSuccess)
+		if i, exists := indexById[article.ID]; exists {
+			articles[i] = article
+			continue
+		}
+		indexById[article.ID] = len(articles)
+		articles = append(articles, article)
+	}
+	return articles, nil
+}
+
+// saveArticle stores an article with its sources and metadata; callers must hold m.mu
+func (m *MemoryDBClient) saveArticle(article *GeneratedArticle, mediaAssets NewsMediaAssets, imageSuccess bool) *NewsArticle {
+	now := time.Now()
+	newsArticle := newNewsArticle(article, mediaAssets, imageSuccess)
+	newsArticle.CreatedAt = now
+	newsArticle.UpdatedAt = now
+
+	// Mirror the urlTitle upsert: a recent live row keeps its identity and
+	// creation time, while an older one is left alone under its urlTitle
+	if newsArticle.URLTitle != "" {
+		for _, existing := range m.articles {
+			if existing.URLTitle != newsArticle.URLTitle || existing.DeletedAt.Valid {
+				continue
+			}
+			if existing.CreatedAt.Before(now.Add(-articleReplaceWindow)) {
+				distinctURLTitle(newsArticle)
+				break
+			}
+			newsArticle.ID = existing.ID
+			newsArticle.CreatedAt = existing.CreatedAt
+			break
+		}
+	}
+	m.articles[newsArticle.ID] = newsArticle
+
+	var sources []NewsArticleSource
+	for _, source := range article.Sources {
+		sources = append(sources, NewsArticleSource{
+			ID:            uuid.New(),
+			NewsArticleId: newsArticle.ID,
+			URL:           source.URL,
+			Title:         source.Title,
+			Domain:        source.Domain,
+			PublishedAt:   source.PublishedAt,
+			CreatedAt:     now,
+		})
+	}
+	m.sources[newsArticle.ID] = sources
+
+	if article.Generation != nil {
+		m.generations[newsArticle.ID] = GenerationMetadata{
+			ID:            uuid.New(),
+			NewsArticleId: newsArticle.ID,
+			Prompt:        article.Generation.Prompt,
+			Model:         article.Generation.Model,
+			Provider:      article.Generation.Provider,
+			Temperature:   article.Generation.Temperature,
+			CreatedAt:     now,
+		}
+	}
+	if mediaAssets.ImageGeneration != nil {
+		metadata := newImageGenerationMetadata(newsArticle.ID, mediaAssets.ImageGeneration)
+		metadata.CreatedAt = now
+		m.imageGenerations[newsArticle.ID] = metadata
+	}
+
+	return copyArticle(newsArticle)
+}
+
+func (m *MemoryDBClient) CheckSimilarKeywords(keyword string, config SimilarityConfig) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	threshold := time.Now().Add(-config.Window)
+	normalized := NormalizeKeyword(keyword)
+	for _, article := range m.articles {
+		if article.DeletedAt.Valid || !article.CreatedAt.After(threshold) {
+			continue
+		}
+		if similarKeyword(article.Keywords, normalized, config.Threshold) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryDBClient) SaveDailyNewsletter(articleId string, titleText string, previewText string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, newsletter := range m.newsletters {
+		if newsletter.NewsArticleId == articleId {
+			return fmt.Errorf("error saving daily newsletter: article %s already has a newsletter", articleId)
+		}
+	}
+	m.newsletters = append(m.newsletters, &DailyNewsletter{
+		ID:            uuid.New().String(),
+		NewsArticleId: articleId,
+		TitleText:     titleText,
+		PreviewText:   previewText,
+		CreatedAt:     time.Now(),
+		Issue:         len(m.newsletters) + 1,
+	})
+	return nil
+}
+
+func (m *MemoryDBClient) GetArticlesSince(since time.Time, filters ArticleFilters) ([]*NewsArticle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var articles []*NewsArticle
+	for _, article := range m.articles {
+		if article.DeletedAt.Valid || !article.CreatedAt.After(since) {
+			continue
+		}
+		if filters.PublishedOnly && !article.Published {
+			continue
+		}
+		if len(filters.CategoryIds) > 0 && (article.CategoryId == nil || !containsInt(filters.CategoryIds, *article.CategoryId)) {
+			continue
+		}
+		articles = append(articles, copyArticle(article))
+	}
+
+	sort.Slice(articles, func(i, j int) bool {
+		return articles[i].CreatedAt.After(articles[j].CreatedAt)
+	})
+	if filters.Limit > 0 && len(articles) > filters.Limit {
+		articles = articles[:filters.Limit]
+	}
+	return articles, nil
+}
+
+func (m *MemoryDBClient) GetArticleByID(id string) (*NewsArticle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	article, err := m.findArticle(id, false)
+	if err != nil {
+		return nil, err
+	}
+	return copyArticle(article), nil
+}
+
+// SearchArticles matches articles containing every query word in the title or
+// body, ranking title matches first. Search operators are not supported.
+func (m *MemoryDBClient) SearchArticles(query string, filters ArticleFilters) ([]*NewsArticle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("search query is required")
+	}
+
+	var articles []*NewsArticle
+	ranks := make(map[uuid.UUID]int)
+	for _, article := range m.articles {
+		if article.DeletedAt.Valid {
+			continue
+		}
+		if filters.PublishedOnly && !article.Published {
+			continue
+		}
+		if len(filters.CategoryIds) > 0 && (article.CategoryId == nil || !containsInt(filters.CategoryIds, *article.CategoryId)) {
+			continue
+		}
+
+		title := strings.ToLower(article.Title)
+		body := strings.ToLower(article.Body)
+		rank := 0
+		for _, term := range terms {
+			switch {
+			case strings.Contains(title, term):
+				rank += 2
+			case strings.Contains(body, term):
+				rank++
+			default:
+				rank = -1
+			}
+			if rank < 0 {
+				break
+			}
+		}
+		if rank > 0 {
+			ranks[article.ID] = rank
+			articles = append(articles, copyArticle(article))
+		}
+	}
+
+	sort.Slice(articles, func(i, j int) bool {
+		if ranks[articles[i].ID] != ranks[articles[j].ID] {
+			return ranks[articles[i].ID] > ranks[articles[j].ID]
+		}
+		return articles[i].CreatedAt.After(articles[j].CreatedAt)
+	})
+	if filters.Limit > 0 && len(articles) > filters.Limit {
+		articles = articles[:filters.Limit]
+	}
+	return articles, nil
+}
+
+func (m *MemoryDBClient) SaveKeywordDecision(decision *KeywordDecision) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if decision.ID == uuid.Nil {
+		decision.ID = uuid.New()
+	}
+	if decision.CreatedAt.IsZero() {
+		decision.CreatedAt = time.Now()
+	}
+	stored := *decision
+	m.decisions = append(m.decisions, &stored)
+	return nil
+}
+
+func (m *MemoryDBClient) GetKeywordDecisions(from time.Time, to time.Time, decision string) ([]*KeywordDecision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Decisions are appended in creation order
+	var decisions []*KeywordDecision
+	for _, stored := range m.decisions {
+		if stored.Decision == decision && !stored.CreatedAt.Before(from) && stored.CreatedAt.Before(to) {
+			copied := *stored
+			decisions = append(decisions, &copied)
+		}
+	}
+	return decisions, nil
+}
+
+func (m *MemoryDBClient) GetArticlesBefore(before time.Time) ([]*NewsArticle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var articles []*NewsArticle
+	for _, article := range m.articles {
+		if article.CreatedAt.Before(before) {
+			articles = append(articles, copyArticle(article))
+		}
+	}
+	sort.Slice(articles, func(i, j int) bool {
+		return articles[i].CreatedAt.Before(articles[j].CreatedAt)
+	})
+	return articles, nil
+}
+
+func (m *MemoryDBClient) DeleteArticles(ids []uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range ids {
+		delete(m.articles, id)
+		delete(m.sources, id)
+		delete(m.generations, id)
+		delete(m.imageGenerations, id)
+	}
+	m.newsletters = m.keepNewsletters(func(newsletter *DailyNewsletter) bool {
+		for _, id := range ids {
+			if newsletter.NewsArticleId == id.String() {
+				return false
+			}
+		}
+		return true
+	})
+	return nil
+}
+
+func (m *MemoryDBClient) ArchiveArticles(ids []uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range ids {
+		article, ok := m.articles[id]
+		if !ok || article.DeletedAt.Valid {
+			continue
+		}
+		article.Published = false
+		article.ImageUrl = nil
+		article.ThumbnailUrl = nil
+		article.ImageAvifUrl = nil
+		article.ThumbnailAvifUrl = nil
+		article.ImageSrcset = nil
+		article.ImageAltText = nil
+		article.ImageCaption = nil
+		article.ImageCredit = nil
+		article.ImageCreditUrl = nil
+		article.AudioUrl = nil
+		article.AudioDurationSeconds = nil
+		article.TranscriptUrl = nil
+		article.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (m *MemoryDBClient) DeleteOrphanedNewsletters() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := len(m.newsletters)
+	m.newsletters = m.keepNewsletters(func(newsletter *DailyNewsletter) bool {
+		id, err := uuid.Parse(newsletter.NewsArticleId)
+		if err != nil {
+			return false
+		}
+		_, exists := m.articles[id]
+		return exists
+	})
+	return int64(before - len(m.newsletters)), nil
+}
+
+func (m *MemoryDBClient) DeleteArticle(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	article, err := m.findArticle(id, false)
+	if err != nil {
+		return fmt.Errorf("article %s not found", id)
+	}
+	article.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	return nil
+}
+
+func (m *MemoryDBClient) RestoreArticle(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	article, err := m.findArticle(id, true)
+	if err != nil || !article.DeletedAt.Valid {
+		return fmt.Errorf("no deleted article with ID %s", id)
+	}
+	article.DeletedAt = gorm.DeletedAt{}
+	return nil
+}
+
+func (m *MemoryDBClient) UpdateArticle(id string, update ArticleUpdate) (*NewsArticle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	article, err := m.findArticle(id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := false
+	if update.Title != nil {
+		article.Title = *update.Title
+		changed = true
+	}
+	if update.Body != nil {
+		article.Body = *update.Body
+		changed = true
+	}
+	if update.ImageUrl != nil {
+		article.ImageUrl = update.ImageUrl
+		changed = true
+	}
+	if update.ThumbnailUrl != nil {
+		article.ThumbnailUrl = update.ThumbnailUrl
+		changed = true
+	}
+	if update.AudioUrl != nil {
+		article.AudioUrl = update.AudioUrl
+		changed = true
+	}
+	if update.Published != nil {
+		article.Published = *update.Published
+		changed = true
+	}
+	if changed {
+		article.UpdatedAt = time.Now()
+	}
+
+	return copyArticle(article), nil
+}
+
+func (m *MemoryDBClient) HasDailyNewsletterSince(since time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, newsletter := range m.newsletters {
+		if !newsletter.CreatedAt.Before(since) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryDBClient) GetDailyNewsletterSince(since time.Time) (*DailyNewsletter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var latest *DailyNewsletter
+	for _, newsletter := range m.newsletters {
+		if !newsletter.CreatedAt.Before(since) && (latest == nil || newsletter.CreatedAt.After(latest.CreatedAt)) {
+			latest = newsletter
+		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+	copied := *latest
+	return &copied, nil
+}
+
+func (m *MemoryDBClient) SaveWeeklyDigest(weekStart time.Time, articleIds []string, titleText string, previewText string, intro string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, digest := range m.digests {
+		if digest.WeekStart.Equal(weekStart) {
+			return fmt.Errorf("error saving weekly digest: week of %s already has a digest", weekStart.Format("2006-01-02"))
+		}
+	}
+	m.digests = append(m.digests, &WeeklyDigest{
+		ID:          uuid.New().String(),
+		WeekStart:   weekStart,
+		ArticleIds:  append(pq.StringArray(nil), articleIds...),
+		TitleText:   titleText,
+		PreviewText: previewText,
+		Intro:       intro,
+		CreatedAt:   time.Now(),
+		Issue:       len(m.digests) + 1,
+	})
+	return nil
+}
+
+func (m *MemoryDBClient) HasWeeklyDigestSince(since time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, digest := range m.digests {
+		if !digest.WeekStart.Before(since) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryDBClient) GetWeeklyDigestSince(since time.Time) (*WeeklyDigest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var first *WeeklyDigest
+	for _, digest := range m.digests {
+		if !digest.WeekStart.Before(since) && (first == nil || digest.WeekStart.Before(first.WeekStart)) {
+			first = digest
+		}
+	}
+	if first == nil {
+		return nil, nil
+	}
+	copied := *first
+	copied.ArticleIds = append(pq.StringArray(nil), first.ArticleIds...)
+	return &copied, nil
+}
+
+func (m *MemoryDBClient) SavePodcastEpisode(episode *PodcastEpisode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if episode.ID == uuid.Nil {
+		episode.ID = uuid.New()
+	}
+	stored := *episode
+	stored.ArticleIds = append(pq.StringArray(nil), episode.ArticleIds...)
+	stored.UpdatedAt = time.Now()
+
+	// An episode for the same day replaces the earlier one but keeps its ID
+	for i, existing := range m.episodes {
+		if existing.EpisodeDate.Equal(stored.EpisodeDate) {
+			stored.ID = existing.ID
+			stored.CreatedAt = existing.CreatedAt
+			m.episodes[i] = &stored
+			return nil
+		}
+	}
+	stored.CreatedAt = stored.UpdatedAt
+	m.episodes = append(m.episodes, &stored)
+	return nil
+}
+
+func (m *MemoryDBClient) GetPodcastEpisodes(limit int) ([]*PodcastEpisode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var episodes []*PodcastEpisode
+	for _, episode := range m.episodes {
+		copied := *episode
+		episodes = append(episodes, &copied)
+	}
+	sort.Slice(episodes, func(i, j int) bool {
+		return episodes[i].EpisodeDate.After(episodes[j].EpisodeDate)
+	})
+	if limit > 0 && len(episodes) > limit {
+		episodes = episodes[:limit]
+	}
+	return episodes, nil
+}
+
+func (m *MemoryDBClient) EnqueuePipelineJobs(jobs []*PipelineJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.enqueuePipelineJobs(jobs)
+	return nil
+}
+
+func (m *MemoryDBClient) enqueuePipelineJobs(jobs []*PipelineJob) {
+	for _, job := range jobs {
+		if job.ID == uuid.Nil {
+			job.ID = uuid.New()
+		}
+		job.Status = jobPending
+		job.CreatedAt = time.Now()
+		job.UpdatedAt = job.CreatedAt
+		job.RunAfter = job.CreatedAt
+		stored := *job
+		m.jobs = append(m.jobs, &stored)
+	}
+}
+
+func (m *MemoryDBClient) ClaimPipelineJob(mode string, kind string) (*PipelineJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Jobs are appended in creation order
+	for _, job := range m.jobs {
+		if job.Mode == mode && job.Kind == kind && job.Status == jobPending && !job.RunAfter.After(time.Now()) {
+			job.Status = jobRunning
+			job.Attempts++
+			job.UpdatedAt = time.Now()
+			copied := *job
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryDBClient) CheckpointPipelineJob(id uuid.UUID, payload string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, job := range m.jobs {
+		if job.ID == id {
+			job.Payload = payload
+			job.UpdatedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDBClient) FinishPipelineJob(job *PipelineJob, next *PipelineJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.jobs {
+		if stored.ID == job.ID {
+			stored.Status = job.Status
+			stored.Payload = job.Payload
+			stored.LastError = job.LastError
+			stored.FailedStage = job.FailedStage
+			stored.RunAfter = job.RunAfter
+			stored.UpdatedAt = time.Now()
+		}
+	}
+	if next != nil {
+		m.enqueuePipelineJobs([]*PipelineJob{next})
+	}
+	return nil
+}
+
+func (m *MemoryDBClient) GetPipelineJobs(mode string, statuses []string) ([]*PipelineJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var jobs []*PipelineJob
+	for _, job := range m.jobs {
+		if job.Mode == mode && (len(statuses) == 0 || contains(statuses, job.Status)) {
+			copied := *job
+			jobs = append(jobs, &copied)
+		}
+	}
+	return jobs, nil
+}
+
+func (m *MemoryDBClient) RequeueRunningPipelineJobs(mode string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var requeued int64
+	for _, job := range m.jobs {
+		if job.Mode == mode && job.Status == jobRunning {
+			job.Status = jobPending
+			job.UpdatedAt = time.Now()
+			requeued++
+		}
+	}
+	return requeued, nil
+}
+
+func (m *MemoryDBClient) DeletePipelineJobs(ids []uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	remove := make(map[uuid.UUID]bool)
+	for _, id := range ids {
+		remove[id] = true
+	}
+	var kept []*PipelineJob
+	for _, job := range m.jobs {
+		if !remove[job.ID] {
+			kept = append(kept, job)
+		}
+	}
+	m.jobs = kept
+	return nil
+}
+
+func (m *MemoryDBClient) RecordTTSUsage(provider string, month time.Time, characters int, costUSD float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, usage := range m.ttsUsage {
+		if usage.Provider == provider && usage.Month.Equal(month) {
+			usage.Characters += int64(characters)
+			usage.CostUSD += costUSD
+			usage.UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	m.ttsUsage = append(m.ttsUsage, &TTSUsage{
+		ID:         uuid.New(),
+		Provider:   provider,
+		Month:      month,
+		Characters: int64(characters),
+		CostUSD:    costUSD,
+		UpdatedAt:  time.Now(),
+	})
+	return nil
+}
+
+func (m *MemoryDBClient) GetTTSUsage(month time.Time) ([]*TTSUsage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var usage []*TTSUsage
+	for _, entry := range m.ttsUsage {
+		if entry.Month.Equal(month) {
+			copied := *entry
+			usage = append(usage, &copied)
+		}
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Provider < usage[j].Provider
+	})
+	return usage, nil
+}
+
+func (m *MemoryDBClient) RecordStageTimings(timings []*StageTiming) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, timing := range timings {
+		copied := *timing
+		if copied.ID == uuid.Nil {
+			copied.ID = uuid.New()
+		}
+		if copied.CreatedAt.IsZero() {
+			copied.CreatedAt = time.Now()
+		}
+		m.timings = append(m.timings, &copied)
+	}
+	return nil
+}
+
+func (m *MemoryDBClient) GetStageTimings(since time.Time) ([]*StageTiming, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var timings []*StageTiming
+	for _, timing := range m.timings {
+		if !timing.CreatedAt.Before(since) {
+			copied := *timing
+			timings = append(timings, &copied)
+		}
+	}
+	sort.SliceStable(timings, func(i, j int) bool {
+		return timings[i].CreatedAt.Before(timings[j].CreatedAt)
+	})
+	return timings, nil
+}
+
+func (m *MemoryDBClient) GetPipelineControl() (*PipelineControl, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	control := m.control
+	return &control, nil
+}
+
+func (m *MemoryDBClient) SetPipelineControl(paused bool, reason string) (*PipelineControl, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.control = PipelineControl{ID: pipelineControlID, Paused: paused, Reason: reason, UpdatedAt: time.Now()}
+	control := m.control
+	return &control, nil
+}
+
+func (m *MemoryDBClient) RecordProxyOutcomes(host string, successes int, failures int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stat := m.proxyStat(host)
+	stat.Successes += int64(successes)
+	stat.Failures += int64(failures)
+	stat.UpdatedAt = time.Now()
+	return nil
+}
+
+func (m *MemoryDBClient) GetProxyStats() ([]*ProxyStat, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var stats []*ProxyStat
+	for _, stat := range m.proxyStats {
+		copied := *stat
+		stats = append(stats, &copied)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Host < stats[j].Host
+	})
+	return stats, nil
+}
+
+func (m *MemoryDBClient) BlacklistProxy(host string, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stat := m.proxyStat(host)
+	now := time.Now()
+	stat.BlacklistedAt = &now
+	stat.BlacklistReason = reason
+	stat.UpdatedAt = now
+	return nil
+}
+
+func (m *MemoryDBClient) ClearProxyBlacklist(host string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stat, ok := m.proxyStats[host]
+	if !ok {
+		return fmt.Errorf("no stats for proxy %s", host)
+	}
+	*stat = ProxyStat{Host: host, UpdatedAt: time.Now()}
+	return nil
+}
+
+func (m *MemoryDBClient) GetNewsletterSubscribers() ([]*NewsletterSubscriber, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var subscribers []*NewsletterSubscriber
+	for _, subscriber := range m.subscribers {
+		if subscriber.UnsubscribedAt == nil {
+			copied := *subscriber
+			subscribers = append(subscribers, &copied)
+		}
+	}
+	return subscribers, nil
+}
+
+func (m *MemoryDBClient) SetNewsletterSubscription(email string, subscribed bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var unsubscribedAt *time.Time
+	if !subscribed {
+		now := time.Now()
+		unsubscribedAt = &now
+	}
+	for _, subscriber := range m.subscribers {
+		if subscriber.Email == email {
+			subscriber.UnsubscribedAt = unsubscribedAt
+			return nil
+		}
+	}
+	m.subscribers = append(m.subscribers, &NewsletterSubscriber{
+		ID:             uuid.New(),
+		Email:          email,
+		CreatedAt:      time.Now(),
+		UnsubscribedAt: unsubscribedAt,
+	})
+	return nil
+}
+
+func (m *MemoryDBClient) GetNewsletterDelivery(kind string, issueId string) (*NewsletterDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, delivery := range m.deliveries {
+		if delivery.Kind == kind && delivery.IssueId == issueId {
+			copied := *delivery
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryDBClient) SaveNewsletterDelivery(delivery *NewsletterDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.deliveries {
+		if existing.Kind == delivery.Kind && existing.IssueId == delivery.IssueId {
+			return fmt.Errorf("error saving newsletter delivery: %s issue %s was already delivered", delivery.Kind, delivery.IssueId)
+		}
+	}
+	if delivery.ID == uuid.Nil {
+		delivery.ID = uuid.New()
+	}
+	copied := *delivery
+	m.deliveries = append(m.deliveries, &copied)
+	return nil
+}
+
+func (m *MemoryDBClient) GetNewsletterRecipients(kind string, issueId string) ([]*NewsletterRecipient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var recipients []*NewsletterRecipient
+	for _, recipient := range m.recipients {
+		if recipient.Kind == kind && recipient.IssueId == issueId {
+			copied := *recipient
+			recipients = append(recipients, &copied)
+		}
+	}
+	return recipients, nil
+}
+
+func (m *MemoryDBClient) SaveNewsletterRecipient(recipient *NewsletterRecipient) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.recipients {
+		if existing.Kind == recipient.Kind && existing.IssueId == recipient.IssueId && existing.Email == recipient.Email {
+			return fmt.Errorf("error saving newsletter recipient: %s issue %s was already emailed to %s", recipient.Kind, recipient.IssueId, recipient.Email)
+		}
+	}
+	if recipient.ID == uuid.Nil {
+		recipient.ID = uuid.New()
+	}
+	copied := *recipient
+	m.recipients = append(m.recipients, &copied)
+	return nil
+}
+
+// proxyStat returns the stats row for host, adding it if missing; mu must be held
+func (m *MemoryDBClient) proxyStat(host string) *ProxyStat {
+	stat, ok := m.proxyStats[host]
+	if !ok {
+		stat = &ProxyStat{Host: host}
+		m.proxyStats[host] = stat
+	}
+	return stat
+}
+
+// Ping has no connection to check
+func (m *MemoryDBClient) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (m *MemoryDBClient) ListCategories() ([]Category, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	categories := append([]Category(nil), m.categories...)
+	sort.Slice(categories, func(i, j int) bool {
+		return categories[i].ID < categories[j].ID
+	})
+	return categories, nil
+}
+
+func (m *MemoryDBClient) AddCategory(name string) (*Category, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("category name is required")
+	}
+	nextId := 1
+	for _, category := range m.categories {
+		if strings.EqualFold(category.Name, name) {
+			return nil, fmt.Errorf("error adding category '%s': category already exists", name)
+		}
+		if category.ID >= nextId {
+			nextId = category.ID + 1
+		}
+	}
+	category := Category{ID: nextId, Name: name}
+	m.categories = append(m.categories, category)
+	return &category, nil
+}
+
+func (m *MemoryDBClient) SeedCategories() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var added int64
+	for _, category := range defaultCategories {
+		exists := false
+		for _, existing := range m.categories {
+			if existing.ID == category.ID || existing.Name == category.Name {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			m.categories = append(m.categories, category)
+			added++
+		}
+	}
+	return added, nil
+}
+
+// KeywordDecisions returns the keyword decisions recorded so far, for inspecting dry-runs
+func (m *MemoryDBClient) KeywordDecisions() []KeywordDecision {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	decisions := make([]KeywordDecision, 0, len(m.decisions))
+	for _, decision := range m.decisions {
+		decisions = append(decisions, *decision)
+	}
+	return decisions
+}
+
+// findArticle looks up a stored article by ID; callers must hold m.mu
+func (m *MemoryDBClient) findArticle(id string, includeDeleted bool) (*NewsArticle, error) {
+	articleId, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid article ID %q: %v", id, err)
+	}
+	article, ok := m.articles[articleId]
+	if !ok || (article.DeletedAt.Valid && !includeDeleted) {
+		return nil, fmt.Errorf("error fetching article %s: %v", id, gorm.ErrRecordNotFound)
+	}
+	return article, nil
+}
+
+// keepNewsletters filters the stored newsletters; callers must hold m.mu
+func (m *MemoryDBClient) keepNewsletters(keep func(*DailyNewsletter) bool) []*DailyNewsletter {
+	var kept []*DailyNewsletter
+	for _, newsletter := range m.newsletters {
+		if keep(newsletter) {
+			kept = append(kept, newsletter)
+		}
+	}
+	return kept
+}
+
+// Helper function to check if an int slice contains a value
+func containsInt(slice []int, value int) bool {
+	for _, v := range slice {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// newsletterSummaryChars is how much of an article's opening the email quotes
+const newsletterSummaryChars = 300
+
+// NewsletterEmailArticle is one article as the newsletter template shows it
+type NewsletterEmailArticle struct {
+	Title    string
+	Summary  string // The opening of the article, as plain text
+	URL      string
+	ImageURL string // Empty when the article has no image
+	ImageAlt string
+}
+
+// NewsletterEmail is the data a newsletter email is rendered with
+type NewsletterEmail struct {
+	Kind           string // "daily" or "weekly"
+	Issue          int
+	Title          string // Subject line
+	Preview        string // Inbox preview text
+	Intro          string // Optional opening paragraph
+	Articles       []NewsletterEmailArticle
+	UnsubscribeURL string // This recipient's link from NEWSLETTER_UNSUBSCRIBE_URL
+}
+
+// template parses NEWSLETTER_TEMPLATE, or the built-in template
+func (c EmailConfig) template() (*template.Template, error) {
+	text := newsletterEmailTemplate
+	if c.Template != "" {
+		data, err := os.ReadFile(c.Template)
+		if err != nil {
+			return nil, fmt.Errorf("error reading NEWSLETTER_TEMPLATE: %v", err)
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New("newsletter").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid newsletter template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// newsletterEmailArticle prepares an article for the newsletter template
+func newsletterEmailArticle(config EmailConfig, article *NewsArticle) NewsletterEmailArticle {
+	summary := stripMarkdownTags(article.Body)
+	if len(summary) > newsletterSummaryChars {
+		// Cut at the last word that fits
+		if cut := strings.LastIndex(summary[:newsletterSummaryChars], " "); cut > 0 {
+			summary = summary[:cut] + "..."
+		}
+	}
+	emailArticle := NewsletterEmailArticle{
+		Title:   article.Title,
+		Summary: summary,
+		URL:     strings.ReplaceAll(config.ArticleURL, "{urlTitle}", url.PathEscape(article.URLTitle)),
+	}
+	if article.UseImage && article.ImageUrl != nil {
+		emailArticle.ImageURL = *article.ImageUrl
+		if article.ImageAltText != nil {
+			emailArticle.ImageAlt = *article.ImageAltText
+		}
+	}
+	return emailArticle
+}
+
+// newsletterText is the plain-text alternative to the HTML email
+func newsletterText(newsletter NewsletterEmail) string {
+	var text strings.Builder
+	text.WriteString(newsletter.Title + "\n\n")
+	if newsletter.Intro != "" {
+		text.WriteString(newsletter.Intro + "\n\n")
+	}
+	for _, article := range newsletter.Articles {
+		fmt.Fprintf(&text, "%s\n%s\nRead more: %s\n\n", article.Title, article.Summary, article.URL)
+	}
+	if newsletter.UnsubscribeURL != "" {
+		fmt.Fprintf(&text, "Unsubscribe: %s\n", newsletter.UnsubscribeURL)
+	}
+	return text.String()
+}
+
+// sendNewsletter emails an issue to every subscriber, once. Each recipient
+// is recorded as their email is sent, so a rerun after a crash or a partial
+// failure only emails the subscribers who haven't had it; the issue's
+// delivery is recorded once all of them have.
+func sendNewsletter(ctx context.Context, issueId string, newsletter NewsletterEmail) error {
+	config := emailConfig
+	if config.Provider == "" {
+		return nil
+	}
+	logger := loggerFrom(ctx).With("newsletter", newsletter.Kind, "issue", newsletter.Issue)
+
+	delivery, err := dbClient.GetNewsletterDelivery(newsletter.Kind, issueId)
+	if err != nil {
+		return err
+	}
+	if delivery != nil {
+		logger.Info("Newsletter already emailed, skipping", "sentAt", delivery.SentAt)
+		return nil
+	}
+	subscribers, err := dbClient.GetNewsletterSubscribers()
+	if err != nil {
+		return err
+	}
+	if len(subscribers) == 0 {
+		logger.Info("No newsletter subscribers, skipping email")
+		return nil
+	}
+	recipients, err := dbClient.GetNewsletterRecipients(newsletter.Kind, issueId)
+	if err != nil {
+		return err
+	}
+	emailed := make(map[string]bool)
+	for _, recipient := range recipients {
+		emailed[recipient.Email] = true
+	}
+
+	sender, err := newEmailSender(config)
+	if err != nil {
+		return err
+	}
+	tmpl, err := config.template()
+	if err != nil {
+		return err
+	}
+
+	sent, failures := 0, 0
+	var lastErr error
+	for _, subscriber := range subscribers {
+		if emailed[subscriber.Email] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		email, err := renderNewsletterEmail(tmpl, config, newsletter, subscriber.Email)
+		if err != nil {
+			return err
+		}
+		release, err := waitForAPI(ctx, apiEmail)
+		if err != nil {
+			return err
+		}
+		err = sender.Send(ctx, email)
+		release()
+		if err != nil {
+			failures++
+			lastErr = err
+			logger.Warn("Could not email newsletter", "subscriber", subscriber.ID, "error", err)
+			continue
+		}
+		// Without the record a rerun would email them again, so stop here
+		if err := dbClient.SaveNewsletterRecipient(&NewsletterRecipient{
+			Kind:    newsletter.Kind,
+			IssueId: issueId,
+			Email:   subscriber.Email,
+			SentAt:  appNow(),
+		}); err != nil {
+			return err
+		}
+		sent++
+	}
+	if failures > 0 && sent == 0 {
+		return fmt.Errorf("newsletter could not be emailed to any of %d subscribers: %v", failures, lastErr)
+	}
+	logger.Info("Emailed newsletter", "provider", config.Provider, "recipients", sent, "failures", failures)
+	if failures > 0 {
+		// The next run retries the subscribers who didn't get it
+		reportFailure(ctx, reportLevelWarning, "Newsletter not emailed to every subscriber",
+			fmt.Errorf("%d of %d failed: %v", failures, sent+failures, lastErr), nil)
+		return nil
+	}
+
+	if err := dbClient.SaveNewsletterDelivery(&NewsletterDelivery{
+		Kind:       newsletter.Kind,
+		IssueId:    issueId,
+		Recipients: len(recipients) + sent,
+		SentAt:     appNow(),
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// renderNewsletterEmail renders the newsletter for one subscriber, with a
+// signed unsubscribe link that mail clients can also offer as a one-click
+// unsubscribe (RFC 8058)
+func renderNewsletterEmail(tmpl *template.Template, config EmailConfig, newsletter NewsletterEmail, to string) (Email, error) {
+	var headers map[string]string
+	if config.UnsubscribeURL != "" {
+		token := unsubscribeToken(config.UnsubscribeSecret, to)
+		newsletter.UnsubscribeURL = strings.ReplaceAll(config.UnsubscribeURL, "{token}", url.QueryEscape(token))
+		headers = map[string]string{
+			"List-Unsubscribe":      "<" + newsletter.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		}
+	}
+	var html bytes.Buffer
+	if err := tmpl.Execute(&html, newsletter); err != nil {
+		return Email{}, fmt.Errorf("error rendering newsletter email: %v", err)
+	}
+	return Email{To: to, Subject: newsletter.Title, HTML: html.String(), Text: newsletterText(newsletter), Headers: headers}, nil
+}
+
+// emailDailyNewsletter sends the issue saved since startOfDay, if it hasn't
+// been sent
+func emailDailyNewsletter(ctx context.Context, startOfDay time.Time) error {
+	if emailConfig.Provider == "" {
+		return nil
+	}
+	issue, err := dbClient.GetDailyNewsletterSince(startOfDay)
+	if err != nil {
+		return err
+	}
+	if issue == nil {
+		return nil
+	}
+	article, err := dbClient.GetArticleByID(issue.NewsArticleId)
+	if err != nil {
+		return fmt.Errorf("error loading newsletter article: %v", err)
+	}
+	return sendNewsletter(ctx, issue.ID, NewsletterEmail{
+		Kind:     "daily",
+		Issue:    issue.Issue,
+		Title:    issue.TitleText,
+		Preview:  issue.PreviewText,
+		Articles: []NewsletterEmailArticle{newsletterEmailArticle(emailConfig, article)},
+	})
+}
+
+// newsletterEmailTemplate is the built-in newsletter, rendered with a
+// NewsletterEmail. The hidden preview text is what inboxes show next to
+// the subject.
+const newsletterEmailTemplate = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body style="margin: 0; font-family: Georgia, serif; background: #f5f5f5">
+<div style="display: none; max-height: 0; overflow: hidden">{{.Preview}}</div>
+<div style="max-width: 600px; margin: 0 auto; padding: 24px; background: #ffffff">
+<h1 style="font-size: 26px">{{.Title}}</h1>
+{{if .Intro}}<p style="font-size: 17px; line-height: 1.5">{{.Intro}}</p>
+{{end}}{{range .Articles}}<div style="margin: 32px 0">
+{{if .ImageURL}}<a href="{{.URL}}"><img src="{{.ImageURL}}" alt="{{.ImageAlt}}" width="552" style="width: 100%; height: auto; border: 0"></a>
+{{end}}<h2 style="font-size: 21px"><a href="{{.URL}}" style="color: #111111; text-decoration: none">{{.Title}}</a></h2>
+<p style="font-size: 16px; line-height: 1.5; color: #333333">{{.Summary}}</p>
+<p><a href="{{.URL}}" style="color: #c0392b">Read the full story</a></p>
+</div>
+{{end}}{{if .UnsubscribeURL}}<p style="font-size: 12px; color: #888888">You're receiving this because you subscribed to Daily Scoop. <a href="{{.UnsubscribeURL}}" style="color: #888888">Unsubscribe</a></p>
+{{end}}</div>
+</body>
+</html>
+`
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// minUnsubscribeSecretLength keeps the signing secret out of guessing range
+const minUnsubscribeSecretLength = 32
+
+// unsubscribeToken signs email for the unsubscribe link, so only the
+// recipient can unsubscribe the address: the address and its HMAC-SHA256
+// under secret, each base64url encoded and joined with a dot
+func unsubscribeToken(secret string, email string) string {
+	encoding := base64.RawURLEncoding
+	return encoding.EncodeToString([]byte(email)) + "." + encoding.EncodeToString(unsubscribeSignature(secret, email))
+}
+
+// verifyUnsubscribeToken returns the address a token from unsubscribeToken
+// was signed for
+func verifyUnsubscribeToken(secret string, token string) (string, error) {
+	encodedEmail, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", fmt.Errorf("malformed unsubscribe token")
+	}
+	email, err := base64.RawURLEncoding.DecodeString(encodedEmail)
+	if err != nil {
+		return "", fmt.Errorf("malformed unsubscribe token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return "", fmt.Errorf("malformed unsubscribe token")
+	}
+	if !hmac.Equal(signature, unsubscribeSignature(secret, string(email))) {
+		return "", fmt.Errorf("invalid unsubscribe token")
+	}
+	return string(email), nil
+}
+
+func unsubscribeSignature(secret string, email string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(email))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// RunDailyNewsletter selects one of today's published articles (in APP_TIMEZONE) and saves it as
+// the daily newsletter issue, then emails it to subscribers when EMAIL_PROVIDER is set. It
+// doesn't select again if today's issue already exists, so reruns of the daily mode don't
+// create duplicate issues, but do email an issue that wasn't sent.
+func RunDailyNewsletter(ctx context.Context) error {
+	startOfDay := startOfAppDay(appNow())
+
+	exists, err := dbClient.HasDailyNewsletterSince(startOfDay)
+	if err != nil {
+		return err
+	}
+	if exists {
+		slog.Info("Daily newsletter already saved, skipping selection", "day", startOfDay.Format("2006-01-02"))
+		return emailDailyNewsletter(ctx, startOfDay)
+	}
+
+	articles, err := dbClient.GetArticlesSince(startOfDay, ArticleFilters{PublishedOnly: true})
+	if err != nil {
+		return fmt.Errorf("error loading today's articles: %v", err)
+	}
+	if len(articles) == 0 {
+		slog.Info("No published articles today, skipping daily newsletter")
+		return nil
+	}
+
+	articleId, titleText, previewText, err := selectDailyNewsletterArticle(articles)
+	if err != nil {
+		return fmt.Errorf("error selecting daily newsletter article: %v", err)
+	}
+
+	if err := dbClient.SaveDailyNewsletter(articleId, titleText, previewText); err != nil {
+		return fmt.Errorf("error saving daily newsletter: %v", err)
+	}
+
+	slog.Info("Saved daily newsletter", "article", articleId)
+	return emailDailyNewsletter(ctx, startOfDay)
+}
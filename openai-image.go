@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// openAIImageDeclinedCodes are the error codes OpenAI returns when its
+// moderation refuses a prompt
+var openAIImageDeclinedCodes = map[string]bool{
+	"content_policy_violation": true,
+	"moderation_blocked":       true,
+}
+
+// OpenAIImageProvider generates images with gpt-image-1 or DALL-E 3
+type OpenAIImageProvider struct {
+	client  *openai.Client
+	model   string
+	size    string
+	quality string
+}
+
+// NewOpenAIImageProvider reads OPENAI_API_KEY, OPENAI_IMAGE_MODEL (default
+// "gpt-image-1", or "dall-e-3"), OPENAI_IMAGE_SIZE and OPENAI_IMAGE_QUALITY.
+// The default size is the model's format closest to the image aspect ratio.
+func NewOpenAIImageProvider() (*OpenAIImageProvider, error) {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY environment variable not set")
+	}
+
+	provider := &OpenAIImageProvider{
+		client:  openai.NewClient(apiKey),
+		model:   "gpt-image-1",
+		size:    os.Getenv("OPENAI_IMAGE_SIZE"),
+		quality: os.Getenv("OPENAI_IMAGE_QUALITY"),
+	}
+	if model := os.Getenv("OPENAI_IMAGE_MODEL"); model != "" {
+		provider.model = model
+	}
+	if provider.size == "" {
+		provider.size = closestImageShape(imageProviderConfig.aspectRatio(), openAIImageSizes(provider.model))
+	}
+	return provider, nil
+}
+
+// Generate ignores the seed, which the OpenAI image API doesn't take
+func (p *OpenAIImageProvider) Generate(ctx context.Context, prompt string, basePath string, seed *int64) (*GeneratedImage, error) {
+	request := openai.ImageRequest{
+		Prompt:  prompt,
+		Model:   p.model,
+		N:       1,
+		Size:    p.size,
+		Quality: p.quality,
+	}
+	// gpt-image models always return base64 and reject response_format
+	if p.model == openai.CreateImageModelDallE2 || p.model == openai.CreateImageModelDallE3 {
+		request.ResponseFormat = openai.CreateImageResponseFormatB64JSON
+	}
+
+	release, err := waitForAPI(ctx, apiOpenAI)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	resp, err := p.client.CreateImage(ctx, request)
+	if err != nil {
+		var apiErr *openai.APIError
+		if errors.As(err, &apiErr) {
+			if code, ok := apiErr.Code.(string); ok && openAIImageDeclinedCodes[code] {
+				return nil, fmt.Errorf("%w: %s", errImageDeclined, apiErr.Message)
+			}
+		}
+		return nil, fmt.Errorf("failed to generate image: %w", err)
+	}
+	if len(resp.Data) == 0 || resp.Data[0].B64JSON == "" {
+		return nil, fmt.Errorf("no image in OpenAI response")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(resp.Data[0].B64JSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode OpenAI image: %w", err)
+	}
+	outputPath := basePath + ".png"
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write image: %w", err)
+	}
+	return &GeneratedImage{Path: outputPath, ImageGenerationInfo: ImageGenerationInfo{Model: p.model}}, nil
+}
+
+// openAIImageSizes lists the sizes a model can generate
+func openAIImageSizes(model string) []string {
+	switch model {
+	case openai.CreateImageModelDallE3:
+		return []string{openai.CreateImageSize1792x1024, openai.CreateImageSize1024x1024, openai.CreateImageSize1024x1792}
+	case openai.CreateImageModelDallE2:
+		return []string{openai.CreateImageSize1024x1024}
+	default:
+		return []string{"1536x1024", "1024x1024", "1024x1536"}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// Stages a topic passes through, in order. Jobs checkpoint the last one
+// completed so a restarted job picks up after it; the topic's jobs are
+// deleted once its article is saved.
+const (
+	stageSearched   = "searched"
+	stageScraped    = "scraped"
+	stageSummarized = "summarized"
+	stageGenerated  = "generated"
+	stageMedia      = "media"
+	stageUploaded   = "uploaded"
+)
+
+var pipelineStages = []string{stageSearched, stageScraped, stageSummarized, stageGenerated, stageMedia, stageUploaded}
+
+// TopicJob carries one topic through the pipeline: what it is, the work
+// done on it so far and what went wrong along the way. It is the payload
+// handed from job to job, checkpointed after each stage so a crashed run
+// resumes without paying for it again, and all a stage needs to run.
+type TopicJob struct {
+	Keyword      string            `json:"keyword"`
+	Geo          string            `json:"geo,omitempty"`
+	SearchWindow *SearchWindow     `json:"searchWindow,omitempty"`
+	Stage        string            `json:"stage"`
+	Flagship     bool              `json:"flagship"`
+	SearchResult SearchResult      `json:"searchResult"`
+	Articles     []ArticleContent  `json:"articles,omitempty"`
+	Summaries    map[string]string `json:"summaries,omitempty"`
+	Article      *GeneratedArticle `json:"article,omitempty"`
+	MediaAssets  NewsMediaAssets   `json:"mediaAssets"` // Local paths until uploaded, then URLs
+	LocalMedia   NewsMediaAssets   `json:"localMedia"`  // The local files once uploaded, removed after the save
+	ImageSuccess bool              `json:"imageSuccess"`
+	Errors       []TopicJobError   `json:"errors,omitempty"` // Every failed attempt, oldest first
+}
+
+// TopicJobError is one failed attempt at a topic
+type TopicJobError struct {
+	Stage string    `json:"stage"` // The stage being worked on
+	Error string    `json:"error"`
+	At    time.Time `json:"at"`
+}
+
+// topic returns the trending topic the job is about
+func (t *TopicJob) topic() TrendingTopic {
+	return TrendingTopic{Keyword: t.Keyword, Geo: t.Geo, SearchWindow: t.SearchWindow}
+}
+
+// reached reports whether the topic has completed stage
+func (t *TopicJob) reached(stage string) bool {
+	return stageIndex(t.Stage) >= stageIndex(stage)
+}
+
+// mediaOnDisk reports whether the checkpointed media files are still there to upload
+func (t *TopicJob) mediaOnDisk() bool {
+	for _, path := range []string{t.MediaAssets.AudioPath, t.MediaAssets.ImagePath} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func stageIndex(stage string) int {
+	for i, s := range pipelineStages {
+		if s == stage {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// pipelinePaused reports whether the kill switch is on, and why. A database
+// that can't be read leaves the pipeline running, since runs would fail on
+// it anyway and an outage shouldn't look like an operator's pause.
+func pipelinePaused() (bool, string) {
+	control, err := dbClient.GetPipelineControl()
+	if err != nil {
+		slog.Warn("Could not check whether the pipeline is paused", "error", err)
+		return false, ""
+	}
+	return control.Paused, control.Reason
+}
+
+// RunPipelineControl pauses or resumes the pipeline for every deployment
+// sharing the database, for -mode=pause and -mode=resume
+func RunPipelineControl(paused bool, reason string) error {
+	if paused && reason == "" {
+		return fmt.Errorf("-reason is required to pause the pipeline")
+	}
+	control, err := dbClient.SetPipelineControl(paused, reason)
+	if err != nil {
+		return err
+	}
+	if control.Paused {
+		slog.Info("Pipeline paused", "reason", control.Reason)
+	} else {
+		slog.Info("Pipeline resumed")
+	}
+	return nil
+}
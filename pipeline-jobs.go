@@ -0,0 +1,547 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Pipeline job kinds, one per stage worker pool
+const (
+	jobTopic      = "topic"
+	jobGeneration = "generation"
+	jobMedia      = "media"
+)
+
+// Pipeline job statuses
+const (
+	jobPending = "pending"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// jobPollInterval is how often an idle worker checks for jobs while other
+// stages are still producing them
+const jobPollInterval = 2 * time.Second
+
+// pipelineJobHandler works on a topic and returns the kind of job to enqueue
+// next, or "" when the topic is finished. checkpoint saves the topic after
+// each stage inside the job. ctx carries the run, mode and keyword, and
+// expires once the job has run for topicTimeout.
+type pipelineJobHandler func(ctx context.Context, topic *TopicJob, checkpoint func(stage string)) (string, error)
+
+// JobRetryConfig controls how a failed job is retried before the topic is
+// abandoned
+type JobRetryConfig struct {
+	Retries int           // Retries after the first failure
+	Delay   time.Duration // Wait before each retry
+}
+
+var defaultJobRetryConfig = JobRetryConfig{
+	Retries: 2,
+	Delay:   30 * time.Minute,
+}
+
+var jobRetryConfig = defaultJobRetryConfig
+
+// defaultTopicTimeout is long enough for a slow scrape or a dialogue episode,
+// but well short of the gap between recent runs
+const defaultTopicTimeout = 15 * time.Minute
+
+// topicTimeout caps how long each of a topic's jobs may run, so one hung
+// scrape, subprocess or LLM call can't hold up the whole run; 0 means no limit
+var topicTimeout = defaultTopicTimeout
+
+// loadTopicTimeout reads TOPIC_TIMEOUT, e.g. "15m"
+func loadTopicTimeout() (time.Duration, error) {
+	timeout, err := getEnvDuration("TOPIC_TIMEOUT", defaultTopicTimeout)
+	if err != nil {
+		return timeout, err
+	}
+	if timeout < 0 {
+		return timeout, fmt.Errorf("TOPIC_TIMEOUT must not be negative, got %v", timeout)
+	}
+	return timeout, nil
+}
+
+// loadJobRetryConfig reads JOB_RETRIES and JOB_RETRY_DELAY, e.g. "30m"
+func loadJobRetryConfig() (JobRetryConfig, error) {
+	config := defaultJobRetryConfig
+	var err error
+	if config.Retries, err = getEnvInt("JOB_RETRIES", config.Retries); err != nil {
+		return config, err
+	}
+	if config.Retries < 0 {
+		return config, fmt.Errorf("JOB_RETRIES must not be negative, got %d", config.Retries)
+	}
+	if config.Delay, err = getEnvDuration("JOB_RETRY_DELAY", config.Delay); err != nil {
+		return config, err
+	}
+	if config.Delay <= 0 {
+		return config, fmt.Errorf("JOB_RETRY_DELAY must be positive, got %v", config.Delay)
+	}
+	return config, nil
+}
+
+var pipelineJobHandlers = map[string]pipelineJobHandler{
+	jobTopic:      runTopicJob,
+	jobGeneration: runGenerationJob,
+	jobMedia:      runMediaJob,
+}
+
+var defaultPipelineWorkers = map[string]int{
+	jobTopic:      1,
+	jobGeneration: 1,
+	jobMedia:      1,
+}
+
+var pipelineWorkers = defaultPipelineWorkers
+
+// loadPipelineWorkers reads PIPELINE_WORKERS, the number of workers for each
+// job kind, e.g. "topic=2,generation=2,media=1"
+func loadPipelineWorkers() (map[string]int, error) {
+	workers := make(map[string]int)
+	for kind, count := range defaultPipelineWorkers {
+		workers[kind] = count
+	}
+	for kind, value := range getEnvMap("PIPELINE_WORKERS") {
+		if _, ok := pipelineJobHandlers[kind]; !ok {
+			return workers, fmt.Errorf("unknown PIPELINE_WORKERS job kind %q (must be topic, generation or media)", kind)
+		}
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 1 {
+			return workers, fmt.Errorf("PIPELINE_WORKERS %s must be a positive integer, got %q", kind, value)
+		}
+		workers[kind] = count
+	}
+	return workers, nil
+}
+
+// enqueueTopics adds a topic job for each topic that doesn't already have
+// work queued in mode, so a topic interrupted by a crash is resumed rather
+// than started again
+func enqueueTopics(ctx context.Context, topics []TrendingTopic, mode string) error {
+	existing, err := dbClient.GetPipelineJobs(mode, []string{jobPending, jobRunning, jobDone})
+	if err != nil {
+		return err
+	}
+	queued := make(map[string]bool)
+	for _, job := range existing {
+		queued[job.Keyword] = true
+	}
+
+	var jobs []*PipelineJob
+	for i, topic := range topics {
+		if queued[topic.Keyword] {
+			continue
+		}
+		queued[topic.Keyword] = true
+
+		// The top daily trend is the flagship story
+		payload, err := json.Marshal(TopicJob{Keyword: topic.Keyword, Geo: topic.Geo, SearchWindow: topic.SearchWindow, Flagship: mode == "daily" && i == 0})
+		if err != nil {
+			return fmt.Errorf("error encoding topic job: %v", err)
+		}
+		jobs = append(jobs, &PipelineJob{Mode: mode, Kind: jobTopic, Keyword: topic.Keyword, Payload: string(payload)})
+	}
+	if len(existing) > 0 {
+		loggerFrom(ctx).Info("Resuming queued jobs", "jobs", len(existing))
+	}
+	return dbClient.EnqueuePipelineJobs(jobs)
+}
+
+// runPipelineWorkers works through mode's queue with pipelineWorkers workers
+// per job kind, returning once no job is due or running. After ctx is
+// cancelled workers finish the job in hand but claim no more.
+func runPipelineWorkers(ctx context.Context, mode string) {
+	started := appNow()
+	var wg sync.WaitGroup
+	for kind, handler := range pipelineJobHandlers {
+		for i := 0; i < pipelineWorkers[kind]; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				pipelineWorker(ctx, mode, kind, handler, started)
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+func pipelineWorker(ctx context.Context, mode string, kind string, handler pipelineJobHandler, started time.Time) {
+	ctx = withFields(ctx, "kind", kind)
+	logger := loggerFrom(ctx)
+	for ctx.Err() == nil {
+		// Pausing the pipeline stops new topics; ones already past the
+		// topic stage are still finished
+		paused, reason := pipelinePaused()
+		if paused && kind == jobTopic {
+			logger.Warn("Pipeline paused, taking no new topics", "reason", reason)
+			return
+		}
+
+		job, err := dbClient.ClaimPipelineJob(mode, kind)
+		if err != nil {
+			logger.Error("Stopping worker", "error", err)
+			return
+		}
+		if job != nil && job.Kind == jobTopic && runSpend.Exceeded() {
+			skipPipelineJob(withFields(ctx, "job", job.ID, "keyword", job.Keyword), job)
+			continue
+		}
+		if job != nil {
+			runPipelineJob(withFields(ctx, "job", job.ID, "keyword", job.Keyword), mode, job, handler)
+			continue
+		}
+
+		// Wait for the earlier stages while any of their jobs are unfinished.
+		// Retries that weren't due when the run started are left to a later one.
+		active, err := dbClient.GetPipelineJobs(mode, []string{jobPending, jobRunning})
+		if err != nil {
+			logger.Error("Stopping worker", "error", err)
+			return
+		}
+		if paused {
+			active = withoutPendingTopics(active)
+		}
+		if !anyJobDue(active, started) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+// runPipelineJob runs a claimed job and records whether it finished or failed.
+// Failures are reported along with the fields ctx carries.
+func runPipelineJob(ctx context.Context, mode string, job *PipelineJob, handler pipelineJobHandler) {
+	logger := loggerFrom(ctx)
+	var topic TopicJob
+	if err := json.Unmarshal([]byte(job.Payload), &topic); err != nil {
+		job.Status = jobFailed
+		job.LastError = fmt.Sprintf("unreadable payload: %v", err)
+		logger.Error("Dropping job with unreadable payload", "error", err)
+		reportFailure(ctx, reportLevelError, "Unreadable pipeline job", err, nil)
+		if err := dbClient.FinishPipelineJob(job, nil); err != nil {
+			logger.Error("Error finishing job", "error", err)
+		}
+		return
+	}
+	// Jobs queued before the keyword was part of the payload
+	if topic.Keyword == "" {
+		topic.Keyword = job.Keyword
+	}
+
+	checkpoint := func(stage string) {
+		topic.Stage = stage
+		payload, err := json.Marshal(topic)
+		if err == nil {
+			err = dbClient.CheckpointPipelineJob(job.ID, string(payload))
+		}
+		// Failing to checkpoint only costs the ability to resume, so the job carries on
+		if err != nil {
+			logger.Warn("Could not checkpoint", "stage", stage, "error", err)
+		}
+	}
+
+	nextKind, err := runJobHandler(ctx, handler, &topic, checkpoint)
+	if err != nil {
+		topic.Errors = append(topic.Errors, TopicJobError{Stage: nextStage(topic.Stage), Error: err.Error(), At: appNow()})
+	}
+	payload, encodeErr := json.Marshal(topic)
+	if encodeErr == nil {
+		job.Payload = string(payload)
+	} else if err == nil {
+		err = fmt.Errorf("error encoding topic: %v", encodeErr)
+	}
+
+	var next *PipelineJob
+	if err != nil {
+		job.LastError = err.Error()
+		job.FailedStage = nextStage(topic.Stage)
+		pipelineMetrics.StageError(job.FailedStage)
+		level := reportLevelError
+		// Uploads aren't capped: the media is paid for and kept on disk, so
+		// it waits out a storage outage however many runs that takes
+		if job.Attempts <= jobRetryConfig.Retries || job.FailedStage == stageUploaded {
+			level = reportLevelWarning
+			job.Status = jobPending
+			job.RunAfter = appNow().Add(jobRetryConfig.Delay)
+			logger.Warn("Job failed, retrying later",
+				"stage", job.FailedStage, "attempt", job.Attempts, "runAfter", job.RunAfter, "error", err)
+		} else {
+			job.Status = jobFailed
+			logger.Error("Job failed, giving up",
+				"stage", job.FailedStage, "attempts", job.Attempts, "error", err)
+		}
+
+		// A retry is only a warning, but a panic always needs looking at
+		title := "Pipeline stage failed"
+		extra := map[string]string{"attempt": strconv.Itoa(job.Attempts)}
+		var panicked *recoveredPanic
+		if errors.As(err, &panicked) {
+			title, level = "Pipeline job panicked", reportLevelFatal
+			extra["stack"] = string(panicked.stack)
+			logger.Error("Job panicked", "stack", extra["stack"])
+		}
+		reportFailure(withReportTags(ctx, "stage", job.FailedStage), level, title, err, extra)
+	} else {
+		job.Status = jobDone
+		if nextKind != "" {
+			next = &PipelineJob{Mode: mode, Kind: nextKind, Keyword: job.Keyword, Payload: job.Payload}
+		}
+	}
+	if err := dbClient.FinishPipelineJob(job, next); err != nil {
+		logger.Error("Error finishing job", "error", err)
+	}
+}
+
+// skipPipelineJob fails a topic claimed after the run went over its budget.
+// Topics further along are still finished, without audio or images.
+func skipPipelineJob(ctx context.Context, job *PipelineJob) {
+	logger := loggerFrom(ctx)
+	logger.Warn("Skipping topic, run budget exceeded")
+	job.Status = jobFailed
+	job.LastError = errRunBudgetExceeded.Error()
+	if err := dbClient.FinishPipelineJob(job, nil); err != nil {
+		logger.Error("Error finishing job", "error", err)
+	}
+}
+
+// runJobHandler calls handler, turning a panic into the job's error so one
+// bad topic doesn't take the whole run down. After topicTimeout the handler's
+// context is cancelled, which stops its requests and subprocesses; the
+// handler is still waited for, so it never overlaps the job's retry, and the
+// job fails with a timeout. Shutting down doesn't cut a job short.
+func runJobHandler(ctx context.Context, handler pipelineJobHandler, topic *TopicJob, checkpoint func(stage string)) (nextKind string, err error) {
+	ctx = context.WithoutCancel(ctx)
+	if topicTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, topicTimeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			nextKind, err = "", panicError(recovered)
+		}
+	}()
+	nextKind, err = handler(ctx, topic, checkpoint)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("topic timed out after %v: %v", topicTimeout, err)
+	}
+	return nextKind, err
+}
+
+// anyJobDue reports whether any of the jobs is running or was ready to be
+// claimed at cutoff. Jobs enqueued since by an earlier stage count too, but
+// retries scheduled since don't, so every worker agrees when a run is over.
+func anyJobDue(jobs []*PipelineJob, cutoff time.Time) bool {
+	for _, job := range jobs {
+		if job.Status == jobRunning || job.Attempts == 0 || !job.RunAfter.After(cutoff) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutPendingTopics drops the topic jobs no worker will claim while the
+// pipeline is paused, so the later stages don't wait on them
+func withoutPendingTopics(jobs []*PipelineJob) []*PipelineJob {
+	var kept []*PipelineJob
+	for _, job := range jobs {
+		if job.Kind != jobTopic || job.Status != jobPending {
+			kept = append(kept, job)
+		}
+	}
+	return kept
+}
+
+// hasDueRetries reports whether mode has retries waiting to be worked on
+func hasDueRetries(mode string) (bool, error) {
+	jobs, err := dbClient.GetPipelineJobs(mode, []string{jobPending})
+	if err != nil {
+		return false, err
+	}
+	return anyJobDue(jobs, appNow()), nil
+}
+
+// nextStage is the stage after stage, the one a failing job was working on
+func nextStage(stage string) string {
+	index := stageIndex(stage) + 1
+	if index >= len(pipelineStages) {
+		return stage
+	}
+	return pipelineStages[index]
+}
+
+// runTopicJob searches for coverage of the topic, scrapes it and summarizes
+// each article
+func runTopicJob(ctx context.Context, topic *TopicJob, checkpoint func(stage string)) (string, error) {
+	logger := loggerFrom(ctx)
+	if !topic.reached(stageSearched) {
+		start := time.Now()
+		searchResults, err := GetSearchResults(ctx, logger, []TrendingTopic{topic.topic()})
+		observeStage(topic.Keyword, stageSearched, time.Since(start))
+		if err != nil {
+			return "", fmt.Errorf("error getting search results: %v", err)
+		}
+		result, ok := searchResultFor(searchResults, topic.Keyword)
+		if !ok {
+			return "", fmt.Errorf("no search results")
+		}
+		topic.SearchResult = result
+		checkpoint(stageSearched)
+	}
+
+	if !topic.reached(stageScraped) {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		start := time.Now()
+		articles, err := ScrapeArticles(ctx, logger, []SearchResult{topic.SearchResult})
+		observeStage(topic.Keyword, stageScraped, time.Since(start))
+		if err != nil {
+			pipelineMetrics.Scraped(len(topic.SearchResult.URLs), 0)
+			return "", fmt.Errorf("error scraping articles: %v", err)
+		}
+		topic.Articles = filterArticlesByURLs(articles, topic.SearchResult.URLs)
+		pipelineMetrics.Scraped(len(topic.SearchResult.URLs), len(topic.Articles))
+		checkpoint(stageScraped)
+	}
+
+	if !topic.reached(stageSummarized) {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		start := time.Now()
+		summaries, err := SummarizeArticles(ctx, logger, topic.Articles)
+		observeStage(topic.Keyword, stageSummarized, time.Since(start))
+		if err != nil {
+			return "", fmt.Errorf("error summarizing articles: %v", err)
+		}
+		topic.Summaries = summaries
+		checkpoint(stageSummarized)
+	}
+	return jobGeneration, nil
+}
+
+// runGenerationJob writes the article from the topic's summaries
+func runGenerationJob(ctx context.Context, topic *TopicJob, checkpoint func(stage string)) (string, error) {
+	start := time.Now()
+	article, err := GenerateArticleFromSummaries(
+		ctx,
+		loggerFrom(ctx),
+		topic.Keyword,
+		topic.Summaries,
+		topic.SearchResult.URLs,
+	)
+	observeStage(topic.Keyword, stageGenerated, time.Since(start))
+	if err != nil {
+		return "", fmt.Errorf("error generating article: %v", err)
+	}
+	article.Sources = buildArticleSources(topic.Articles, article.SourceURLs)
+	topic.Article = article
+	topic.Stage = stageGenerated
+	return jobMedia, nil
+}
+
+// runMediaJob renders the article's media and uploads it. A failed upload
+// fails the job, which is retried from the media checkpoint with the files
+// still on disk until storage takes them, beyond JOB_RETRIES.
+func runMediaJob(ctx context.Context, topic *TopicJob, checkpoint func(stage string)) (string, error) {
+	logger := loggerFrom(ctx)
+	// Generate media again if the files didn't survive a restart
+	if !topic.reached(stageMedia) || !topic.mediaOnDisk() {
+		start := time.Now()
+		mediaAssets, imageSuccess, err := GenerateMediaAssets(ctx, logger, *topic.Article, topic.Flagship)
+		observeStage(topic.Keyword, stageMedia, time.Since(start))
+		if err != nil {
+			return "", fmt.Errorf("error generating media assets: %v", err)
+		}
+		topic.MediaAssets = mediaAssets
+		topic.ImageSuccess = imageSuccess
+		checkpoint(stageMedia)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	start := time.Now()
+	uploadedAssets, err := UploadMediaAssets(ctx, topic.MediaAssets)
+	observeStage(topic.Keyword, stageUploaded, time.Since(start))
+	if err != nil {
+		return "", fmt.Errorf("error uploading media assets: %v", err)
+	}
+	topic.LocalMedia = topic.MediaAssets
+	topic.MediaAssets = uploadedAssets
+	topic.Stage = stageUploaded
+	return "", nil
+}
+
+// uploadedBundles returns the articles of mode's finished topics, ready to be
+// saved, and the done jobs to delete once they are
+func uploadedBundles(ctx context.Context, mode string) ([]ArticleBundle, []*PipelineJob, error) {
+	jobs, err := dbClient.GetPipelineJobs(mode, []string{jobDone})
+	if err != nil {
+		return nil, nil, err
+	}
+	var bundles []ArticleBundle
+	for _, job := range jobs {
+		if job.Kind != jobMedia {
+			continue
+		}
+		var topic TopicJob
+		if err := json.Unmarshal([]byte(job.Payload), &topic); err != nil {
+			loggerFrom(ctx).Warn("Skipping unreadable media job", "job", job.ID, "keyword", job.Keyword, "error", err)
+			continue
+		}
+		if !topic.reached(stageUploaded) {
+			continue
+		}
+		bundles = append(bundles, ArticleBundle{
+			Article:      topic.Article,
+			MediaAssets:  topic.MediaAssets,
+			ImageSuccess: topic.ImageSuccess,
+		})
+	}
+	return bundles, jobs, nil
+}
+
+// removeSavedMedia deletes the local media of finished jobs whose articles
+// have been saved
+func removeSavedMedia(ctx context.Context, jobs []*PipelineJob) {
+	for _, job := range jobs {
+		if job.Kind != jobMedia {
+			continue
+		}
+		var topic TopicJob
+		if err := json.Unmarshal([]byte(job.Payload), &topic); err != nil {
+			loggerFrom(ctx).Warn("Leaving media of unreadable job on disk", "job", job.ID, "keyword", job.Keyword, "error", err)
+			continue
+		}
+		removeLocalMedia(topic.LocalMedia)
+	}
+}
+
+// logPipelineQueue summarizes what is left in mode's queue after a run
+func logPipelineQueue(ctx context.Context, mode string) {
+	logger := loggerFrom(ctx)
+	jobs, err := dbClient.GetPipelineJobs(mode, []string{jobPending, jobFailed})
+	if err != nil {
+		logger.Error("Error reading the job queue", "error", err)
+		return
+	}
+	counts := make(map[string]int)
+	for _, job := range jobs {
+		counts[job.Status]++
+	}
+	logger.Info("Job queue", "pending", counts[jobPending], "failed", counts[jobFailed])
+}
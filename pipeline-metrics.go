@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stageDurationBuckets are the histogram bounds, in seconds, for how long a
+// stage takes on one topic
+var stageDurationBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200}
+
+// pipelineMetricHelp describes each metric in the /metrics output
+var pipelineMetricHelp = map[string]string{
+	"dailyscoop_topics_selected_total":       "Trending topics selected for processing.",
+	"dailyscoop_scrape_attempts_total":       "Search result URLs scraped.",
+	"dailyscoop_scrape_successes_total":      "Search result URLs that scraped into usable articles.",
+	"dailyscoop_stage_duration_seconds":      "Time taken by a pipeline stage for one topic.",
+	"dailyscoop_stage_errors_total":          "Pipeline jobs that failed, by the stage they failed at.",
+	"dailyscoop_gemini_errors_total":         "Gemini requests that failed, by caller.",
+	"dailyscoop_articles_published_total":    "Articles saved and published.",
+	"dailyscoop_tts_characters_total":        "Characters synthesized to speech, by provider.",
+	"dailyscoop_tts_cost_usd_total":          "Estimated TTS spend in US dollars, by provider.",
+	"dailyscoop_run_spend_usd_total":         "Estimated spend counted against run budgets, by kind.",
+	"dailyscoop_media_optimized_total":       "Media assets optimized before upload.",
+	"dailyscoop_media_optimized_bytes_total": "Bytes of optimized media uploaded.",
+	"dailyscoop_proxy_requests_total":        "Requests made through a proxy, by proxy and outcome.",
+	"dailyscoop_proxies":                     "Proxies in the pool, by state.",
+}
+
+// stageHistogram accumulates observations for one label value
+type stageHistogram struct {
+	buckets []uint64 // Counts per stageDurationBuckets bound, not cumulative
+	count   uint64
+	sum     float64
+}
+
+// PipelineMetrics counts pipeline activity for the lifetime of the process
+// and renders it in the Prometheus text format at /metrics
+type PipelineMetrics struct {
+	mu         sync.Mutex
+	counters   map[string]map[string]float64         // Metric name -> rendered labels -> value
+	histograms map[string]map[string]*stageHistogram // Metric name -> rendered labels -> observations
+}
+
+var pipelineMetrics = &PipelineMetrics{
+	counters:   make(map[string]map[string]float64),
+	histograms: make(map[string]map[string]*stageHistogram),
+}
+
+func (m *PipelineMetrics) add(name string, labels string, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.counters[name] == nil {
+		m.counters[name] = make(map[string]float64)
+	}
+	m.counters[name][labels] += value
+}
+
+func (m *PipelineMetrics) observe(name string, labels string, seconds float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.histograms[name] == nil {
+		m.histograms[name] = make(map[string]*stageHistogram)
+	}
+	histogram := m.histograms[name][labels]
+	if histogram == nil {
+		histogram = &stageHistogram{buckets: make([]uint64, len(stageDurationBuckets))}
+		m.histograms[name][labels] = histogram
+	}
+	for i, bound := range stageDurationBuckets {
+		if seconds <= bound {
+			histogram.buckets[i]++
+			break
+		}
+	}
+	histogram.count++
+	histogram.sum += seconds
+}
+
+func (m *PipelineMetrics) TopicsSelected(mode string, count int) {
+	m.add("dailyscoop_topics_selected_total", metricLabel("mode", mode), float64(count))
+}
+
+// Scraped records how many of a topic's URLs were attempted and how many scraped
+func (m *PipelineMetrics) Scraped(attempted int, succeeded int) {
+	m.add("dailyscoop_scrape_attempts_total", "", float64(attempted))
+	m.add("dailyscoop_scrape_successes_total", "", float64(succeeded))
+}
+
+// ObserveStage records how long a stage took on one topic, whether or not it succeeded
+func (m *PipelineMetrics) ObserveStage(stage string, duration time.Duration) {
+	m.observe("dailyscoop_stage_duration_seconds", metricLabel("stage", stage), duration.Seconds())
+}
+
+func (m *PipelineMetrics) StageError(stage string) {
+	m.add("dailyscoop_stage_errors_total", metricLabel("stage", stage), 1)
+}
+
+func (m *PipelineMetrics) GeminiError(caller string) {
+	m.add("dailyscoop_gemini_errors_total", metricLabel("caller", caller), 1)
+}
+
+func (m *PipelineMetrics) ArticlesPublished(mode string, count int) {
+	m.add("dailyscoop_articles_published_total", metricLabel("mode", mode), float64(count))
+}
+
+func (m *PipelineMetrics) TTSUsage(provider string, characters int, costUSD float64) {
+	m.add("dailyscoop_tts_characters_total", metricLabel("provider", provider), float64(characters))
+	m.add("dailyscoop_tts_cost_usd_total", metricLabel("provider", provider), costUSD)
+}
+
+func (m *PipelineMetrics) EstimatedSpend(kind string, costUSD float64) {
+	m.add("dailyscoop_run_spend_usd_total", metricLabel("kind", kind), costUSD)
+}
+
+func (m *PipelineMetrics) ProxyRequest(proxy string, outcome string) {
+	m.add("dailyscoop_proxy_requests_total", joinLabels(metricLabel("proxy", proxy), metricLabel("outcome", outcome)), 1)
+}
+
+// Render writes every metric in the Prometheus text exposition format
+func (m *PipelineMetrics) Render(w io.Writer) {
+	counters := make(map[string]map[string]float64)
+	for kind, stats := range mediaMetrics.Snapshot() {
+		label := metricLabel("kind", kind)
+		counters["dailyscoop_media_optimized_total"] = mergeMetric(counters["dailyscoop_media_optimized_total"], label, float64(stats.Count))
+		counters["dailyscoop_media_optimized_bytes_total"] = mergeMetric(counters["dailyscoop_media_optimized_bytes_total"], label, float64(stats.OutputBytes))
+	}
+
+	gauges := make(map[string]map[string]float64)
+	if proxyPoolConfig.Provider != proxyProviderNone {
+		for state, count := range proxyPool.States() {
+			gauges["dailyscoop_proxies"] = mergeMetric(gauges["dailyscoop_proxies"], metricLabel("state", state), float64(count))
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, values := range m.counters {
+		for labels, value := range values {
+			counters[name] = mergeMetric(counters[name], labels, value)
+		}
+	}
+
+	for _, name := range sortedKeys(counters) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, pipelineMetricHelp[name], name)
+		for _, labels := range sortedKeys(counters[name]) {
+			fmt.Fprintf(w, "%s%s %g\n", name, wrapLabels(labels), counters[name][labels])
+		}
+	}
+
+	for _, name := range sortedKeys(gauges) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, pipelineMetricHelp[name], name)
+		for _, labels := range sortedKeys(gauges[name]) {
+			fmt.Fprintf(w, "%s%s %g\n", name, wrapLabels(labels), gauges[name][labels])
+		}
+	}
+
+	for _, name := range sortedKeys(m.histograms) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, pipelineMetricHelp[name], name)
+		for _, labels := range sortedKeys(m.histograms[name]) {
+			histogram := m.histograms[name][labels]
+			var cumulative uint64
+			for i, bound := range stageDurationBuckets {
+				cumulative += histogram.buckets[i]
+				fmt.Fprintf(w, "%s_bucket%s %d\n", name, wrapLabels(joinLabels(labels, metricLabel("le", fmt.Sprintf("%g", bound)))), cumulative)
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, wrapLabels(joinLabels(labels, metricLabel("le", "+Inf"))), histogram.count)
+			fmt.Fprintf(w, "%s_sum%s %g\n", name, wrapLabels(labels), histogram.sum)
+			fmt.Fprintf(w, "%s_count%s %d\n", name, wrapLabels(labels), histogram.count)
+		}
+	}
+}
+
+// ServeHTTP serves the metrics to a Prometheus scrape
+func (m *PipelineMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.Render(w)
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricLabel renders one label pair, e.g. mode="daily"
+func metricLabel(name string, value string) string {
+	return fmt.Sprintf(`%s="%s"`, name, metricLabelEscaper.Replace(value))
+}
+
+func joinLabels(labels ...string) string {
+	var nonEmpty []string
+	for _, label := range labels {
+		if label != "" {
+			nonEmpty = append(nonEmpty, label)
+		}
+	}
+	return strings.Join(nonEmpty, ",")
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func mergeMetric(values map[string]float64, labels string, value float64) map[string]float64 {
+	if values == nil {
+		values = make(map[string]float64)
+	}
+	values[labels] += value
+	return values
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
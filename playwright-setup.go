@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// setupPlaywright makes sure the Playwright driver and Chromium are ready
+// before any scraping starts. Installing checks for updates on every start,
+// which cron-style deployments pay for on each run, so images that bake the
+// browsers in set PLAYWRIGHT_INSTALL=false (or pass -skip-playwright-install)
+// to only check they are there.
+func setupPlaywright(skipInstall bool) error {
+	start := time.Now()
+	if !skipInstall && os.Getenv("PLAYWRIGHT_INSTALL") != "false" {
+		if err := playwright.Install(); err != nil {
+			return fmt.Errorf("error installing Playwright: %v", err)
+		}
+		slog.Debug("Installed Playwright", "duration", time.Since(start).Round(time.Millisecond))
+		return nil
+	}
+
+	if err := verifyPlaywright(); err != nil {
+		return fmt.Errorf("%v; install it in the image with \"playwright install --with-deps chromium\", or unset PLAYWRIGHT_INSTALL to install it at startup", err)
+	}
+	slog.Debug("Verified Playwright installation", "duration", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// verifyPlaywright checks the driver is installed at the version this build
+// expects and Chromium's executable is where the driver looks for it,
+// without launching the browser
+func verifyPlaywright() error {
+	driver, err := playwright.NewDriver()
+	if err != nil {
+		return fmt.Errorf("could not find the Playwright driver: %v", err)
+	}
+	output, err := driver.Command("--version").Output()
+	if err != nil {
+		return fmt.Errorf("Playwright driver is not installed: %v", err)
+	}
+	if !strings.Contains(string(output), driver.Version) {
+		return fmt.Errorf("Playwright driver is %s, this build needs %s", strings.TrimSpace(string(output)), driver.Version)
+	}
+
+	pw, err := playwright.Run()
+	if err != nil {
+		return fmt.Errorf("could not start Playwright: %v", err)
+	}
+	defer pw.Stop()
+
+	path := pw.Chromium.ExecutablePath()
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("Chromium is not installed at %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// podcastFeedName is the fixed storage name of the feed, so its URL can be
+// subscribed to; episodes themselves are content-addressed
+const podcastFeedName = "podcast.xml"
+
+// PodcastConfig describes the daily podcast built from each day's article audio
+type PodcastConfig struct {
+	Enabled     bool
+	Title       string
+	Description string
+	Author      string
+	SiteURL     string // Channel link, e.g. the site's home page
+	ImageURL    string // Cover art; podcast directories require 1400-3000px square
+	Language    string
+	MaxEpisodes int // Episodes listed in the feed
+}
+
+var defaultPodcastConfig = PodcastConfig{
+	Title:       "Daily Scoop AI",
+	Description: "The day's trending news stories, read by Daily Bot.",
+	Author:      "Daily Scoop AI",
+	Language:    "en-us",
+	MaxEpisodes: 30,
+}
+
+var podcastConfig = defaultPodcastConfig
+
+// loadPodcastConfig reads PODCAST_ENABLED ("true" to enable), PODCAST_TITLE,
+// PODCAST_DESCRIPTION, PODCAST_AUTHOR, PODCAST_SITE_URL, PODCAST_IMAGE_URL,
+// PODCAST_LANGUAGE and PODCAST_MAX_EPISODES
+func loadPodcastConfig() (PodcastConfig, error) {
+	config := defaultPodcastConfig
+	config.Enabled = os.Getenv("PODCAST_ENABLED") == "true"
+
+	for key, field := range map[string]*string{
+		"PODCAST_TITLE":       &config.Title,
+		"PODCAST_DESCRIPTION": &config.Description,
+		"PODCAST_AUTHOR":      &config.Author,
+		"PODCAST_SITE_URL":    &config.SiteURL,
+		"PODCAST_IMAGE_URL":   &config.ImageURL,
+		"PODCAST_LANGUAGE":    &config.Language,
+	} {
+		if value := os.Getenv(key); value != "" {
+			*field = value
+		}
+	}
+
+	maxEpisodes, err := getEnvInt("PODCAST_MAX_EPISODES", config.MaxEpisodes)
+	if err != nil {
+		return config, err
+	}
+	if maxEpisodes < 1 {
+		return config, fmt.Errorf("PODCAST_MAX_EPISODES must be at least 1, got %d", maxEpisodes)
+	}
+	config.MaxEpisodes = maxEpisodes
+
+	return config, nil
+}
+
+// RunDailyPodcast joins today's published article audio into one episode with
+// a spoken intro before each story, uploads it and rewrites the podcast feed.
+// Each run replaces today's episode, so stories published later in the day
+// are picked up; it does nothing when the episode is already current.
+func RunDailyPodcast(config PodcastConfig) error {
+	day := startOfAppDay(appNow())
+
+	articles, err := dbClient.GetArticlesSince(day, ArticleFilters{PublishedOnly: true})
+	if err != nil {
+		return fmt.Errorf("error loading today's articles: %v", err)
+	}
+	// Oldest first, so the episode follows the order stories were published
+	var stories []*NewsArticle
+	for i := len(articles) - 1; i >= 0; i-- {
+		if articles[i].AudioUrl != nil && *articles[i].AudioUrl != "" {
+			stories = append(stories, articles[i])
+		}
+	}
+	if len(stories) == 0 {
+		slog.Info("No article audio today, skipping podcast episode")
+		return nil
+	}
+
+	articleIds := make([]string, len(stories))
+	for i, story := range stories {
+		articleIds[i] = story.ID.String()
+	}
+
+	episodes, err := dbClient.GetPodcastEpisodes(1)
+	if err != nil {
+		return err
+	}
+	var previous *PodcastEpisode
+	if len(episodes) > 0 && episodes[0].EpisodeDate.Equal(day) {
+		previous = episodes[0]
+		if strings.Join(previous.ArticleIds, ",") == strings.Join(articleIds, ",") {
+			slog.Info("Podcast episode is up to date, skipping", "day", day.Format("2006-01-02"))
+			return nil
+		}
+	}
+
+	episodePath, err := buildPodcastEpisode(config, day, stories)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(episodePath)
+
+	info, err := os.Stat(episodePath)
+	if err != nil {
+		return fmt.Errorf("failed to read episode: %v", err)
+	}
+	duration, err := probeAudioDuration(episodePath)
+	if err != nil {
+		slog.Warn("Could not read podcast episode duration", "error", err)
+	}
+	audioURL, err := uploadToStorage(context.Background(), episodePath, audioBucket)
+	if err != nil {
+		return fmt.Errorf("error uploading podcast episode: %v", err)
+	}
+
+	titles := make([]string, len(stories))
+	for i, story := range stories {
+		titles[i] = story.Title
+	}
+	episode := &PodcastEpisode{
+		EpisodeDate:     day,
+		Title:           fmt.Sprintf("%s for %s", config.Title, day.Format("Monday, January 2, 2006")),
+		Description:     "In this episode: " + strings.Join(titles, "; ") + ".",
+		AudioUrl:        audioURL,
+		AudioBytes:      info.Size(),
+		DurationSeconds: duration,
+		ArticleIds:      articleIds,
+	}
+	if err := dbClient.SavePodcastEpisode(episode); err != nil {
+		return err
+	}
+
+	// The replaced episode's audio is no longer referenced by the feed
+	if previous != nil && previous.AudioUrl != audioURL {
+		if err := storageClient.Delete(previous.AudioUrl); err != nil {
+			slog.Warn("Could not delete replaced podcast episode", "url", previous.AudioUrl, "error", err)
+		}
+	}
+
+	feedURL, err := publishPodcastFeed(config)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Published podcast episode", "day", day.Format("2006-01-02"), "stories", len(stories), "feed", feedURL)
+	return nil
+}
+
+// buildPodcastEpisode downloads each story's audio and joins it into one file,
+// with a spoken welcome and a short intro naming each story
+func buildPodcastEpisode(config PodcastConfig, day time.Time, stories []*NewsArticle) (string, error) {
+	provider, err := newTTSProvider()
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	defer func() {
+		for _, part := range parts {
+			os.Remove(part)
+		}
+	}()
+
+	storyCount := "one story"
+	if len(stories) > 1 {
+		storyCount = fmt.Sprintf("%d stories", len(stories))
+	}
+	welcome := fmt.Sprintf("Welcome to %s for %s. Today we have %s.", config.Title, day.Format("Monday, January 2"), storyCount)
+	clip, err := synthesizeClip(context.Background(), provider, welcome, "")
+	if err != nil {
+		return "", fmt.Errorf("episode welcome: %v", err)
+	}
+	parts = append(parts, clip)
+
+	for i, story := range stories {
+		intro := fmt.Sprintf("Story %d: %s.", i+1, story.Title)
+		if i == len(stories)-1 && len(stories) > 1 {
+			intro = fmt.Sprintf("And finally: %s.", story.Title)
+		}
+		clip, err := synthesizeClip(context.Background(), provider, intro, "")
+		if err != nil {
+			return "", fmt.Errorf("segment intro for %s: %v", story.ID, err)
+		}
+		parts = append(parts, clip)
+
+		audio, err := downloadMedia(*story.AudioUrl)
+		if err != nil {
+			return "", fmt.Errorf("audio for %s: %v", story.ID, err)
+		}
+		parts = append(parts, audio)
+	}
+
+	episodePath := filepath.Join("media/audio", fmt.Sprintf("podcast_%s.mp3", day.Format("2006-01-02")))
+	if err := concatAudio(parts, episodePath); err != nil {
+		return "", fmt.Errorf("failed to join podcast episode: %v", err)
+	}
+	return episodePath, nil
+}
+
+// downloadMedia fetches a stored file to a temporary file. file:// URLs from
+// local storage are read directly.
+func downloadMedia(mediaURL string) (string, error) {
+	transport := &http.Transport{}
+	transport.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	client := &http.Client{Transport: transport, Timeout: 5 * time.Minute}
+
+	resp, err := client.Get(mediaURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %v", mediaURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download %s: status %d", mediaURL, resp.StatusCode)
+	}
+
+	file, err := os.CreateTemp("", "podcast-*"+filepath.Ext(mediaURL))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to download %s: %v", mediaURL, err)
+	}
+	return file.Name(), nil
+}
+
+// podcastFeed is an RSS 2.0 document with the iTunes tags podcast apps expect
+type podcastFeed struct {
+	XMLName xml.Name       `xml:"rss"`
+	Version string         `xml:"version,attr"`
+	ITunes  string         `xml:"xmlns:itunes,attr"`
+	Channel podcastChannel `xml:"channel"`
+}
+
+type podcastChannel struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link,omitempty"`
+	Description string        `xml:"description"`
+	Language    string        `xml:"language"`
+	Author      string        `xml:"itunes:author"`
+	Image       *podcastImage `xml:"itunes:image,omitempty"`
+	Explicit    string        `xml:"itunes:explicit"`
+	Items       []podcastItem `xml:"item"`
+}
+
+type podcastImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type podcastItem struct {
+	Title       string           `xml:"title"`
+	Description string           `xml:"description"`
+	GUID        podcastGUID      `xml:"guid"`
+	PubDate     string           `xml:"pubDate"`
+	Enclosure   podcastEnclosure `xml:"enclosure"`
+	Duration    int              `xml:"itunes:duration,omitempty"` // Seconds
+}
+
+type podcastGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type podcastEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// publishPodcastFeed renders the most recent episodes as RSS and uploads it
+// under podcastFeedName, returning the feed URL
+func publishPodcastFeed(config PodcastConfig) (string, error) {
+	episodes, err := dbClient.GetPodcastEpisodes(config.MaxEpisodes)
+	if err != nil {
+		return "", err
+	}
+
+	feed := podcastFeed{
+		Version: "2.0",
+		ITunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		Channel: podcastChannel{
+			Title:       config.Title,
+			Link:        config.SiteURL,
+			Description: config.Description,
+			Language:    config.Language,
+			Author:      config.Author,
+			Explicit:    "false",
+		},
+	}
+	if config.ImageURL != "" {
+		feed.Channel.Image = &podcastImage{Href: config.ImageURL}
+	}
+	for _, episode := range episodes {
+		feed.Channel.Items = append(feed.Channel.Items, podcastItem{
+			Title:       episode.Title,
+			Description: episode.Description,
+			GUID:        podcastGUID{Value: episode.ID.String()},
+			PubDate:     episode.EpisodeDate.In(appLocation).Format(time.RFC1123Z),
+			Enclosure:   podcastEnclosure{URL: episode.AudioUrl, Length: episode.AudioBytes, Type: "audio/mpeg"},
+			Duration:    episode.DurationSeconds,
+		})
+	}
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to render podcast feed: %v", err)
+	}
+
+	file, err := os.CreateTemp("", "podcast-*.xml")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(append([]byte(xml.Header), data...)); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write podcast feed: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write podcast feed: %v", err)
+	}
+
+	// The feed keeps a fixed name, so it's uploaded directly rather than content-addressed
+	feedURL, err := storageClient.Upload(context.Background(), file.Name(), audioBucket, podcastFeedName)
+	if err != nil {
+		return "", fmt.Errorf("error uploading podcast feed: %v", err)
+	}
+	return feedURL, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	defaultPollyVoice  = "Joanna"
+	defaultPollyEngine = "neural"
+	pollyMaxChars      = 2900 // Polly rejects requests over 3000 characters of text
+)
+
+// PollyTTS synthesizes speech with Amazon Polly through its REST API
+type PollyTTS struct {
+	region          string
+	accessKeyId     string
+	secretAccessKey string
+	voice           string
+	engine          string
+	speed           float64
+	httpClient      *http.Client
+}
+
+// NewPollyTTS reads POLLY_REGION, POLLY_ACCESS_KEY_ID and POLLY_SECRET_ACCESS_KEY,
+// plus POLLY_VOICE and POLLY_ENGINE ("neural", "standard", ...)
+func NewPollyTTS() (*PollyTTS, error) {
+	p := &PollyTTS{
+		region:          os.Getenv("POLLY_REGION"),
+		accessKeyId:     os.Getenv("POLLY_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("POLLY_SECRET_ACCESS_KEY"),
+		voice:           os.Getenv("POLLY_VOICE"),
+		engine:          os.Getenv("POLLY_ENGINE"),
+		speed:           ttsConfig.Speed,
+		httpClient:      &http.Client{Timeout: 2 * time.Minute},
+	}
+	for key, value := range map[string]string{
+		"POLLY_REGION":            p.region,
+		"POLLY_ACCESS_KEY_ID":     p.accessKeyId,
+		"POLLY_SECRET_ACCESS_KEY": p.secretAccessKey,
+	} {
+		if value == "" {
+			return nil, fmt.Errorf("%s environment variable is not set", key)
+		}
+	}
+	if p.voice == "" {
+		p.voice = defaultPollyVoice
+	}
+	if p.engine == "" {
+		p.engine = defaultPollyEngine
+	}
+	return p, nil
+}
+
+// Synthesize sends the text in chunks under Polly's limit and joins the MP3 results
+func (p *PollyTTS) Synthesize(ctx context.Context, text string, voice string) (io.ReadCloser, error) {
+	if voice == "" {
+		voice = p.voice
+	}
+	var audio bytes.Buffer
+	for _, chunk := range splitTextForTTS(text, pollyMaxChars) {
+		// Polly only takes a speaking rate through SSML
+		textType := "text"
+		if p.speed != 1.0 {
+			textType, chunk = "ssml", p.speak(escapeXML(chunk))
+		}
+		if err := p.synthesizeChunk(ctx, textType, chunk, voice, &audio); err != nil {
+			return nil, err
+		}
+	}
+	return io.NopCloser(&audio), nil
+}
+
+// speak wraps an SSML body in <speak>, applying the configured speaking rate
+func (p *PollyTTS) speak(body string) string {
+	if p.speed != 1.0 {
+		body = fmt.Sprintf(`<prosody rate="%.0f%%">%s</prosody>`, p.speed*100, body)
+	}
+	return "<speak>" + body + "</speak>"
+}
+
+// SynthesizeSSML is Synthesize for SSML scripts, split between sentences
+func (p *PollyTTS) SynthesizeSSML(ctx context.Context, script ssmlScript, voice string) (io.ReadCloser, error) {
+	if voice == "" {
+		voice = p.voice
+	}
+	var audio bytes.Buffer
+	for _, chunk := range script.chunks(pollyMaxChars) {
+		if err := p.synthesizeChunk(ctx, "ssml", p.speak(chunk), voice, &audio); err != nil {
+			return nil, err
+		}
+	}
+	return io.NopCloser(&audio), nil
+}
+
+// synthesizeChunk sends one request; textType is "text" or "ssml"
+func (p *PollyTTS) synthesizeChunk(ctx context.Context, textType, text, voice string, audio io.Writer) error {
+	jsonBody, err := json.Marshal(map[string]string{
+		"Engine":       p.engine,
+		"OutputFormat": "mp3",
+		"Text":         text,
+		"TextType":     textType,
+		"VoiceId":      voice,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body to JSON: %v", err)
+	}
+
+	endpoint := fmt.Sprintf("https://polly.%s.amazonaws.com/v1/speech", p.region)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signAWSRequest(req, sha256Hex(jsonBody), time.Now(), p.accessKeyId, p.secretAccessKey, p.region, "polly")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request to Polly: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		// GenerateAudioFileWithConfig backs off on errors mentioning a rate limit
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusBadRequest && bytes.Contains(body, []byte("ThrottlingException")) {
+			return fmt.Errorf("Polly rate limit reached: %s", string(body))
+		}
+		return fmt.Errorf("Polly request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	if _, err := io.Copy(audio, resp.Body); err != nil {
+		return fmt.Errorf("failed to read Polly audio: %v", err)
+	}
+	return nil
+}
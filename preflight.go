@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/playwright-community/playwright-go"
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/api/option"
+)
+
+// Preflight check outcomes
+const (
+	preflightPass = "pass"
+	preflightFail = "fail"
+	preflightSkip = "skip" // The configuration doesn't use the dependency
+)
+
+// preflightCheckTimeout bounds each check; launching a browser or importing
+// torch can take a while on a cold container
+const preflightCheckTimeout = time.Minute
+
+// pythonModules are imported by summarizer.py, fact_checker.py and
+// imagen_generator.py
+var pythonModules = []string{"torch", "transformers", "google.genai", "PIL"}
+
+// PreflightCheck is one dependency a run needs
+type PreflightCheck struct {
+	Name string
+	// Health marks checks cheap and side-effect free enough to run on every
+	// /healthz request
+	Health bool
+	Run    func(ctx context.Context) error
+}
+
+// PreflightResult is the outcome of one check
+type PreflightResult struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"` // preflightPass, preflightFail or preflightSkip
+	Detail     string `json:"detail,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// skipCheck is returned by a check whose dependency isn't configured for use
+type skipCheck string
+
+func (s skipCheck) Error() string {
+	return string(s)
+}
+
+// preflightChecks lists everything a scheduled run depends on. dbErr and
+// storageErr are from setting up the database and storage clients, which a
+// preflight run reports instead of exiting on.
+func preflightChecks(dbErr error, storageErr error) []PreflightCheck {
+	return []PreflightCheck{
+		{Name: "database", Health: true, Run: func(ctx context.Context) error {
+			if dbErr != nil {
+				return dbErr
+			}
+			return dbClient.Ping(ctx)
+		}},
+		{Name: "storage", Run: func(ctx context.Context) error {
+			if storageErr != nil {
+				return storageErr
+			}
+			return verifyStorageBuckets()
+		}},
+		{Name: "gemini", Run: checkGemini},
+		{Name: "openai", Run: checkOpenAI},
+		{Name: "proxies", Run: checkProxyPool},
+		{Name: "google_search", Run: checkGoogleSearch},
+		{Name: "playwright", Run: checkPlaywright},
+		{Name: "ffmpeg", Health: true, Run: checkFFmpeg},
+		{Name: "python", Run: checkPython},
+	}
+}
+
+// healthChecks are the checks /healthz runs
+func healthChecks() []PreflightCheck {
+	var checks []PreflightCheck
+	for _, check := range preflightChecks(nil, nil) {
+		if check.Health {
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
+
+// runPreflightChecks runs the checks concurrently, returning results in the
+// same order
+func runPreflightChecks(ctx context.Context, checks []PreflightCheck) []PreflightResult {
+	results := make([]PreflightResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check PreflightCheck) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, preflightCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.Run(checkCtx)
+			result := PreflightResult{Name: check.Name, Status: preflightPass, DurationMs: time.Since(start).Milliseconds()}
+			var skip skipCheck
+			if errors.As(err, &skip) {
+				result.Status = preflightSkip
+				result.Detail = skip.Error()
+			} else if err != nil {
+				result.Status = preflightFail
+				result.Detail = err.Error()
+			}
+			results[i] = result
+		}(i, check)
+	}
+	wg.Wait()
+	return results
+}
+
+// RunPreflight checks every dependency and prints a pass/fail matrix, failing
+// when any check does
+func RunPreflight(dbErr error, storageErr error) error {
+	results := runPreflightChecks(context.Background(), preflightChecks(dbErr, storageErr))
+	writePreflightResults(os.Stdout, results)
+
+	failed := 0
+	for _, result := range results {
+		if result.Status == preflightFail {
+			slog.Warn("Dependency check failed", "check", result.Name, "error", result.Detail)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	return nil
+}
+
+// writePreflightResults prints one line per check
+func writePreflightResults(w io.Writer, results []PreflightResult) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "CHECK\tSTATUS\tTIME\tDETAIL")
+	for _, result := range results {
+		duration := (time.Duration(result.DurationMs) * time.Millisecond).String()
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", result.Name, strings.ToUpper(result.Status), duration, result.Detail)
+	}
+	table.Flush()
+}
+
+// checkGemini looks up the article model, which checks both the key and
+// GEMINI_MODEL
+func checkGemini(ctx context.Context) error {
+	apiKey := os.Getenv("GEMINI_API_KEY")
+	if apiKey == "" {
+		return fmt.Errorf("GEMINI_API_KEY is not set")
+	}
+	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	if err != nil {
+		return fmt.Errorf("error creating client: %v", err)
+	}
+	defer client.Close()
+	if _, err := client.GenerativeModel(articleModel).Info(ctx); err != nil {
+		return fmt.Errorf("error looking up model %s: %v", articleModel, err)
+	}
+	return nil
+}
+
+// checkOpenAI lists models when OpenAI generates speech or images
+func checkOpenAI(ctx context.Context) error {
+	used := imageProviderConfig.Provider == "openai" || imageProviderConfig.Fallback == "openai"
+	for _, name := range ttsProviderNames() {
+		used = used || name == "openai"
+	}
+	if !used {
+		return skipCheck("not used by TTS_PROVIDERS or IMAGE_PROVIDER")
+	}
+
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return fmt.Errorf("OPENAI_API_KEY is not set")
+	}
+	if _, err := openai.NewClient(apiKey).ListModels(ctx); err != nil {
+		return fmt.Errorf("error listing models: %v", err)
+	}
+	return nil
+}
+
+// checkProxyPool fetches and health checks the proxies trend fetching runs
+// through
+func checkProxyPool(ctx context.Context) error {
+	if proxyPoolConfig.Provider == proxyProviderNone {
+		return skipCheck("PROXY_PROVIDER is none")
+	}
+	if err := proxyPool.refreshIfStale(); err != nil {
+		return err
+	}
+	healthy, total := proxyPool.Healthy()
+	if total == 0 {
+		return fmt.Errorf("the %s proxy provider has no proxies", proxyPoolConfig.Provider)
+	}
+	if healthy == 0 {
+		return fmt.Errorf("none of the %d proxies passed a health check against %s", total, proxyPoolConfig.CheckURL)
+	}
+	return nil
+}
+
+// checkGoogleSearch runs a one-result search, which uses one query of the
+// daily Custom Search quota
+func checkGoogleSearch(ctx context.Context) error {
+	apiKey := os.Getenv("GOOGLE_API_KEY")
+	searchEngineID := os.Getenv("GOOGLE_SEARCH_ENGINE_ID")
+	if apiKey == "" || searchEngineID == "" {
+		return fmt.Errorf("GOOGLE_API_KEY and GOOGLE_SEARCH_ENGINE_ID must be set")
+	}
+
+	params := url.Values{}
+	params.Add("key", apiKey)
+	params.Add("cx", searchEngineID)
+	params.Add("q", "news")
+	params.Add("num", "1")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://www.googleapis.com/customsearch/v1?"+params.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error searching: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("search API returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// checkPlaywright starts the driver and launches Chromium, without
+// installing anything
+func checkPlaywright(ctx context.Context) error {
+	pw, err := playwright.Run()
+	if err != nil {
+		return fmt.Errorf("could not start Playwright: %v", err)
+	}
+	defer pw.Stop()
+
+	browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
+		Headless: playwright.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("could not launch Chromium: %v", err)
+	}
+	return browser.Close()
+}
+
+// checkFFmpeg runs ffmpeg and ffprobe, which media optimization and audio
+// mixing shell out to
+func checkFFmpeg(ctx context.Context) error {
+	for _, name := range []string{"ffmpeg", "ffprobe"} {
+		if output, err := exec.CommandContext(ctx, name, "-version").CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %v", name, commandError(err, output))
+		}
+	}
+	return nil
+}
+
+// checkPython imports the modules the Python helpers need
+func checkPython(ctx context.Context) error {
+	script := "import " + strings.Join(pythonModules, ", ")
+	if output, err := exec.CommandContext(ctx, "python3", "-c", script).CombinedOutput(); err != nil {
+		return commandError(err, output)
+	}
+	return nil
+}
+
+// commandError adds the last line of a failed command's output to its
+// error; for a Python traceback that line is the exception itself
+func commandError(err error, output []byte) error {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return fmt.Errorf("%v: %s", err, last)
+	}
+	return err
+}
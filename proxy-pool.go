@@ -0,0 +1,596 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// ProxyPoolConfig controls where proxies come from and how they are shared
+// out. Every Playwright session goes through the pool; article scraping only
+// does when Scraper is set.
+type ProxyPoolConfig struct {
+	Provider       string        // "webshare", "url", "static" or "none"
+	Scheme         string        // "http" or "socks5", for the Webshare proxies
+	ProviderURL    string        // Listing the proxies, for the "url" provider
+	List           []ProxyInfo   // The "static" provider's proxies
+	Scraper        bool          // Route article scraping through the proxies too
+	DirectFallback bool          // Connect directly when the provider fails or has no proxies
+	Refresh        time.Duration // How often the list is fetched from Webshare again
+	CheckURL       string        // Fetched through each proxy to check its health
+	MaxLatency     time.Duration // Health checks slower than this fail
+	MaxFailures    int           // Failures in a row that quarantine a proxy
+	Cooldown       time.Duration // How long a quarantined proxy is left out
+	BlacklistRatio float64       // Share of failed requests that blacklists a proxy for good; 0 never does
+	BlacklistMin   int           // Requests through a proxy before its ratio counts
+}
+
+var defaultProxyPoolConfig = ProxyPoolConfig{
+	Provider:       proxyProviderWebshare,
+	Scheme:         "http",
+	Refresh:        time.Hour,
+	CheckURL:       "https://www.google.com/generate_204",
+	MaxLatency:     5 * time.Second,
+	MaxFailures:    2,
+	Cooldown:       30 * time.Minute,
+	BlacklistRatio: 0.5,
+	BlacklistMin:   20,
+}
+
+var proxyPoolConfig = defaultProxyPoolConfig
+
+// loadProxyPoolConfig reads PROXY_PROVIDER, PROXY_SCHEME, PROXY_PROVIDER_URL,
+// PROXY_LIST or PROXY_FILE, PROXY_SCRAPER ("true" to proxy scraping),
+// PROXY_DIRECT_FALLBACK ("true" to connect directly without proxies),
+// PROXY_REFRESH, PROXY_CHECK_URL, PROXY_MAX_LATENCY, PROXY_MAX_FAILURES,
+// PROXY_COOLDOWN, PROXY_BLACKLIST_RATIO and PROXY_BLACKLIST_MIN_REQUESTS
+func loadProxyPoolConfig() (ProxyPoolConfig, error) {
+	config := defaultProxyPoolConfig
+	if value := os.Getenv("PROXY_PROVIDER"); value != "" {
+		config.Provider = value
+	}
+	switch config.Provider {
+	case proxyProviderWebshare, proxyProviderNone:
+	case proxyProviderURL:
+		config.ProviderURL = os.Getenv("PROXY_PROVIDER_URL")
+		parsed, err := url.Parse(config.ProviderURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return config, fmt.Errorf("PROXY_PROVIDER_URL must be an http or https URL when PROXY_PROVIDER is url")
+		}
+	case proxyProviderStatic:
+		list, err := loadProxyList()
+		if err != nil {
+			return config, err
+		}
+		if len(list) == 0 {
+			return config, fmt.Errorf("PROXY_LIST or PROXY_FILE must list proxies when PROXY_PROVIDER is static")
+		}
+		config.List = list
+	default:
+		return config, fmt.Errorf("unknown PROXY_PROVIDER %q (must be webshare, url, static or none)", config.Provider)
+	}
+	if value := os.Getenv("PROXY_SCHEME"); value != "" {
+		config.Scheme = value
+	}
+	if config.Scheme != "http" && config.Scheme != "socks5" {
+		return config, fmt.Errorf("unknown PROXY_SCHEME %q (must be http or socks5)", config.Scheme)
+	}
+	config.Scraper = os.Getenv("PROXY_SCRAPER") == "true"
+	config.DirectFallback = os.Getenv("PROXY_DIRECT_FALLBACK") == "true"
+	if value := os.Getenv("PROXY_CHECK_URL"); value != "" {
+		parsed, err := url.Parse(value)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return config, fmt.Errorf("PROXY_CHECK_URL must be an http or https URL, got %q", value)
+		}
+		config.CheckURL = value
+	}
+
+	var err error
+	if config.Refresh, err = getEnvDuration("PROXY_REFRESH", config.Refresh); err != nil {
+		return config, err
+	}
+	if config.MaxLatency, err = getEnvDuration("PROXY_MAX_LATENCY", config.MaxLatency); err != nil {
+		return config, err
+	}
+	if config.Cooldown, err = getEnvDuration("PROXY_COOLDOWN", config.Cooldown); err != nil {
+		return config, err
+	}
+	if config.MaxFailures, err = getEnvInt("PROXY_MAX_FAILURES", config.MaxFailures); err != nil {
+		return config, err
+	}
+	if config.Refresh <= 0 || config.MaxLatency <= 0 || config.Cooldown <= 0 {
+		return config, fmt.Errorf("PROXY_REFRESH, PROXY_MAX_LATENCY and PROXY_COOLDOWN must be positive")
+	}
+	if config.MaxFailures < 1 {
+		return config, fmt.Errorf("PROXY_MAX_FAILURES must be at least 1, got %d", config.MaxFailures)
+	}
+	if config.BlacklistRatio, err = getEnvFloat("PROXY_BLACKLIST_RATIO", config.BlacklistRatio); err != nil {
+		return config, err
+	}
+	if config.BlacklistMin, err = getEnvInt("PROXY_BLACKLIST_MIN_REQUESTS", config.BlacklistMin); err != nil {
+		return config, err
+	}
+	if config.BlacklistRatio < 0 || config.BlacklistRatio > 1 {
+		return config, fmt.Errorf("PROXY_BLACKLIST_RATIO must be between 0 and 1, got %g", config.BlacklistRatio)
+	}
+	if config.BlacklistMin < 1 {
+		return config, fmt.Errorf("PROXY_BLACKLIST_MIN_REQUESTS must be at least 1, got %d", config.BlacklistMin)
+	}
+	return config, nil
+}
+
+// errProxyBanned marks a response showing the proxy itself is blocked, e.g.
+// rate limited or sent to Google's CAPTCHA page, rather than the site being
+// down. A banned proxy is quarantined straight away.
+var errProxyBanned = errors.New("proxy banned")
+
+// pooledProxy is one proxy and how it has been doing
+type pooledProxy struct {
+	url              string
+	country          string // Where it exits, when the provider says
+	failures         int    // In a row
+	quarantinedUntil time.Time
+	requests         int64 // Ever made through it, as recorded in proxy_stats
+	failed           int64
+}
+
+// ProxyPool hands out the provider's proxies round-robin, leaving out those
+// that keep failing until their cooldown is over
+type ProxyPool struct {
+	refreshMu   sync.Mutex // Held while fetching, so concurrent callers fetch once
+	mu          sync.Mutex
+	proxies     []*pooledProxy
+	next        int
+	fetchedAt   time.Time
+	direct      bool // Falling back to direct connections until the provider recovers
+	blacklisted int  // Proxies the provider lists that are left out for failing too often
+}
+
+// proxyFallbackRetry is how often a pool falling back to direct connections
+// asks the provider for proxies again
+const proxyFallbackRetry = 5 * time.Minute
+
+var proxyPool = &ProxyPool{}
+
+// Next returns the proxy to use for the next session or request, or "" to
+// connect directly when PROXY_PROVIDER is none. The list is fetched and
+// health checked when it is missing or older than the refresh interval.
+// With every proxy quarantined, the one due back soonest is used rather
+// than failing. When the provider can't supply any proxies, Next fails
+// unless PROXY_DIRECT_FALLBACK is set, in which case it connects directly,
+// waiting for the "direct" rate limit.
+func (p *ProxyPool) Next() (string, error) {
+	return p.NextIn("")
+}
+
+// NextIn is Next preferring a proxy exiting in country, so sites like Google
+// Trends serve that country's content and language. Without a healthy one
+// there it takes one in a neighbouring country, then any proxy.
+func (p *ProxyPool) NextIn(country string) (string, error) {
+	return p.pick(country, nil)
+}
+
+// NextForBrowser is NextIn leaving out proxies Chromium can't use, which
+// are SOCKS5 proxies with credentials other than Webshare's
+func (p *ProxyPool) NextForBrowser(country string) (string, error) {
+	return p.pick(country, browserCanUse)
+}
+
+// pick chooses a proxy as NextIn does, from those usable accepts when it is set
+func (p *ProxyPool) pick(country string, usable func(proxyURL string) bool) (string, error) {
+	if proxyPoolConfig.Provider == proxyProviderNone {
+		return "", nil
+	}
+	if err := p.refreshIfStale(); err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	if p.direct {
+		p.mu.Unlock()
+		release, err := waitForAPI(context.Background(), apiDirect)
+		if err != nil {
+			return "", err
+		}
+		release()
+		return "", nil
+	}
+	defer p.mu.Unlock()
+	var candidates []*pooledProxy
+	for _, proxy := range p.proxies {
+		if usable == nil || usable(proxy.url) {
+			candidates = append(candidates, proxy)
+		}
+	}
+	if len(candidates) == 0 {
+		if len(p.proxies) > 0 {
+			return "", fmt.Errorf("none of the %d proxies can be used by the browser, which doesn't support SOCKS5 proxies with credentials", len(p.proxies))
+		}
+		return "", fmt.Errorf("no proxies found")
+	}
+	now := appNow()
+	region := proxyRegions[country]
+	matches := []func(*pooledProxy) bool{
+		func(proxy *pooledProxy) bool { return proxy.country == country },
+		func(proxy *pooledProxy) bool { return region != "" && proxyRegions[proxy.country] == region },
+		func(proxy *pooledProxy) bool { return true },
+	}
+	if country == "" {
+		matches = matches[2:]
+	}
+	for level, match := range matches {
+		for i := range p.proxies {
+			proxy := p.proxies[(p.next+i)%len(p.proxies)]
+			if now.Before(proxy.quarantinedUntil) || !match(proxy) || (usable != nil && !usable(proxy.url)) {
+				continue
+			}
+			p.next = (p.next + i + 1) % len(p.proxies)
+			if level > 0 {
+				slog.Debug("No healthy proxy in the requested country", "country", country,
+					"proxy", proxyHost(proxy.url), "proxyCountry", proxy.country)
+			}
+			return proxy.url, nil
+		}
+	}
+
+	soonest := candidates[0]
+	for _, proxy := range candidates[1:] {
+		if proxy.quarantinedUntil.Before(soonest.quarantinedUntil) {
+			soonest = proxy
+		}
+	}
+	slog.Warn("Every proxy is quarantined, using the one due back soonest",
+		"proxy", proxyHost(soonest.url), "until", soonest.quarantinedUntil)
+	return soonest.url, nil
+}
+
+// Report records how a request through proxyURL went. Failures in a row, or
+// a single ban, quarantine the proxy for the cooldown, and failing too large
+// a share of its requests blacklists it.
+func (p *ProxyPool) Report(proxyURL string, err error) {
+	p.mu.Lock()
+	var proxy *pooledProxy
+	for _, candidate := range p.proxies {
+		if candidate.url == proxyURL {
+			proxy = candidate
+			break
+		}
+	}
+	if proxy == nil {
+		p.mu.Unlock()
+		return
+	}
+	proxy.requests++
+	if err == nil {
+		proxy.failures = 0
+	} else {
+		proxy.failed++
+		proxy.failures++
+		if proxy.failures >= proxyPoolConfig.MaxFailures || errors.Is(err, errProxyBanned) {
+			proxy.quarantinedUntil = appNow().Add(proxyPoolConfig.Cooldown)
+			proxy.failures = 0
+			slog.Warn("Quarantining proxy", "proxy", proxyHost(proxy.url), "until", proxy.quarantinedUntil, "error", err)
+		}
+	}
+	reason := blacklistReason(proxy.requests, proxy.failed)
+	if reason != "" {
+		p.remove(proxy)
+		p.blacklisted++
+	}
+	p.mu.Unlock()
+
+	recordProxyOutcome(proxyURL, err, reason)
+}
+
+// remove takes proxy out of the rotation; mu must be held
+func (p *ProxyPool) remove(proxy *pooledProxy) {
+	for i, candidate := range p.proxies {
+		if candidate == proxy {
+			p.proxies = append(p.proxies[:i], p.proxies[i+1:]...)
+			if p.next > i {
+				p.next--
+			}
+			break
+		}
+	}
+	if len(p.proxies) > 0 {
+		p.next %= len(p.proxies)
+	} else {
+		p.next = 0
+	}
+}
+
+// Healthy returns how many proxies are in the pool and out of quarantine
+func (p *ProxyPool) Healthy() (healthy int, total int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := appNow()
+	for _, proxy := range p.proxies {
+		if !now.Before(proxy.quarantinedUntil) {
+			healthy++
+		}
+	}
+	return healthy, len(p.proxies)
+}
+
+// refreshIfStale fetches the proxy list again once it is older than the
+// refresh interval, keeping the quarantine of proxies still on it, and
+// health checks the new list. A failed fetch keeps the old list if there
+// is one.
+func (p *ProxyPool) refreshIfStale() error {
+	p.refreshMu.Lock()
+	defer p.refreshMu.Unlock()
+	p.mu.Lock()
+	refresh := proxyPoolConfig.Refresh
+	if p.direct {
+		refresh = proxyFallbackRetry
+	}
+	stale := p.fetchedAt.IsZero() || (len(p.proxies) == 0 && !p.direct) || appNow().Sub(p.fetchedAt) >= refresh
+	p.mu.Unlock()
+	if !stale {
+		return nil
+	}
+
+	provider, err := newProxyProvider(proxyPoolConfig)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), proxyListTimeout)
+	defer cancel()
+	infos, err := provider.Proxies(ctx)
+	if err != nil {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if len(p.proxies) > 0 {
+			slog.Warn("Could not refresh proxies, keeping the current list", "error", err)
+			p.fetchedAt = appNow()
+			return nil
+		}
+		return p.fallBackToDirect(fmt.Errorf("error fetching proxies: %v", err))
+	}
+	infos, stats, blacklisted := withoutBlacklisted(infos)
+	if len(infos) == 0 {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.blacklisted = blacklisted
+		if blacklisted > 0 {
+			return p.fallBackToDirect(fmt.Errorf("all %d proxies from the %s provider are blacklisted", blacklisted, proxyPoolConfig.Provider))
+		}
+		return p.fallBackToDirect(fmt.Errorf("the %s proxy provider has no proxies", proxyPoolConfig.Provider))
+	}
+
+	urls := make([]string, 0, len(infos))
+	for _, info := range infos {
+		urls = append(urls, info.URL)
+	}
+	checked := checkProxies(urls)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	previous := make(map[string]*pooledProxy)
+	for _, proxy := range p.proxies {
+		previous[proxy.url] = proxy
+	}
+	p.proxies = nil
+	for _, info := range infos {
+		proxy := &pooledProxy{url: info.URL, country: info.Country}
+		if stat, ok := stats[proxyHost(info.URL)]; ok {
+			proxy.requests = stat.Successes + stat.Failures
+			proxy.failed = stat.Failures
+		}
+		if old, ok := previous[info.URL]; ok {
+			proxy.quarantinedUntil = old.quarantinedUntil
+		}
+		if checked[info.URL].err != nil {
+			proxy.quarantinedUntil = appNow().Add(proxyPoolConfig.Cooldown)
+		}
+		p.proxies = append(p.proxies, proxy)
+	}
+	p.next = 0
+	p.fetchedAt = appNow()
+	p.blacklisted = blacklisted
+	if p.direct {
+		slog.Info("Proxies are back, no longer connecting directly")
+		p.direct = false
+	}
+
+	healthy := 0
+	for _, result := range checked {
+		if result.err == nil {
+			healthy++
+		}
+	}
+	slog.Info("Refreshed proxies", "proxies", len(infos), "healthy", healthy, "blacklisted", blacklisted)
+	return nil
+}
+
+// fallBackToDirect returns err unless PROXY_DIRECT_FALLBACK is set, in which
+// case the pool connects directly until the provider is asked again; mu must
+// be held
+func (p *ProxyPool) fallBackToDirect(err error) error {
+	if !proxyPoolConfig.DirectFallback {
+		return err
+	}
+	if !p.direct {
+		slog.Warn("No proxies available, connecting directly at a reduced rate",
+			"error", err, "retryIn", proxyFallbackRetry, "perMinute", rateLimitConfig.PerMinute[apiDirect])
+		reportFailure(context.Background(), reportLevelWarning, "Proxies unavailable, connecting directly", err, nil)
+	}
+	p.direct = true
+	p.proxies = nil
+	p.fetchedAt = appNow()
+	return nil
+}
+
+// proxyRegions groups the countries Trends is most often followed in, so a
+// geo without a proxy of its own gets one nearby rather than anywhere
+var proxyRegions = map[string]string{
+	"US": "north-america", "CA": "north-america", "MX": "north-america",
+	"BR": "south-america", "AR": "south-america", "CL": "south-america", "CO": "south-america", "PE": "south-america",
+	"GB": "western-europe", "IE": "western-europe", "FR": "western-europe", "BE": "western-europe", "NL": "western-europe",
+	"LU": "western-europe", "DE": "western-europe", "AT": "western-europe", "CH": "western-europe",
+	"ES": "southern-europe", "PT": "southern-europe", "IT": "southern-europe", "GR": "southern-europe",
+	"SE": "northern-europe", "NO": "northern-europe", "DK": "northern-europe", "FI": "northern-europe",
+	"PL": "eastern-europe", "CZ": "eastern-europe", "SK": "eastern-europe", "HU": "eastern-europe", "RO": "eastern-europe", "UA": "eastern-europe",
+	"TR": "middle-east", "IL": "middle-east", "AE": "middle-east", "SA": "middle-east", "EG": "middle-east",
+	"NG": "africa", "KE": "africa", "ZA": "africa",
+	"IN": "south-asia", "PK": "south-asia", "BD": "south-asia",
+	"JP": "east-asia", "KR": "east-asia", "TW": "east-asia", "HK": "east-asia",
+	"SG": "southeast-asia", "MY": "southeast-asia", "ID": "southeast-asia", "TH": "southeast-asia", "VN": "southeast-asia", "PH": "southeast-asia",
+	"AU": "oceania", "NZ": "oceania",
+}
+
+// proxyListTimeout bounds fetching the proxy list from its provider
+const proxyListTimeout = 30 * time.Second
+
+// proxyCheckConcurrency caps how many proxies are health checked at once, so
+// a long list doesn't open thousands of connections together
+const proxyCheckConcurrency = 20
+
+// proxyCheck is the outcome of one proxy's health check
+type proxyCheck struct {
+	latency time.Duration
+	err     error
+}
+
+// checkProxies health checks every proxy, proxyCheckConcurrency at a time
+func checkProxies(urls []string) map[string]proxyCheck {
+	results := make(map[string]proxyCheck)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, proxyCheckConcurrency)
+	for _, proxyURL := range urls {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			start := time.Now()
+			err := checkProxy(proxyURL)
+			mu.Lock()
+			results[proxyURL] = proxyCheck{latency: time.Since(start), err: err}
+			mu.Unlock()
+			if err != nil {
+				slog.Debug("Proxy failed its health check", "proxy", proxyHost(proxyURL), "error", err)
+			} else {
+				slog.Debug("Proxy passed its health check", "proxy", proxyHost(proxyURL), "latency", time.Since(start).Round(time.Millisecond))
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// checkProxy fetches the check URL through the proxy within the latency
+// limit. Being rate limited counts as a ban. The connection is closed
+// afterwards rather than left idle, as the transport isn't used again.
+func checkProxy(proxyURL string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), proxyPoolConfig.MaxLatency)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, proxyPoolConfig.CheckURL, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	proxy, err := url.Parse(proxyURL)
+	if err != nil {
+		return fmt.Errorf("invalid proxy URL: %v", err)
+	}
+	transport := &http.Transport{Proxy: http.ProxyURL(proxy), DisableKeepAlives: true}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return proxyResponseError(resp.StatusCode, resp.Request.URL.String())
+}
+
+// proxyResponseError tells whether a response fetched through a proxy shows
+// the proxy is banned: rate limiting, the proxy refusing its credentials,
+// or a redirect to Google's CAPTCHA page
+func proxyResponseError(status int, finalURL string) error {
+	if status == http.StatusTooManyRequests || status == http.StatusProxyAuthRequired || strings.Contains(finalURL, "google.com/sorry/") {
+		return errProxyBanned
+	}
+	return nil
+}
+
+// proxyContextKey carries the proxy chosen for a request
+type proxyContextKey struct{}
+
+// withProxy sends requests made with ctx through proxyURL, when their
+// client's transport uses requestProxy
+func withProxy(ctx context.Context, proxyURL string) context.Context {
+	return context.WithValue(ctx, proxyContextKey{}, proxyURL)
+}
+
+// requestProxy is an http.Transport Proxy function using the proxy chosen
+// for the request with withProxy, or none
+func requestProxy(req *http.Request) (*url.URL, error) {
+	proxyURL, _ := req.Context().Value(proxyContextKey{}).(string)
+	if proxyURL == "" {
+		return nil, nil
+	}
+	return url.Parse(proxyURL)
+}
+
+// browserCanUse reports whether a Playwright browser context can go through
+// proxyURL
+func browserCanUse(proxyURL string) bool {
+	return browserProxyURL(proxyURL) != ""
+}
+
+// browserProxyURL is the address Chromium should use for proxyURL, or "" if
+// it can't use it. Chromium can't authenticate to SOCKS5 proxies, so those
+// only work without credentials, except Webshare's, which take HTTP on the
+// same port.
+func browserProxyURL(proxyURL string) string {
+	parsed, err := url.Parse(proxyURL)
+	if err != nil {
+		return ""
+	}
+	if !strings.HasPrefix(parsed.Scheme, "socks") || parsed.User == nil {
+		return proxyURL
+	}
+	if proxyPoolConfig.Provider == proxyProviderWebshare {
+		parsed.Scheme = "http"
+		return parsed.String()
+	}
+	return ""
+}
+
+// playwrightProxy is the proxy setting for a Playwright browser context,
+// which takes the credentials apart from the server address, going through
+// browserProxyURL first
+func playwrightProxy(proxyURL string) *playwright.Proxy {
+	proxyURL = browserProxyURL(proxyURL)
+	parsed, err := url.Parse(proxyURL)
+	if err != nil || parsed.User == nil {
+		return &playwright.Proxy{Server: proxyURL}
+	}
+	proxy := &playwright.Proxy{
+		Server:   parsed.Scheme + "://" + parsed.Host,
+		Username: playwright.String(parsed.User.Username()),
+	}
+	if password, ok := parsed.User.Password(); ok {
+		proxy.Password = playwright.String(password)
+	}
+	return proxy
+}
+
+// proxyHost is the proxy's address without its credentials, for logging
+func proxyHost(proxyURL string) string {
+	if parsed, err := url.Parse(proxyURL); err == nil {
+		return parsed.Host
+	}
+	return "unknown"
+}
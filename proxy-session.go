@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// ProxySession pins one proxy for everything a run does through the pool,
+// since sites like Google Trends flag a session whose IP keeps changing. The
+// pinned proxy is dropped when a request through it fails or the pool
+// quarantines it, and the next request pins another.
+type ProxySession struct {
+	pool    *ProxyPool
+	country string // Preferred country for the proxy, as for NextIn
+	mu      sync.Mutex
+	proxy   string
+}
+
+// Session starts a proxy session preferring proxies in country
+func (p *ProxyPool) Session(country string) *ProxySession {
+	return &ProxySession{pool: p, country: country}
+}
+
+// Proxy returns the session's pinned proxy, pinning the pool's next proxy
+// when there is none or the pinned one is no longer usable
+func (s *ProxySession) Proxy(ctx context.Context) (string, error) {
+	return s.pin(ctx, nil)
+}
+
+// BrowserProxy is Proxy for a Playwright browser context, re-pinning the
+// run to a proxy Chromium can use if it can't use the pinned one
+func (s *ProxySession) BrowserProxy(ctx context.Context) (string, error) {
+	return s.pin(ctx, browserCanUse)
+}
+
+// pin returns the pinned proxy if usable accepts it, or pins another
+func (s *ProxySession) pin(ctx context.Context, usable func(proxyURL string) bool) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.proxy != "" && s.pool.usable(s.proxy) && (usable == nil || usable(s.proxy)) {
+		return s.proxy, nil
+	}
+	proxy, err := s.pool.pick(s.country, usable)
+	if err != nil {
+		return "", err
+	}
+	if proxy != "" && proxy != s.proxy {
+		if s.proxy == "" {
+			loggerFrom(ctx).Debug("Pinned proxy for the run", "proxy", proxyHost(proxy))
+		} else {
+			loggerFrom(ctx).Info("Re-pinned proxy for the run", "from", proxyHost(s.proxy), "to", proxyHost(proxy))
+		}
+	}
+	s.proxy = proxy
+	return proxy, nil
+}
+
+// Report tells the pool how a request through proxy went, unpinning it if
+// it failed so the next request tries another
+func (s *ProxySession) Report(proxy string, err error) {
+	s.pool.Report(proxy, err)
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.proxy == proxy {
+		s.proxy = ""
+	}
+}
+
+// usable reports whether proxyURL is still in the pool and out of quarantine
+func (p *ProxyPool) usable(proxyURL string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.direct {
+		return false
+	}
+	now := appNow()
+	for _, proxy := range p.proxies {
+		if proxy.url == proxyURL {
+			return !now.Before(proxy.quarantinedUntil)
+		}
+	}
+	return false
+}
+
+// proxySessionKey carries a run's proxy session
+type proxySessionKey struct{}
+
+// withProxySession returns a context whose browser sessions and proxied
+// requests share session's proxy
+func withProxySession(ctx context.Context, session *ProxySession) context.Context {
+	return context.WithValue(ctx, proxySessionKey{}, session)
+}
+
+// proxySessionFrom returns the run's proxy session, or a new one for work
+// outside a run
+func proxySessionFrom(ctx context.Context) *ProxySession {
+	if session, ok := ctx.Value(proxySessionKey{}).(*ProxySession); ok {
+		return session
+	}
+	return proxyPool.Session(trendsGeo)
+}
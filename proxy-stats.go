@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// blacklistReason says why a proxy with these totals should be blacklisted,
+// or returns "" while it is doing well enough or has too few requests to tell
+func blacklistReason(requests int64, failed int64) string {
+	if proxyPoolConfig.BlacklistRatio <= 0 || requests < int64(proxyPoolConfig.BlacklistMin) {
+		return ""
+	}
+	ratio := float64(failed) / float64(requests)
+	if ratio < proxyPoolConfig.BlacklistRatio {
+		return ""
+	}
+	return fmt.Sprintf("%d of %d requests failed (%.0f%%, limit %.0f%%)", failed, requests, ratio*100, proxyPoolConfig.BlacklistRatio*100)
+}
+
+// withoutBlacklisted leaves out the proxies blacklisted in proxy_stats,
+// returning the rest with the stats by host and how many were left out. The
+// list is kept whole when the stats can't be read.
+func withoutBlacklisted(infos []ProxyInfo) ([]ProxyInfo, map[string]*ProxyStat, int) {
+	stats := make(map[string]*ProxyStat)
+	if dbClient == nil {
+		return infos, stats, 0
+	}
+	rows, err := dbClient.GetProxyStats()
+	if err != nil {
+		slog.Warn("Could not load proxy stats, not leaving out blacklisted proxies", "error", err)
+		return infos, stats, 0
+	}
+	for _, stat := range rows {
+		stats[stat.Host] = stat
+	}
+
+	var kept []ProxyInfo
+	blacklisted := 0
+	for _, info := range infos {
+		if stat, ok := stats[proxyHost(info.URL)]; ok && stat.BlacklistedAt != nil {
+			blacklisted++
+			continue
+		}
+		kept = append(kept, info)
+	}
+	return kept, stats, blacklisted
+}
+
+// recordProxyOutcome counts a request through proxyURL in the metrics and
+// proxy_stats, and persists its blacklisting when reason is set
+func recordProxyOutcome(proxyURL string, err error, reason string) {
+	host := proxyHost(proxyURL)
+	outcome := "success"
+	successes, failures := 1, 0
+	if err != nil {
+		outcome = "failure"
+		successes, failures = 0, 1
+	}
+	pipelineMetrics.ProxyRequest(host, outcome)
+	if dbClient == nil {
+		return
+	}
+	if err := dbClient.RecordProxyOutcomes(host, successes, failures); err != nil {
+		slog.Warn("Could not record proxy outcome", "proxy", host, "error", err)
+	}
+	if reason == "" {
+		return
+	}
+
+	slog.Warn("Blacklisting proxy", "proxy", host, "reason", reason)
+	reportFailure(context.Background(), reportLevelWarning, "Proxy blacklisted", fmt.Errorf("%s: %s", host, reason), nil)
+	if err := dbClient.BlacklistProxy(host, reason); err != nil {
+		slog.Warn("Could not save proxy blacklisting, it will be back after the next refresh", "proxy", host, "error", err)
+	}
+}
+
+// States counts the pool's proxies by state, "healthy", "quarantined" or
+// "blacklisted", for /metrics
+func (p *ProxyPool) States() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	states := map[string]int{"healthy": 0, "quarantined": 0, "blacklisted": p.blacklisted}
+	now := appNow()
+	for _, proxy := range p.proxies {
+		if now.Before(proxy.quarantinedUntil) {
+			states["quarantined"]++
+		} else {
+			states["healthy"]++
+		}
+	}
+	return states
+}
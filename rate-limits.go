@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// External APIs whose requests go through a shared limiter
+const (
+	apiGemini   = "gemini"
+	apiOpenAI   = "openai"
+	apiSearch   = "cse" // Google Custom Search
+	apiSupabase = "supabase"
+	apiTTS      = "tts"    // Whichever TTS provider is configured; TTS_MAX_CONCURRENT caps it
+	apiDirect   = "direct" // Proxied requests sent directly while the proxy provider is down
+	apiEmail    = "email"  // Newsletter sends through EMAIL_PROVIDER
+)
+
+// apiRequestsPerMinute are the default request rates, set under each
+// provider's lowest paid tier so parallel workers don't get the key banned
+var apiRequestsPerMinute = map[string]float64{
+	apiGemini:   300,
+	apiOpenAI:   50,
+	apiSearch:   100,
+	apiSupabase: 600,
+	apiTTS:      0,
+	apiDirect:   20, // One address is much easier to ban than a pool
+	apiEmail:    600,
+}
+
+// RateLimitConfig holds the request rate allowed to each external API. Rates
+// are requests per minute, 0 meaning unlimited; concurrency caps requests
+// in flight at once, 0 meaning uncapped.
+type RateLimitConfig struct {
+	PerMinute   map[string]float64
+	Concurrency map[string]int
+}
+
+var defaultRateLimitConfig = RateLimitConfig{PerMinute: apiRequestsPerMinute}
+
+var rateLimitConfig = defaultRateLimitConfig
+
+// loadRateLimitConfig reads RATE_LIMITS ("gemini=1000,openai=500") in
+// requests per minute. TTS concurrency comes from TTS_MAX_CONCURRENT.
+func loadRateLimitConfig() (RateLimitConfig, error) {
+	config := RateLimitConfig{
+		PerMinute:   make(map[string]float64),
+		Concurrency: map[string]int{apiTTS: ttsMaxConcurrent()},
+	}
+	for name, perMinute := range apiRequestsPerMinute {
+		config.PerMinute[name] = perMinute
+	}
+	for name, value := range getEnvMap("RATE_LIMITS") {
+		if _, ok := config.PerMinute[name]; !ok {
+			return config, fmt.Errorf("unknown RATE_LIMITS entry %q", name)
+		}
+		perMinute, err := strconv.ParseFloat(value, 64)
+		if err != nil || perMinute < 0 {
+			return config, fmt.Errorf("RATE_LIMITS %s must be a non-negative number, got %q", name, value)
+		}
+		config.PerMinute[name] = perMinute
+	}
+	return config, nil
+}
+
+// apiLimiter paces the requests to one API
+type apiLimiter struct {
+	rate  *rate.Limiter // Nil when the rate is unlimited
+	slots chan struct{} // Nil when concurrency is uncapped
+}
+
+var (
+	apiLimitersMu sync.Mutex
+	apiLimiters   = make(map[string]*apiLimiter)
+)
+
+// limiterFor returns the API's limiter, creating it from rateLimitConfig on
+// first use. Bursts are capped at one request, so a limit of 60 spaces
+// requests a second apart rather than allowing 60 at once.
+func limiterFor(api string) *apiLimiter {
+	apiLimitersMu.Lock()
+	defer apiLimitersMu.Unlock()
+	if limiter, ok := apiLimiters[api]; ok {
+		return limiter
+	}
+	limiter := &apiLimiter{}
+	if perMinute := rateLimitConfig.PerMinute[api]; perMinute > 0 {
+		limiter.rate = rate.NewLimiter(rate.Limit(perMinute/60), 1)
+	}
+	if n := rateLimitConfig.Concurrency[api]; n > 0 {
+		limiter.slots = make(chan struct{}, n)
+	}
+	apiLimiters[api] = limiter
+	return limiter
+}
+
+// waitForAPI blocks until a request to the API may be made, returning the
+// function that ends it. The caller must call release once the request is
+// done, and on every path: in a loop, call it per iteration rather than
+// deferring it.
+func waitForAPI(ctx context.Context, api string) (release func(), err error) {
+	limiter := limiterFor(api)
+	if limiter.slots != nil {
+		select {
+		case limiter.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		release = func() { <-limiter.slots }
+	} else {
+		release = func() {}
+	}
+	if limiter.rate != nil {
+		if err := limiter.rate.Wait(ctx); err != nil {
+			release()
+			return nil, fmt.Errorf("waiting for %s rate limit: %v", api, err)
+		}
+	}
+	return release, nil
+}
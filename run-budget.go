@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Kinds of spending counted against the run budget
+const (
+	spendLLM   = "llm"
+	spendTTS   = "tts"
+	spendImage = "image"
+)
+
+// errRunBudgetExceeded is recorded on topics a run skipped for lack of budget
+var errRunBudgetExceeded = errors.New("run budget exceeded, topic skipped")
+
+// geminiPricePerMillionTokens is Gemini 2.0 Flash's list price in US dollars
+// for input and output tokens. GEMINI_PRICES overrides it for other models.
+var geminiPricePerMillionTokens = map[string]float64{
+	"input":  0.10,
+	"output": 0.40,
+}
+
+// imagePricePerImage is each image provider's list price in US dollars.
+// IMAGE_PRICES overrides it, e.g. for OpenAI's quality settings or a paid
+// Stable Diffusion host.
+var imagePricePerImage = map[string]float64{
+	"imagen":          0.03,
+	"openai":          0.04,
+	"stablediffusion": 0,
+}
+
+// RunBudgetConfig caps what one run may spend on paid APIs. Spending is
+// estimated from list prices: Gemini tokens, TTS characters (priced by
+// TTS_PRICES) and generated images.
+type RunBudgetConfig struct {
+	Limit        float64            // US dollars per run; 0 means unlimited
+	GeminiPrices map[string]float64 // US dollars per million "input" and "output" tokens
+	ImagePrices  map[string]float64 // US dollars per image, by provider
+}
+
+var defaultRunBudgetConfig = RunBudgetConfig{
+	GeminiPrices: geminiPricePerMillionTokens,
+	ImagePrices:  imagePricePerImage,
+}
+
+var runBudgetConfig = defaultRunBudgetConfig
+
+// loadRunBudgetConfig reads RUN_BUDGET (US dollars, e.g. "2.50"),
+// GEMINI_PRICES ("input=0.10,output=0.40") and IMAGE_PRICES ("openai=0.08")
+func loadRunBudgetConfig() (RunBudgetConfig, error) {
+	config := defaultRunBudgetConfig
+	var err error
+	if config.Limit, err = getEnvFloat("RUN_BUDGET", 0); err != nil {
+		return config, err
+	}
+	if config.Limit < 0 {
+		return config, fmt.Errorf("RUN_BUDGET must not be negative, got %v", config.Limit)
+	}
+
+	config.GeminiPrices = make(map[string]float64)
+	for name, price := range geminiPricePerMillionTokens {
+		config.GeminiPrices[name] = price
+	}
+	config.ImagePrices = make(map[string]float64)
+	for name, price := range imagePricePerImage {
+		config.ImagePrices[name] = price
+	}
+	for _, setting := range []struct {
+		key    string
+		values map[string]float64
+	}{
+		{"GEMINI_PRICES", config.GeminiPrices},
+		{"IMAGE_PRICES", config.ImagePrices},
+	} {
+		for name, value := range getEnvMap(setting.key) {
+			if _, ok := setting.values[name]; !ok {
+				return config, fmt.Errorf("unknown %s entry %q", setting.key, name)
+			}
+			amount, err := strconv.ParseFloat(value, 64)
+			if err != nil || amount < 0 {
+				return config, fmt.Errorf("%s %s must be a non-negative number, got %q", setting.key, name, value)
+			}
+			setting.values[name] = amount
+		}
+	}
+	return config, nil
+}
+
+// geminiCost estimates what a Gemini call cost from its token counts
+func (c RunBudgetConfig) geminiCost(inputTokens int, outputTokens int) float64 {
+	return (c.GeminiPrices["input"]*float64(inputTokens) + c.GeminiPrices["output"]*float64(outputTokens)) / 1e6
+}
+
+// RunSpend tracks the estimated spending of the run in progress. Runs never
+// overlap, so processTopics resets the one tracker at the start of each.
+type RunSpend struct {
+	mu       sync.Mutex
+	ctx      context.Context // The run's, for logging and reporting a breach
+	runID    string
+	limit    float64
+	spent    map[string]float64
+	exceeded bool
+}
+
+var runSpend = &RunSpend{ctx: context.Background(), spent: make(map[string]float64)}
+
+// Start begins tracking a run that may spend up to limit US dollars, or
+// without a limit when it is 0
+func (s *RunSpend) Start(ctx context.Context, limit float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ctx = ctx
+	s.runID = reportTagsFrom(ctx)["run"]
+	s.limit = limit
+	s.spent = make(map[string]float64)
+	s.exceeded = false
+}
+
+// Add records spending of one kind. The first addition that takes the run
+// over its limit logs and reports the breach.
+func (s *RunSpend) Add(kind string, costUSD float64) {
+	if costUSD <= 0 {
+		return
+	}
+	pipelineMetrics.EstimatedSpend(kind, costUSD)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spent[kind] += costUSD
+	total := s.total()
+	if s.limit == 0 || s.exceeded || total <= s.limit {
+		return
+	}
+	s.exceeded = true
+
+	loggerFrom(s.ctx).Warn("Run budget exceeded, skipping new topics and publishing the rest without audio or images",
+		append([]any{"budget", s.limit}, s.breakdown()...)...)
+	extra := make(map[string]string)
+	for kind, spent := range s.spent {
+		extra[kind] = fmt.Sprintf("%.4f", spent)
+	}
+	err := fmt.Errorf("estimated spend of $%.2f is over the run budget of $%.2f", total, s.limit)
+	reportFailure(s.ctx, reportLevelWarning, "Run budget exceeded", err, extra)
+}
+
+// Exceeded reports whether the run has spent more than its limit
+func (s *RunSpend) Exceeded() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exceeded
+}
+
+// SpentBy returns what the run with runID is estimated to have spent, or 0
+// when another run has been tracked since, or none at all
+func (s *RunSpend) SpentBy(runID string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if runID == "" || s.runID != runID {
+		return 0
+	}
+	return s.total()
+}
+
+// LogSummary logs what the run is estimated to have spent
+func (s *RunSpend) LogSummary(logger *slog.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	args := s.breakdown()
+	if s.limit > 0 {
+		args = append(args, "budget", s.limit, "exceeded", s.exceeded)
+	}
+	logger.Info("Estimated run spend", args...)
+}
+
+// total must be called with mu held
+func (s *RunSpend) total() float64 {
+	total := 0.0
+	for _, spent := range s.spent {
+		total += spent
+	}
+	return total
+}
+
+// breakdown returns the spending so far as log attributes, rounded to a
+// hundredth of a cent; mu must be held
+func (s *RunSpend) breakdown() []any {
+	round := func(usd float64) float64 { return math.Round(usd*1e4) / 1e4 }
+	return []any{
+		"spentUSD", round(s.total()),
+		spendLLM, round(s.spent[spendLLM]),
+		spendTTS, round(s.spent[spendTTS]),
+		spendImage, round(s.spent[spendImage]),
+	}
+}
+
+// recordGeminiUsage counts a Gemini response's tokens against the run budget
+func recordGeminiUsage(usage *genai.UsageMetadata) {
+	if usage == nil {
+		return
+	}
+	runSpend.Add(spendLLM, runBudgetConfig.geminiCost(int(usage.PromptTokenCount), int(usage.CandidatesTokenCount)))
+}
+
+// recordGeminiRESTUsage does the same for a response decoded from the REST
+// API, whose "usageMetadata" carries the token counts
+func recordGeminiRESTUsage(response map[string]interface{}) {
+	usage, ok := response["usageMetadata"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	input, _ := usage["promptTokenCount"].(float64)
+	output, _ := usage["candidatesTokenCount"].(float64)
+	runSpend.Add(spendLLM, runBudgetConfig.geminiCost(int(input), int(output)))
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// S3Storage stores media in an S3-compatible bucket (AWS S3, MinIO, R2, ...).
+// Objects are keyed "<bucket>/<fileName>", where bucket is the logical media
+// bucket ("images", "audio"). The bucket must allow public reads of its objects.
+type S3Storage struct {
+	bucket          string
+	region          string
+	accessKeyId     string
+	secretAccessKey string
+	endpoint        string // Base URL objects are addressed under, including the bucket
+	publicURL       string // Base URL objects are served from
+	httpClient      *http.Client
+}
+
+func init() {
+	RegisterStorageBackend("s3", func() (StorageClient, error) {
+		client, err := NewS3Storage()
+		if err != nil {
+			return nil, fmt.Errorf("error initializing S3 storage: %v", err)
+		}
+		return client, nil
+	})
+}
+
+// NewS3Storage reads S3_BUCKET, S3_REGION, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY.
+// S3_ENDPOINT points at a non-AWS server such as MinIO (path-style addressing is
+// used), and S3_PUBLIC_URL overrides the base URL written to articles, e.g. a CDN.
+func NewS3Storage() (*S3Storage, error) {
+	s := &S3Storage{
+		bucket:          os.Getenv("S3_BUCKET"),
+		region:          os.Getenv("S3_REGION"),
+		accessKeyId:     os.Getenv("S3_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		httpClient:      &http.Client{Timeout: 5 * time.Minute},
+	}
+	for key, value := range map[string]string{
+		"S3_BUCKET":            s.bucket,
+		"S3_REGION":            s.region,
+		"S3_ACCESS_KEY_ID":     s.accessKeyId,
+		"S3_SECRET_ACCESS_KEY": s.secretAccessKey,
+	} {
+		if value == "" {
+			return nil, fmt.Errorf("%s environment variable is not set", key)
+		}
+	}
+
+	if endpoint := strings.TrimSuffix(os.Getenv("S3_ENDPOINT"), "/"); endpoint != "" {
+		if _, err := url.ParseRequestURI(endpoint); err != nil {
+			return nil, fmt.Errorf("S3_ENDPOINT must be a URL like \"http://localhost:9000\", got %q", endpoint)
+		}
+		s.endpoint = endpoint + "/" + s3EscapePath(s.bucket)
+	} else {
+		s.endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", s.bucket, s.region)
+	}
+
+	s.publicURL = strings.TrimSuffix(os.Getenv("S3_PUBLIC_URL"), "/")
+	if s.publicURL == "" {
+		s.publicURL = s.endpoint
+	}
+
+	return s, nil
+}
+
+// Upload puts a file into the bucket and returns its public URL
+func (s *S3Storage) Upload(ctx context.Context, filePath string, bucket string, fileName string) (string, error) {
+	// SigV4 signs the payload hash, so hash the file in one pass and stream it in another
+	payloadHash, err := fileSHA256(filePath)
+	if err != nil {
+		return "", err
+	}
+	file, size, err := openUpload(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	key := strings.Trim(bucket, "\"") + "/" + fileName
+
+	contentType := mime.TypeByExtension(filepath.Ext(filePath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", s.endpoint+"/"+s3EscapePath(key), file)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Cache-Control", cacheControlFor(fileName))
+	s.sign(req, payloadHash, time.Now())
+
+	if err := s.do(req, "upload"); err != nil {
+		return "", err
+	}
+
+	return s.PublicURL(bucket, fileName), nil
+}
+
+// PublicURL returns the URL an object is served from
+func (s *S3Storage) PublicURL(bucket string, fileName string) string {
+	return s.publicURL + "/" + s3EscapePath(strings.Trim(bucket, "\"")+"/"+fileName)
+}
+
+// Exists sends a signed HEAD request for the object
+func (s *S3Storage) Exists(ctx context.Context, bucket string, fileName string) (bool, error) {
+	key := strings.Trim(bucket, "\"") + "/" + fileName
+	req, err := http.NewRequestWithContext(ctx, "HEAD", s.endpoint+"/"+s3EscapePath(key), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %v", err)
+	}
+	s.sign(req, sha256Hex(nil), time.Now())
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to check file: %v", err)
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("check failed with status %d", resp.StatusCode)
+	}
+}
+
+// Delete removes an object given the public URL returned by Upload
+func (s *S3Storage) Delete(publicURL string) error {
+	prefix := s.publicURL + "/"
+	if !strings.HasPrefix(publicURL, prefix) {
+		return fmt.Errorf("not a storage URL for this bucket: %s", publicURL)
+	}
+	escapedKey := strings.TrimPrefix(publicURL, prefix)
+	if escapedKey == "" {
+		return fmt.Errorf("malformed storage URL: %s", publicURL)
+	}
+
+	req, err := http.NewRequest("DELETE", s.endpoint+"/"+escapedKey, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	s.sign(req, sha256Hex(nil), time.Now())
+
+	return s.do(req, "delete")
+}
+
+// do sends a signed request and turns non-2xx responses into errors
+func (s *S3Storage) do(req *http.Request, action string) error {
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to %s file: %v", action, err)
+	}
+	defer resp.Body.Close()
+
+	// S3 answers deletes of missing objects with 204 as well
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s failed with status %d: %s", action, resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to the request
+func (s *S3Storage) sign(req *http.Request, payloadHash string, now time.Time) {
+	signAWSRequest(req, payloadHash, now, s.accessKeyId, s.secretAccessKey, s.region, "s3")
+}
+
+// s3EscapePath percent-encodes each segment of an object key the way SigV4 expects
+func s3EscapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		var escaped strings.Builder
+		for _, b := range []byte(segment) {
+			if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') ||
+				b == '-' || b == '_' || b == '.' || b == '~' {
+				escaped.WriteByte(b)
+			} else {
+				fmt.Fprintf(&escaped, "%%%02X", b)
+			}
+		}
+		segments[i] = escaped.String()
+	}
+	return strings.Join(segments, "/")
+}
@@ -1,172 +1,412 @@
 package main
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"sync"
 	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+// ScheduleConfig holds the cron expressions (minute hour day month weekday,
+// evaluated in APP_TIMEZONE) for the daemon's trend fetches. Each scheduled
+// run starts after a random delay of up to its jitter, so deployments sharing
+// a schedule don't all hit Google Trends at the same moment.
+type ScheduleConfig struct {
+    DailyCron    string
+    RecentCron   string
+    DailyJitter  time.Duration
+    RecentJitter time.Duration
+}
+
+var defaultScheduleConfig = ScheduleConfig{
+    DailyCron:    "0 8 * * *",   // 8 AM every day
+    RecentCron:   "0 */2 * * *", // Every 2 hours
+    RecentJitter: 15 * time.Minute,
+}
+
+// loadScheduleConfig reads DAILY_CRON and RECENT_CRON, e.g. "0 8 * * *", and
+// DAILY_JITTER and RECENT_JITTER, e.g. "15m"
+func loadScheduleConfig() (ScheduleConfig, error) {
+    config := defaultScheduleConfig
+    if value := os.Getenv("DAILY_CRON"); value != "" {
+        config.DailyCron = value
+    }
+    if value := os.Getenv("RECENT_CRON"); value != "" {
+        config.RecentCron = value
+    }
+    var err error
+    if config.DailyJitter, err = getEnvDuration("DAILY_JITTER", config.DailyJitter); err != nil {
+        return config, err
+    }
+    if config.RecentJitter, err = getEnvDuration("RECENT_JITTER", config.RecentJitter); err != nil {
+        return config, err
+    }
+    if config.DailyJitter < 0 || config.RecentJitter < 0 {
+        return config, fmt.Errorf("DAILY_JITTER and RECENT_JITTER must not be negative")
+    }
+
+    if _, err := cron.ParseStandard(config.DailyCron); err != nil {
+        return config, fmt.Errorf("invalid DAILY_CRON %q: %v", config.DailyCron, err)
+    }
+    if _, err := cron.ParseStandard(config.RecentCron); err != nil {
+        return config, fmt.Errorf("invalid RECENT_CRON %q: %v", config.RecentCron, err)
+    }
+    return config, nil
+}
+
+// retryCheckCron is how often the daemon looks for failed jobs due a retry
+// between scheduled runs
+const retryCheckCron = "*/5 * * * *"
+
+// What started a run
+const (
+    runTriggerSchedule = "schedule"
+    runTriggerRetry    = "retry"
+    runTriggerAdmin    = "admin"
 )
 
+// maxRunHistory is how many finished runs the scheduler remembers for the admin API
+const maxRunHistory = 20
+
+// SchedulerRun is one run of the pipeline started by the daemon
+type SchedulerRun struct {
+    ID         string     `json:"id"` // Tags the run's log lines as "run"
+    Mode       string     `json:"mode"`
+    Trigger    string     `json:"trigger"` // "schedule", "retry" or "admin"
+    StartedAt  time.Time  `json:"startedAt"`
+    FinishedAt *time.Time `json:"finishedAt,omitempty"` // Unset while the run is in progress
+    Articles   int        `json:"articles"`             // Articles saved
+    SpendUSD   float64    `json:"spendUsd"`             // Estimated, as counted against RUN_BUDGET
+    Error      string     `json:"error,omitempty"`
+}
+
 type TrendScheduler struct {
-    stopChan chan struct{}
+    cron  *cron.Cron
+    ctx   context.Context // Cancelled at shutdown to stop runs starting new topics
+    runMu sync.Mutex      // Keeps the daily and recent runs from overlapping
+
+    statusMu sync.Mutex      // Guards runs
+    runs     []*SchedulerRun // Oldest first
 }
 
-func NewTrendScheduler() *TrendScheduler {
-    return &TrendScheduler{
-        stopChan: make(chan struct{}),
+func NewTrendScheduler(ctx context.Context, config ScheduleConfig) (*TrendScheduler, error) {
+    s := &TrendScheduler{
+        cron: cron.New(cron.WithLocation(appLocation)),
+        ctx:  ctx,
+    }
+    if _, err := s.cron.AddFunc(config.DailyCron, s.scheduledRun("daily", config.DailyJitter)); err != nil {
+        return nil, fmt.Errorf("invalid daily schedule: %v", err)
+    }
+    if _, err := s.cron.AddFunc(config.RecentCron, s.scheduledRun("recent", config.RecentJitter)); err != nil {
+        return nil, fmt.Errorf("invalid recent schedule: %v", err)
     }
+    if _, err := s.cron.AddFunc(retryCheckCron, s.runRetries); err != nil {
+        return nil, fmt.Errorf("invalid retry schedule: %v", err)
+    }
+    return s, nil
 }
 
 func (s *TrendScheduler) Start() {
-    // Start daily trends (runs at 8 AM local time)
-    go s.scheduleDailyTrends()
-    
-    // Start recent trends (runs every 2 hours)
-    go s.scheduleRecentTrends()
+    s.cron.Start()
 }
 
-func (s *TrendScheduler) Stop() {
-    close(s.stopChan)
+// Stop stops scheduling new runs. The returned context is done once a run in
+// progress has finished.
+func (s *TrendScheduler) Stop() context.Context {
+    return s.cron.Stop()
 }
 
-func (s *TrendScheduler) scheduleDailyTrends() {
-    for {
-        now := time.Now()
-        next := time.Date(now.Year(), now.Month(), now.Day(), 8, 0, 0, 0, now.Location())
-        if now.After(next) {
-            next = next.Add(24 * time.Hour)
-        }
-        
-        select {
-        case <-time.After(time.Until(next)):
-            log.Printf("Running daily trends fetch at %v", time.Now())
-            topics, err := GetTrendingKeywordsWithMode("daily")
-            if err != nil {
-                log.Printf("Error fetching daily trends: %v", err)
-                continue
-            }
-            // Process the topics
-            processTopics(topics, "daily")
-            
-        case <-s.stopChan:
-            return
+// ScheduleSummaryEmail sends the summary email on spec, with the runs the
+// scheduler remembers
+func (s *TrendScheduler) ScheduleSummaryEmail(spec string) error {
+    _, err := s.cron.AddFunc(spec, func() {
+        if err := SendRunSummary(s.Runs()); err != nil {
+            slog.Error("Error sending summary email", "error", err)
+            reportFailure(s.ctx, reportLevelError, "Summary email failed", err, nil)
         }
+    })
+    if err != nil {
+        return fmt.Errorf("invalid summary email schedule: %v", err)
     }
+    return nil
 }
 
-func (s *TrendScheduler) scheduleRecentTrends() {
-    ticker := time.NewTicker(2 * time.Hour)
-    defer ticker.Stop()
-    
-    for {
-        select {
-        case <-ticker.C:
-            log.Printf("Running recent trends fetch at %v", time.Now())
-            topics, err := GetTrendingKeywordsWithMode("recent")
-            if err != nil {
-                log.Printf("Error fetching recent trends: %v", err)
-                continue
+// scheduledRun returns the cron job for mode, which waits a random delay of
+// up to jitter before running. Shutting down cuts the wait short.
+func (s *TrendScheduler) scheduledRun(mode string, jitter time.Duration) func() {
+    return func() {
+        if jitter > 0 {
+            delay := rand.N(jitter)
+            slog.Debug("Delaying scheduled run", "mode", mode, "delay", delay.Round(time.Second))
+            select {
+            case <-s.ctx.Done():
+                return
+            case <-time.After(delay):
             }
-            // Process the topics
-            processTopics(topics, "recent")
-            
-        case <-s.stopChan:
-            return
         }
+        s.runTrends(mode, runTriggerSchedule)
     }
 }
 
-func processTopics(topics []TrendingTopic, mode string) {
-    log.Printf("Processing %s trends with %d topics", mode, len(topics))
-
-    // Create a slice to store successfully saved articles
-    var savedArticles []*NewsArticle
-
-    // Get search results
-    searchResults, err := GetSearchResults(topics)
+// nextRun is when mode's schedule next fires, before jitter
+func (config ScheduleConfig) nextRun(mode string) time.Time {
+    spec := config.RecentCron
+    if mode == "daily" {
+        spec = config.DailyCron
+    }
+    schedule, err := cron.ParseStandard(spec)
     if err != nil {
-        log.Printf("Error getting search results for %s trends: %v", mode, err)
-        return
+        return time.Time{}
     }
+    return schedule.Next(appNow())
+}
 
-    // Create a map to store article data by keyword
-    articleDataMap := make(map[string]ArticleData)
-
-    // Scrape articles from search results
-    articles, err := ScrapeArticles(searchResults)
-    if err != nil {
-        log.Printf("Error scraping articles for %s trends: %v", mode, err)
+// runTrends fetches and processes one mode's trends, waiting for any run
+// already in progress so two runs never publish at once. Runs are skipped
+// while the pipeline is paused, including one that was waiting when it was.
+func (s *TrendScheduler) runTrends(mode string, trigger string) {
+    s.runMu.Lock()
+    defer s.runMu.Unlock()
+    if s.ctx.Err() != nil {
         return
     }
-
-    // Organize articles by keyword
-    for _, result := range searchResults {
-        articleDataMap[result.Keyword] = ArticleData{
-            Keyword:   result.Keyword,
-            Articles:  filterArticlesByURLs(articles, result.URLs),
-            Summaries: make(map[string]string),
-        }
+    if paused, reason := s.Paused(); paused {
+        slog.Info("Pipeline paused, skipping trends fetch", "mode", mode, "trigger", trigger, "reason", reason)
+        return
     }
 
-    // Process each keyword's articles
-    for keyword, data := range articleDataMap {
-        // Summarize the articles
-        summaries, err := SummarizeArticles(data.Articles)
-        if err != nil {
-            log.Printf("[%s trends] Error summarizing articles for %s: %v", mode, keyword, err)
-            continue
-        }
-        data.Summaries = summaries
-
-        // Generate comprehensive article
-        article, err := GenerateArticleFromSummaries(
-            keyword,
-            data.Summaries,
-            searchResults[0].URLs,
-        )
+    s.execute(mode, trigger, func(ctx context.Context) (int, error) {
+        logger := loggerFrom(ctx)
+        logger.Info("Running trends fetch", "trigger", trigger)
+        topics, err := GetTrendingKeywordsWithMode(ctx, mode)
         if err != nil {
-            log.Printf("[%s trends] Error generating article for %s: %v", mode, keyword, err)
-            continue
+            logger.Error("Error fetching trends", "error", err)
+            reportFailure(ctx, reportLevelError, "Trends fetch failed", err, nil)
+            return 0, err
         }
+        // Process the topics
+        return processTopics(ctx, topics, mode), nil
+    })
+}
 
-        // Generate media assets
-        mediaAssets, imageSuccess, err := GenerateMediaAssets(*article)
+// runRetries works through each mode's queue when it has retries due, so a
+// failed topic doesn't wait for the mode's next scheduled run
+func (s *TrendScheduler) runRetries() {
+    if paused, _ := s.Paused(); paused {
+        return
+    }
+    for _, mode := range []string{"daily", "recent"} {
+        due, err := hasDueRetries(mode)
         if err != nil {
-            log.Printf("[%s trends] Error generating media assets for %s: %v", mode, keyword, err)
+            slog.Error("Error checking job retries", "mode", mode, "error", err)
             continue
         }
-
-        // Upload media assets
-        uploadedAssets, err := UploadMediaAssets(mediaAssets)
-        if err != nil {
-            log.Printf("[%s trends] Error uploading media assets for %s: %v", mode, keyword, err)
+        if !due {
             continue
         }
 
-        // Save to database
-        savedArticle, err := dbClient.SaveArticle(article, uploadedAssets, imageSuccess)
-        if err != nil {
-            log.Printf("[%s trends] Error saving article to database for %s: %v", mode, keyword, err)
-            continue
+        func() {
+            s.runMu.Lock()
+            defer s.runMu.Unlock()
+            if s.ctx.Err() != nil {
+                return
+            }
+            s.execute(mode, runTriggerRetry, func(ctx context.Context) (int, error) {
+                loggerFrom(ctx).Info("Retrying failed jobs")
+                return processTopics(ctx, nil, mode), nil
+            })
+        }()
+    }
+}
+
+// execute records a run of mode while calling run with a context carrying
+// the run's ID. A panic fails the run and is reported instead of taking the
+// daemon down.
+func (s *TrendScheduler) execute(mode string, trigger string, run func(ctx context.Context) (int, error)) {
+    ctx, runID := runLogger(s.ctx, mode)
+    // Everything the run does through a proxy shares one, pinned for the run
+    ctx = withProxySession(ctx, proxyPool.Session(trendsGeo))
+    record := s.startRun(runID, mode, trigger)
+    defer func() {
+        if recovered := recover(); recovered != nil {
+            err := panicError(recovered)
+            loggerFrom(ctx).Error("Run panicked", "error", err, "stack", string(err.stack))
+            reportFailure(ctx, reportLevelFatal, "Run panicked", err, map[string]string{"stack": string(err.stack)})
+            s.finishRun(record, 0, err)
         }
+    }()
+    articles, err := run(ctx)
+    s.finishRun(record, articles, err)
+}
+
+// Trigger starts a run of mode now, after any run in progress
+func (s *TrendScheduler) Trigger(mode string) error {
+    if mode != "daily" && mode != "recent" {
+        return fmt.Errorf("invalid mode %q: use daily or recent", mode)
+    }
+    if s.ctx.Err() != nil {
+        return fmt.Errorf("scheduler is shutting down")
+    }
+    if paused, reason := s.Paused(); paused {
+        return fmt.Errorf("pipeline is paused: %s", reason)
+    }
+    go s.runTrends(mode, runTriggerAdmin)
+    return nil
+}
+
+// Pause turns the pipeline's kill switch on until Resume: no run starts, and
+// a run in progress finishes the topics it has started but takes no more.
+// The switch is kept in the database, so it holds across restarts and for
+// every deployment sharing it.
+func (s *TrendScheduler) Pause(reason string) error {
+    _, err := dbClient.SetPipelineControl(true, reason)
+    return err
+}
+
+func (s *TrendScheduler) Resume() error {
+    _, err := dbClient.SetPipelineControl(false, "")
+    return err
+}
+
+// Paused reports whether the pipeline is paused, and why
+func (s *TrendScheduler) Paused() (bool, string) {
+    return pipelinePaused()
+}
+
+// Runs returns the run in progress, if any, and the recent runs, newest first
+func (s *TrendScheduler) Runs() []SchedulerRun {
+    s.statusMu.Lock()
+    defer s.statusMu.Unlock()
+    runs := make([]SchedulerRun, len(s.runs))
+    for i, run := range s.runs {
+        runs[len(s.runs)-1-i] = *run
+    }
+    return runs
+}
+
+func (s *TrendScheduler) startRun(id string, mode string, trigger string) *SchedulerRun {
+    s.statusMu.Lock()
+    defer s.statusMu.Unlock()
+    run := &SchedulerRun{ID: id, Mode: mode, Trigger: trigger, StartedAt: appNow()}
+    s.runs = append(s.runs, run)
+    if len(s.runs) > maxRunHistory {
+        s.runs = s.runs[len(s.runs)-maxRunHistory:]
+    }
+    return run
+}
+
+func (s *TrendScheduler) finishRun(run *SchedulerRun, articles int, err error) {
+    s.statusMu.Lock()
+    defer s.statusMu.Unlock()
+    finishedAt := appNow()
+    run.FinishedAt = &finishedAt
+    run.Articles = articles
+    run.SpendUSD = runSpend.SpentBy(run.ID)
+    if err != nil {
+        run.Error = err.Error()
+    }
+}
+
+// processTopics turns trending topics into published articles by queueing
+// them as pipeline jobs and working the queue until it drains. Once ctx is
+// cancelled no new job is started, but the articles already finished are
+// still saved and the rest stay queued for the next run. It returns the
+// number of articles saved.
+func processTopics(ctx context.Context, topics []TrendingTopic, mode string) int {
+    logger := loggerFrom(ctx)
+    logger.Info("Processing trends", "topics", len(topics))
+
+    pipelineMetrics.TopicsSelected(mode, len(topics))
+    mediaBefore := mediaMetrics.Snapshot()
+    defer mediaMetrics.LogSince(logger, mediaBefore)
+    runSpend.Start(ctx, runBudgetConfig.Limit)
+    defer runSpend.LogSummary(logger)
+    runTimings.Start(ctx, mode)
+    defer runTimings.Save(ctx)
+
+    // Jobs left running by a crashed run go back on the queue, to resume
+    // from their last checkpoint alongside the new topics
+    if requeued, err := dbClient.RequeueRunningPipelineJobs(mode); err != nil {
+        logger.Error("Error requeueing interrupted jobs", "error", err)
+    } else if requeued > 0 {
+        logger.Info("Requeued interrupted jobs", "jobs", requeued)
+    }
+    if err := enqueueTopics(ctx, topics, mode); err != nil {
+        logger.Error("Error queueing trends", "error", err)
+        reportFailure(ctx, reportLevelError, "Queueing topics failed", err, nil)
+        return 0
+    }
+
+    // Each stage's workers take topics from the queue as the stage before finishes them
+    runPipelineWorkers(ctx, mode)
+    defer logPipelineQueue(ctx, mode)
+
+    // Articles are published together once every topic has been processed,
+    // along with any finished on an earlier run that failed to save
+    bundles, finishedJobs, err := uploadedBundles(ctx, mode)
+    if err != nil {
+        logger.Error("Error collecting finished articles", "error", err)
+        reportFailure(ctx, reportLevelError, "Collecting finished articles failed", err, nil)
+        return 0
+    }
 
-        log.Printf("[%s trends] Successfully processed and saved article: %s (ID: %s)", 
-            mode, savedArticle.Title, savedArticle.ID)
-            
-        // Add to our collection of saved articles
-        savedArticles = append(savedArticles, savedArticle)
+    // Save every article in one transaction so a run never publishes partially
+    saveStart := time.Now()
+    savedArticles, err := dbClient.SaveArticles(bundles)
+    observeStage("", stageSaved, time.Since(saveStart))
+    if err != nil {
+        logger.Error("Error saving articles to database", "articles", len(bundles), "error", err)
+        reportFailure(ctx, reportLevelError, "Saving articles failed", err, nil)
+        return 0
+    }
+    pipelineMetrics.ArticlesPublished(mode, len(savedArticles))
+    for _, savedArticle := range savedArticles {
+        logger.Info("Saved article", "article", savedArticle.ID, "title", savedArticle.Title)
+    }
+    // The articles are live, so the webhooks go out even when shutting down
+    publishWebhooks(context.WithoutCancel(ctx), savedArticles)
+    removeSavedMedia(ctx, finishedJobs)
+    finishedIds := make([]uuid.UUID, len(finishedJobs))
+    for i, job := range finishedJobs {
+        finishedIds[i] = job.ID
+    }
+    if err := dbClient.DeletePipelineJobs(finishedIds); err != nil {
+        logger.Error("Error clearing finished jobs from the queue", "jobs", len(finishedIds), "error", err)
+    }
+
+    // Leave the newsletter and podcast to the next run when shutting down
+    if ctx.Err() != nil {
+        return len(savedArticles)
     }
 
     // After all articles are processed, handle daily newsletter selection if in daily mode
     if mode == "daily" && len(savedArticles) > 0 {
-        articleId, titleText, previewText, err := selectDailyNewsletterArticle(savedArticles)
-        if err != nil {
-            log.Printf("Error selecting daily newsletter article: %v", err)
-            return
+        if err := RunDailyNewsletter(ctx); err != nil {
+            logger.Error("Error running daily newsletter selection", "error", err)
+            reportFailure(ctx, reportLevelError, "Daily newsletter failed", err, nil)
+        }
+    }
+
+    // Fold the new stories into today's podcast episode; backfilled ones aren't today's news
+    if podcastConfig.Enabled && mode != backfillMode && len(savedArticles) > 0 {
+        if err := RunDailyPodcast(podcastConfig); err != nil {
+            logger.Error("Error building podcast episode", "error", err)
+            reportFailure(ctx, reportLevelError, "Podcast episode failed", err, nil)
         }
+    }
 
-        if err := dbClient.SaveDailyNewsletter(articleId, titleText, previewText); err != nil {
-            log.Printf("Error saving daily newsletter: %v", err)
-            return
+    // List the new articles in the sitemap so search engines find them quickly
+    if sitemapConfig.Enabled && len(savedArticles) > 0 {
+        if err := RunSitemap(ctx, sitemapConfig); err != nil {
+            logger.Error("Error updating sitemap", "error", err)
+            reportFailure(ctx, reportLevelWarning, "Sitemap update failed", err, nil)
         }
-        log.Printf("Successfully saved daily newsletter for article ID: %s", articleId)
     }
-} 
\ No newline at end of file
+    return len(savedArticles)
+}
@@ -5,8 +5,11 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	neturl "net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -24,17 +27,14 @@ func (e *ScrapingError) Error() string {
 	return fmt.Sprintf("failed to scrape %d URLs", len(e.FailedURLs))
 }
 
-func ScrapeArticles(searchResults []SearchResult) ([]ArticleContent, error) {
+func ScrapeArticles(runCtx context.Context, logger *slog.Logger, searchResults []SearchResult) ([]ArticleContent, error) {
 	logError := func(url string, err error, context string) {
-		fmt.Printf("[%s] Error scraping %s (%s): %v\n",
-			time.Now().Format("2006/01/02 15:04:05"),
-			url,
-			context,
-			err)
+		logger.Warn("Error scraping", "url", url, "step", context, "error", err)
 	}
 
 	var articles []ArticleContent
 	failedURLs := make(map[string]error)
+	session := proxySessionFrom(runCtx)
 	client := &http.Client{
 		Timeout: 30 * time.Second,
 		Transport: &http.Transport{
@@ -42,6 +42,7 @@ func ScrapeArticles(searchResults []SearchResult) ([]ArticleContent, error) {
 			MaxIdleConnsPerHost: 100,
 			IdleConnTimeout:     90 * time.Second,
 			DisableKeepAlives:   false,
+			Proxy:               requestProxy,
 		},
 	}
 
@@ -64,21 +65,19 @@ func ScrapeArticles(searchResults []SearchResult) ([]ArticleContent, error) {
 	var wg sync.WaitGroup
 
 	for _, result := range searchResults {
-		fmt.Printf("[%s] Processing articles for keyword: %s\n",
-			time.Now().Format("2006/01/02 15:04:05"),
-			result.Keyword)
+		logger.Info("Scraping search results", "urls", len(result.URLs))
 
 		for _, url := range result.URLs {
 			totalURLs++
 			// Skip non-HTML URLs and social media (same as before)
 			if !strings.HasPrefix(url, "http") {
-				fmt.Printf("Skipping non-HTTP URL: %s\n", url)
+				logger.Debug("Skipping non-HTTP URL", "url", url)
 				continue
 			}
 			shouldSkip := false
 			for _, domain := range skipDomains {
 				if strings.Contains(url, domain) {
-					fmt.Printf("Skipping social media URL: %s\n", url)
+					logger.Debug("Skipping social media URL", "url", url)
 					shouldSkip = true
 					break
 				}
@@ -95,14 +94,21 @@ func ScrapeArticles(searchResults []SearchResult) ([]ArticleContent, error) {
 				var lastError error
 				for attempts := 0; attempts < 3; attempts++ {
 					if attempts > 0 {
-						fmt.Printf("[%s] Retry attempt %d for %s\n",
-							time.Now().Format("2006/01/02 15:04:05"),
-							attempts+1,
-							url)
+						logger.Info("Retrying scrape", "url", url, "attempt", attempts+1)
 						time.Sleep(time.Duration(attempts) * time.Second)
 					}
 
 					ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+					// Each attempt goes through the run's pinned proxy when scraping is proxied
+					var proxy string
+					if proxyPoolConfig.Scraper {
+						var err error
+						if proxy, err = session.Proxy(runCtx); err != nil {
+							logError(url, err, "choosing proxy")
+						} else {
+							ctx = withProxy(ctx, proxy)
+						}
+					}
 					req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 					if err != nil {
 						lastError = fmt.Errorf("request creation failed: %v", err)
@@ -116,6 +122,13 @@ func ScrapeArticles(searchResults []SearchResult) ([]ArticleContent, error) {
 					req.Header.Set("Connection", "keep-alive")
 
 					resp, err := client.Do(req)
+					if proxy != "" {
+						if err != nil {
+							session.Report(proxy, err)
+						} else {
+							session.Report(proxy, proxyResponseError(resp.StatusCode, resp.Request.URL.String()))
+						}
+					}
 					if err != nil {
 						lastError = fmt.Errorf("request failed: %v", err)
 						logError(url, err, "making request")
@@ -165,6 +178,8 @@ func ScrapeArticles(searchResults []SearchResult) ([]ArticleContent, error) {
 
 							title := doc.Find("title").Text()
 							title = cleanText(title)
+							publishedAt := extractPublishedAt(doc)
+							imageURL, imageWidth := extractImage(doc, url)
 
 							doc.Find("script").Remove()
 							doc.Find("style").Remove()
@@ -195,9 +210,12 @@ func ScrapeArticles(searchResults []SearchResult) ([]ArticleContent, error) {
 							}
 
 							articleChan <- ArticleContent{ // Send article to channel
-								URL:     url,
-								Title:   title,
-								Content: content,
+								URL:         url,
+								Title:       title,
+								Content:     content,
+								PublishedAt: publishedAt,
+								ImageURL:    imageURL,
+								ImageWidth:  imageWidth,
 							}
 							return true
 						}
@@ -211,8 +229,6 @@ func ScrapeArticles(searchResults []SearchResult) ([]ArticleContent, error) {
 					failedURLs[url] = lastError
 					errorChan <- fmt.Errorf("scraping failed for %s after multiple retries: %v", url, lastError) // Send error to channel
 					logError(url, lastError, "final failure after all attempts")
-					fmt.Printf("[%s] Continuing to next URL despite failure\n",
-						time.Now().Format("2006/01/02 15:04:05"))
 				}
 			}(url)
 		}
@@ -223,10 +239,7 @@ func ScrapeArticles(searchResults []SearchResult) ([]ArticleContent, error) {
 		for article := range articleChan {
 			articles = append(articles, article)
 			successCount++
-			fmt.Printf("[%s] Progress: %d/%d URLs successfully scraped\n",
-				time.Now().Format("2006/01/02 15:04:05"),
-				successCount,
-				totalURLs)
+			logger.Debug("Scrape progress", "url", article.URL, "scraped", successCount, "urls", totalURLs)
 		}
 	}()
 
@@ -246,15 +259,9 @@ func ScrapeArticles(searchResults []SearchResult) ([]ArticleContent, error) {
 	}
 
 	// Enhanced summary at the end (same as before)
-	fmt.Printf("\n[%s] Final Scraping Summary:\n", time.Now().Format("2006/01/02 15:04:05"))
-	fmt.Printf("- Total URLs processed: %d\n", totalURLs)
-	fmt.Printf("- Successfully scraped: %d articles\n", successCount)
-	fmt.Printf("- Failed URLs: %d\n", len(failedURLs))
-	if len(failedURLs) > 0 {
-		fmt.Println("Failed URLs and reasons:")
-		for url, err := range failedURLs {
-			fmt.Printf("  - %s: %v\n", url, err)
-		}
+	logger.Info("Finished scraping", "urls", totalURLs, "scraped", successCount, "failed", len(failedURLs))
+	for url, err := range failedURLs {
+		logger.Info("Failed to scrape URL", "url", url, "error", err)
 	}
 
 	// Error handling logic (similar to before, but consider consolidatedError)
@@ -329,4 +336,71 @@ func cleanText(text string) string {
 	text = regexp.MustCompile(`https?://\S+`).ReplaceAllString(text, "")
 	
 	return strings.TrimSpace(text)
-}
\ No newline at end of file
+}
+
+// extractPublishedAt looks for the article's publish date in common meta tags
+// and <time> elements, returning nil if none can be parsed
+func extractPublishedAt(doc *goquery.Document) *time.Time {
+	selectors := []struct {
+		selector string
+		attr     string
+	}{
+		{"meta[property='article:published_time']", "content"},
+		{"meta[name='article:published_time']", "content"},
+		{"meta[itemprop='datePublished']", "content"},
+		{"meta[name='pubdate']", "content"},
+		{"meta[name='date']", "content"},
+		{"time[datetime]", "datetime"},
+	}
+	layouts := []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05Z0700",
+		"2006-01-02T15:04:05",
+		"2006-01-02",
+	}
+
+	for _, candidate := range selectors {
+		value, exists := doc.Find(candidate.selector).First().Attr(candidate.attr)
+		if !exists {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		for _, layout := range layouts {
+			if parsed, err := time.Parse(layout, value); err == nil {
+				return &parsed
+			}
+		}
+	}
+	return nil
+}
+
+// extractImage returns the page's og:image (or twitter:image) resolved against
+// pageURL, and its declared width, 0 when the page doesn't declare one
+func extractImage(doc *goquery.Document, pageURL string) (string, int) {
+	for _, selector := range []string{
+		"meta[property='og:image:secure_url']",
+		"meta[property='og:image']",
+		"meta[name='og:image']",
+		"meta[name='twitter:image']",
+	} {
+		value, exists := doc.Find(selector).First().Attr("content")
+		if !exists || strings.TrimSpace(value) == "" {
+			continue
+		}
+		base, err := neturl.Parse(pageURL)
+		if err != nil {
+			return "", 0
+		}
+		resolved, err := base.Parse(strings.TrimSpace(value))
+		if err != nil || (resolved.Scheme != "http" && resolved.Scheme != "https") {
+			continue
+		}
+
+		width := 0
+		if value, exists := doc.Find("meta[property='og:image:width']").First().Attr("content"); exists {
+			width, _ = strconv.Atoi(strings.TrimSpace(value))
+		}
+		return resolved.String(), width
+	}
+	return "", 0
+}
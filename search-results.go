@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 )
 
 type SearchResult struct {
@@ -14,6 +17,17 @@ type SearchResult struct {
 	URLs    []string `json:"urls"`
 }
 
+// searchResultFor picks keyword's result out of results, which leave out
+// keywords nothing was found for and so can't be matched up by position
+func searchResultFor(results []SearchResult, keyword string) (SearchResult, bool) {
+	for _, result := range results {
+		if result.Keyword == keyword {
+			return result, true
+		}
+	}
+	return SearchResult{}, false
+}
+
 type GoogleSearchResponse struct {
 	Items []struct {
 		Link string `json:"link"`
@@ -21,8 +35,7 @@ type GoogleSearchResponse struct {
 }
 
 // GetSearchResults takes trending topics and returns search results for each keyword
-func GetSearchResults(topics []TrendingTopic) ([]SearchResult, error) {
-	fmt.Printf("Processing %d topics\n", len(topics))
+func GetSearchResults(ctx context.Context, logger *slog.Logger, topics []TrendingTopic) ([]SearchResult, error) {
 
 	apiKey := os.Getenv("GOOGLE_API_KEY")
 	searchEngineID := os.Getenv("GOOGLE_SEARCH_ENGINE_ID")
@@ -34,7 +47,7 @@ func GetSearchResults(topics []TrendingTopic) ([]SearchResult, error) {
 	var results []SearchResult
 
 	for _, topic := range topics {
-		fmt.Printf("Searching for keyword: %s\n", topic.Keyword)
+		logger.Info("Searching for coverage", "query", topic.Keyword+" news")
 
 		// Build the Google Custom Search API URL
 		baseURL := "https://www.googleapis.com/customsearch/v1"
@@ -43,13 +56,31 @@ func GetSearchResults(topics []TrendingTopic) ([]SearchResult, error) {
 		params.Add("cx", searchEngineID)
 		params.Add("q", topic.Keyword + " news")
 		params.Add("num", "10")
-		params.Add("dateRestrict", "d1") 
+		if topic.SearchWindow != nil {
+			// Both ends of a date range are inclusive
+			params.Add("sort", fmt.Sprintf("date:r:%s:%s", topic.SearchWindow.From.Format("20060102"), topic.SearchWindow.To.AddDate(0, 0, -1).Format("20060102")))
+		} else {
+			params.Add("dateRestrict", "d1")
+		}
 		params.Add("orderBy", "relevance")
+		if topic.Geo != "" {
+			params.Add("gl", strings.ToLower(topic.Geo))
+		}
 
 		// Make the request
-		resp, err := http.Get(baseURL + "?" + params.Encode())
+		release, err := waitForAPI(ctx, apiSearch)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"?"+params.Encode(), nil)
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("error creating search request: %v", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		release()
 		if err != nil {
-			fmt.Printf("Error searching for %s: %v\n", topic.Keyword, err)
+			logger.Error("Error searching", "error", err)
 			continue
 		}
 		defer resp.Body.Close()
@@ -57,19 +88,18 @@ func GetSearchResults(topics []TrendingTopic) ([]SearchResult, error) {
 		// Check response status code
 		if resp.StatusCode != http.StatusOK {
 			body, _ := io.ReadAll(resp.Body)
-			fmt.Printf("API error for %s: Status %d, Body: %s\n", topic.Keyword, resp.StatusCode, string(body))
+			logger.Error("Search API error", "status", resp.StatusCode, "body", string(body))
 			continue
 		}
 
 		// Parse the response
 		var searchResp GoogleSearchResponse
 		if err := json.NewDecoder(resp.Body).Decode(&searchResp); err != nil {
-			fmt.Printf("Error parsing response for %s: %v\n", topic.Keyword, err)
+			logger.Error("Error parsing search response", "error", err)
 			continue
 		}
 
-		// Add debug logging for response
-		fmt.Printf("Raw response for %s: %+v\n", topic.Keyword, searchResp)
+		logger.Debug("Search response", "response", fmt.Sprintf("%+v", searchResp))
 
 		// Extract URLs
 		var urls []string
@@ -77,8 +107,7 @@ func GetSearchResults(topics []TrendingTopic) ([]SearchResult, error) {
 			urls = append(urls, item.Link)
 		}
 
-		// Add debug logging
-		fmt.Printf("Found %d URLs for %s\n", len(urls), topic.Keyword)
+		logger.Info("Found search results", "urls", len(urls))
 
 		// Add results if we found any URLs
 		if len(urls) > 0 {
@@ -86,7 +115,6 @@ func GetSearchResults(topics []TrendingTopic) ([]SearchResult, error) {
 				Keyword: topic.Keyword,
 				URLs:    urls,
 			})
-			fmt.Printf("Added results for %s\n", topic.Keyword)
 		}
 	}
 
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"os"
+	"time"
+)
+
+const sendGridMailURL = "https://api.sendgrid.com/v3/mail/send"
+
+// SendGridEmail sends email through SendGrid's v3 Mail Send API
+type SendGridEmail struct {
+	apiKey     string
+	from       *mail.Address
+	replyTo    *mail.Address
+	httpClient *http.Client
+}
+
+// sendGridAddress is an address in a SendGrid request
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+// NewSendGridEmail reads SENDGRID_API_KEY
+func NewSendGridEmail(config EmailConfig) (*SendGridEmail, error) {
+	s := &SendGridEmail{
+		apiKey:     os.Getenv("SENDGRID_API_KEY"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+	if s.apiKey == "" {
+		return nil, fmt.Errorf("SENDGRID_API_KEY environment variable is not set")
+	}
+	from, err := mail.ParseAddress(config.fromAddress())
+	if err != nil {
+		return nil, fmt.Errorf("invalid EMAIL_FROM: %v", err)
+	}
+	s.from = from
+	if config.ReplyTo != "" {
+		if s.replyTo, err = mail.ParseAddress(config.ReplyTo); err != nil {
+			return nil, fmt.Errorf("invalid EMAIL_REPLY_TO: %v", err)
+		}
+	}
+	return s, nil
+}
+
+func (s *SendGridEmail) Send(ctx context.Context, email Email) error {
+	body := map[string]interface{}{
+		"personalizations": []map[string]interface{}{
+			{"to": []sendGridAddress{{Email: email.To}}},
+		},
+		"from":    sendGridAddress{Email: s.from.Address, Name: s.from.Name},
+		"subject": email.Subject,
+		"content": []map[string]string{
+			{"type": "text/plain", "value": email.Text},
+			{"type": "text/html", "value": email.HTML},
+		},
+	}
+	if s.replyTo != nil {
+		body["reply_to"] = sendGridAddress{Email: s.replyTo.Address, Name: s.replyTo.Name}
+	}
+	if len(email.Headers) > 0 {
+		body["headers"] = email.Headers
+	}
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body to JSON: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", sendGridMailURL, bytes.NewReader(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request to SendGrid: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// SendGrid accepts mail for delivery with 202
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("SendGrid request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
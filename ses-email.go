@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// SESEmail sends email through Amazon SES's v2 REST API
+type SESEmail struct {
+	region          string
+	accessKeyId     string
+	secretAccessKey string
+	from            string
+	replyTo         string
+	httpClient      *http.Client
+}
+
+// NewSESEmail reads SES_REGION, SES_ACCESS_KEY_ID and SES_SECRET_ACCESS_KEY
+func NewSESEmail(config EmailConfig) (*SESEmail, error) {
+	s := &SESEmail{
+		region:          os.Getenv("SES_REGION"),
+		accessKeyId:     os.Getenv("SES_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("SES_SECRET_ACCESS_KEY"),
+		from:            config.fromAddress(),
+		replyTo:         config.ReplyTo,
+		httpClient:      &http.Client{Timeout: 30 * time.Second},
+	}
+	for key, value := range map[string]string{
+		"SES_REGION":            s.region,
+		"SES_ACCESS_KEY_ID":     s.accessKeyId,
+		"SES_SECRET_ACCESS_KEY": s.secretAccessKey,
+	} {
+		if value == "" {
+			return nil, fmt.Errorf("%s environment variable is not set", key)
+		}
+	}
+	return s, nil
+}
+
+func (s *SESEmail) Send(ctx context.Context, email Email) error {
+	content := func(data string) map[string]string {
+		return map[string]string{"Data": data, "Charset": "UTF-8"}
+	}
+	simple := map[string]interface{}{
+		"Subject": content(email.Subject),
+		"Body": map[string]interface{}{
+			"Html": content(email.HTML),
+			"Text": content(email.Text),
+		},
+	}
+	var headers []map[string]string
+	for name, value := range email.Headers {
+		headers = append(headers, map[string]string{"Name": name, "Value": value})
+	}
+	if len(headers) > 0 {
+		simple["Headers"] = headers
+	}
+	body := map[string]interface{}{
+		"FromEmailAddress": s.from,
+		"Destination":      map[string][]string{"ToAddresses": {email.To}},
+		"Content":          map[string]interface{}{"Simple": simple},
+	}
+	if s.replyTo != "" {
+		body["ReplyToAddresses"] = []string{s.replyTo}
+	}
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body to JSON: %v", err)
+	}
+
+	endpoint := fmt.Sprintf("https://email.%s.amazonaws.com/v2/email/outbound-emails", s.region)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signAWSRequest(req, sha256Hex(jsonBody), time.Now(), s.accessKeyId, s.secretAccessKey, s.region, "ses")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request to SES: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("SES request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// defaultShutdownGracePeriod leaves time for an article in progress to finish
+// its media, upload and save
+const defaultShutdownGracePeriod = 10 * time.Minute
+
+// loadShutdownGracePeriod reads SHUTDOWN_GRACE_PERIOD, e.g. "5m"
+func loadShutdownGracePeriod() (time.Duration, error) {
+	return getEnvDuration("SHUTDOWN_GRACE_PERIOD", defaultShutdownGracePeriod)
+}
+
+// notifyShutdown returns a context cancelled on SIGINT or SIGTERM, which stops
+// new topics from starting while the article in progress finishes and the
+// finished ones are saved. The process exits anyway once the grace period
+// runs out, or on a second signal.
+func notifyShutdown(grace time.Duration) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		received := <-signals
+		slog.Info("Shutting down, finishing in-flight work", "signal", received, "grace", grace)
+		cancel()
+
+		select {
+		case received = <-signals:
+			fatal("Exiting without waiting for in-flight work", "signal", received)
+		case <-time.After(grace):
+			fatal("Shutdown grace period elapsed, exiting with work in flight", "grace", grace)
+		}
+	}()
+	return ctx
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// sitemapName is the fixed storage name of the sitemap, so its URL can be
+	// listed in the site's robots.txt
+	sitemapName = "sitemap.xml"
+
+	// sitemapNewsWindow is how old an article can be and still carry news
+	// tags; Google News ignores older ones
+	sitemapNewsWindow = 48 * time.Hour
+)
+
+// SitemapConfig describes the sitemap rewritten after each run
+type SitemapConfig struct {
+	Enabled         bool
+	ArticleURL      string // Link to an article, with {urlTitle} replaced
+	PublicationName string // news:name, which must match the name in Google News
+	Language        string // news:language, an ISO 639 code
+	MaxURLs         int    // Most recent articles listed; sitemaps allow 50,000
+	Bucket          string // Public storage bucket the sitemap is uploaded to
+	SitemapURL      string // URL search engines know the sitemap by, if not its storage URL
+	PingURLs        []string
+}
+
+var defaultSitemapConfig = SitemapConfig{
+	PublicationName: "Daily Scoop AI",
+	Language:        "en",
+	MaxURLs:         1000,
+	Bucket:          "site",
+}
+
+var sitemapConfig = defaultSitemapConfig
+
+// loadSitemapConfig reads SITEMAP_ENABLED ("true" to enable), SITEMAP_ARTICLE_URL
+// (defaulting to NEWSLETTER_ARTICLE_URL), SITEMAP_PUBLICATION_NAME,
+// SITEMAP_LANGUAGE, SITEMAP_MAX_URLS, SITEMAP_BUCKET, SITEMAP_URL and SITEMAP_PING_URLS, a
+// comma-separated list of ping endpoints with {sitemap} replaced by the
+// sitemap's escaped URL, e.g. "https://www.bing.com/ping?sitemap={sitemap}"
+func loadSitemapConfig() (SitemapConfig, error) {
+	config := defaultSitemapConfig
+	config.Enabled = os.Getenv("SITEMAP_ENABLED") == "true"
+	config.ArticleURL = os.Getenv("SITEMAP_ARTICLE_URL")
+	if config.ArticleURL == "" {
+		config.ArticleURL = os.Getenv("NEWSLETTER_ARTICLE_URL")
+	}
+	config.SitemapURL = os.Getenv("SITEMAP_URL")
+	if value := os.Getenv("SITEMAP_PUBLICATION_NAME"); value != "" {
+		config.PublicationName = value
+	}
+	if value := os.Getenv("SITEMAP_LANGUAGE"); value != "" {
+		config.Language = value
+	}
+	if value := os.Getenv("SITEMAP_BUCKET"); value != "" {
+		config.Bucket = value
+	}
+	for _, value := range strings.Split(os.Getenv("SITEMAP_PING_URLS"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		if !strings.Contains(value, "{sitemap}") {
+			return config, fmt.Errorf("SITEMAP_PING_URLS entries must contain {sitemap}, got %q", value)
+		}
+		config.PingURLs = append(config.PingURLs, value)
+	}
+
+	maxURLs, err := getEnvInt("SITEMAP_MAX_URLS", config.MaxURLs)
+	if err != nil {
+		return config, err
+	}
+	if maxURLs < 1 || maxURLs > 50000 {
+		return config, fmt.Errorf("SITEMAP_MAX_URLS must be between 1 and 50000, got %d", maxURLs)
+	}
+	config.MaxURLs = maxURLs
+
+	if config.Enabled && !strings.Contains(config.ArticleURL, "{urlTitle}") {
+		return config, fmt.Errorf("SITEMAP_ARTICLE_URL must contain {urlTitle} when SITEMAP_ENABLED is set, got %q", config.ArticleURL)
+	}
+	return config, nil
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	News    string       `xml:"xmlns:news,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string       `xml:"loc"`
+	LastMod string       `xml:"lastmod"`
+	News    *sitemapNews `xml:"news:news,omitempty"`
+}
+
+type sitemapNews struct {
+	Publication     sitemapPublication `xml:"news:publication"`
+	PublicationDate string             `xml:"news:publication_date"`
+	Title           string             `xml:"news:title"`
+}
+
+type sitemapPublication struct {
+	Name     string `xml:"news:name"`
+	Language string `xml:"news:language"`
+}
+
+// RunSitemap rewrites the sitemap from the most recent published articles,
+// uploads it under sitemapName and pings SITEMAP_PING_URLS, with SITEMAP_URL
+// when it is set. A SITEMAP_URL still serving an older sitemap, e.g. from a
+// cache, is only logged, as is a failed ping, since the engines read the
+// sitemap again on their own schedule.
+func RunSitemap(ctx context.Context, config SitemapConfig) error {
+	logger := loggerFrom(ctx)
+
+	articles, err := dbClient.GetArticlesSince(time.Time{}, ArticleFilters{PublishedOnly: true, Limit: config.MaxURLs})
+	if err != nil {
+		return fmt.Errorf("error loading articles for the sitemap: %v", err)
+	}
+	data, err := renderSitemap(config, articles, appNow())
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp("", "sitemap-*.xml")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write sitemap: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write sitemap: %v", err)
+	}
+
+	// Like the podcast feed, the sitemap keeps a fixed name rather than being content-addressed
+	sitemapURL, err := storageClient.Upload(ctx, file.Name(), config.Bucket, sitemapName)
+	if err != nil {
+		return fmt.Errorf("error uploading sitemap: %v", err)
+	}
+	logger.Info("Uploaded sitemap", "url", sitemapURL, "articles", len(articles))
+
+	if config.SitemapURL != "" && config.SitemapURL != sitemapURL {
+		if err := checkSitemapServed(ctx, config.SitemapURL, data); err != nil {
+			logger.Warn("SITEMAP_URL does not serve the uploaded sitemap yet, pinging anyway", "uploaded", sitemapURL, "error", err)
+		}
+		sitemapURL = config.SitemapURL
+	}
+	for _, pingURL := range config.PingURLs {
+		if err := pingSitemap(ctx, strings.ReplaceAll(pingURL, "{sitemap}", url.QueryEscape(sitemapURL))); err != nil {
+			logger.Warn("Sitemap ping failed", "error", err)
+		}
+	}
+	return nil
+}
+
+// renderSitemap lists articles, newest first, adding news tags to those
+// published within sitemapNewsWindow of now
+func renderSitemap(config SitemapConfig, articles []*NewsArticle, now time.Time) ([]byte, error) {
+	urlSet := sitemapURLSet{
+		XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9",
+		News:  "http://www.google.com/schemas/sitemap-news/0.9",
+	}
+	for _, article := range articles {
+		if article.URLTitle == "" {
+			continue
+		}
+		lastMod := article.UpdatedAt
+		if lastMod.IsZero() {
+			lastMod = article.CreatedAt
+		}
+		entry := sitemapURL{
+			Loc:     strings.ReplaceAll(config.ArticleURL, "{urlTitle}", url.PathEscape(article.URLTitle)),
+			LastMod: lastMod.In(appLocation).Format(time.RFC3339),
+		}
+		if now.Sub(article.CreatedAt) <= sitemapNewsWindow {
+			entry.News = &sitemapNews{
+				Publication:     sitemapPublication{Name: config.PublicationName, Language: config.Language},
+				PublicationDate: article.CreatedAt.In(appLocation).Format(time.RFC3339),
+				Title:           article.Title,
+			}
+		}
+		urlSet.URLs = append(urlSet.URLs, entry)
+	}
+
+	data, err := xml.MarshalIndent(urlSet, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to render sitemap: %v", err)
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// checkSitemapServed fetches sitemapURL and checks it is the sitemap just
+// uploaded, so the engines aren't pointed at a stale or missing file
+func checkSitemapServed(ctx context.Context, sitemapURL string, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", sitemapURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %v", sitemapURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s failed with status %d", sitemapURL, resp.StatusCode)
+	}
+	served, err := io.ReadAll(io.LimitReader(resp.Body, int64(len(data))+1))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", sitemapURL, err)
+	}
+	if !bytes.Equal(served, data) {
+		return fmt.Errorf("%s serves a different file", sitemapURL)
+	}
+	return nil
+}
+
+// pingSitemap tells a search engine the sitemap changed
+func pingSitemap(ctx context.Context, pingURL string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", pingURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to ping %s: %v", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("ping to %s failed with status %d", req.URL.Host, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg" // Decoders for reading the width of source photos
+	_ "image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Image strategies
+const (
+	imageStrategyGenerate    = "generate"     // Always generate an image with the image provider
+	imageStrategySourceFirst = "source-first" // Reuse a source's og:image when its domain permits it
+)
+
+// sourceImageMaxBytes limits how much of a source photo is downloaded
+const sourceImageMaxBytes = 20 * 1024 * 1024
+
+// SourceImageConfig controls reusing photos from the scraped source articles
+type SourceImageConfig struct {
+	Strategy string
+	// Domains whose photos we're licensed to reuse, subdomains included
+	PermittedDomains []string
+	MinWidth         int // Narrowest photo accepted, so banners aren't upscaled much
+}
+
+var defaultSourceImageConfig = SourceImageConfig{Strategy: imageStrategyGenerate, MinWidth: 1200}
+
+var sourceImageConfig = defaultSourceImageConfig
+
+// loadSourceImageConfig reads IMAGE_STRATEGY ("generate" or "source-first"),
+// SOURCE_IMAGE_DOMAINS ("apnews.com,reuters.com") and SOURCE_IMAGE_MIN_WIDTH
+func loadSourceImageConfig() (SourceImageConfig, error) {
+	config := defaultSourceImageConfig
+	if value := os.Getenv("IMAGE_STRATEGY"); value != "" {
+		config.Strategy = value
+	}
+	for _, domain := range strings.Split(os.Getenv("SOURCE_IMAGE_DOMAINS"), ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			config.PermittedDomains = append(config.PermittedDomains, strings.TrimPrefix(domain, "www."))
+		}
+	}
+
+	var err error
+	if config.MinWidth, err = getEnvInt("SOURCE_IMAGE_MIN_WIDTH", config.MinWidth); err != nil {
+		return config, err
+	}
+
+	switch config.Strategy {
+	case imageStrategyGenerate:
+	case imageStrategySourceFirst:
+		if len(config.PermittedDomains) == 0 {
+			return config, fmt.Errorf("IMAGE_STRATEGY=source-first needs SOURCE_IMAGE_DOMAINS")
+		}
+	default:
+		return config, fmt.Errorf("unknown image strategy %q, expected generate or source-first", config.Strategy)
+	}
+	return config, nil
+}
+
+// permitted reports whether photos from the domain may be reused
+func (c SourceImageConfig) permitted(domain string) bool {
+	domain = strings.TrimPrefix(strings.ToLower(domain), "www.")
+	for _, allowed := range c.PermittedDomains {
+		if domain == allowed || strings.HasSuffix(domain, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSourceImage downloads the og:image of the first source from a permitted
+// domain that's wide enough for a banner. The photo is credited to the source
+// and links back to its article.
+func (c SourceImageConfig) GetSourceImage(article GeneratedArticle) (*StockPhoto, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	for _, source := range article.Sources {
+		if source.ImageURL == "" || !c.permitted(source.Domain) {
+			continue
+		}
+		if source.ImageWidth > 0 && source.ImageWidth < c.MinWidth {
+			continue
+		}
+
+		imagePath, err := c.downloadSourceImage(client, source.ImageURL)
+		if err != nil {
+			slog.Warn("Failed to reuse source image", "domain", source.Domain, "error", err)
+			continue
+		}
+		return &StockPhoto{
+			Path:      imagePath,
+			Credit:    "Photo: " + source.Domain,
+			CreditURL: source.URL,
+		}, nil
+	}
+	return nil, fmt.Errorf("no source image from a permitted domain")
+}
+
+// downloadSourceImage saves the image under media/images, rejecting anything
+// that isn't a JPEG or PNG at least MinWidth wide
+func (c SourceImageConfig) downloadSourceImage(client *http.Client, imageURL string) (string, error) {
+	resp, err := client.Get(imageURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download source image: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download source image: status %d", resp.StatusCode)
+	}
+
+	outputDir := "media/images"
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+	outputPath := filepath.Join(outputDir, fmt.Sprintf("source_%s", uuid.New().String()))
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create source image file: %w", err)
+	}
+	_, err = io.Copy(file, io.LimitReader(resp.Body, sourceImageMaxBytes))
+	file.Close()
+	if err != nil {
+		os.Remove(outputPath)
+		return "", fmt.Errorf("failed to download source image: %w", err)
+	}
+
+	// The declared og:image:width can't be trusted, so check the image itself
+	file, err = os.Open(outputPath)
+	if err != nil {
+		os.Remove(outputPath)
+		return "", err
+	}
+	config, format, err := image.DecodeConfig(file)
+	file.Close()
+	if err != nil {
+		os.Remove(outputPath)
+		return "", fmt.Errorf("unsupported source image: %w", err)
+	}
+	if config.Width < c.MinWidth {
+		os.Remove(outputPath)
+		return "", fmt.Errorf("source image is %dpx wide, below %dpx", config.Width, c.MinWidth)
+	}
+
+	finalPath := outputPath + "." + strings.Replace(format, "jpeg", "jpg", 1)
+	if err := os.Rename(outputPath, finalPath); err != nil {
+		os.Remove(outputPath)
+		return "", err
+	}
+	return finalPath, nil
+}
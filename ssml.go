@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"html"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ssmlParagraphBreak is the pause inserted between paragraphs
+const ssmlParagraphBreak = `<break time="750ms"/>`
+
+// SSMLSynthesizer is implemented by TTS providers that accept SSML markup.
+// Providers wrap the script's chunks in their own <speak> element.
+type SSMLSynthesizer interface {
+	SynthesizeSSML(ctx context.Context, script ssmlScript, voice string) (io.ReadCloser, error)
+}
+
+// SSMLConfig controls SSML generation for providers that support it
+type SSMLConfig struct {
+	Enabled        bool              // TTS_SSML=false sends plain text to every provider
+	Pronunciations map[string]string // Word -> spoken alias, e.g. "Nguyen" -> "win"
+}
+
+var defaultSSMLConfig = SSMLConfig{
+	Enabled:        true,
+	Pronunciations: map[string]string{},
+}
+
+var ssmlConfig SSMLConfig
+var ssmlConfigOnce sync.Once
+
+// loadSSMLConfig reads TTS_SSML and TTS_PRONUNCIATIONS ("Nguyen=win,Xi=shee")
+func loadSSMLConfig() SSMLConfig {
+	config := defaultSSMLConfig
+
+	if os.Getenv("TTS_SSML") == "false" {
+		config.Enabled = false
+	}
+	config.Pronunciations = getEnvMap("TTS_PRONUNCIATIONS")
+	return config
+}
+
+func currentSSMLConfig() SSMLConfig {
+	ssmlConfigOnce.Do(func() {
+		ssmlConfig = loadSSMLConfig()
+	})
+	return ssmlConfig
+}
+
+// spokenAcronyms are read as words rather than spelled out letter by letter
+var spokenAcronyms = map[string]bool{
+	"NASA": true, "NATO": true, "OPEC": true, "COVID": true, "UNICEF": true,
+	"FIFA": true, "NASDAQ": true, "AIDS": true, "SWAT": true, "UNESCO": true,
+	"FEMA": true, "ASEAN": true, "LIDAR": true, "RADAR": true, "LASER": true,
+}
+
+// acronymPattern matches runs of capital letters such as "FBI" or "GDP"
+const acronymPattern = `[A-Z]{2,6}`
+
+// ssmlScript is narration as SSML fragments, one per sentence, grouped by
+// paragraph so providers can chunk requests without splitting markup
+type ssmlScript [][]string
+
+// buildSSMLScript converts article content with [p] paragraph tags into SSML,
+// spelling out acronyms and substituting configured pronunciations
+func buildSSMLScript(content string, pronunciations map[string]string) ssmlScript {
+	words := make([]string, 0, len(pronunciations))
+	for word := range pronunciations {
+		words = append(words, regexp.QuoteMeta(word))
+	}
+	// Longest first so "New York Times" wins over "New York"
+	sort.Slice(words, func(i, j int) bool { return len(words[i]) > len(words[j]) })
+	pattern := regexp.MustCompile(`\b(?:` + strings.Join(append(words, acronymPattern), "|") + `)\b`)
+
+	var script ssmlScript
+	for _, paragraph := range renderPlainText(content) {
+		var sentences []string
+		for _, sentence := range splitSentences(paragraph) {
+			if sentence = strings.TrimSpace(sentence); sentence != "" {
+				sentences = append(sentences, sentenceToSSML(sentence, pattern, pronunciations))
+			}
+		}
+		if len(sentences) > 0 {
+			script = append(script, sentences)
+		}
+	}
+	return script
+}
+
+func sentenceToSSML(sentence string, pattern *regexp.Regexp, pronunciations map[string]string) string {
+	var out strings.Builder
+	last := 0
+	for _, match := range pattern.FindAllStringIndex(sentence, -1) {
+		out.WriteString(escapeXML(sentence[last:match[0]]))
+		word := sentence[match[0]:match[1]]
+		switch alias, ok := pronunciations[word]; {
+		case ok:
+			out.WriteString(`<sub alias="` + escapeXML(alias) + `">` + escapeXML(word) + `</sub>`)
+		case spokenAcronyms[word]:
+			out.WriteString(word)
+		default:
+			out.WriteString(`<say-as interpret-as="characters">` + word + `</say-as>`)
+		}
+		last = match[1]
+	}
+	out.WriteString(escapeXML(sentence[last:]))
+	return out.String()
+}
+
+// withBookends wraps the script in plain-text intro and outro paragraphs;
+// either may be empty
+func (s ssmlScript) withBookends(intro, outro string) ssmlScript {
+	var script ssmlScript
+	for _, part := range []ssmlScript{plainTextScript(intro), s, plainTextScript(outro)} {
+		script = append(script, part...)
+	}
+	return script
+}
+
+// plainTextScript escapes text as a single paragraph
+func plainTextScript(text string) ssmlScript {
+	var sentences []string
+	for _, sentence := range splitSentences(text) {
+		if sentence = strings.TrimSpace(sentence); sentence != "" {
+			sentences = append(sentences, escapeXML(sentence))
+		}
+	}
+	if len(sentences) == 0 {
+		return nil
+	}
+	return ssmlScript{sentences}
+}
+
+// chunks packs the script into SSML bodies of at most maxBytes, splitting only
+// between sentences and pausing between paragraphs. maxBytes <= 0 returns a
+// single chunk.
+func (s ssmlScript) chunks(maxBytes int) []string {
+	var chunks []string
+	var current strings.Builder
+	for i, paragraph := range s {
+		for j, sentence := range paragraph {
+			piece := sentence + " "
+			if i > 0 && j == 0 {
+				piece = ssmlParagraphBreak + piece
+			}
+			if maxBytes > 0 && current.Len() > 0 && current.Len()+len(piece) > maxBytes {
+				chunks = append(chunks, strings.TrimSpace(current.String()))
+				current.Reset()
+			}
+			current.WriteString(piece)
+		}
+	}
+	if current.Len() > 0 {
+		chunks = append(chunks, strings.TrimSpace(current.String()))
+	}
+	return chunks
+}
+
+// ssmlTagPattern matches the markup added by sentenceToSSML
+var ssmlTagPattern = regexp.MustCompile(`<[^>]+>`)
+
+// plainText strips the markup from the script for providers without SSML,
+// separating paragraphs with blank lines
+func (s ssmlScript) plainText() string {
+	paragraphs := make([]string, len(s))
+	for i, paragraph := range s {
+		text := ssmlTagPattern.ReplaceAllString(strings.Join(paragraph, " "), "")
+		paragraphs[i] = html.UnescapeString(text)
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+func escapeXML(text string) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(text))
+	return escaped.String()
+}
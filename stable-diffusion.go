@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sdPromptPlaceholder marks where the prompt goes in a ComfyUI workflow
+const sdPromptPlaceholder = "%prompt%"
+
+// sdSeedPlaceholder optionally marks where a ComfyUI workflow takes its seed,
+// as a bare number: "seed": %seed%
+const sdSeedPlaceholder = "%seed%"
+
+// sdDefaultPixels is the image area SDXL models are trained at, about 1024x1024
+const sdDefaultPixels = 1024 * 1024
+
+// sdPollInterval is how often ComfyUI is asked whether a queued prompt is done
+const sdPollInterval = 2 * time.Second
+
+// StableDiffusionProvider generates images with a self-hosted Stable Diffusion
+// server, through either the AUTOMATIC1111 web UI API or ComfyUI
+type StableDiffusionProvider struct {
+	baseURL        string
+	api            string // "a1111" or "comfyui"
+	negativePrompt string
+	width, height  int
+	steps          int
+	workflow       []byte // ComfyUI workflow in API format
+	workflowName   string // Recorded as the model, since the checkpoint is set in the workflow
+	client         *http.Client
+}
+
+// NewStableDiffusionProvider reads SD_URL (e.g. http://localhost:7860), SD_API
+// ("a1111", the default, or "comfyui"), SD_NEGATIVE_PROMPT, SD_WIDTH,
+// SD_HEIGHT, SD_STEPS and SD_TIMEOUT. The default size has the image aspect
+// ratio at SDXL's native resolution. ComfyUI also needs SD_COMFYUI_WORKFLOW:
+// a workflow exported in API format with %prompt% in its positive prompt, and
+// optionally %seed% as its sampler's seed so the seed can be recorded.
+func NewStableDiffusionProvider() (*StableDiffusionProvider, error) {
+	baseURL := strings.TrimSuffix(os.Getenv("SD_URL"), "/")
+	if baseURL == "" {
+		return nil, fmt.Errorf("SD_URL environment variable not set")
+	}
+
+	provider := &StableDiffusionProvider{
+		baseURL:        baseURL,
+		api:            "a1111",
+		negativePrompt: "text, watermark, logo, caption, blurry, deformed, low quality",
+	}
+	if api := os.Getenv("SD_API"); api != "" {
+		provider.api = api
+	}
+	if value := os.Getenv("SD_NEGATIVE_PROMPT"); value != "" {
+		provider.negativePrompt = value
+	}
+
+	defaultWidth, defaultHeight := sdImageSize(imageProviderConfig.aspectRatio())
+	var err error
+	if provider.width, err = getEnvInt("SD_WIDTH", defaultWidth); err != nil {
+		return nil, err
+	}
+	if provider.height, err = getEnvInt("SD_HEIGHT", defaultHeight); err != nil {
+		return nil, err
+	}
+	if provider.steps, err = getEnvInt("SD_STEPS", 30); err != nil {
+		return nil, err
+	}
+	timeout, err := getEnvDuration("SD_TIMEOUT", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	provider.client = &http.Client{Timeout: timeout}
+
+	switch provider.api {
+	case "a1111":
+	case "comfyui":
+		path := os.Getenv("SD_COMFYUI_WORKFLOW")
+		if path == "" {
+			return nil, fmt.Errorf("SD_COMFYUI_WORKFLOW must be set for SD_API=comfyui")
+		}
+		workflow, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ComfyUI workflow: %w", err)
+		}
+		if !bytes.Contains(workflow, []byte(sdPromptPlaceholder)) {
+			return nil, fmt.Errorf("ComfyUI workflow %s has no %s placeholder", path, sdPromptPlaceholder)
+		}
+		provider.workflow = workflow
+		provider.workflowName = filepath.Base(path)
+	default:
+		return nil, fmt.Errorf("unknown SD_API: %s", provider.api)
+	}
+	return provider, nil
+}
+
+func (p *StableDiffusionProvider) Generate(ctx context.Context, prompt string, basePath string, seed *int64) (*GeneratedImage, error) {
+	// Choosing the seed here rather than letting the server pick lets the image be reproduced
+	if seed == nil {
+		random := rand.Int63n(imageMaxSeed)
+		seed = &random
+	}
+	image := &GeneratedImage{ImageGenerationInfo: ImageGenerationInfo{Seed: seed}}
+
+	var data []byte
+	var err error
+	if p.api == "comfyui" {
+		data, err = p.generateComfyUI(ctx, prompt, *seed)
+		image.Model = p.workflowName
+		if !bytes.Contains(p.workflow, []byte(sdSeedPlaceholder)) {
+			image.Seed = nil
+		}
+	} else {
+		data, image.Model, err = p.generateA1111(ctx, prompt, *seed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Both APIs return PNG by default
+	image.Path = basePath + ".png"
+	if err := os.WriteFile(image.Path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write image: %w", err)
+	}
+	return image, nil
+}
+
+// generateA1111 calls the AUTOMATIC1111 txt2img endpoint, which returns the
+// image inline as base64, and returns it with the checkpoint's name
+func (p *StableDiffusionProvider) generateA1111(ctx context.Context, prompt string, seed int64) ([]byte, string, error) {
+	var result struct {
+		Images []string `json:"images"`
+		Info   string   `json:"info"` // JSON-encoded generation parameters
+	}
+	err := p.postJSON(ctx, "/sdapi/v1/txt2img", map[string]interface{}{
+		"prompt":          prompt,
+		"negative_prompt": p.negativePrompt,
+		"width":           p.width,
+		"height":          p.height,
+		"steps":           p.steps,
+		"seed":            seed,
+		"batch_size":      1,
+	}, &result)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(result.Images) == 0 {
+		return nil, "", fmt.Errorf("no image in Stable Diffusion response")
+	}
+	data, err := base64.StdEncoding.DecodeString(result.Images[0])
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode Stable Diffusion image: %w", err)
+	}
+
+	// The model name is only for the record, so a missing one isn't an error
+	var info struct {
+		Model string `json:"sd_model_name"`
+	}
+	json.Unmarshal([]byte(result.Info), &info)
+	return data, info.Model, nil
+}
+
+// comfyUIImage identifies an output image for ComfyUI's /view endpoint
+type comfyUIImage struct {
+	Filename  string `json:"filename"`
+	Subfolder string `json:"subfolder"`
+	Type      string `json:"type"`
+}
+
+// generateComfyUI queues the workflow with the prompt and seed filled in, waits
+// for it to finish and downloads the first output image
+func (p *StableDiffusionProvider) generateComfyUI(ctx context.Context, prompt string, seed int64) ([]byte, error) {
+	// The prompt is substituted as a JSON string so quotes in it can't break the workflow
+	encodedPrompt, err := json.Marshal(prompt)
+	if err != nil {
+		return nil, err
+	}
+	filled := bytes.ReplaceAll(p.workflow, []byte(sdPromptPlaceholder), encodedPrompt[1:len(encodedPrompt)-1])
+	filled = bytes.ReplaceAll(filled, []byte(sdSeedPlaceholder), []byte(strconv.FormatInt(seed, 10)))
+	var workflow map[string]interface{}
+	if err := json.Unmarshal(filled, &workflow); err != nil {
+		return nil, fmt.Errorf("invalid ComfyUI workflow: %w", err)
+	}
+
+	var queued struct {
+		PromptID string `json:"prompt_id"`
+	}
+	err = p.postJSON(ctx, "/prompt", map[string]interface{}{
+		"prompt":    workflow,
+		"client_id": uuid.New().String(),
+	}, &queued)
+	if err != nil {
+		return nil, err
+	}
+	if queued.PromptID == "" {
+		return nil, fmt.Errorf("ComfyUI did not return a prompt ID")
+	}
+
+	deadline := time.Now().Add(p.client.Timeout)
+	for time.Now().Before(deadline) {
+		var history map[string]struct {
+			Outputs map[string]struct {
+				Images []comfyUIImage `json:"images"`
+			} `json:"outputs"`
+		}
+		if err := p.getJSON(ctx, "/history/"+queued.PromptID, &history); err != nil {
+			return nil, err
+		}
+		if entry, ok := history[queued.PromptID]; ok {
+			for _, output := range entry.Outputs {
+				if len(output.Images) > 0 {
+					return p.downloadComfyUIImage(ctx, output.Images[0])
+				}
+			}
+			return nil, fmt.Errorf("ComfyUI workflow finished without an image")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(sdPollInterval):
+		}
+	}
+	return nil, fmt.Errorf("timed out waiting for ComfyUI prompt %s", queued.PromptID)
+}
+
+func (p *StableDiffusionProvider) downloadComfyUIImage(ctx context.Context, image comfyUIImage) ([]byte, error) {
+	query := url.Values{"filename": {image.Filename}, "subfolder": {image.Subfolder}, "type": {image.Type}}
+	resp, err := p.do(ctx, http.MethodGet, "/view?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func (p *StableDiffusionProvider) postJSON(ctx context.Context, path string, body interface{}, result interface{}) error {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body to JSON: %w", err)
+	}
+	resp, err := p.do(ctx, http.MethodPost, path, bytes.NewReader(jsonBody))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode Stable Diffusion response: %w", err)
+	}
+	return nil
+}
+
+func (p *StableDiffusionProvider) getJSON(ctx context.Context, path string, result interface{}) error {
+	resp, err := p.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode Stable Diffusion response: %w", err)
+	}
+	return nil
+}
+
+// do sends a request to the server, returning an error for non-200 responses
+func (p *StableDiffusionProvider) do(ctx context.Context, method string, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Stable Diffusion at %s: %w", p.baseURL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("Stable Diffusion request to %s failed with status %d: %s", path, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// sdImageSize returns the width and height with the given ratio and about
+// sdDefaultPixels in area, in multiples of 64 as Stable Diffusion expects
+func sdImageSize(ratio float64) (int, int) {
+	height := math.Sqrt(sdDefaultPixels / ratio)
+	roundTo64 := func(value float64) int {
+		return max(64, int(math.Round(value/64))*64)
+	}
+	return roundTo64(height * ratio), roundTo64(height)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stages that are timed without being checkpointed: audio and image are the
+// two halves of stageMedia, and saving is done once for the whole run
+const (
+	stageAudio = "audio"
+	stageImage = "image"
+	stageSaved = "saved"
+)
+
+// timingStages orders the stages in timing summaries
+var timingStages = []string{stageSearched, stageScraped, stageSummarized, stageGenerated, stageMedia, stageAudio, stageImage, stageUploaded, stageSaved}
+
+// RunTimings collects how long each stage takes on each topic of the run in
+// progress. Runs never overlap, so processTopics resets the one collector at
+// the start of each and saves what it collected at the end.
+type RunTimings struct {
+	mu      sync.Mutex
+	runID   string
+	mode    string
+	timings []*StageTiming
+}
+
+var runTimings = &RunTimings{}
+
+// Start begins collecting the timings of the run ctx belongs to
+func (t *RunTimings) Start(ctx context.Context, mode string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.runID = reportTagsFrom(ctx)["run"]
+	t.mode = mode
+	t.timings = nil
+}
+
+// Observe records how long stage took on keyword, or on the whole run when
+// keyword is empty
+func (t *RunTimings) Observe(keyword string, stage string, duration time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timings = append(t.timings, &StageTiming{
+		RunID:      t.runID,
+		Mode:       t.mode,
+		Keyword:    keyword,
+		Stage:      stage,
+		DurationMs: duration.Milliseconds(),
+		CreatedAt:  appNow(),
+	})
+}
+
+// Save stores the run's timings. Losing them only leaves a gap in the
+// history, so a failure is logged rather than failing the run.
+func (t *RunTimings) Save(ctx context.Context) {
+	t.mu.Lock()
+	timings := t.timings
+	t.timings = nil
+	t.mu.Unlock()
+
+	if err := dbClient.RecordStageTimings(timings); err != nil {
+		loggerFrom(ctx).Warn("Could not save stage timings", "timings", len(timings), "error", err)
+	}
+}
+
+// observeStage records how long a stage took on one topic, for /metrics and
+// the run's timings
+func observeStage(keyword string, stage string, duration time.Duration) {
+	pipelineMetrics.ObserveStage(stage, duration)
+	runTimings.Observe(keyword, stage, duration)
+}
+
+// StageSummary sums up one stage's timings in a run
+type StageSummary struct {
+	Stage   string `json:"stage"`
+	Count   int    `json:"count"` // Topics timed, or 1 for stages of the whole run
+	AvgMs   int64  `json:"avgMs"`
+	MaxMs   int64  `json:"maxMs"`
+	TotalMs int64  `json:"totalMs"`
+}
+
+// RunTimingSummary is a run's stage timings, as listed by GET /timings
+type RunTimingSummary struct {
+	RunID     string         `json:"runId"`
+	Mode      string         `json:"mode"`
+	StartedAt time.Time      `json:"startedAt"` // When its first timing was recorded
+	Stages    []StageSummary `json:"stages"`
+}
+
+// summarizeStageTimings groups timings by run, newest run first, so a stage
+// slowing down shows up as its average climbing from run to run
+func summarizeStageTimings(timings []*StageTiming) []RunTimingSummary {
+	var runs []*RunTimingSummary
+	byRun := make(map[string]*RunTimingSummary)
+	stages := make(map[string]map[string]*StageSummary)
+	for _, timing := range timings {
+		run, ok := byRun[timing.RunID]
+		if !ok {
+			run = &RunTimingSummary{RunID: timing.RunID, Mode: timing.Mode, StartedAt: timing.CreatedAt}
+			byRun[timing.RunID] = run
+			stages[timing.RunID] = make(map[string]*StageSummary)
+			runs = append(runs, run)
+		}
+		if timing.CreatedAt.Before(run.StartedAt) {
+			run.StartedAt = timing.CreatedAt
+		}
+		summary, ok := stages[timing.RunID][timing.Stage]
+		if !ok {
+			summary = &StageSummary{Stage: timing.Stage}
+			stages[timing.RunID][timing.Stage] = summary
+		}
+		summary.Count++
+		summary.TotalMs += timing.DurationMs
+		if timing.DurationMs > summary.MaxMs {
+			summary.MaxMs = timing.DurationMs
+		}
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	summaries := make([]RunTimingSummary, 0, len(runs))
+	for _, run := range runs {
+		for _, stage := range timingStages {
+			if summary, ok := stages[run.RunID][stage]; ok {
+				summary.AvgMs = summary.TotalMs / int64(summary.Count)
+				run.Stages = append(run.Stages, *summary)
+			}
+		}
+		summaries = append(summaries, *run)
+	}
+	return summaries
+}
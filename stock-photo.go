@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// stockPhotoMinWidth is the narrowest photo accepted, so banners aren't upscaled much
+const stockPhotoMinWidth = 1200
+
+// stockPhotoMaxQueries limits how many keywords are searched for one article
+const stockPhotoMaxQueries = 3
+
+// StockPhoto is a licensed photo downloaded in place of a generated image
+type StockPhoto struct {
+	Path      string
+	AltText   string
+	Credit    string // e.g. "Photo by Jane Doe on Unsplash"
+	CreditURL string // Photographer's profile, which both services require linking
+}
+
+// stockPhotoSource searches one stock photo service
+type stockPhotoSource struct {
+	name   string
+	search func(client *http.Client, query string) (*StockPhoto, string, error) // Photo and its download URL
+}
+
+// stockPhotoSources returns the services with API keys configured, Unsplash
+// first: UNSPLASH_ACCESS_KEY and PEXELS_API_KEY
+func stockPhotoSources() []stockPhotoSource {
+	var sources []stockPhotoSource
+	if key := os.Getenv("UNSPLASH_ACCESS_KEY"); key != "" {
+		sources = append(sources, stockPhotoSource{"Unsplash", func(client *http.Client, query string) (*StockPhoto, string, error) {
+			return searchUnsplash(client, key, query)
+		}})
+	}
+	if key := os.Getenv("PEXELS_API_KEY"); key != "" {
+		sources = append(sources, stockPhotoSource{"Pexels", func(client *http.Client, query string) (*StockPhoto, string, error) {
+			return searchPexels(client, key, query)
+		}})
+	}
+	return sources
+}
+
+// GetStockPhoto finds a landscape stock photo for the article's keywords and
+// downloads it under media/images. It fails when no service is configured or
+// nothing suitable turns up.
+func GetStockPhoto(article GeneratedArticle) (*StockPhoto, error) {
+	sources := stockPhotoSources()
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no stock photo service configured")
+	}
+
+	var queries []string
+	seen := make(map[string]bool)
+	for _, keyword := range append([]string{article.Keyword}, article.Keywords...) {
+		if keyword != "" && !seen[NormalizeKeyword(keyword)] && len(queries) < stockPhotoMaxQueries {
+			seen[NormalizeKeyword(keyword)] = true
+			queries = append(queries, keyword)
+		}
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	for _, query := range queries {
+		for _, source := range sources {
+			photo, downloadURL, err := source.search(client, query)
+			if err != nil {
+				slog.Warn("Stock photo search failed", "source", source.name, "query", query, "error", err)
+				continue
+			}
+			if photo == nil {
+				continue
+			}
+			if photo.Path, err = downloadStockPhoto(client, downloadURL); err != nil {
+				slog.Warn("Failed to download stock photo", "source", source.name, "error", err)
+				continue
+			}
+			return photo, nil
+		}
+	}
+	return nil, fmt.Errorf("no suitable stock photo found for %v", queries)
+}
+
+func downloadStockPhoto(client *http.Client, photoURL string) (string, error) {
+	resp, err := client.Get(photoURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download stock photo: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download stock photo: status %d", resp.StatusCode)
+	}
+
+	outputDir := "media/images"
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+	outputPath := filepath.Join(outputDir, fmt.Sprintf("stock_%s.jpg", uuid.New().String()))
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create stock photo file: %w", err)
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		os.Remove(outputPath)
+		return "", fmt.Errorf("failed to download stock photo: %w", err)
+	}
+	return outputPath, nil
+}
+
+// getStockJSON sends an authorized search request and decodes the response
+func getStockJSON(client *http.Client, searchURL string, authorization string, result interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, searchURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Authorization", authorization)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("search failed with status code: %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// unsplashReferral is appended to Unsplash links, as its API guidelines require
+const unsplashReferral = "?utm_source=daily_scoop_ai&utm_medium=referral"
+
+func searchUnsplash(client *http.Client, accessKey string, query string) (*StockPhoto, string, error) {
+	searchURL := "https://api.unsplash.com/search/photos?" + url.Values{
+		"query":          {query},
+		"orientation":    {"landscape"},
+		"content_filter": {"high"},
+		"per_page":       {"10"},
+	}.Encode()
+
+	var result struct {
+		Results []struct {
+			Width          int    `json:"width"`
+			AltDescription string `json:"alt_description"`
+			URLs           struct {
+				Raw string `json:"raw"`
+			} `json:"urls"`
+			Links struct {
+				DownloadLocation string `json:"download_location"`
+			} `json:"links"`
+			User struct {
+				Name  string `json:"name"`
+				Links struct {
+					HTML string `json:"html"`
+				} `json:"links"`
+			} `json:"user"`
+		} `json:"results"`
+	}
+	if err := getStockJSON(client, searchURL, "Client-ID "+accessKey, &result); err != nil {
+		return nil, "", err
+	}
+
+	for _, photo := range result.Results {
+		if photo.Width < stockPhotoMinWidth || photo.URLs.Raw == "" {
+			continue
+		}
+		// Unsplash counts downloads through this endpoint; a failure doesn't stop us using the photo
+		if photo.Links.DownloadLocation != "" {
+			var tracked struct{}
+			if err := getStockJSON(client, photo.Links.DownloadLocation, "Client-ID "+accessKey, &tracked); err != nil {
+				slog.Warn("Failed to register Unsplash download", "error", err)
+			}
+		}
+		return &StockPhoto{
+			AltText:   photo.AltDescription,
+			Credit:    fmt.Sprintf("Photo by %s on Unsplash", photo.User.Name),
+			CreditURL: photo.User.Links.HTML + unsplashReferral,
+		}, photo.URLs.Raw + "&w=1920&fm=jpg&q=85", nil
+	}
+	return nil, "", nil
+}
+
+func searchPexels(client *http.Client, apiKey string, query string) (*StockPhoto, string, error) {
+	searchURL := "https://api.pexels.com/v1/search?" + url.Values{
+		"query":       {query},
+		"orientation": {"landscape"},
+		"per_page":    {"10"},
+	}.Encode()
+
+	var result struct {
+		Photos []struct {
+			Width           int    `json:"width"`
+			Alt             string `json:"alt"`
+			Photographer    string `json:"photographer"`
+			PhotographerURL string `json:"photographer_url"`
+			Src             struct {
+				Large2x string `json:"large2x"`
+			} `json:"src"`
+		} `json:"photos"`
+	}
+	if err := getStockJSON(client, searchURL, apiKey, &result); err != nil {
+		return nil, "", err
+	}
+
+	for _, photo := range result.Photos {
+		if photo.Width < stockPhotoMinWidth || photo.Src.Large2x == "" {
+			continue
+		}
+		return &StockPhoto{
+			AltText:   photo.Alt,
+			Credit:    fmt.Sprintf("Photo by %s on Pexels", photo.Photographer),
+			CreditURL: photo.PhotographerURL,
+		}, photo.Src.Large2x, nil
+	}
+	return nil, "", nil
+}
@@ -1,39 +1,108 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"image"
 	"io"
+	"log/slog"
 	"math"
-	"mime"
-	"net/http"
-	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+)
+
+const (
+	// Storage buckets media is uploaded to
+	imagesBucket = "images"
+	audioBucket  = "audio"
 
-	"github.com/h2non/bimg"
+	contentHashChars = 16 // Hex characters of sha256 kept in stored file names
+
+	defaultMaxUploadBytes = 50 << 20 // 50 MB, well above a banner or a few minutes of 128k audio
 )
 
+// responsiveBannerWidths are the extra banner sizes offered to smaller screens.
+// Widths at or above the configured banner width are skipped; the full-size
+// banner is always the largest entry of the srcset.
+var responsiveBannerWidths = []int{640, 1280}
+
+// ImageConfig controls the size and encoding quality of optimized images
+type ImageConfig struct {
+	BannerWidth  int // Full-size banner width in pixels
+	BannerHeight int // Full-size banner height; smaller banners keep the same aspect ratio
+	ThumbSize    int // Thumbnail size (both width and height)
+	Quality      int // Encoder quality from 1 to 100
+}
+
+var defaultImageConfig = ImageConfig{
+	BannerWidth:  1920, // Standard HD width
+	BannerHeight: 1080, // Standard HD height (16:9 ratio)
+	ThumbSize:    500,
+	Quality:      75, // bimg's default, which images were encoded with before this was configurable
+}
+
+// Minimums keep a misconfigured deployment from publishing unusable images
 const (
-	supabaseProjectURL = "https://dymrplcuovidgyepquba.supabase.co"
-	
-	// Image dimensions
-	bannerWidth  = 1920  // Standard HD width
-	bannerHeight = 1080  // Standard HD height (16:9 ratio)
-	thumbSize    = 500   // Thumbnail size (both width and height)
+	minBannerWidth  = 320
+	minBannerHeight = 180
+	minThumbSize    = 64
 )
 
+// imageConfig is used by every MediaOptimizer, loaded at startup by loadImageConfig
+var imageConfig = defaultImageConfig
+
+// loadImageConfig reads IMAGE_BANNER_WIDTH, IMAGE_BANNER_HEIGHT, IMAGE_THUMB_SIZE and IMAGE_QUALITY
+func loadImageConfig() (ImageConfig, error) {
+	config := defaultImageConfig
+	var err error
+
+	if config.BannerWidth, err = getEnvInt("IMAGE_BANNER_WIDTH", config.BannerWidth); err != nil {
+		return config, err
+	}
+	if config.BannerHeight, err = getEnvInt("IMAGE_BANNER_HEIGHT", config.BannerHeight); err != nil {
+		return config, err
+	}
+	if config.ThumbSize, err = getEnvInt("IMAGE_THUMB_SIZE", config.ThumbSize); err != nil {
+		return config, err
+	}
+	if config.Quality, err = getEnvInt("IMAGE_QUALITY", config.Quality); err != nil {
+		return config, err
+	}
+
+	if config.BannerWidth < minBannerWidth {
+		return config, fmt.Errorf("IMAGE_BANNER_WIDTH must be at least %d, got %d", minBannerWidth, config.BannerWidth)
+	}
+	if config.BannerHeight < minBannerHeight {
+		return config, fmt.Errorf("IMAGE_BANNER_HEIGHT must be at least %d, got %d", minBannerHeight, config.BannerHeight)
+	}
+	if config.ThumbSize < minThumbSize {
+		return config, fmt.Errorf("IMAGE_THUMB_SIZE must be at least %d, got %d", minThumbSize, config.ThumbSize)
+	}
+	if config.Quality < 1 || config.Quality > 100 {
+		return config, fmt.Errorf("IMAGE_QUALITY must be between 1 and 100, got %d", config.Quality)
+	}
+
+	return config, nil
+}
+
 // MediaOptimizer handles compression of media files
 type MediaOptimizer struct {
 	AudioBitrate string // e.g., "128k"
+	Image        ImageConfig
 }
 
 func NewMediaOptimizer() *MediaOptimizer {
 	return &MediaOptimizer{
 		AudioBitrate: "128k", // decent quality for voice
+		Image:        imageConfig,
 	}
 }
 
@@ -42,113 +111,103 @@ type SubImager interface {
 	SubImage(r image.Rectangle) image.Image
 }
 
-func (m *MediaOptimizer) OptimizeImage(inputPath string) (string, error) {
-	// Read and validate input
-	buffer, err := bimg.Read(inputPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to read image: %v", err)
-	}
+// OptimizedImage holds the local paths of the files produced by OptimizeImage.
+// The AVIF paths are empty when the image backend can't encode AVIF.
+type OptimizedImage struct {
+	BannerPath        string
+	ThumbnailPath     string
+	BannerAvifPath    string
+	ThumbnailAvifPath string
+	BannerSizes       map[int]string // Banner paths by width, including the full-size banner
+}
 
-	// Create output paths
-	basePath := strings.TrimSuffix(inputPath, filepath.Ext(inputPath))
-	bannerPath := basePath + "_banner.webp"
-	thumbnailPath := basePath + "_thumb.webp"
+// imageFormat is an output encoding for optimized images
+type imageFormat int
 
-	// Process banner
-	if err := m.createBanner(buffer, bannerPath); err != nil {
-		return "", fmt.Errorf("failed to create banner: %v", err)
-	}
+const (
+	imageFormatWebP imageFormat = iota
+	imageFormatAVIF
+	imageFormatJPEG
+)
 
-	// Process thumbnail
-	if err := m.createThumbnail(buffer, thumbnailPath); err != nil {
-		return "", fmt.Errorf("failed to create thumbnail: %v", err)
+// ext returns the file extension written for the format
+func (f imageFormat) ext() string {
+	switch f {
+	case imageFormatAVIF:
+		return ".avif"
+	case imageFormatJPEG:
+		return ".jpg"
+	default:
+		return ".webp"
 	}
-
-	return bannerPath, nil
 }
 
-func (m *MediaOptimizer) createBanner(buffer []byte, outputPath string) error {
-	size, err := bimg.NewImage(buffer).Size()
-	if err != nil {
-		return fmt.Errorf("failed to get image dimensions: %v", err)
-	}
-
-	// Calculate resize dimensions
-	widthRatio := float64(bannerWidth) / float64(size.Width)
-	heightRatio := float64(bannerHeight) / float64(size.Height)
-	resizeRatio := math.Max(widthRatio, heightRatio)
-	resizedWidth := int(float64(size.Width) * resizeRatio)
-	resizedHeight := int(float64(size.Height) * resizeRatio)
-
-	// Resize image
-	banner, err := bimg.NewImage(buffer).Process(bimg.Options{
-		Width:   resizedWidth,
-		Height:  resizedHeight,
-		Force:   true,
-		Enlarge: true,
-		Type:    bimg.WEBP,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to resize banner: %v", err)
+// primaryImageFormat is WebP, or JPEG when the image backend can't encode WebP
+func primaryImageFormat() imageFormat {
+	if imageFormatSupported(imageFormatWebP) {
+		return imageFormatWebP
 	}
+	return imageFormatJPEG
+}
 
-	// Crop to 16:9
-	resizedSize, err := bimg.NewImage(banner).Size()
+func (m *MediaOptimizer) OptimizeImage(inputPath string) (*OptimizedImage, error) {
+	// Read and validate input
+	buffer, err := readImage(inputPath)
 	if err != nil {
-		return fmt.Errorf("failed to get resized dimensions: %v", err)
+		return nil, fmt.Errorf("failed to read image: %v", err)
 	}
 
-	x := (resizedSize.Width - bannerWidth) / 2
-	y := (resizedSize.Height - bannerHeight) / 2
-	banner, err = bimg.NewImage(banner).Extract(y, x, bannerWidth, bannerHeight)
-	if err != nil {
-		return fmt.Errorf("failed to crop banner: %v", err)
+	// Create output paths
+	format := primaryImageFormat()
+	basePath := strings.TrimSuffix(inputPath, filepath.Ext(inputPath))
+	optimized := &OptimizedImage{
+		BannerPath:    basePath + "_banner" + format.ext(),
+		ThumbnailPath: basePath + "_thumb" + format.ext(),
 	}
 
-	return bimg.Write(outputPath, banner)
-}
-
-func (m *MediaOptimizer) createThumbnail(buffer []byte, outputPath string) error {
-	size, err := bimg.NewImage(buffer).Size()
-	if err != nil {
-		return fmt.Errorf("failed to get image dimensions: %v", err)
-	}
-
-	// Resize maintaining aspect ratio
-	var thumb []byte
-	if size.Height < size.Width {
-		thumb, err = bimg.NewImage(buffer).Process(bimg.Options{
-			Width:   0,
-			Height:  thumbSize,
-			Force:   true,
-			Type:    bimg.WEBP,
-		})
-	} else {
-		thumb, err = bimg.NewImage(buffer).Process(bimg.Options{
-			Width:   thumbSize,
-			Height:  0,
-			Force:   true,
-			Type:    bimg.WEBP,
-		})
+	// Process banner
+	if err := m.createBanner(buffer, optimized.BannerPath, format, m.Image.BannerWidth); err != nil {
+		return nil, fmt.Errorf("failed to create banner: %v", err)
 	}
-	if err != nil {
-		return fmt.Errorf("failed to resize thumbnail: %v", err)
+
+	// Process smaller banners for the srcset
+	optimized.BannerSizes = map[int]string{m.Image.BannerWidth: optimized.BannerPath}
+	for _, width := range responsiveBannerWidths {
+		if width >= m.Image.BannerWidth {
+			continue
+		}
+		sizePath := fmt.Sprintf("%s_banner_%d%s", basePath, width, format.ext())
+		if err := m.createBanner(buffer, sizePath, format, width); err != nil {
+			slog.Warn("Failed to create banner, leaving it out of the srcset", "width", width, "error", err)
+			continue
+		}
+		optimized.BannerSizes[width] = sizePath
 	}
 
-	// Crop to square
-	resizedSize, err := bimg.NewImage(thumb).Size()
-	if err != nil {
-		return fmt.Errorf("failed to get resized dimensions: %v", err)
+	// Process thumbnail
+	if err := m.createThumbnail(buffer, optimized.ThumbnailPath, format); err != nil {
+		return nil, fmt.Errorf("failed to create thumbnail: %v", err)
 	}
 
-	x := (resizedSize.Width - thumbSize) / 2
-	y := (resizedSize.Height - thumbSize) / 2
-	thumb, err = bimg.NewImage(thumb).Extract(y, x, thumbSize, thumbSize)
-	if err != nil {
-		return fmt.Errorf("failed to crop thumbnail: %v", err)
+	// AVIF is smaller but optional: the primary format is always produced as the fallback
+	if !imageFormatSupported(imageFormatAVIF) {
+		return optimized, nil
+	}
+	bannerAvifPath := basePath + "_banner.avif"
+	thumbnailAvifPath := basePath + "_thumb.avif"
+	if err := m.createBanner(buffer, bannerAvifPath, imageFormatAVIF, m.Image.BannerWidth); err != nil {
+		slog.Warn("Failed to create AVIF banner", "fallback", format.ext(), "error", err)
+		return optimized, nil
 	}
+	if err := m.createThumbnail(buffer, thumbnailAvifPath, imageFormatAVIF); err != nil {
+		slog.Warn("Failed to create AVIF thumbnail", "fallback", format.ext(), "error", err)
+		os.Remove(bannerAvifPath)
+		return optimized, nil
+	}
+	optimized.BannerAvifPath = bannerAvifPath
+	optimized.ThumbnailAvifPath = thumbnailAvifPath
 
-	return bimg.Write(outputPath, thumb)
+	return optimized, nil
 }
 
 func (m *MediaOptimizer) OptimizeAudio(inputPath string) (string, error) {
@@ -169,129 +228,356 @@ func (m *MediaOptimizer) OptimizeAudio(inputPath string) (string, error) {
 	return outputPath, nil
 }
 
-// UploadToStorage uploads a file to Supabase storage and returns the public URL
-func uploadToStorage(filePath string, bucket string) (string, error) {
-	// Read the file
-	data, err := os.ReadFile(filePath)
+// probeAudioDuration returns an audio file's playback length in whole seconds, using ffprobe
+func probeAudioDuration(filePath string) (int, error) {
+	length, err := probeAudioLength(filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file: %v", err)
+		return 0, err
 	}
+	return int(math.Round(length.Seconds())), nil
+}
 
-	// Get service role key and clean it
-	serviceKey := os.Getenv("SUPABASE_SERVICE_KEY")
-	if serviceKey == "" {
-		return "", fmt.Errorf("SUPABASE_SERVICE_KEY environment variable not set")
+// probeAudioLength returns an audio file's exact playback length, using ffprobe
+func probeAudioLength(filePath string) (time.Duration, error) {
+	output, err := exec.Command("ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		filePath).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %v", err)
 	}
-	// Remove any quotes from the key
-	serviceKey = strings.Trim(serviceKey, "\"")
 
-	// Clean and encode bucket name
-	bucket = strings.Trim(bucket, "\"")
-	encodedBucket := url.PathEscape(bucket)
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected ffprobe duration %q", strings.TrimSpace(string(output)))
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
 
-	// Prepare the request
-	fileName := filepath.Base(filePath)
-	encodedFileName := url.PathEscape(fileName)
-	url := fmt.Sprintf("%s/storage/v1/object/%s/%s", supabaseProjectURL, encodedBucket, encodedFileName)
-	
-	// Detect content type
-	ext := filepath.Ext(filePath)
-	contentType := mime.TypeByExtension(ext)
-	if contentType == "" {
-		contentType = "application/octet-stream"
+// StorageClient stores media files and serves them from public URLs
+type StorageClient interface {
+	Upload(ctx context.Context, filePath string, bucket string, fileName string) (string, error) // Stores filePath as bucket/fileName and returns its public URL
+	Delete(publicURL string) error                                                               // Removes a file given the URL returned by Upload
+	PublicURL(bucket string, fileName string) string                                             // URL bucket/fileName is served from
+	Exists(ctx context.Context, bucket string, fileName string) (bool, error)                    // Reports whether bucket/fileName is already stored
+}
+
+// StorageClientFactory creates a StorageClient for a STORAGE_BACKEND value
+type StorageClientFactory func() (StorageClient, error)
+
+// storageBackends maps STORAGE_BACKEND values to the factories that create their clients
+var storageBackends = make(map[string]StorageClientFactory)
+
+// RegisterStorageBackend makes a StorageClient implementation selectable through STORAGE_BACKEND
+func RegisterStorageBackend(name string, factory StorageClientFactory) {
+	if _, exists := storageBackends[name]; exists {
+		panic(fmt.Sprintf("storage backend %q registered twice", name))
 	}
+	storageBackends[name] = factory
+}
 
-	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+// Global storage client, selected by initStorage
+var storageClient StorageClient
+
+// maxUploadBytes is the largest file uploadToStorage accepts, from MAX_UPLOAD_BYTES
+var maxUploadBytes int64 = defaultMaxUploadBytes
+
+// initStorage selects the media storage backend from STORAGE_BACKEND
+// ("supabase" by default, "s3" for S3-compatible object storage, or "local"
+// to keep media on disk for offline development)
+func initStorage() error {
+	maxBytes, err := getEnvInt("MAX_UPLOAD_BYTES", defaultMaxUploadBytes)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+		return err
 	}
+	if maxBytes < 1 {
+		return fmt.Errorf("MAX_UPLOAD_BYTES must be positive, got %d", maxBytes)
+	}
+	maxUploadBytes = int64(maxBytes)
 
-	// Set headers
-	req.Header.Set("Content-Type", contentType)
-	req.Header.Set("Authorization", "Bearer "+serviceKey)
-	req.Header.Set("apikey", serviceKey)
-	
-	// Set cache control for media files
-	if bucket == "images" || bucket == "audio" {
-		req.Header.Set("Cache-Control", "public, max-age=31536000") // 1 year
+	backend := os.Getenv("STORAGE_BACKEND")
+	if backend == "" {
+		backend = "supabase"
 	}
 
-	// Print request details for debugging
-	fmt.Printf("Making request to: %s\n", url)
-	fmt.Printf("Authorization: Bearer %s\n", serviceKey[:10]+"...")
+	factory, ok := storageBackends[backend]
+	if !ok {
+		return fmt.Errorf("unknown storage backend: %s", backend)
+	}
+	client, err := factory()
+	if err != nil {
+		return err
+	}
+	storageClient = client
+
+	return nil
+}
+
+// checkStorageBuckets writes and deletes a small object in every media bucket,
+// so a missing bucket or bad credentials stop a run before any content is
+// generated instead of after it has been paid for. Set STORAGE_STARTUP_CHECK=false to skip it.
+func checkStorageBuckets() error {
+	if os.Getenv("STORAGE_STARTUP_CHECK") == "false" {
+		return nil
+	}
+	return verifyStorageBuckets()
+}
+
+// verifyStorageBuckets uploads and deletes a small file in each bucket
+func verifyStorageBuckets() error {
+	probe, err := os.CreateTemp("", "storage-check-*.txt")
+	if err != nil {
+		return fmt.Errorf("failed to create storage check file: %v", err)
+	}
+	defer os.Remove(probe.Name())
+	if _, err := probe.WriteString("storage check"); err != nil {
+		probe.Close()
+		return fmt.Errorf("failed to write storage check file: %v", err)
+	}
+	if err := probe.Close(); err != nil {
+		return fmt.Errorf("failed to write storage check file: %v", err)
+	}
+
+	buckets := []string{imagesBucket, audioBucket}
+	if sitemapConfig.Enabled {
+		buckets = append(buckets, sitemapConfig.Bucket)
+	}
+	for _, bucket := range buckets {
+		publicURL, err := storageClient.Upload(context.Background(), probe.Name(), bucket, filepath.Base(probe.Name()))
+		if err != nil {
+			return fmt.Errorf("storage bucket %q is missing or not writable: %v", bucket, err)
+		}
+		if err := storageClient.Delete(publicURL); err != nil {
+			return fmt.Errorf("storage bucket %q does not allow deletes: %v", bucket, err)
+		}
+	}
+	return nil
+}
+
+// uploadToStorage uploads a file with the configured storage backend and returns the public URL.
+// Files are stored under a name derived from their content, so uploads never
+// collide and URLs can be cached forever. A file that is already stored is not
+// uploaded again; its existing URL is returned instead.
+func uploadToStorage(ctx context.Context, filePath string, bucket string) (string, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+	if info.Size() > maxUploadBytes {
+		return "", fmt.Errorf("file %s is %d bytes, over the %d byte upload limit", filepath.Base(filePath), info.Size(), maxUploadBytes)
+	}
+	if err := validateMediaContent(filePath); err != nil {
+		return "", err
+	}
+
+	fileName, err := contentAddressedName(filePath)
+	if err != nil {
+		return "", err
+	}
 
-	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	exists, err := storageClient.Exists(ctx, bucket, fileName)
 	if err != nil {
-		return "", fmt.Errorf("failed to upload file: %v", err)
+		slog.Warn("Could not check for existing object, uploading anyway", "bucket", bucket, "file", fileName, "error", err)
+	} else if exists {
+		slog.Info("Reusing stored object", "bucket", bucket, "file", fileName, "source", filepath.Base(filePath))
+		return storageClient.PublicURL(bucket, fileName), nil
 	}
-	defer resp.Body.Close()
 
-	// Check response
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(body))
+	return storageClient.Upload(ctx, filePath, bucket, fileName)
+}
+
+// contentAddressedPattern matches names produced by contentAddressedName
+var contentAddressedPattern = regexp.MustCompile(fmt.Sprintf(`^[0-9a-f]{%d}\.[a-z0-9]+$`, contentHashChars))
+
+// cacheControlFor lets CDNs cache content-addressed files forever, since their
+// names change with their content, but has fixed names like the podcast feed
+// and sitemap revalidated on every request so readers never get a stale copy
+func cacheControlFor(fileName string) string {
+	if contentAddressedPattern.MatchString(fileName) {
+		return "public, max-age=31536000, immutable"
 	}
+	return "public, no-cache"
+}
 
-	// Get public URL
-	publicUrl := fmt.Sprintf("%s/storage/v1/object/public/%s/%s", supabaseProjectURL, bucket, fileName)
-	return publicUrl, nil
+// contentAddressedName returns a file name made of a sha256 prefix of the
+// file's contents, keeping its extension, e.g. "3f2a9c0e1b7d4a68.webp"
+func contentAddressedName(filePath string) (string, error) {
+	hash, err := fileSHA256(filePath)
+	if err != nil {
+		return "", err
+	}
+	return hash[:contentHashChars] + strings.ToLower(filepath.Ext(filePath)), nil
 }
 
-func UploadMediaAssets(assets NewsMediaAssets) (NewsMediaAssets, error) {
+// fileSHA256 returns the hex sha256 of a file without reading it all into memory
+func fileSHA256(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash file: %v", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// openUpload opens a file to be streamed as a request body and returns its size,
+// which must be set as the request's ContentLength since *os.File isn't sized by net/http
+func openUpload(filePath string) (*os.File, int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read file: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to read file: %v", err)
+	}
+	return file, info.Size(), nil
+}
+
+// deleteFromStorage removes a previously uploaded file given its public URL
+func deleteFromStorage(publicURL string) error {
+	return storageClient.Delete(publicURL)
+}
+
+func UploadMediaAssets(ctx context.Context, assets NewsMediaAssets) (NewsMediaAssets, error) {
 	var updatedAssets NewsMediaAssets
 	optimizer := NewMediaOptimizer()
 
 	// Upload image
 	if assets.ImagePath != "" {
-		bannerPath, err := optimizer.OptimizeImage(assets.ImagePath)
+		imageStart := time.Now()
+		optimized, err := optimizer.OptimizeImage(assets.ImagePath)
 		if err != nil {
 			return updatedAssets, fmt.Errorf("failed to optimize image: %v", err)
 		}
-		
-		// Get the thumbnail path from the banner path
-		basePath := strings.TrimSuffix(bannerPath, "_banner.webp")
-		thumbnailPath := basePath + "_thumb.webp"
+		// Output counts every variant uploaded for the image
+		outputPaths := []string{optimized.ThumbnailPath, optimized.BannerAvifPath, optimized.ThumbnailAvifPath}
+		for _, sizePath := range optimized.BannerSizes {
+			outputPaths = append(outputPaths, sizePath)
+		}
+		mediaMetrics.Record("image", time.Since(imageStart), fileSizes(assets.ImagePath), fileSizes(outputPaths...))
 		
 		// Upload banner
-		bannerURL, err := uploadToStorage(bannerPath, "images")
+		bannerURL, err := uploadToStorage(ctx, optimized.BannerPath, imagesBucket)
 		if err != nil {
 			return updatedAssets, fmt.Errorf("failed to upload banner image: %v", err)
 		}
 		updatedAssets.ImagePath = bannerURL
+		updatedAssets.ImageAltText = assets.ImageAltText
+		updatedAssets.ImageCaption = assets.ImageCaption
+		updatedAssets.ImageCredit = assets.ImageCredit
+		updatedAssets.ImageCreditURL = assets.ImageCreditURL
+		updatedAssets.ImageGeneration = assets.ImageGeneration
+
+		// Upload the responsive banner sizes, smallest first
+		var widths []int
+		for width := range optimized.BannerSizes {
+			widths = append(widths, width)
+		}
+		sort.Ints(widths)
+		for _, width := range widths {
+			sizeURL := bannerURL
+			if optimized.BannerSizes[width] != optimized.BannerPath {
+				sizeURL, err = uploadToStorage(ctx, optimized.BannerSizes[width], imagesBucket)
+				if err != nil {
+					slog.Warn("Failed to upload banner", "width", width, "error", err)
+					continue
+				}
+			}
+			updatedAssets.ImageSrcset = append(updatedAssets.ImageSrcset, ImageSource{URL: sizeURL, Width: width})
+		}
 
 		// Upload thumbnail
-		thumbnailURL, err := uploadToStorage(thumbnailPath, "images")
+		thumbnailURL, err := uploadToStorage(ctx, optimized.ThumbnailPath, imagesBucket)
 		if err != nil {
 			return updatedAssets, fmt.Errorf("failed to upload thumbnail: %v", err)
 		}
 		updatedAssets.ThumbnailPath = thumbnailURL
 
-		// Clean up local files
-		os.Remove(assets.ImagePath)
-		os.Remove(bannerPath)
-		os.Remove(thumbnailPath)
+		// Upload AVIF variants; readers fall back to WebP if these are missing
+		if optimized.BannerAvifPath != "" {
+			bannerAvifURL, err := uploadToStorage(ctx, optimized.BannerAvifPath, imagesBucket)
+			if err != nil {
+				slog.Warn("Failed to upload AVIF banner", "error", err)
+			} else {
+				updatedAssets.ImageAvifPath = bannerAvifURL
+			}
+		}
+		if optimized.ThumbnailAvifPath != "" {
+			thumbnailAvifURL, err := uploadToStorage(ctx, optimized.ThumbnailAvifPath, imagesBucket)
+			if err != nil {
+				slog.Warn("Failed to upload AVIF thumbnail", "error", err)
+			} else {
+				updatedAssets.ThumbnailAvifPath = thumbnailAvifURL
+			}
+		}
+
+		// Clean up optimized files; the original is kept until the audio is uploaded too
+		os.Remove(optimized.BannerPath)
+		os.Remove(optimized.ThumbnailPath)
+		for _, sizePath := range optimized.BannerSizes {
+			os.Remove(sizePath)
+		}
+		if optimized.BannerAvifPath != "" {
+			os.Remove(optimized.BannerAvifPath)
+			os.Remove(optimized.ThumbnailAvifPath)
+		}
 	}
 
 	// Upload audio
 	if assets.AudioPath != "" {
+		audioStart := time.Now()
+		audioInputBytes := fileSizes(assets.AudioPath)
 		optimizedPath, err := optimizer.OptimizeAudio(assets.AudioPath)
 		if err != nil {
 			return updatedAssets, fmt.Errorf("failed to optimize audio: %v", err)
 		}
+		mediaMetrics.Record("audio", time.Since(audioStart), audioInputBytes, fileSizes(optimizedPath))
+
+		// The duration is a display nicety, so an unreadable file doesn't stop the upload
+		duration, err := probeAudioDuration(optimizedPath)
+		if err != nil {
+			slog.Warn("Failed to read audio duration", "error", err)
+		} else {
+			updatedAssets.AudioDurationSeconds = duration
+		}
 		
-		audioURL, err := uploadToStorage(optimizedPath, "audio")
+		audioURL, err := uploadToStorage(ctx, optimizedPath, audioBucket)
 		if err != nil {
 			return updatedAssets, fmt.Errorf("failed to upload audio: %v", err)
 		}
 		updatedAssets.AudioPath = audioURL
 
-		// Clean up local files
-		os.Remove(assets.AudioPath)
 		os.Remove(optimizedPath)
 	}
 
-	return updatedAssets, nil
-} 
+	// Upload the transcript; the audio plays fine without it
+	if assets.TranscriptPath != "" {
+		transcriptURL, err := uploadToStorage(ctx, assets.TranscriptPath, audioBucket)
+		if err != nil {
+			slog.Warn("Failed to upload transcript", "error", err)
+		} else {
+			updatedAssets.TranscriptPath = transcriptURL
+		}
+	}
+
+ 	return updatedAssets, nil
+}
+
+// removeLocalMedia deletes the original media files once their article is
+// saved. Until then they are kept, so a failed upload or save can be retried
+// without generating the media again.
+func removeLocalMedia(assets NewsMediaAssets) {
+	for _, path := range []string{assets.ImagePath, assets.AudioPath, assets.TranscriptPath} {
+		if path != "" {
+			os.Remove(path)
+		}
+	}
+}
 
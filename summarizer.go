@@ -2,10 +2,12 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"os/exec"
 	"sync"
 	"time"
@@ -15,43 +17,46 @@ type SummarizationRequest struct {
 	Content string
 }
 
-func SummarizeArticles(articles []ArticleContent) (map[string]string, error) {
-	log.Printf("Starting summarization for %d articles", len(articles))
+func SummarizeArticles(ctx context.Context, logger *slog.Logger, articles []ArticleContent) (map[string]string, error) {
+	logger.Info("Starting summarization", "articles", len(articles))
 	summaries := make(map[string]string)
 	var mutex sync.Mutex
 	maxContentLength := 60000
 
 	for i, article := range articles {
-		log.Printf("Processing article %d of %d: %s", i+1, len(articles), article.Title)
+		logger := logger.With("url", article.URL)
+		logger.Info("Summarizing article", "article", i+1, "articles", len(articles), "title", article.Title)
 		
 		if len(article.Content) > maxContentLength {
-			log.Printf("INFO: Skipping article %d (too long): %s - URL: %s", i+1, article.Title, article.URL)
+			logger.Info("Skipping article, too long to summarize", "length", len(article.Content))
 			continue
 		}
 
-		log.Printf("DEBUG: Starting summarization for article: %s", article.Title)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
-		cmd := exec.Command("python3", "summarizer.py")
+		cmd := exec.CommandContext(ctx, "python3", "summarizer.py")
 		stdin, err := cmd.StdinPipe()
 		if err != nil {
-			log.Printf("ERROR: Error creating stdin pipe for %s - URL: %s, Error: %v", article.Title, article.URL, err)
+			logger.Error("Error creating stdin pipe", "error", err)
 			continue
 		}
 
 		stdout, err := cmd.StdoutPipe()
 		if err != nil {
-			log.Printf("ERROR: Error creating stdout pipe for %s - URL: %s, Error: %v", article.Title, article.URL, err)
+			logger.Error("Error creating stdout pipe", "error", err)
 			continue
 		}
 
 		stderr, err := cmd.StderrPipe()
 		if err != nil {
-			log.Printf("ERROR: Error creating stderr pipe for %s - URL: %s, Error: %v", article.Title, article.URL, err)
+			logger.Error("Error creating stderr pipe", "error", err)
 			continue
 		}
 
 		if err := cmd.Start(); err != nil {
-			log.Printf("ERROR: Error starting command for %s - URL: %s, Error: %v", article.Title, article.URL, err)
+			logger.Error("Error starting summarizer", "error", err)
 			continue
 		}
 
@@ -75,14 +80,14 @@ func SummarizeArticles(articles []ArticleContent) (map[string]string, error) {
 		// Read and process the result
 		result, err := io.ReadAll(stdout)
 		if err != nil {
-			log.Printf("ERROR: Error reading stdout for %s - URL: %s, Error: %v", article.Title, article.URL, err)
+			logger.Error("Error reading summarizer output", "error", err)
 			cmd.Process.Kill()
 			continue
 		}
 
 		// Wait for the command to complete
 		if err := cmd.Wait(); err != nil {
-			log.Printf("ERROR: Command failed for %s - URL: %s, Error: %v", article.Title, article.URL, err)
+			logger.Error("Summarizer failed", "error", err)
 			continue
 		}
 
@@ -94,7 +99,7 @@ func SummarizeArticles(articles []ArticleContent) (map[string]string, error) {
 		}
 
 		if err := json.Unmarshal(result, &response); err != nil {
-			log.Printf("ERROR: Error parsing JSON for %s - URL: %s, Error: %v", article.Title, article.URL, err)
+			logger.Error("Error parsing summarizer output", "error", err)
 			continue
 		}
 
@@ -103,7 +108,7 @@ func SummarizeArticles(articles []ArticleContent) (map[string]string, error) {
 			summaries[article.URL] = response.Summary
 			mutex.Unlock()
 		} else {
-			log.Printf("ERROR: Summarization failed for %s - URL: %s, Error: %s", article.Title, article.URL, response.Error)
+			logger.Error("Summarization failed", "error", response.Error)
 		}
 
 		// Print any debug/error messages from stderr
@@ -114,10 +119,10 @@ func SummarizeArticles(articles []ArticleContent) (map[string]string, error) {
 			}
 			if err := json.Unmarshal([]byte(msg), &debugMsg); err == nil {
 				if debugMsg.Debug != "" {
-					log.Printf("DEBUG [%s]: %s", article.Title, debugMsg.Debug)
+					logger.Debug("Summarizer output", "message", debugMsg.Debug)
 				}
 				if debugMsg.Error != "" {
-					log.Printf("ERROR [%s]: %s", article.Title, debugMsg.Error)
+					logger.Error("Summarizer error", "error", debugMsg.Error)
 				}
 			}
 		}
@@ -134,16 +139,16 @@ func SummarizeArticles(articles []ArticleContent) (map[string]string, error) {
 }
 
 func StartSummarizer() {
-	log.Println("Starting Python summarizer pre-warming in background...")
+	slog.Info("Starting Python summarizer pre-warming in background")
 
 	cmd := exec.Command("python3", "summarizer.py")
 	cmd.Stderr = log.Writer()
 	cmd.Stdout = log.Writer()
 
 	if err := cmd.Start(); err != nil {
-		log.Printf("Error starting pre-warming script: %v", err)
+		slog.Error("Error starting pre-warming script", "error", err)
 		return
 	}
 
-	log.Println("Python summarizer pre-warming started in background.")
+	slog.Info("Python summarizer pre-warming started in background")
 }
\ No newline at end of file
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// SummaryEmailConfig sends editors a daily email of what the pipeline did,
+// so they can follow it without access to the logs. Nothing is sent unless
+// To is set.
+type SummaryEmailConfig struct {
+	To       []string
+	From     string
+	SMTPHost string
+	SMTPPort int
+	Username string // PLAIN auth is skipped when empty
+	Password string
+	Cron     string // When the daemon sends it, in APP_TIMEZONE
+	Template string // html/template file replacing summaryEmailTemplate
+}
+
+var defaultSummaryEmailConfig = SummaryEmailConfig{SMTPPort: 587, Cron: "0 20 * * *"}
+
+var summaryEmailConfig = defaultSummaryEmailConfig
+
+// summaryEmailPeriod is how far back each summary looks
+const summaryEmailPeriod = 24 * time.Hour
+
+// loadSummaryEmailConfig reads SUMMARY_EMAIL_TO ("editor@example.com,ops@example.com"),
+// SUMMARY_EMAIL_FROM, SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD,
+// SUMMARY_EMAIL_CRON and SUMMARY_EMAIL_TEMPLATE
+func loadSummaryEmailConfig() (SummaryEmailConfig, error) {
+	config := defaultSummaryEmailConfig
+	for _, value := range strings.Split(os.Getenv("SUMMARY_EMAIL_TO"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		if _, err := mail.ParseAddress(value); err != nil {
+			return config, fmt.Errorf("SUMMARY_EMAIL_TO entry %q is not an email address", value)
+		}
+		config.To = append(config.To, value)
+	}
+	config.From = os.Getenv("SUMMARY_EMAIL_FROM")
+	config.SMTPHost = os.Getenv("SMTP_HOST")
+	config.Username = os.Getenv("SMTP_USERNAME")
+	config.Password = os.Getenv("SMTP_PASSWORD")
+	config.Template = os.Getenv("SUMMARY_EMAIL_TEMPLATE")
+	if value := os.Getenv("SUMMARY_EMAIL_CRON"); value != "" {
+		config.Cron = value
+	}
+	var err error
+	if config.SMTPPort, err = getEnvInt("SMTP_PORT", config.SMTPPort); err != nil {
+		return config, err
+	}
+	if len(config.To) == 0 {
+		return config, nil
+	}
+
+	if config.SMTPHost == "" {
+		return config, fmt.Errorf("SMTP_HOST must be set when SUMMARY_EMAIL_TO is")
+	}
+	if _, err := mail.ParseAddress(config.From); err != nil {
+		return config, fmt.Errorf("SUMMARY_EMAIL_FROM must be an email address when SUMMARY_EMAIL_TO is set, got %q", config.From)
+	}
+	if _, err := cron.ParseStandard(config.Cron); err != nil {
+		return config, fmt.Errorf("invalid SUMMARY_EMAIL_CRON %q: %v", config.Cron, err)
+	}
+	if _, err := config.template(); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// template parses the configured template, or the built-in one
+func (c SummaryEmailConfig) template() (*template.Template, error) {
+	text := summaryEmailTemplate
+	if c.Template != "" {
+		data, err := os.ReadFile(c.Template)
+		if err != nil {
+			return nil, fmt.Errorf("error reading SUMMARY_EMAIL_TEMPLATE: %v", err)
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New("summary").Funcs(template.FuncMap{
+		"usd":  func(amount float64) string { return fmt.Sprintf("$%.2f", amount) },
+		"time": func(t time.Time) string { return t.In(appLocation).Format("Jan 2 15:04") },
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid summary email template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// SummaryRejection is a topic the pipeline turned down
+type SummaryRejection struct {
+	Keyword  string
+	Decision string // One of the KeywordRejected outcomes
+	Reason   string
+	At       time.Time
+}
+
+// SummaryFailure is a topic that ran out of retries, or a run that failed
+type SummaryFailure struct {
+	Keyword string // Empty for a whole run
+	Mode    string
+	Stage   string // Where the topic failed, when known
+	Error   string
+	At      time.Time
+}
+
+// RunSummary is the data the summary email template is rendered with
+type RunSummary struct {
+	From        time.Time
+	To          time.Time
+	Published   []*NewsArticle
+	Drafts      int // Articles saved in the period still awaiting approval
+	Rejected    []SummaryRejection
+	Failures    []SummaryFailure
+	Runs        []SchedulerRun // Only known to the daemon, empty otherwise
+	RunSpendUSD float64        // Estimated spend of Runs
+	TTSUsage    []*TTSUsage    // Month to date, by provider
+	TTSSpendUSD float64
+}
+
+// buildRunSummary gathers what happened between from and to. runs are the
+// daemon's recent runs; those that started before from are left out.
+func buildRunSummary(from time.Time, to time.Time, runs []SchedulerRun) (*RunSummary, error) {
+	summary := &RunSummary{From: from, To: to}
+
+	articles, err := dbClient.GetArticlesSince(from, ArticleFilters{})
+	if err != nil {
+		return nil, err
+	}
+	for _, article := range articles {
+		if article.CreatedAt.After(to) {
+			continue
+		}
+		if article.Published {
+			summary.Published = append(summary.Published, article)
+		} else {
+			summary.Drafts++
+		}
+	}
+
+	for _, outcome := range []string{KeywordRejectedNotNews, KeywordRejectedInactive, KeywordRejectedSimilarInDB, KeywordRejectedSimilarInBatch, KeywordRejectedError, KeywordSkippedLimit} {
+		decisions, err := dbClient.GetKeywordDecisions(from, to, outcome)
+		if err != nil {
+			return nil, err
+		}
+		for _, decision := range decisions {
+			summary.Rejected = append(summary.Rejected, SummaryRejection{
+				Keyword:  decision.Keyword,
+				Decision: decision.Decision,
+				Reason:   decision.Reason,
+				At:       decision.CreatedAt,
+			})
+		}
+	}
+	sort.SliceStable(summary.Rejected, func(i, j int) bool {
+		return summary.Rejected[i].At.Before(summary.Rejected[j].At)
+	})
+
+	for _, mode := range []string{"daily", "recent"} {
+		jobs, err := dbClient.GetPipelineJobs(mode, []string{jobFailed})
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range jobs {
+			if job.UpdatedAt.Before(from) || job.UpdatedAt.After(to) {
+				continue
+			}
+			summary.Failures = append(summary.Failures, SummaryFailure{
+				Keyword: job.Keyword,
+				Mode:    job.Mode,
+				Stage:   job.FailedStage,
+				Error:   job.LastError,
+				At:      job.UpdatedAt,
+			})
+		}
+	}
+	for _, run := range runs {
+		if run.StartedAt.Before(from) || run.StartedAt.After(to) {
+			continue
+		}
+		summary.Runs = append(summary.Runs, run)
+		summary.RunSpendUSD += run.SpendUSD
+		if run.Error != "" {
+			summary.Failures = append(summary.Failures, SummaryFailure{Mode: run.Mode, Error: run.Error, At: run.StartedAt})
+		}
+	}
+	sort.SliceStable(summary.Failures, func(i, j int) bool {
+		return summary.Failures[i].At.Before(summary.Failures[j].At)
+	})
+
+	usage, err := dbClient.GetTTSUsage(startOfAppMonth(to))
+	if err != nil {
+		return nil, err
+	}
+	summary.TTSUsage = usage
+	for _, provider := range usage {
+		summary.TTSSpendUSD += provider.CostUSD
+	}
+	return summary, nil
+}
+
+// SendRunSummary emails the last day's summary to SUMMARY_EMAIL_TO, for
+// -mode=summary and the daemon's SUMMARY_EMAIL_CRON job
+func SendRunSummary(runs []SchedulerRun) error {
+	config := summaryEmailConfig
+	if len(config.To) == 0 {
+		return fmt.Errorf("SUMMARY_EMAIL_TO is not set")
+	}
+	to := appNow()
+	summary, err := buildRunSummary(to.Add(-summaryEmailPeriod), to, runs)
+	if err != nil {
+		return fmt.Errorf("error gathering summary: %v", err)
+	}
+	tmpl, err := config.template()
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, summary); err != nil {
+		return fmt.Errorf("error rendering summary email: %v", err)
+	}
+
+	subject := fmt.Sprintf("Daily Scoop summary for %s: %d published, %d failed",
+		to.Format("Monday, January 2"), len(summary.Published), len(summary.Failures))
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", config.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(config.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", to.Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+	message.Write(body.Bytes())
+
+	var auth smtp.Auth
+	if config.Username != "" {
+		auth = smtp.PlainAuth("", config.Username, config.Password, config.SMTPHost)
+	}
+	addr := net.JoinHostPort(config.SMTPHost, strconv.Itoa(config.SMTPPort))
+	from, _ := mail.ParseAddress(config.From)
+	recipients := make([]string, 0, len(config.To))
+	for _, value := range config.To {
+		address, _ := mail.ParseAddress(value)
+		recipients = append(recipients, address.Address)
+	}
+	if err := smtp.SendMail(addr, auth, from.Address, recipients, message.Bytes()); err != nil {
+		return fmt.Errorf("error sending summary email: %v", err)
+	}
+	slog.Info("Sent summary email", "recipients", len(recipients), "published", len(summary.Published),
+		"rejected", len(summary.Rejected), "failures", len(summary.Failures))
+	return nil
+}
+
+// summaryEmailTemplate is the built-in summary, rendered with a RunSummary
+const summaryEmailTemplate = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; max-width: 640px">
+<h2>Daily Scoop, {{time .From}} to {{time .To}}</h2>
+
+<h3>Published ({{len .Published}})</h3>
+{{if .Published}}<ul>
+{{range .Published}}<li>{{.Title}}</li>
+{{end}}</ul>{{else}}<p>No articles were published.</p>{{end}}
+{{if .Drafts}}<p>{{.Drafts}} draft(s) are waiting for approval.</p>{{end}}
+
+<h3>Rejected topics ({{len .Rejected}})</h3>
+{{if .Rejected}}<ul>
+{{range .Rejected}}<li><b>{{.Keyword}}</b>: {{if .Reason}}{{.Reason}}{{else}}{{.Decision}}{{end}}</li>
+{{end}}</ul>{{else}}<p>No topics were rejected.</p>{{end}}
+
+<h3>Failures ({{len .Failures}})</h3>
+{{if .Failures}}<ul>
+{{range .Failures}}<li>{{time .At}} {{if .Keyword}}<b>{{.Keyword}}</b>{{else}}{{.Mode}} run{{end}}{{if .Stage}} ({{.Stage}}){{end}}: {{.Error}}</li>
+{{end}}</ul>{{else}}<p>Nothing failed.</p>{{end}}
+
+<h3>Spend</h3>
+<ul>
+{{if .Runs}}<li>{{len .Runs}} run(s), estimated {{usd .RunSpendUSD}}</li>
+{{end}}<li>Text to speech this month: {{usd .TTSSpendUSD}}{{range .TTSUsage}} ({{.Provider}}: {{usd .CostUSD}}){{end}}</li>
+</ul>
+</body>
+</html>
+`
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// supabaseExistsTimeout bounds the HEAD request Exists makes before an upload
+const supabaseExistsTimeout = 30 * time.Second
+
+func init() {
+	RegisterStorageBackend("supabase", func() (StorageClient, error) {
+		client, err := NewSupabaseStorage()
+		if err != nil {
+			return nil, fmt.Errorf("error initializing Supabase storage: %v", err)
+		}
+		return client, nil
+	})
+}
+
+// SupabaseStorage stores media in Supabase Storage buckets
+type SupabaseStorage struct {
+	projectURL string // e.g. https://<project-ref>.supabase.co
+	httpClient *http.Client
+}
+
+// NewSupabaseStorage reads the project URL from SUPABASE_PROJECT_URL so each
+// deployment (staging, prod) can use its own buckets. There's no default, so
+// a missing setting can't send uploads to another deployment's project.
+func NewSupabaseStorage() (*SupabaseStorage, error) {
+	projectURL := strings.TrimSuffix(os.Getenv("SUPABASE_PROJECT_URL"), "/")
+	if projectURL == "" {
+		return nil, fmt.Errorf("SUPABASE_PROJECT_URL environment variable is not set")
+	}
+
+	parsed, err := url.Parse(projectURL)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" || (parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" {
+		return nil, fmt.Errorf("SUPABASE_PROJECT_URL must look like \"https://<project-ref>.supabase.co\", got %q", projectURL)
+	}
+
+	return &SupabaseStorage{projectURL: projectURL, httpClient: &http.Client{Timeout: 5 * time.Minute}}, nil
+}
+
+// Upload uploads a file to Supabase storage and returns the public URL
+func (s *SupabaseStorage) Upload(ctx context.Context, filePath string, bucket string, fileName string) (string, error) {
+	// Open the file; it is streamed rather than read into memory
+	file, size, err := openUpload(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// Get service role key and clean it
+	serviceKey := os.Getenv("SUPABASE_SERVICE_KEY")
+	if serviceKey == "" {
+		return "", fmt.Errorf("SUPABASE_SERVICE_KEY environment variable not set")
+	}
+	// Remove any quotes from the key
+	serviceKey = strings.Trim(serviceKey, "\"")
+
+	// Clean and encode bucket name
+	bucket = strings.Trim(bucket, "\"")
+	encodedBucket := url.PathEscape(bucket)
+
+	// Prepare the request
+	encodedFileName := url.PathEscape(fileName)
+	url := fmt.Sprintf("%s/storage/v1/object/%s/%s", s.projectURL, encodedBucket, encodedFileName)
+	
+	// Detect content type
+	ext := filepath.Ext(filePath)
+	contentType := mime.TypeByExtension(ext)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, file)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+	req.ContentLength = size
+
+	// Set headers
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+serviceKey)
+	req.Header.Set("apikey", serviceKey)
+	req.Header.Set("x-upsert", "true") // Names are content hashes, so an existing file is identical
+	
+	// Set cache control, including for the fixed-name sitemap and podcast feed
+	req.Header.Set("Cache-Control", cacheControlFor(fileName))
+
+	// Print request details for debugging
+	slog.Debug("Making storage request", "url", url)
+
+	release, err := waitForAPI(ctx, apiSupabase)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	// Send the request
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload file: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Check response
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return s.PublicURL(bucket, fileName), nil
+}
+
+// PublicURL returns the URL of a file in a public bucket
+func (s *SupabaseStorage) PublicURL(bucket string, fileName string) string {
+	return fmt.Sprintf("%s/storage/v1/object/public/%s/%s", s.projectURL, strings.Trim(bucket, "\""), fileName)
+}
+
+// Exists checks the file's public URL, which works because media buckets are public
+func (s *SupabaseStorage) Exists(ctx context.Context, bucket string, fileName string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, supabaseExistsTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "HEAD", s.PublicURL(bucket, fileName), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %v", err)
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to check file: %v", err)
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return true, nil
+	// Supabase reports missing objects as 400 as well as 404
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest:
+		return false, nil
+	default:
+		return false, fmt.Errorf("check failed with status %d", resp.StatusCode)
+	}
+}
+
+// Delete removes a previously uploaded file given its public URL
+func (s *SupabaseStorage) Delete(publicURL string) error {
+	prefix := s.projectURL + "/storage/v1/object/public/"
+	if !strings.HasPrefix(publicURL, prefix) {
+		return fmt.Errorf("not a storage URL for this project: %s", publicURL)
+	}
+
+	// Public URLs have the form <prefix><bucket>/<fileName>
+	parts := strings.SplitN(strings.TrimPrefix(publicURL, prefix), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("malformed storage URL: %s", publicURL)
+	}
+	bucket, fileName := parts[0], parts[1]
+
+	serviceKey := strings.Trim(os.Getenv("SUPABASE_SERVICE_KEY"), "\"")
+	if serviceKey == "" {
+		return fmt.Errorf("SUPABASE_SERVICE_KEY environment variable not set")
+	}
+
+	url := fmt.Sprintf("%s/storage/v1/object/%s/%s", s.projectURL, url.PathEscape(bucket), url.PathEscape(fileName))
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+serviceKey)
+	req.Header.Set("apikey", serviceKey)
+
+	release, err := waitForAPI(context.Background(), apiSupabase)
+	if err != nil {
+		return err
+	}
+	defer release()
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete file: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("delete failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+	_ "time/tzdata" // Slim containers often ship without a zoneinfo database
+)
+
+// appLocation is the timezone used for schedules and day boundaries
+var appLocation = time.Local
+
+// loadAppTimezone sets appLocation from the IANA name in APP_TIMEZONE
+// (e.g. "America/New_York"), keeping the server's local time when unset
+func loadAppTimezone() error {
+	name := os.Getenv("APP_TIMEZONE")
+	if name == "" {
+		return nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("APP_TIMEZONE must be an IANA timezone like \"America/New_York\", got %q", name)
+	}
+	appLocation = location
+	return nil
+}
+
+// appNow returns the current time in the application timezone
+func appNow() time.Time {
+	return time.Now().In(appLocation)
+}
+
+// startOfAppDay returns midnight of t's calendar day in the application timezone
+func startOfAppDay(t time.Time) time.Time {
+	t = t.In(appLocation)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, appLocation)
+}
+
+// startOfAppMonth returns midnight on the first of t's month in the application timezone
+func startOfAppMonth(t time.Time) time.Time {
+	t = t.In(appLocation)
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, appLocation)
+}
+
+// dbTime converts a time to UTC before it is compared with createdAt columns,
+// which the database stores in UTC. Column types without a timezone would
+// otherwise compare against the wall clock of whatever zone t happens to be in.
+func dbTime(t time.Time) time.Time {
+	return t.UTC()
+}
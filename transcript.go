@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+func init() {
+	// Players only load captions served as text/vtt
+	mime.AddExtensionType(".vtt", "text/vtt")
+}
+
+// Relative weights used to spread narration time over the words, in
+// characters: each word costs its length plus a space, and sentence and
+// paragraph ends cost extra for the pause that follows them
+const (
+	sentencePauseWeight  = 4
+	paragraphPauseWeight = 8
+)
+
+// maxSilenceSnap is how far a sentence boundary may move to land on a pause
+const maxSilenceSnap = 1500 * time.Millisecond
+
+// transcriptWord is a spoken word with its position in the audio
+type transcriptWord struct {
+	Text       string
+	Start, End time.Duration
+}
+
+// audioSilence is a pause found by ffmpeg's silencedetect filter
+type audioSilence struct {
+	Start, End time.Duration
+}
+
+// writeTranscript aligns the spoken paragraphs with the narration at
+// audioPath and writes a WebVTT file with word timings next to it. offset
+// shifts every cue, e.g. by the length of an intro jingle added afterwards.
+func writeTranscript(audioPath string, paragraphs []string, offset time.Duration) error {
+	length, err := probeAudioLength(audioPath)
+	if err != nil {
+		return err
+	}
+	silences, err := detectSilences(audioPath)
+	if err != nil {
+		// Alignment still works from text length alone, just less precisely
+		slog.Warn("Failed to detect pauses for transcript alignment", "error", err)
+	}
+
+	sentences := alignTranscript(paragraphs, length, silences)
+	if err := os.WriteFile(transcriptPathFor(audioPath), []byte(renderWebVTT(sentences, offset)), 0644); err != nil {
+		return fmt.Errorf("failed to write transcript: %v", err)
+	}
+	return nil
+}
+
+// transcriptPathFor returns where the transcript of an audio file is written
+func transcriptPathFor(audioPath string) string {
+	return strings.TrimSuffix(audioPath, filepath.Ext(audioPath)) + ".vtt"
+}
+
+// alignTranscript estimates when each word is spoken. Time is spread over the
+// text by length, then each sentence boundary is moved onto the nearest
+// detected pause, which is where the voice actually stopped.
+func alignTranscript(paragraphs []string, length time.Duration, silences []audioSilence) [][]transcriptWord {
+	type sentence struct {
+		words       []string
+		weight      float64
+		pauseWeight float64
+	}
+	var sentences []sentence
+	totalWeight := 0.0
+	for _, paragraph := range paragraphs {
+		parts := splitSentences(paragraph)
+		for i, part := range parts {
+			words := strings.Fields(part)
+			if len(words) == 0 {
+				continue
+			}
+			s := sentence{words: words, pauseWeight: sentencePauseWeight}
+			if i == len(parts)-1 {
+				s.pauseWeight = paragraphPauseWeight
+			}
+			for _, word := range words {
+				s.weight += float64(utf8.RuneCountInString(word) + 1)
+			}
+			totalWeight += s.weight + s.pauseWeight
+			sentences = append(sentences, s)
+		}
+	}
+	if totalWeight == 0 {
+		return nil
+	}
+
+	// Estimated start and end of each sentence
+	perWeight := float64(length) / totalWeight
+	starts := make([]time.Duration, len(sentences))
+	ends := make([]time.Duration, len(sentences))
+	position := 0.0
+	for i, s := range sentences {
+		starts[i] = time.Duration(position * perWeight)
+		position += s.weight
+		ends[i] = time.Duration(position * perWeight)
+		position += s.pauseWeight
+	}
+
+	// Snap each boundary between sentences onto the closest pause
+	for i := 0; i < len(sentences)-1; i++ {
+		boundary := (ends[i] + starts[i+1]) / 2
+		best := -1
+		bestDistance := maxSilenceSnap
+		for j, silence := range silences {
+			distance := absDuration((silence.Start+silence.End)/2 - boundary)
+			if distance < bestDistance && silence.Start > starts[i] {
+				best, bestDistance = j, distance
+			}
+		}
+		if best >= 0 {
+			ends[i], starts[i+1] = silences[best].Start, silences[best].End
+		}
+	}
+
+	// Spread each sentence's time over its words by length
+	aligned := make([][]transcriptWord, len(sentences))
+	for i, s := range sentences {
+		span := float64(ends[i] - starts[i])
+		if span < 0 {
+			span = 0
+		}
+		position := 0.0
+		for _, word := range s.words {
+			start := starts[i] + time.Duration(position/s.weight*span)
+			position += float64(utf8.RuneCountInString(word) + 1)
+			end := starts[i] + time.Duration(position/s.weight*span)
+			aligned[i] = append(aligned[i], transcriptWord{Text: word, Start: start, End: end})
+		}
+	}
+	return aligned
+}
+
+var (
+	silenceStartPattern = regexp.MustCompile(`silence_start: (-?[0-9.]+)`)
+	silenceEndPattern   = regexp.MustCompile(`silence_end: ([0-9.]+)`)
+)
+
+// detectSilences lists the pauses in an audio file using ffmpeg's silencedetect
+func detectSilences(audioPath string) ([]audioSilence, error) {
+	output, err := exec.Command("ffmpeg",
+		"-i", audioPath,
+		"-af", "silencedetect=noise=-35dB:d=0.2",
+		"-f", "null", "-").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg silencedetect failed: %v", err)
+	}
+
+	var silences []audioSilence
+	var start time.Duration
+	for _, line := range strings.Split(string(output), "\n") {
+		if match := silenceStartPattern.FindStringSubmatch(line); match != nil {
+			start = parseSeconds(match[1])
+		} else if match := silenceEndPattern.FindStringSubmatch(line); match != nil {
+			silences = append(silences, audioSilence{Start: start, End: parseSeconds(match[1])})
+		}
+	}
+	return silences, nil
+}
+
+// renderWebVTT writes one cue per sentence, with a timestamp tag before each
+// word after the first so players can highlight words as they're spoken
+func renderWebVTT(sentences [][]transcriptWord, offset time.Duration) string {
+	var vtt strings.Builder
+	vtt.WriteString("WEBVTT\n")
+	for i, words := range sentences {
+		if len(words) == 0 {
+			continue
+		}
+		fmt.Fprintf(&vtt, "\n%d\n%s --> %s\n", i+1, vttTimestamp(words[0].Start+offset), vttTimestamp(words[len(words)-1].End+offset))
+		for j, word := range words {
+			if j > 0 {
+				fmt.Fprintf(&vtt, " <%s>", vttTimestamp(word.Start+offset))
+			}
+			vtt.WriteString(escapeVTT(word.Text))
+		}
+		vtt.WriteString("\n")
+	}
+	return vtt.String()
+}
+
+// vttTimestamp formats a duration as HH:MM:SS.mmm
+func vttTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// escapeVTT escapes the characters WebVTT treats as markup
+func escapeVTT(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+func parseSeconds(value string) time.Duration {
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(math.Max(seconds, 0) * float64(time.Second))
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
@@ -13,199 +15,81 @@ import (
 	"github.com/playwright-community/playwright-go"
 )
 
+// trendsGeo is the country whose Google Trends the pipeline follows, set by
+// TRENDS_GEO
+var trendsGeo = "US"
+
+// loadTrendsGeo reads TRENDS_GEO, a two-letter country code such as "GB"
+func loadTrendsGeo() (string, error) {
+	value := os.Getenv("TRENDS_GEO")
+	if value == "" {
+		return trendsGeo, nil
+	}
+	geo := normalizeCountry(value)
+	if geo == "" {
+		return trendsGeo, fmt.Errorf("TRENDS_GEO must be a two-letter country code, got %q", value)
+	}
+	return geo, nil
+}
+
 // TrendingTopic represents a single trending topic with all its data
 type TrendingTopic struct {
 	Keyword         string   `json:"keyword"`
+	Geo             string   `json:"geo,omitempty"` // Country the topic trended in, e.g. "US"
 	SearchVolume    string   `json:"searchVolume"`
 	Status          string   `json:"status"`
 	TimeAgo         string   `json:"timeAgo"`
 	TrendBreakdown  []string `json:"trendBreakdown"`
+	SearchWindow    *SearchWindow `json:"searchWindow,omitempty"` // Days to search for coverage in, when not the last day
 }
 
-// Update constants at the top of the file
-const (
-	MAX_DAILY_TOPICS  = 3  // Or whatever number you want for daily
-	MAX_RECENT_TOPICS = 1  // Or whatever number you want for recent
-	MAX_SPORTS_TOPICS = 1  // Maximum number of sports topics for daily mode
-)
-
-// GetTrendingKeywords fetches trending keywords from Google Trends using Playwright and Webshare proxies
-func GetTrendingKeywords() ([]TrendingTopic, error) {
-	// Fetch proxies from Webshare API
-	proxies, err := GetProxies()
-	if err != nil {
-		return nil, fmt.Errorf("error fetching proxies: %v", err)
-	}
-
-	if len(proxies) == 0 {
-		return nil, fmt.Errorf("no proxies found")
-	}
-
-	// Use the first proxy from the list
-	proxy := proxies[0]
-
-	// Initialize Playwright and launch browser
-	pw, err := playwright.Run()
-	if err != nil {
-		return nil, fmt.Errorf("could not start Playwright: %v", err)
-	}
-	defer pw.Stop()
-
-	browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
-		Headless: playwright.Bool(true),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("could not launch browser: %v", err)
-	}
-	defer browser.Close()
-
-	// Set up context with proxy
-	contextOptions := playwright.BrowserNewContextOptions{
-		Proxy: &playwright.Proxy{
-			Server: proxy,
-		},
-	}
-
-	context, err := browser.NewContext(contextOptions)
-	if err != nil {
-		return nil, fmt.Errorf("could not create browser context: %v", err)
-	}
-	defer context.Close()
+// SearchWindow is the [From, To) range of days a topic's coverage was published in
+type SearchWindow struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
 
-	page, err := context.NewPage()
-	if err != nil {
-		return nil, fmt.Errorf("could not create page: %v", err)
-	}
-	defer page.Close()
+// TopicLimits caps how many trending topics a run picks
+type TopicLimits struct {
+	Daily  int // Topics per daily run
+	Recent int // Topics per recent run
+	Sports int // Sports topics per daily run; recent runs skip sports
+}
 
-	// Navigate to Google Trends
-	if _, err = page.Goto("https://trends.google.com/trending?geo=US&hours=24", playwright.PageGotoOptions{
-		WaitUntil: playwright.WaitUntilStateNetworkidle,
-		Timeout:   playwright.Float(60000),
-	}); err != nil {
-		return nil, fmt.Errorf("could not go to Google Trends: %v", err)
-	}
+var defaultTopicLimits = TopicLimits{
+	Daily:  3,
+	Recent: 1,
+	Sports: 1,
+}
 
-	// Wait longer for the content to be visible
-	time.Sleep(5 * time.Second)
+var topicLimits = defaultTopicLimits
 
-	// Get the page content and parse with goquery
-	content, err := page.Content()
-	if err != nil {
-		return nil, fmt.Errorf("could not get page content: %v", err)
+// loadTopicLimits reads MAX_DAILY_TOPICS, MAX_RECENT_TOPICS and MAX_SPORTS_TOPICS
+func loadTopicLimits() (TopicLimits, error) {
+	config := defaultTopicLimits
+	var err error
+	if config.Daily, err = getEnvInt("MAX_DAILY_TOPICS", config.Daily); err != nil {
+		return config, err
 	}
-
-	// Parse the HTML content
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
-	if err != nil {
-		return nil, fmt.Errorf("could not parse HTML: %v", err)
+	if config.Recent, err = getEnvInt("MAX_RECENT_TOPICS", config.Recent); err != nil {
+		return config, err
 	}
-
-	var topics []TrendingTopic
-
-	func() {
-		defer func() {
-			recover() // Recover from our intentional panic
-		}()
-
-		doc.Find("table tbody:nth-of-type(2) tr").Each(func(i int, s *goquery.Selection) {
-			// Skip header row if present
-			cells := s.Find("td")
-			if cells.Length() < 2 {
-				return
-			}
-
-			// Collect all related search terms from the 5th cell (index 4)
-			var relatedTerms []string
-			cells.Eq(4).Find("button span:nth-child(4)").Each(func(i int, s *goquery.Selection) {
-				term := strings.TrimSpace(s.Text())
-				if term != "" {
-					relatedTerms = append(relatedTerms, term)
-				}
-			})
-
-			topic := TrendingTopic{
-				Keyword:         strings.TrimSpace(cells.Eq(1).Children().First().Text()),
-				SearchVolume:    strings.TrimSpace(cells.Eq(1).Find("div:nth-child(2) > div:first-child > div:first-child").Text()),
-				Status:          strings.TrimSpace(cells.Eq(1).Find("div:nth-child(2) > div:nth-child(2) > div:last-child").Text()),
-				TimeAgo:         strings.TrimSpace(cells.Eq(1).Find("div:nth-child(2) > div:nth-child(3) > div:last-child").Text()),
-				TrendBreakdown:  relatedTerms,
-			}
-
-			// Check if topic is news-related using DeepSeek before adding
-			isNewsRelated, replacementKeyword, err := IsNewsRelatedTopic(topic.Keyword, topic.TrendBreakdown, "daily", nil)
-			if err != nil {
-				fmt.Printf("Warning: Could not check if '%s' is news-related: %v\n", topic.Keyword, err)
-				return
-			}
-
-			// Only append active and news-related topics
-			if topic.Keyword != "" && topic.Status == "Active" {
-				if isNewsRelated {
-					// If we have a replacement keyword, use it
-					if replacementKeyword != "" {
-						topic.Keyword = replacementKeyword
-					}
-
-					// Check if we already have a similar article in the database from the last 24 hours
-					similar, err := dbClient.CheckSimilarKeywords(topic.Keyword, 24) // Check last 24 hours
-					if err != nil {
-						fmt.Printf("Warning: Error checking database for similar keywords '%s': %v\n", topic.Keyword, err)
-						return
-					}
-
-					if !similar {
-						topics = append(topics, topic)
-						fmt.Printf("Added unique topic: %s\n", topic.Keyword)
-						// Break if we've reached MAX_TRENDING_TOPICS
-						if len(topics) >= MAX_DAILY_TOPICS {
-							s.Parent().Find("tr").Each(func(_ int, _ *goquery.Selection) {
-								panic("break")
-							})
-						}
-					} else {
-						fmt.Printf("Skipping topic '%s' - similar article exists in database\n", topic.Keyword)
-					}
-				}
-			}
-		})
-	}()
-
-	if len(topics) == 0 {
-		return nil, fmt.Errorf("no trending topics found")
+	if config.Sports, err = getEnvInt("MAX_SPORTS_TOPICS", config.Sports); err != nil {
+		return config, err
 	}
-
-	// Filter out topics with similar keywords in the database
-	var filteredTopics []TrendingTopic
-	for _, topic := range topics {
-		fmt.Printf("\nChecking similarity for topic: %s\n", topic.Keyword)
-		similar, err := CheckSimilarKeywords(topic.Keyword, topicsToKeywords(filteredTopics)) // Pass filteredTopics keywords for similarity check
-		if err != nil {
-			fmt.Printf("Warning: Error checking similar keywords for '%s': %v\n", topic.Keyword, err)
-			continue
-		}
-		fmt.Printf("Similarity check result for '%s': similar=%v\n", topic.Keyword, similar)
-
-		if !similar {
-			filteredTopics = append(filteredTopics, topic)
-			fmt.Printf("Found unique topic: %s\n", topic.Keyword)
-			// If we've reached our limit, break
-			if len(filteredTopics) >= MAX_DAILY_TOPICS {
-				break
-			}
-		} else {
-			fmt.Printf("Skipping similar keyword: %s\n", topic.Keyword)
-		}
+	if config.Daily < 1 || config.Recent < 1 {
+		return config, fmt.Errorf("MAX_DAILY_TOPICS and MAX_RECENT_TOPICS must be at least 1, got %d and %d", config.Daily, config.Recent)
 	}
-
-	// If we found any unique topics, return them
-	if len(filteredTopics) > 0 {
-		return filteredTopics, nil
+	if config.Sports < 0 {
+		return config, fmt.Errorf("MAX_SPORTS_TOPICS must not be negative, got %d", config.Sports)
 	}
+	return config, nil
+}
 
-	// If all topics were filtered out, return error
-	fmt.Printf("No unique topics found. All were similar to recent articles.\n")
-	return nil, fmt.Errorf("all trending topics were similar to recent articles")
+// GetTrendingKeywords fetches the daily trending keywords, recording a
+// decision for every topic considered like the other modes
+func GetTrendingKeywords() ([]TrendingTopic, error) {
+	return GetTrendingKeywordsWithMode(context.Background(), "daily")
 }
 
 // Helper function to extract keywords from TrendingTopic slice
@@ -255,14 +139,15 @@ func FormatTrendingTopicsJSON(topics []TrendingTopic) (string, error) {
 	return string(jsonBytes), nil
 }
 
-// IsNewsRelatedTopic uses Gemini to determine if a keyword is news-related
-func IsNewsRelatedTopic(keyword string, trendBreakdown []string, mode string, sportsCount *int) (bool, string, error) {
+// IsNewsRelatedTopic uses Gemini to determine if a keyword is news-related.
+// The raw Gemini response is returned alongside the decision for auditing.
+func IsNewsRelatedTopic(keyword string, trendBreakdown []string, mode string, sportsCount *int) (bool, string, string, error) {
 	// Add mode-specific rules to the prompt
 	modeRules := ""
 	if mode == "recent" {
 		modeRules = `Additional Rule:
 - If the topic is sports-related (e.g., games, matches, scores, athletes, teams), respond with "false|sports"`
-	} else if mode == "daily" && *sportsCount >= MAX_SPORTS_TOPICS {
+	} else if mode == "daily" && *sportsCount >= topicLimits.Sports {
 		modeRules = `Additional Rule:
 - If the topic is sports-related (e.g., games, matches, scores, athletes, teams), respond with "false|sports"`
 	}
@@ -292,15 +177,15 @@ Analyze '%s' and provide your response:`, keyword, modeRules, trendBreakdown, ke
 
 	response, err := QueryGemini(prompt)
 	if err != nil {
-		return false, "", err
+		return false, "", response, err
 	}
 
-	fmt.Printf("Gemini Response for '%s': %s\n", keyword, response)
+	slog.Debug("News relevance response", "keyword", keyword, "response", response)
 
 	// Split response into parts (now possibly including sports indicator)
 	parts := strings.Split(response, "|")
 	if len(parts) < 2 {
-		return false, "", fmt.Errorf("invalid response format: %s", response)
+		return false, "", response, fmt.Errorf("invalid response format: %s", response)
 	}
 
 	isNews := strings.TrimSpace(strings.ToLower(parts[0])) == "true"
@@ -310,16 +195,16 @@ Analyze '%s' and provide your response:`, keyword, modeRules, trendBreakdown, ke
 	// Update sports count if this is a sports topic and it was accepted
 	if isNews && isSports && mode == "daily" {
 		*sportsCount++
-		fmt.Printf("Sports topic count increased to: %d\n", *sportsCount)
+		slog.Info("Accepted a sports topic", "keyword", keyword, "sportsTopics", *sportsCount)
 	}
 
 	// If it's news-related and we have a replacement keyword
 	if isNews && replacementKeyword != "" && replacementKeyword != "sports" {
-		fmt.Printf("Using replacement keyword: '%s'\n", replacementKeyword)
-		return true, replacementKeyword, nil
+		slog.Info("Using replacement keyword", "keyword", keyword, "replacement", replacementKeyword)
+		return true, replacementKeyword, response, nil
 	}
 
-	return isNews, "", nil
+	return isNews, "", response, nil
 }
 
 // QueryGemini sends a prompt to Gemini API and returns the response // Renamed to QueryGemini
@@ -356,15 +241,22 @@ func QueryGemini(prompt string) (string, error) {
 	// Set headers for Gemini API
 	req.Header.Set("Content-Type", "application/json")
 
+	release, err := waitForAPI(context.Background(), apiGemini)
+	if err != nil {
+		return "", err
+	}
+	defer release()
 	// Send the request
 	resp, err := client.Do(req)
 	if err != nil {
+		pipelineMetrics.GeminiError("trends")
 		return "", fmt.Errorf("error making request to Gemini API: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// Check for non-OK status codes
 	if resp.StatusCode != http.StatusOK {
+		pipelineMetrics.GeminiError("trends")
 		return "", fmt.Errorf("Gemini API request failed with status code: %d", resp.StatusCode)
 	}
 
@@ -394,14 +286,15 @@ func QueryGemini(prompt string) (string, error) {
 	}
 
 	geminiResponse = strings.TrimSpace(geminiResponse)
-	fmt.Printf("Raw Gemini Response: '%s'\n", geminiResponse) // Added raw response print
+	slog.Debug("Gemini response", "response", geminiResponse)
 
 	// Validate response format (should be "true|replacement" or "false|" for IsNewsRelated, and "true" or "false" for CheckSimilarKeywords)
 	responseParts := strings.Split(geminiResponse, "|")
 	if len(responseParts) == 2 {
 		isNews := strings.ToLower(strings.TrimSpace(responseParts[0]))
 		if isNews != "true" && isNews != "false" {
-			fmt.Printf("Warning: Invalid boolean value in response from Gemini (2 parts): %s\n", geminiResponse)
+			slog.Warn("Invalid boolean value in response from Gemini", "response", geminiResponse)
+			reportLLMParseError("trends", geminiResponse, fmt.Errorf("invalid boolean value"))
 			return "false|", nil // Default to false if invalid format
 		}
 		return geminiResponse, nil // Return full response for IsNewsRelated
@@ -410,20 +303,31 @@ func QueryGemini(prompt string) (string, error) {
 		if isBool == "true" || isBool == "false" {
 			return geminiResponse, nil // Return single "true" or "false" for CheckSimilarKeywords
 		} else {
-			fmt.Printf("Warning: Invalid boolean value in response from Gemini (1 part): %s\n", geminiResponse)
+			slog.Warn("Invalid boolean value in response from Gemini", "response", geminiResponse)
+			reportLLMParseError("trends", geminiResponse, fmt.Errorf("invalid boolean value"))
 			return "false", fmt.Errorf("invalid boolean response from Gemini: %s", geminiResponse) // Indicate error for unexpected single part response
 		}
 	} else {
-		fmt.Printf("Warning: Received unexpected response format from Gemini: %s\n", geminiResponse)
+		slog.Warn("Received unexpected response format from Gemini", "response", geminiResponse)
+		reportLLMParseError("trends", geminiResponse, fmt.Errorf("unexpected response format"))
 		return "false", fmt.Errorf("unexpected response format from Gemini: %s", geminiResponse) // Indicate error for completely unexpected format
 	}
 }
 
 
-// CheckSimilarKeywords compares a new keyword with existing keywords and returns true if they are similar
-func CheckSimilarKeywords(newKeyword string, existingKeywords []string) (bool, error) {
+// CheckSimilarKeywords compares a new keyword with existing keywords and returns true if they are similar.
+// The raw Gemini response is returned alongside the result for auditing.
+func CheckSimilarKeywords(newKeyword string, existingKeywords []string) (bool, string, error) {
 	if len(existingKeywords) == 0 {
-		return false, nil
+		return false, "", nil
+	}
+
+	// Skip the LLM call when the keywords are identical once normalized
+	normalized := NormalizeKeyword(newKeyword)
+	for _, existing := range existingKeywords {
+		if NormalizeKeyword(existing) == normalized {
+			return true, "", nil
+		}
 	}
 
 	// Simplified prompt for more reliable responses
@@ -433,15 +337,15 @@ Answer with ONLY a single word: "true" or "false"`, newKeyword, existingKeywords
 
 	response, err := QueryGemini(prompt)
 	if err != nil {
-		return false, fmt.Errorf("error querying Gemini for similarity: %v", err)
+		return false, response, fmt.Errorf("error querying Gemini for similarity: %v", err)
 	}
 
 	// Clean and validate the response
-	response = strings.TrimSpace(strings.ToLower(response))
-	return response == "true", nil
+	cleaned := strings.TrimSpace(strings.ToLower(response))
+	return cleaned == "true", response, nil
 }
 
-func GetTrendingKeywordsWithMode(mode string) ([]TrendingTopic, error) {
+func GetTrendingKeywordsWithMode(ctx context.Context, mode string) ([]TrendingTopic, error) {
 	var (
 		url string
 		maxTopics int
@@ -449,32 +353,50 @@ func GetTrendingKeywordsWithMode(mode string) ([]TrendingTopic, error) {
 	
 	switch mode {
 	case "daily":
-		url = "https://trends.google.com/trending?geo=US&hours=24"
-		maxTopics = MAX_DAILY_TOPICS
+		url = "https://trends.google.com/trending?geo=" + trendsGeo + "&hours=24"
+		maxTopics = topicLimits.Daily
 	case "recent":
-		url = "https://trends.google.com/trending?geo=US&hours=2"
-		maxTopics = MAX_RECENT_TOPICS
+		url = "https://trends.google.com/trending?geo=" + trendsGeo + "&hours=2"
+		maxTopics = topicLimits.Recent
 	default:
 		return nil, fmt.Errorf("invalid mode: %s", mode)
 	}
 
 	// Pass both URL, max topics limit, and mode
-	return GetTrendingKeywordsFromURL(url, maxTopics, mode)
+	return GetTrendingKeywordsFromURL(ctx, url, maxTopics, mode)
 }
 
-func GetTrendingKeywordsFromURL(trendURL string, maxTopics int, mode string) ([]TrendingTopic, error) {
-	// Fetch proxies from Webshare API
-	proxies, err := GetProxies()
+// reportTrendsProxy tells the proxy pool how loading Google Trends through
+// proxy went, failing the fetch if the page didn't load or Google blocked
+// the proxy
+func reportTrendsProxy(session *ProxySession, proxy string, page playwright.Page, resp playwright.Response, err error) error {
 	if err != nil {
-		return nil, fmt.Errorf("error fetching proxies: %v", err)
+		session.Report(proxy, err)
+		return fmt.Errorf("could not go to Google Trends: %v", err)
 	}
-
-	if len(proxies) == 0 {
-		return nil, fmt.Errorf("no proxies found")
+	status := http.StatusOK
+	if resp != nil {
+		status = resp.Status()
+	}
+	if err := proxyResponseError(status, page.URL()); err != nil {
+		session.Report(proxy, err)
+		if proxy == "" {
+			return fmt.Errorf("Google Trends blocked this host")
+		}
+		return fmt.Errorf("Google Trends blocked proxy %s", proxyHost(proxy))
 	}
+	session.Report(proxy, nil)
+	return nil
+}
 
-	// Use the first proxy from the list
-	proxy := proxies[0]
+func GetTrendingKeywordsFromURL(ctx context.Context, trendURL string, maxTopics int, mode string) ([]TrendingTopic, error) {
+	// The browser goes through the run's pinned proxy, preferably in the
+	// country whose trends are fetched
+	session := proxySessionFrom(ctx)
+	proxy, err := session.BrowserProxy(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	// Initialize Playwright and launch browser
 	pw, err := playwright.Run()
@@ -492,10 +414,9 @@ func GetTrendingKeywordsFromURL(trendURL string, maxTopics int, mode string) ([]
 	defer browser.Close()
 
 	// Set up context with proxy
-	contextOptions := playwright.BrowserNewContextOptions{
-		Proxy: &playwright.Proxy{
-			Server: proxy,
-		},
+	contextOptions := playwright.BrowserNewContextOptions{}
+	if proxy != "" {
+		contextOptions.Proxy = playwrightProxy(proxy)
 	}
 
 	context, err := browser.NewContext(contextOptions)
@@ -511,11 +432,12 @@ func GetTrendingKeywordsFromURL(trendURL string, maxTopics int, mode string) ([]
 	defer page.Close()
 
 	// Navigate to the provided URL
-	if _, err = page.Goto(trendURL, playwright.PageGotoOptions{
+	resp, err := page.Goto(trendURL, playwright.PageGotoOptions{
 		WaitUntil: playwright.WaitUntilStateNetworkidle,
 		Timeout:   playwright.Float(30000),
-	}); err != nil {
-		return nil, fmt.Errorf("could not go to Google Trends: %v", err)
+	})
+	if err := reportTrendsProxy(session, proxy, page, resp, err); err != nil {
+		return nil, err
 	}
 
 	// Wait for the content to be visible
@@ -533,9 +455,17 @@ func GetTrendingKeywordsFromURL(trendURL string, maxTopics int, mode string) ([]
 		return nil, fmt.Errorf("could not parse HTML: %v", err)
 	}
 
+	similarityConfig, err := loadSimilarityConfig(mode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid similarity configuration: %v", err)
+	}
+
 	var topics []TrendingTopic
 	sportsCount := 0 // Initialize sports counter
 
+	// Decisions for topics that passed the database check, keyed by final keyword
+	pendingDecisions := make(map[string]*KeywordDecision)
+
 	func() {
 		defer func() {
 			recover() // Recover from our intentional panic
@@ -559,16 +489,26 @@ func GetTrendingKeywordsFromURL(trendURL string, maxTopics int, mode string) ([]
 
 			topic := TrendingTopic{
 				Keyword:        strings.TrimSpace(cells.Eq(1).Children().First().Text()),
+				Geo:            trendsGeo,
 				SearchVolume:   strings.TrimSpace(cells.Eq(1).Find("div:nth-child(2) > div:first-child > div:first-child").Text()),
 				Status:         strings.TrimSpace(cells.Eq(1).Find("div:nth-child(2) > div:nth-child(2) > div:last-child").Text()),
 				TimeAgo:        strings.TrimSpace(cells.Eq(1).Find("div:nth-child(2) > div:nth-child(3) > div:last-child").Text()),
 				TrendBreakdown: relatedTerms,
 			}
 
+			decision := &KeywordDecision{
+				Keyword:        topic.Keyword,
+				Geo:            topic.Geo,
+				Mode:           mode,
+				TrendBreakdown: topic.TrendBreakdown,
+			}
+
 			// Check if topic is news-related using the updated function
-			isNewsRelated, replacementKeyword, err := IsNewsRelatedTopic(topic.Keyword, topic.TrendBreakdown, mode, &sportsCount)
+			isNewsRelated, replacementKeyword, rawResponse, err := IsNewsRelatedTopic(topic.Keyword, topic.TrendBreakdown, mode, &sportsCount)
+			decision.LLMResponses = append(decision.LLMResponses, rawResponse)
 			if err != nil {
-				fmt.Printf("Warning: Could not check if '%s' is news-related: %v\n", topic.Keyword, err)
+				slog.Warn("Could not check if topic is news-related", "keyword", topic.Keyword, "error", err)
+				recordKeywordDecision(decision, KeywordRejectedError, fmt.Sprintf("news check failed: %v", err))
 				return
 			}
 
@@ -578,25 +518,33 @@ func GetTrendingKeywordsFromURL(trendURL string, maxTopics int, mode string) ([]
 					// Use replacement keyword if available
 					if replacementKeyword != "" {
 						topic.Keyword = replacementKeyword
+						decision.ReplacementKeyword = replacementKeyword
 					}
 
 					// Check for similar articles in database
-					similar, err := dbClient.CheckSimilarKeywords(topic.Keyword, 24)
+					similar, err := dbClient.CheckSimilarKeywords(topic.Keyword, similarityConfig)
 					if err != nil {
-						fmt.Printf("Warning: Error checking database for similar keywords '%s': %v\n", topic.Keyword, err)
+						slog.Warn("Error checking database for similar keywords", "keyword", topic.Keyword, "error", err)
+						recordKeywordDecision(decision, KeywordRejectedError, fmt.Sprintf("database similarity check failed: %v", err))
 						return
 					}
 
 					if !similar {
 						topics = append(topics, topic)
-						fmt.Printf("Added unique topic: %s\n", topic.Keyword)
+						pendingDecisions[topic.Keyword] = decision
+						slog.Info("Added unique topic", "keyword", topic.Keyword)
 						if len(topics) >= maxTopics {
 							panic("break") // Use panic to break out of the loop
 						}
 					} else {
-						fmt.Printf("Skipping topic '%s' - similar article exists in database\n", topic.Keyword)
+						slog.Info("Skipping topic, similar article exists in database", "keyword", topic.Keyword)
+						recordKeywordDecision(decision, KeywordRejectedSimilarInDB, fmt.Sprintf("similar article exists in database within %v", similarityConfig.Window))
 					}
+				} else {
+					recordKeywordDecision(decision, KeywordRejectedNotNews, "Gemini classified topic as not news-related")
 				}
+			} else {
+				recordKeywordDecision(decision, KeywordRejectedInactive, fmt.Sprintf("topic status is '%s'", topic.Status))
 			}
 		})
 	}()
@@ -607,24 +555,34 @@ func GetTrendingKeywordsFromURL(trendURL string, maxTopics int, mode string) ([]
 
 	// Filter out topics with similar keywords in the database
 	var filteredTopics []TrendingTopic
-	for _, topic := range topics {
-		fmt.Printf("\nChecking similarity for topic: %s\n", topic.Keyword)
-		similar, err := CheckSimilarKeywords(topic.Keyword, topicsToKeywords(filteredTopics)) // Pass filteredTopics keywords for similarity check
+	for i, topic := range topics {
+		slog.Debug("Checking similarity for topic", "keyword", topic.Keyword)
+		decision := pendingDecisions[topic.Keyword]
+		similar, rawResponse, err := CheckSimilarKeywords(topic.Keyword, topicsToKeywords(filteredTopics)) // Pass filteredTopics keywords for similarity check
+		if decision != nil && rawResponse != "" {
+			decision.LLMResponses = append(decision.LLMResponses, rawResponse)
+		}
 		if err != nil {
-			fmt.Printf("Warning: Error checking similar keywords for '%s': %v\n", topic.Keyword, err)
+			slog.Warn("Error checking similar keywords", "keyword", topic.Keyword, "error", err)
+			recordKeywordDecision(decision, KeywordRejectedError, fmt.Sprintf("batch similarity check failed: %v", err))
 			continue
 		}
-		fmt.Printf("Similarity check result for '%s': similar=%v\n", topic.Keyword, similar)
+		slog.Debug("Similarity check result", "keyword", topic.Keyword, "similar", similar)
 
 		if !similar {
 			filteredTopics = append(filteredTopics, topic)
-			fmt.Printf("Found unique topic: %s\n", topic.Keyword)
-			// If we've reached our limit, break
+			slog.Info("Found unique topic", "keyword", topic.Keyword)
+			recordKeywordDecision(decision, KeywordAccepted, "")
+			// If we've reached our limit, break, recording why the rest were skipped
 			if len(filteredTopics) >= maxTopics {
+				for _, skipped := range topics[i+1:] {
+					recordKeywordDecision(pendingDecisions[skipped.Keyword], KeywordSkippedLimit, fmt.Sprintf("topic limit of %d reached", maxTopics))
+				}
 				break
 			}
 		} else {
-			fmt.Printf("Skipping similar keyword: %s\n", topic.Keyword)
+			slog.Info("Skipping similar keyword", "keyword", topic.Keyword)
+			recordKeywordDecision(decision, KeywordRejectedSimilarInBatch, "similar to another topic selected in this run")
 		}
 	}
 
@@ -634,6 +592,19 @@ func GetTrendingKeywordsFromURL(trendURL string, maxTopics int, mode string) ([]
 	}
 
 	// If all topics were filtered out, return error
-	fmt.Printf("No unique topics found. All were similar to recent articles.\n")
+	slog.Info("No unique topics found. All were similar to recent articles.")
 	return nil, fmt.Errorf("all trending topics were similar to recent articles")
-}
\ No newline at end of file
+}
+
+// recordKeywordDecision persists the outcome of the keyword filtering pipeline.
+// Failures are only logged so auditing never blocks topic selection.
+func recordKeywordDecision(decision *KeywordDecision, outcome string, reason string) {
+	if decision == nil {
+		return
+	}
+	decision.Decision = outcome
+	decision.Reason = reason
+	if err := dbClient.SaveKeywordDecision(decision); err != nil {
+		slog.Warn("Failed to record keyword decision", "keyword", decision.Keyword, "error", err)
+	}
+}
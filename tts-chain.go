@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ttsSkipProvider ends TTS_PROVIDERS to publish articles without audio when
+// every provider has failed or is over budget
+const ttsSkipProvider = "skip"
+
+// errTTSSkipped reports that the chain gave up and the article goes out without audio
+var errTTSSkipped = errors.New("every TTS provider failed or is over budget, skipping audio")
+
+// ttsPricePerMillionChars is each provider's list price in US dollars for its
+// default voices, used to track spending against TTS_MONTHLY_BUDGETS.
+// TTS_PRICES overrides these, e.g. for ElevenLabs plans or standard voices.
+var ttsPricePerMillionChars = map[string]float64{
+	"openai":     15,
+	"google":     16,
+	"elevenlabs": 300,
+	"polly":      16,
+	"azure":      16,
+}
+
+// TTSChainConfig lists the TTS providers to try in order and what each may spend
+type TTSChainConfig struct {
+	Providers []string           // Tried in order until one succeeds
+	Skip      bool               // Publish without audio when every provider fails
+	Budgets   map[string]float64 // Monthly cap per provider in US dollars; absent means unlimited
+	Prices    map[string]float64 // US dollars per million characters
+}
+
+var defaultTTSChainConfig = TTSChainConfig{
+	Providers: []string{"openai"},
+	Budgets:   map[string]float64{},
+	Prices:    ttsPricePerMillionChars,
+}
+
+var ttsChainConfig = defaultTTSChainConfig
+
+// loadTTSChainConfig reads TTS_PROVIDERS (falling back to TTS_PROVIDER),
+// TTS_MONTHLY_BUDGETS ("openai=20,google=10") and TTS_PRICES ("elevenlabs=180")
+func loadTTSChainConfig() (TTSChainConfig, error) {
+	config := defaultTTSChainConfig
+	config.Providers = nil
+
+	names := ttsProviderNames()
+	for i, name := range names {
+		if name == ttsSkipProvider {
+			if i != len(names)-1 {
+				return config, fmt.Errorf("%q must be the last entry of TTS_PROVIDERS", ttsSkipProvider)
+			}
+			config.Skip = true
+			continue
+		}
+		if _, ok := ttsConcurrency[name]; !ok {
+			return config, fmt.Errorf("unknown TTS provider: %s", name)
+		}
+		config.Providers = append(config.Providers, name)
+	}
+	if len(config.Providers) == 0 {
+		return config, fmt.Errorf("TTS_PROVIDERS must name at least one provider")
+	}
+
+	config.Budgets = make(map[string]float64)
+	config.Prices = make(map[string]float64)
+	for name, price := range ttsPricePerMillionChars {
+		config.Prices[name] = price
+	}
+	for _, setting := range []struct {
+		key    string
+		values map[string]float64
+	}{
+		{"TTS_PRICES", config.Prices},
+		{"TTS_MONTHLY_BUDGETS", config.Budgets},
+	} {
+		for name, value := range getEnvMap(setting.key) {
+			amount, err := strconv.ParseFloat(value, 64)
+			if err != nil || amount < 0 {
+				return config, fmt.Errorf("%s has an invalid amount for %s: %q", setting.key, name, value)
+			}
+			if _, ok := ttsConcurrency[name]; !ok {
+				return config, fmt.Errorf("%s names unknown TTS provider: %s", setting.key, name)
+			}
+			setting.values[name] = amount
+		}
+	}
+	return config, nil
+}
+
+// single reports whether the chain is just one provider with nothing to
+// track, including spending against a run budget
+func (c TTSChainConfig) single() bool {
+	return len(c.Providers) == 1 && !c.Skip && len(c.Budgets) == 0 && runBudgetConfig.Limit == 0
+}
+
+// cost estimates what a provider charges for the given number of characters
+func (c TTSChainConfig) cost(provider string, characters int) float64 {
+	return c.Prices[provider] * float64(characters) / 1e6
+}
+
+// TTSChain tries each configured provider in turn, passing over any that
+// would exceed their monthly budget and falling through on errors. Spending is
+// tracked per calendar month in the tts_usage table.
+type TTSChain struct {
+	config    TTSChainConfig
+	names     []string
+	providers []TTSProvider
+}
+
+// newTTSChain creates the providers in the chain. One that can't be set up,
+// e.g. for missing credentials, is left out rather than failing the chain.
+func newTTSChain(config TTSChainConfig) (*TTSChain, error) {
+	chain := &TTSChain{config: config}
+	for _, name := range config.Providers {
+		provider, err := newNamedTTSProvider(name)
+		if err != nil {
+			slog.Warn("Leaving provider out of the TTS chain", "provider", name, "error", err)
+			continue
+		}
+		chain.names = append(chain.names, name)
+		chain.providers = append(chain.providers, provider)
+	}
+	if len(chain.providers) == 0 && !config.Skip {
+		return nil, fmt.Errorf("no TTS provider in the chain could be set up")
+	}
+	return chain, nil
+}
+
+func (c *TTSChain) Synthesize(ctx context.Context, text string, voice string) (io.ReadCloser, error) {
+	return c.run(utf8.RuneCountInString(text), voice, func(provider TTSProvider, voice string) (io.ReadCloser, error) {
+		return provider.Synthesize(ctx, text, voice)
+	})
+}
+
+// SynthesizeSSML sends the script as SSML to providers that accept it and as
+// plain text to the rest
+func (c *TTSChain) SynthesizeSSML(ctx context.Context, script ssmlScript, voice string) (io.ReadCloser, error) {
+	text := script.plainText()
+	return c.run(utf8.RuneCountInString(text), voice, func(provider TTSProvider, voice string) (io.ReadCloser, error) {
+		if ssmlProvider, ok := provider.(SSMLSynthesizer); ok {
+			return ssmlProvider.SynthesizeSSML(ctx, script, voice)
+		}
+		return provider.Synthesize(ctx, text, voice)
+	})
+}
+
+func (c *TTSChain) run(characters int, voice string, synthesize func(provider TTSProvider, voice string) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	month := startOfAppMonth(appNow())
+	spent, err := c.monthlySpend(month)
+	if err != nil {
+		// Better to risk overspending slightly than to stop producing audio
+		slog.Warn("Could not load TTS spending, ignoring budgets", "error", err)
+	}
+
+	var failures []string
+	for i, name := range c.names {
+		cost := c.config.cost(name, characters)
+		if budget, ok := c.config.Budgets[name]; ok && spent != nil && spent[name]+cost > budget {
+			failures = append(failures, fmt.Sprintf("%s: monthly budget of $%.2f reached", name, budget))
+			continue
+		}
+
+		// Voices are configured for the primary provider and mean nothing to the others
+		providerVoice := voice
+		if name != ttsProviderName() {
+			providerVoice = ""
+		}
+		resp, err := synthesize(c.providers[i], providerVoice)
+		if err != nil {
+			slog.Warn("TTS failed", "provider", name, "error", err)
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+
+		if err := dbClient.RecordTTSUsage(name, month, characters, cost); err != nil {
+			slog.Warn("Could not record TTS usage", "provider", name, "error", err)
+		}
+		pipelineMetrics.TTSUsage(name, characters, cost)
+		runSpend.Add(spendTTS, cost)
+		return resp, nil
+	}
+
+	if c.config.Skip {
+		slog.Warn("Skipping audio", "failures", strings.Join(failures, "; "))
+		return nil, errTTSSkipped
+	}
+	return nil, fmt.Errorf("every TTS provider failed: %s", strings.Join(failures, "; "))
+}
+
+// monthlySpend returns what each provider has cost so far in the month, or
+// nil when no provider has a budget to check against
+func (c *TTSChain) monthlySpend(month time.Time) (map[string]float64, error) {
+	if len(c.config.Budgets) == 0 {
+		return nil, nil
+	}
+	usage, err := dbClient.GetTTSUsage(month)
+	if err != nil {
+		return nil, err
+	}
+	spent := make(map[string]float64)
+	for _, entry := range usage {
+		spent[entry.Provider] = entry.CostUSD
+	}
+	return spent, nil
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// TTSProvider turns article text into spoken MP3 audio
+type TTSProvider interface {
+	// Synthesize returns MP3 data which the caller closes. voice is a
+	// provider-specific voice name; empty uses the provider's configured default.
+	Synthesize(ctx context.Context, text string, voice string) (io.ReadCloser, error)
+}
+
+// TTSConfig holds narration settings passed to every provider
+type TTSConfig struct {
+	Speed float64 // Speaking rate multiplier; 1.0 is the voice's normal pace
+	Pitch float64 // Semitones up or down; only Google and Azure support pitch
+}
+
+var defaultTTSConfig = TTSConfig{Speed: 1.0}
+
+var ttsConfig = defaultTTSConfig
+
+// ttsPitchProviders are the providers that can change pitch
+var ttsPitchProviders = map[string]bool{"google": true, "azure": true}
+
+// loadTTSConfig reads TTS_SPEED (0.25 to 4.0) and TTS_PITCH (-20 to 20 semitones)
+func loadTTSConfig() (TTSConfig, error) {
+	config := defaultTTSConfig
+
+	speed, err := getEnvFloat("TTS_SPEED", config.Speed)
+	if err != nil {
+		return config, err
+	}
+	if speed < 0.25 || speed > 4.0 {
+		return config, fmt.Errorf("TTS_SPEED must be between 0.25 and 4.0, got %v", speed)
+	}
+	config.Speed = speed
+
+	pitch, err := getEnvFloat("TTS_PITCH", config.Pitch)
+	if err != nil {
+		return config, err
+	}
+	if pitch < -20 || pitch > 20 {
+		return config, fmt.Errorf("TTS_PITCH must be between -20 and 20 semitones, got %v", pitch)
+	}
+	if pitch != 0 && !ttsPitchProviders[ttsProviderName()] {
+		slog.Warn("TTS_PITCH is not supported by the TTS provider and will be ignored", "provider", ttsProviderName())
+	}
+	config.Pitch = pitch
+
+	return config, nil
+}
+
+// ttsConcurrency is how many requests each provider is sent at once by default;
+// TTS_MAX_CONCURRENT overrides it
+var ttsConcurrency = map[string]int{
+	"openai":     2,
+	"google":     4,
+	"elevenlabs": 2,
+	"polly":      4,
+	"azure":      2,
+}
+
+// ttsProviderName returns the primary TTS provider: the first entry of
+// TTS_PROVIDERS, else TTS_PROVIDER, defaulting to "openai"
+func ttsProviderName() string {
+	return ttsProviderNames()[0]
+}
+
+// ttsProviderNames returns the provider chain from TTS_PROVIDERS
+// ("openai,google,skip"), or just the primary provider when it's unset
+func ttsProviderNames() []string {
+	var names []string
+	for _, name := range strings.Split(os.Getenv("TTS_PROVIDERS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		return names
+	}
+	if provider := os.Getenv("TTS_PROVIDER"); provider != "" {
+		return []string{provider}
+	}
+	return []string{"openai"}
+}
+
+// ttsMaxConcurrent returns the number of concurrent requests allowed for the
+// configured provider
+func ttsMaxConcurrent() int {
+	if value := os.Getenv("TTS_MAX_CONCURRENT"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+		slog.Warn("Invalid TTS_MAX_CONCURRENT, using provider default", "value", value)
+	}
+	if n, ok := ttsConcurrency[ttsProviderName()]; ok {
+		return n
+	}
+	return defaultAudioBatchConfig.MaxConcurrent
+}
+
+// newTTSProvider returns the configured speech provider, or a chain that
+// falls through the providers in TTS_PROVIDERS (see tts-chain.go)
+func newTTSProvider() (TTSProvider, error) {
+	if ttsChainConfig.single() {
+		return newNamedTTSProvider(ttsChainConfig.Providers[0])
+	}
+	return newTTSChain(ttsChainConfig)
+}
+
+// newNamedTTSProvider creates a speech provider by name: "openai", "google"
+// for Google Cloud Text-to-Speech, "elevenlabs", "polly" for Amazon Polly or
+// "azure" for Azure AI Speech
+func newNamedTTSProvider(provider string) (TTSProvider, error) {
+	switch provider {
+	case "openai":
+		return &OpenAITTS{client: openai.NewClient(os.Getenv("OPENAI_API_KEY")), speed: ttsConfig.Speed}, nil
+	case "google":
+		return NewGoogleTTS()
+	case "elevenlabs":
+		return NewElevenLabsTTS()
+	case "polly":
+		return NewPollyTTS()
+	case "azure":
+		return NewAzureTTS()
+	default:
+		return nil, fmt.Errorf("unknown TTS provider: %s", provider)
+	}
+}
+
+// OpenAITTS synthesizes speech with OpenAI's tts-1 model
+type OpenAITTS struct {
+	client *openai.Client
+	speed  float64
+}
+
+const (
+	openAITTSMaxChars         = 4096 // OpenAI rejects longer speech input
+	openAITTSChunkConcurrency = 3    // Chunks of one article synthesized at once
+)
+
+// Synthesize splits text longer than OpenAI's input limit at paragraph
+// boundaries, synthesizes the chunks concurrently and joins them with ffmpeg
+func (o *OpenAITTS) Synthesize(ctx context.Context, text string, voice string) (io.ReadCloser, error) {
+	if voice == "" {
+		voice = string(openai.VoiceAlloy)
+	}
+	chunks := splitParagraphsForTTS(text, openAITTSMaxChars)
+	if len(chunks) == 1 {
+		return o.synthesizeChunk(ctx, chunks[0], voice)
+	}
+
+	clips := make([]string, len(chunks))
+	errs := make([]error, len(chunks))
+	defer func() {
+		for _, clip := range clips {
+			if clip != "" {
+				os.Remove(clip)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, openAITTSChunkConcurrency)
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			clips[i], errs[i] = o.synthesizeChunkToFile(ctx, chunk, voice)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d of %d: %v", i+1, len(chunks), err)
+		}
+	}
+
+	output, err := os.CreateTemp("", "tts-*.mp3")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %v", err)
+	}
+	output.Close()
+	if err := concatAudio(clips, output.Name()); err != nil {
+		os.Remove(output.Name())
+		return nil, fmt.Errorf("failed to join audio chunks: %v", err)
+	}
+	file, err := os.Open(output.Name())
+	if err != nil {
+		os.Remove(output.Name())
+		return nil, fmt.Errorf("failed to open joined audio: %v", err)
+	}
+	return &tempFileReader{file}, nil
+}
+
+func (o *OpenAITTS) synthesizeChunkToFile(ctx context.Context, text string, voice string) (string, error) {
+	resp, err := o.synthesizeChunk(ctx, text, voice)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Close()
+
+	clip, err := os.CreateTemp("", "tts-chunk-*.mp3")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer clip.Close()
+	if _, err := io.Copy(clip, resp); err != nil {
+		os.Remove(clip.Name())
+		return "", fmt.Errorf("failed to write audio chunk: %v", err)
+	}
+	return clip.Name(), nil
+}
+
+func (o *OpenAITTS) synthesizeChunk(ctx context.Context, text string, voice string) (io.ReadCloser, error) {
+	release, err := waitForAPI(ctx, apiOpenAI)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	resp, err := o.client.CreateSpeech(ctx, openai.CreateSpeechRequest{
+		Model:          openai.TTSModel1,
+		Input:          text,
+		Voice:          openai.SpeechVoice(voice),
+		ResponseFormat: openai.SpeechResponseFormatMp3,
+		Speed:          o.speed,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// languageCodeFromVoice returns the "<language>-<region>" prefix of Google and
+// Azure voice names such as "en-US-Neural2-D" or "en-US-JennyNeural"
+func languageCodeFromVoice(voice string) (string, error) {
+	parts := strings.Split(voice, "-")
+	if len(parts) < 3 {
+		return "", fmt.Errorf("invalid voice name %q: expected <language>-<region>-<name>", voice)
+	}
+	return parts[0] + "-" + parts[1], nil
+}
+
+// categoryVoices maps lowercase category names or IDs to voices, from
+// TTS_CATEGORY_VOICES ("Sports=nova,Politics=onyx,3=echo")
+var categoryVoices map[string]string
+var categoryVoicesOnce sync.Once
+
+// voiceForCategory returns the voice configured for an article's category, or
+// "" to use the provider's default voice
+func voiceForCategory(categoryId int) string {
+	categoryVoicesOnce.Do(func() {
+		categoryVoices = loadCategorySettings("TTS_CATEGORY_VOICES")
+	})
+	return categorySetting(categoryVoices, categoryId)
+}
+
+// tempFileReader deletes its file once the caller is done reading it
+type tempFileReader struct {
+	*os.File
+}
+
+func (t *tempFileReader) Close() error {
+	err := t.File.Close()
+	os.Remove(t.File.Name())
+	return err
+}
+
+// splitParagraphsForTTS packs blank-line separated paragraphs into chunks of
+// at most maxBytes, splitting oversized paragraphs with splitTextForTTS
+func splitParagraphsForTTS(text string, maxBytes int) []string {
+	var chunks []string
+	var current strings.Builder
+
+	flush := func() {
+		if chunk := strings.TrimSpace(current.String()); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		current.Reset()
+	}
+
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		if current.Len() > 0 && current.Len()+len(paragraph)+2 > maxBytes {
+			flush()
+		}
+		if len(paragraph) > maxBytes {
+			chunks = append(chunks, splitTextForTTS(paragraph, maxBytes)...)
+			continue
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n\n")
+		}
+		current.WriteString(paragraph)
+	}
+	flush()
+
+	if len(chunks) == 0 {
+		return []string{text}
+	}
+	return chunks
+}
@@ -1,5 +1,9 @@
 package main
 
+import (
+	"time"
+)
+
 // GeneratedArticle represents a generated news article with metadata
 type GeneratedArticle struct {
     Title      string
@@ -8,6 +12,40 @@ type GeneratedArticle struct {
     Keywords   []string
     CategoryId int
     URLTitle   string
+    SourceURLs []string        // URLs of the summaries the article was written from
+    Sources    []ArticleSource // Source details saved alongside the article
+    Generation *GenerationInfo // Prompt and model settings used to write the article
+}
+
+// GenerationInfo records how an article was generated so outputs can be reproduced
+type GenerationInfo struct {
+    Prompt      string
+    Model       string
+    Provider    string
+    Temperature float32
+}
+
+// ImageGenerationInfo records how an article's image was generated so it can
+// be regenerated or audited
+type ImageGenerationInfo struct {
+    Prompt          string // Final prompt, after any revisions
+    Provider        string
+    Model           string
+    Seed            *int64 // nil when the provider doesn't report one
+    Symbolic        bool   // Rendered under the symbolic imagery guideline
+    PromptRevisions int    // Times the prompt was revised after the provider declined it
+    // Why moderation rejected an earlier attempt; empty when the first was kept
+    ModerationRejection string
+}
+
+// ArticleSource describes a scraped article used to generate a news article
+type ArticleSource struct {
+    URL         string
+    Title       string
+    Domain      string
+    PublishedAt *time.Time
+    ImageURL    string // og:image of the source page, used by the source-first image strategy
+    ImageWidth  int
 }
 
 // NewsMediaAssets holds paths to generated media files for a news article
@@ -15,4 +53,20 @@ type NewsMediaAssets struct {
     AudioPath string
     ImagePath string
 	ThumbnailPath  string  
+	ImageAvifPath     string // Empty when no AVIF variant was produced
+	ThumbnailAvifPath string
+	ImageSrcset       []ImageSource // Banner URLs by width, smallest first
+	AudioDurationSeconds int        // 0 when the duration couldn't be read
+	ImageAltText      string        // Description of the image for screen readers
+	ImageCaption      string        // e.g. "AI-generated illustration of ...", empty for stock photos
+	ImageCredit       string        // e.g. "Photo by Jane Doe on Unsplash" or "AI-generated image by Google Imagen"
+	ImageCreditURL    string        // Link for the attribution, stock photos only
+	TranscriptPath    string        // WebVTT transcript of the audio; empty when none was made
+	ImageGeneration   *ImageGenerationInfo // nil unless the image was AI-generated
+}
+
+// ImageSource is one entry of a responsive image srcset
+type ImageSource struct {
+	URL   string `json:"url"`
+	Width int    `json:"width"`
 } 
\ No newline at end of file
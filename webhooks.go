@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// webhookEventPublished is sent for each article a run publishes or the
+// admin API approves
+const webhookEventPublished = "article.published"
+
+// WebhookConfig lists the endpoints told about newly published articles.
+// Each request carries X-DailyScoop-Timestamp (Unix seconds) and
+// X-DailyScoop-Signature, "sha256=" and the hex HMAC-SHA256 of the timestamp,
+// a ".", and the body, keyed with Secret.
+type WebhookConfig struct {
+	URLs    []string
+	Secret  string
+	Timeout time.Duration // Per request
+	Retries int           // Extra attempts after a request fails or gets a non-2xx response
+}
+
+var defaultWebhookConfig = WebhookConfig{Timeout: 10 * time.Second, Retries: 2}
+
+var webhookConfig = defaultWebhookConfig
+
+// webhookRetryDelay is the wait before the first retry, doubling after each
+const webhookRetryDelay = 2 * time.Second
+
+// loadWebhookConfig reads WEBHOOK_URLS ("https://a.example/hook,https://b.example/hook"),
+// WEBHOOK_SECRET, WEBHOOK_TIMEOUT and WEBHOOK_RETRIES
+func loadWebhookConfig() (WebhookConfig, error) {
+	config := defaultWebhookConfig
+	for _, value := range strings.Split(os.Getenv("WEBHOOK_URLS"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		parsed, err := url.Parse(value)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return config, fmt.Errorf("WEBHOOK_URLS entry %q is not an http or https URL", value)
+		}
+		config.URLs = append(config.URLs, value)
+	}
+	config.Secret = os.Getenv("WEBHOOK_SECRET")
+	if len(config.URLs) > 0 && config.Secret == "" {
+		return config, fmt.Errorf("WEBHOOK_SECRET must be set when WEBHOOK_URLS is")
+	}
+
+	var err error
+	if config.Timeout, err = getEnvDuration("WEBHOOK_TIMEOUT", config.Timeout); err != nil {
+		return config, err
+	}
+	if config.Retries, err = getEnvInt("WEBHOOK_RETRIES", config.Retries); err != nil {
+		return config, err
+	}
+	if config.Retries < 0 {
+		return config, fmt.Errorf("WEBHOOK_RETRIES must not be negative, got %d", config.Retries)
+	}
+	return config, nil
+}
+
+// WebhookPayload is the JSON body of a webhook request
+type WebhookPayload struct {
+	Event   string         `json:"event"`
+	SentAt  time.Time      `json:"sentAt"`
+	Article WebhookArticle `json:"article"`
+}
+
+// WebhookArticle is the published article, with the URLs of its media
+type WebhookArticle struct {
+	ID            uuid.UUID `json:"id"`
+	Title         string    `json:"title"`
+	URLTitle      string    `json:"urlTitle"`
+	Category      string    `json:"category,omitempty"`
+	ImageURL      *string   `json:"imageUrl,omitempty"`
+	ThumbnailURL  *string   `json:"thumbnailUrl,omitempty"`
+	AudioURL      *string   `json:"audioUrl,omitempty"`
+	TranscriptURL *string   `json:"transcriptUrl,omitempty"`
+}
+
+// publishWebhooks tells every endpoint about the articles, waiting until each
+// request has succeeded or run out of retries. The articles are already
+// saved, so failures are logged and reported rather than returned.
+func publishWebhooks(ctx context.Context, articles []*NewsArticle) {
+	if len(webhookConfig.URLs) == 0 || len(articles) == 0 {
+		return
+	}
+	logger := loggerFrom(ctx)
+
+	categories := make(map[int]string)
+	if list, err := dbClient.ListCategories(); err != nil {
+		logger.Warn("Could not load categories for webhooks, leaving them out", "error", err)
+	} else {
+		for _, category := range list {
+			categories[category.ID] = category.Name
+		}
+	}
+
+	client := &http.Client{Timeout: webhookConfig.Timeout}
+	var wg sync.WaitGroup
+	for _, article := range articles {
+		payload := WebhookPayload{
+			Event:  webhookEventPublished,
+			SentAt: appNow(),
+			Article: WebhookArticle{
+				ID:            article.ID,
+				Title:         article.Title,
+				URLTitle:      article.URLTitle,
+				ImageURL:      article.ImageUrl,
+				ThumbnailURL:  article.ThumbnailUrl,
+				AudioURL:      article.AudioUrl,
+				TranscriptURL: article.TranscriptUrl,
+			},
+		}
+		if article.CategoryId != nil {
+			payload.Article.Category = categories[*article.CategoryId]
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			logger.Warn("Could not encode webhook payload", "article", article.ID, "error", err)
+			continue
+		}
+
+		for _, endpoint := range webhookConfig.URLs {
+			wg.Add(1)
+			go func(endpoint string, article *NewsArticle) {
+				defer wg.Done()
+				if err := sendWebhook(ctx, client, endpoint, body); err != nil {
+					// The query string may hold a token, so only the host is logged
+					host := endpoint
+					if parsed, err := url.Parse(endpoint); err == nil {
+						host = parsed.Host
+					}
+					logger.Warn("Webhook failed", "endpoint", host, "article", article.ID, "error", err)
+					reportFailure(ctx, reportLevelWarning, "Webhook failed", err, map[string]string{"endpoint": host, "article": article.ID.String()})
+				}
+			}(endpoint, article)
+		}
+	}
+	wg.Wait()
+}
+
+// sendWebhook posts the signed body, retrying with a doubling delay
+func sendWebhook(ctx context.Context, client *http.Client, endpoint string, body []byte) error {
+	delay := webhookRetryDelay
+	var err error
+	for attempt := 0; attempt <= webhookConfig.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%v; gave up retrying: %v", err, ctx.Err())
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+		if err = postWebhook(ctx, client, endpoint, body); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// postWebhook makes one signed request, failing on any non-2xx response
+func postWebhook(ctx context.Context, client *http.Client, endpoint string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	timestamp := strconv.FormatInt(appNow().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-DailyScoop-Event", webhookEventPublished)
+	req.Header.Set("X-DailyScoop-Timestamp", timestamp)
+	req.Header.Set("X-DailyScoop-Signature", "sha256="+signWebhook(webhookConfig.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// signWebhook returns the hex HMAC-SHA256 of "timestamp.body". Signing the
+// timestamp too lets receivers reject replayed requests.
+func signWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
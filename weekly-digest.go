@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWeeklyDigestSize = 5
+	digestBodyPreviewChars  = 500 // Runes; a week's worth of full bodies makes the ranking prompt needlessly long
+)
+
+// startOfAppWeek returns midnight on the Monday of t's week in the application timezone
+func startOfAppWeek(t time.Time) time.Time {
+	day := startOfAppDay(t)
+	daysSinceMonday := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -daysSinceMonday)
+}
+
+// RunWeeklyDigest ranks the published articles of the last full week, Monday
+// to Sunday, with Gemini, saves the top WEEKLY_DIGEST_SIZE of them as that
+// week's digest issue with an intro, and emails it to subscribers. Like the
+// daily newsletter, it doesn't select again if the week's issue already
+// exists, but still emails it if it wasn't sent.
+func RunWeeklyDigest(ctx context.Context) error {
+	size, err := getEnvInt("WEEKLY_DIGEST_SIZE", defaultWeeklyDigestSize)
+	if err != nil {
+		return err
+	}
+	if size < 1 {
+		return fmt.Errorf("WEEKLY_DIGEST_SIZE must be at least 1, got %d", size)
+	}
+
+	// A run early in the week would otherwise rank only a day or two of stories
+	weekEnd := startOfAppWeek(appNow())
+	weekStart := weekEnd.AddDate(0, 0, -7)
+
+	exists, err := dbClient.HasWeeklyDigestSince(weekStart)
+	if err != nil {
+		return err
+	}
+	if exists {
+		slog.Info("Weekly digest already saved, skipping selection", "week", weekStart.Format("2006-01-02"))
+		return emailWeeklyDigest(ctx, weekStart)
+	}
+
+	since, err := dbClient.GetArticlesSince(weekStart, ArticleFilters{PublishedOnly: true})
+	if err != nil {
+		return fmt.Errorf("error loading last week's articles: %v", err)
+	}
+	var articles []*NewsArticle
+	for _, article := range since {
+		if article.CreatedAt.Before(weekEnd) {
+			articles = append(articles, article)
+		}
+	}
+	if len(articles) == 0 {
+		slog.Info("No published articles last week, skipping weekly digest", "week", weekStart.Format("2006-01-02"))
+		return nil
+	}
+
+	selection, err := selectWeeklyDigestArticles(ctx, articles, size)
+	if err != nil {
+		return fmt.Errorf("error selecting weekly digest articles: %v", err)
+	}
+
+	if err := dbClient.SaveWeeklyDigest(weekStart, selection.ArticleIds, selection.TitleText, selection.PreviewText, selection.Intro); err != nil {
+		return err
+	}
+
+	slog.Info("Saved weekly digest", "week", weekStart.Format("2006-01-02"), "articles", len(selection.ArticleIds))
+	return emailWeeklyDigest(ctx, weekStart)
+}
+
+// emailWeeklyDigest sends the digest for the week starting at weekStart, if
+// it hasn't been sent
+func emailWeeklyDigest(ctx context.Context, weekStart time.Time) error {
+	if emailConfig.Provider == "" {
+		return nil
+	}
+	digest, err := dbClient.GetWeeklyDigestSince(weekStart)
+	if err != nil {
+		return err
+	}
+	if digest == nil {
+		return nil
+	}
+
+	var articles []NewsletterEmailArticle
+	for _, id := range digest.ArticleIds {
+		article, err := dbClient.GetArticleByID(id)
+		if err != nil {
+			// A digest article deleted since is left out
+			slog.Warn("Leaving article out of the weekly digest email", "article", id, "error", err)
+			continue
+		}
+		articles = append(articles, newsletterEmailArticle(emailConfig, article))
+	}
+	if len(articles) == 0 {
+		return fmt.Errorf("none of the weekly digest's %d articles could be loaded", len(digest.ArticleIds))
+	}
+
+	return sendNewsletter(ctx, digest.ID, NewsletterEmail{
+		Kind:     "weekly",
+		Issue:    digest.Issue,
+		Title:    digest.TitleText,
+		Preview:  digest.PreviewText,
+		Intro:    digest.Intro,
+		Articles: articles,
+	})
+}
+
+// weeklyDigestSelection is Gemini's pick of the week's top articles, with the
+// text of the email
+type weeklyDigestSelection struct {
+	ArticleIds  []string // Best first
+	TitleText   string
+	PreviewText string
+	Intro       string
+}
+
+// selectWeeklyDigestArticles asks Gemini to rank the articles and returns the
+// IDs of the top n, best first, along with the email title, preview text and intro
+func selectWeeklyDigestArticles(ctx context.Context, articles []*NewsArticle, n int) (*weeklyDigestSelection, error) {
+	if n > len(articles) {
+		n = len(articles)
+	}
+
+	var articleTexts []string
+	articleMapping := make(map[int]*NewsArticle) // 1-based, matching the numbers in the prompt
+
+	for i, article := range articles {
+		categoryId := otherCategoryId
+		if article.CategoryId != nil {
+			categoryId = *article.CategoryId
+		}
+		body := article.Body
+		if runes := []rune(body); len(runes) > digestBodyPreviewChars {
+			body = string(runes[:digestBodyPreviewChars]) + "..."
+		}
+		articleTexts = append(articleTexts, fmt.Sprintf("Article %d:\nTitle: %s\nBody: %s\nCategory: %d",
+			i+1, article.Title, body, categoryId))
+		articleMapping[i+1] = article
+	}
+
+	prompt := fmt.Sprintf(`Rank these news articles from the past week and select the %d most important ones for a weekly recap newsletter.
+Consider impact, uniqueness, and broad appeal. Prefer a mix of topics over several articles about the same story.
+AVOID sports articles (category 7) unless truly exceptional.
+
+Articles:
+%s
+
+Respond in this JSON format:
+{
+    "selectedArticleIndexes": [N, ...], // Exactly %d article numbers as shown (1-%d), most important first
+    "emailTitle": "Brief, attention-grabbing title for the week (max 60 chars)",
+    "previewText": "Compelling preview text summarizing the week (max 150 chars)",
+    "intro": "A short opening paragraph for the newsletter tying the selected stories together (2-3 sentences, max 400 chars, no markdown)"
+}`, n, strings.Join(articleTexts, "\n\n"), n, len(articles))
+
+	response, err := queryGeminiForArticle(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("error querying Gemini: %v", err)
+	}
+
+	var result struct {
+		SelectedArticleIndexes []int  `json:"selectedArticleIndexes"`
+		EmailTitle             string `json:"emailTitle"`
+		PreviewText            string `json:"previewText"`
+		Intro                  string `json:"intro"`
+	}
+
+	if err := json.Unmarshal([]byte(response), &result); err != nil {
+		reportLLMParseError("weekly_digest", response, err)
+		return nil, fmt.Errorf("error parsing Gemini response: %v", err)
+	}
+
+	// Keep the ranking order, ignoring repeats and indexes that don't exist
+	var articleIds []string
+	seen := make(map[int]bool)
+	for _, index := range result.SelectedArticleIndexes {
+		article, exists := articleMapping[index]
+		if !exists || seen[index] {
+			slog.Warn("Ignoring invalid or repeated article index from Gemini", "index", index)
+			continue
+		}
+		seen[index] = true
+		articleIds = append(articleIds, article.ID.String())
+		if len(articleIds) == n {
+			break
+		}
+	}
+	if len(articleIds) == 0 {
+		return nil, fmt.Errorf("Gemini returned no valid article indexes: %v", result.SelectedArticleIndexes)
+	}
+
+	return &weeklyDigestSelection{
+		ArticleIds:  articleIds,
+		TitleText:   result.EmailTitle,
+		PreviewText: result.PreviewText,
+		Intro:       strings.TrimSpace(stripMarkdownTags(result.Intro)),
+	}, nil
+}